@@ -0,0 +1,134 @@
+package well
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+)
+
+// ActivityIDGenerator generates activity IDs, a.k.a. request tracking
+// IDs, that are put in contexts by WithRequestID, sent to other
+// services by HTTPClient, and logged as request_id.
+//
+// ctx is the context of the new activity.  For HTTPServer, ctx has
+// TraceContext of the incoming request, if any.
+//
+// NewID is called concurrently from multiple goroutines.
+type ActivityIDGenerator interface {
+	NewID(ctx context.Context) string
+}
+
+type activityIDGeneratorHolder struct {
+	g ActivityIDGenerator
+}
+
+var activityIDGenerator atomic.Value
+
+// SetActivityIDGenerator replaces the generator of activity IDs for
+// Environment.GoWithID, Server, HTTPServer, and GenerateID.
+// nil restores the default generator, IDGenerator.
+//
+// This should be called before starting servers.
+func SetActivityIDGenerator(g ActivityIDGenerator) {
+	activityIDGenerator.Store(activityIDGeneratorHolder{g})
+}
+
+// newActivityID generates an ID by the generator set by
+// SetActivityIDGenerator, or by fallback if it is not set.
+func newActivityID(ctx context.Context, fallback *IDGenerator) string {
+	if h, ok := activityIDGenerator.Load().(activityIDGeneratorHolder); ok && h.g != nil {
+		return h.g.NewID(ctx)
+	}
+	return fallback.Generate()
+}
+
+// NewID implements ActivityIDGenerator.
+func (g *IDGenerator) NewID(ctx context.Context) string {
+	return g.Generate()
+}
+
+// UUIDv7Generator generates UUID version 7 defined in RFC 9562.
+// IDs are ordered by their generation time in milliseconds.
+//
+// The zero value is ready to use.
+type UUIDv7Generator struct{}
+
+// NewID implements ActivityIDGenerator.
+func (UUIDv7Generator) NewID(ctx context.Context) string {
+	var id [16]byte
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic(err)
+	}
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixMilli()))
+	copy(id[:6], ts[2:])
+	id[6] = 0x70 | (id[6] & 0x0f)
+	id[8] = 0x80 | (id[8] & 0x3f)
+
+	var strbuf [36]byte
+	j := 0
+	for i, b := range id {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			strbuf[j] = '-'
+			j++
+		}
+		strbuf[j] = hexData[int(b)*2]
+		strbuf[j+1] = hexData[int(b)*2+1]
+		j += 2
+	}
+	return string(strbuf[:])
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator generates ULID, Universally Unique Lexicographically
+// Sortable Identifier.  https://github.com/ulid/spec
+//
+// The zero value is ready to use.
+type ULIDGenerator struct{}
+
+// NewID implements ActivityIDGenerator.
+func (ULIDGenerator) NewID(ctx context.Context) string {
+	var id [16]byte
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic(err)
+	}
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixMilli()))
+	copy(id[:6], ts[2:])
+
+	// 128 bits are encoded into 26 characters of 5 bits from the
+	// most significant bits.  The first character has only 3 bits.
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	var strbuf [26]byte
+	for i := 25; i >= 0; i-- {
+		strbuf[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(strbuf[:])
+}
+
+// TraceIDGenerator uses the trace ID of TraceContext in the context
+// as the activity ID.  This makes the request ID of logs the same as
+// the trace ID of the upstream tracing system.
+//
+// If the context has no TraceContext, Fallback is used.
+// If Fallback is nil, IDs are generated by the default IDGenerator.
+type TraceIDGenerator struct {
+	Fallback ActivityIDGenerator
+}
+
+// NewID implements ActivityIDGenerator.
+func (g TraceIDGenerator) NewID(ctx context.Context) string {
+	if tc, ok := TraceContextFromContext(ctx); ok {
+		return tc.TraceID
+	}
+	if g.Fallback != nil {
+		return g.Fallback.NewID(ctx)
+	}
+	return defaultGenerator.Generate()
+}
@@ -0,0 +1,127 @@
+package well
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestUUIDv7Generator(t *testing.T) {
+	t.Parallel()
+
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	var g UUIDv7Generator
+	id1 := g.NewID(context.Background())
+	if !re.MatchString(id1) {
+		t.Error(`invalid UUIDv7`, id1)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	id2 := g.NewID(context.Background())
+	if id2 <= id1 {
+		t.Error(`id2 <= id1`, id1, id2)
+	}
+}
+
+func TestULIDGenerator(t *testing.T) {
+	t.Parallel()
+
+	re := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	var g ULIDGenerator
+	id1 := g.NewID(context.Background())
+	if !re.MatchString(id1) {
+		t.Error(`invalid ULID`, id1)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	id2 := g.NewID(context.Background())
+	if id2 <= id1 {
+		t.Error(`id2 <= id1`, id1, id2)
+	}
+}
+
+func TestTraceIDGenerator(t *testing.T) {
+	t.Parallel()
+
+	tc := TraceContext{
+		TraceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+		ParentID: "00f067aa0ba902b7",
+	}
+	g := TraceIDGenerator{Fallback: ULIDGenerator{}}
+	id := g.NewID(WithTraceContext(context.Background(), tc))
+	if id != tc.TraceID {
+		t.Error(`id != tc.TraceID`, id)
+	}
+
+	id = g.NewID(context.Background())
+	if len(id) != 26 {
+		t.Error(`len(id) != 26`, id)
+	}
+
+	id = TraceIDGenerator{}.NewID(context.Background())
+	if len(id) != 36 {
+		t.Error(`len(id) != 36`, id)
+	}
+}
+
+func TestSetActivityIDGenerator(t *testing.T) {
+	SetActivityIDGenerator(TraceIDGenerator{Fallback: ULIDGenerator{}})
+	defer SetActivityIDGenerator(nil)
+
+	if id := GenerateID(); len(id) != 26 {
+		t.Error(`len(GenerateID()) != 26`, id)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	logger.SetOutput(io.Discard)
+	ch := make(chan string, 1)
+	s := &HTTPServer{
+		Server: &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ch <- r.Context().Value(RequestIDContextKey).(string)
+			}),
+		},
+		AccessLog: logger,
+		Env:       env,
+	}
+	if err := s.Serve(l); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "http://"+l.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if id := <-ch; id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Error(`id != "4bf92f3577b34da6a3ce929d0e0e4736"`, id)
+	}
+
+	env.GoWithID(func(ctx context.Context) error {
+		ch <- ctx.Value(RequestIDContextKey).(string)
+		return nil
+	})
+	if id := <-ch; len(id) != 26 {
+		t.Error(`len(id) != 26`, id)
+	}
+
+	env.Cancel(nil)
+	env.Wait()
+}
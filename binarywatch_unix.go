@@ -0,0 +1,148 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultBinaryWatchInterval = 5 * time.Second
+)
+
+// binaryPath returns the path of the file to be watched for WatchBinary.
+func (g *Graceful) binaryPath() (string, error) {
+	if len(g.BinaryPath) > 0 {
+		return filepath.Abs(g.BinaryPath)
+	}
+	p, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(p)
+}
+
+func hashFile(p string) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func sameFileInfo(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// watchBinary polls p every interval and calls f when the file is
+// replaced with a different content.  To avoid restarting with a file
+// being copied, f is called only after the file stays unchanged for
+// one interval.
+func watchBinary(ctx context.Context, p string, interval time.Duration, f func()) {
+	last, err := os.Stat(p)
+	if err != nil {
+		log.Error("well: failed to watch binary", map[string]interface{}{
+			"path":      p,
+			log.FnError: err,
+		})
+		return
+	}
+	lastHash, err := hashFile(p)
+	if err != nil {
+		log.Error("well: failed to watch binary", map[string]interface{}{
+			"path":      p,
+			log.FnError: err,
+		})
+		return
+	}
+
+	var pending os.FileInfo
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fi, err := os.Stat(p)
+		if err != nil {
+			// the file may be being replaced.
+			pending = nil
+			continue
+		}
+		if sameFileInfo(fi, last) {
+			pending = nil
+			continue
+		}
+		if pending == nil || !sameFileInfo(fi, pending) {
+			pending = fi
+			continue
+		}
+
+		pending = nil
+		last = fi
+		h, err := hashFile(p)
+		if err != nil {
+			log.Warn("well: failed to read binary", map[string]interface{}{
+				"path":      p,
+				log.FnError: err,
+			})
+			continue
+		}
+		if bytes.Equal(h, lastHash) {
+			continue
+		}
+		lastHash = h
+
+		log.Warn("well: binary changed", map[string]interface{}{
+			"path": p,
+		})
+		f()
+	}
+}
+
+// startBinaryWatch starts watching the binary if WatchBinary is true.
+// It sends SIGHUP to ch when the binary changes.
+func (g *Graceful) startBinaryWatch(ctx context.Context, ch chan<- os.Signal) {
+	if !g.WatchBinary {
+		return
+	}
+
+	p, err := g.binaryPath()
+	if err != nil {
+		log.Error("well: failed to watch binary", map[string]interface{}{
+			log.FnError: err,
+		})
+		return
+	}
+	interval := g.BinaryWatchInterval
+	if interval == 0 {
+		interval = defaultBinaryWatchInterval
+	}
+
+	go watchBinary(ctx, p, interval, func() {
+		select {
+		case ch <- syscall.SIGHUP:
+		default:
+		}
+	})
+}
@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchBinary(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "prog")
+	if err := os.WriteFile(p, []byte("v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 10)
+	go watchBinary(ctx, p, 10*time.Millisecond, func() {
+		changed <- struct{}{}
+	})
+	time.Sleep(30 * time.Millisecond)
+
+	replace := func(data string) {
+		tmp := filepath.Join(dir, "prog.tmp")
+		if err := os.WriteFile(tmp, []byte(data), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the same content does not trigger restarts.
+	replace("v1")
+	select {
+	case <-changed:
+		t.Error(`restarted with the same content`)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	replace("v2")
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`change was not detected`)
+	}
+
+	select {
+	case <-changed:
+		t.Error(`restarted twice`)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
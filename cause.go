@@ -0,0 +1,53 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+// IsCanceled returns true if err returned by Wait indicates that the
+// program was stopped intentionally, i.e. err is nil, the program has
+// received a stop signal, or err is context.Canceled.  Otherwise, err
+// is a failure of a goroutine started by Go or given to Cancel.
+func IsCanceled(err error) bool {
+	return err == nil || IsSignaled(err) || errors.Is(err, context.Canceled)
+}
+
+// CauseOf returns the root cause of err by unwrapping it as far as
+// possible.  If err does not wrap another error, err is returned.
+func CauseOf(err error) error {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			return err
+		}
+		err = next
+	}
+}
+
+// ExitCode returns the exit status for err returned by Wait.
+//
+// It returns 0 if IsCanceled(err) is true.  If err is or wraps
+// *exec.ExitError of a command that exited with a positive status,
+// that status is returned.  Otherwise, it returns 1.
+//
+// A main function can be written as:
+//
+//	err := well.Wait()
+//	if !well.IsCanceled(err) {
+//		log.Error(err.Error(), nil)
+//	}
+//	well.FlushLogs()
+//	os.Exit(well.ExitCode(err))
+func ExitCode(err error) int {
+	if IsCanceled(err) {
+		return 0
+	}
+
+	var ee *exec.ExitError
+	if errors.As(err, &ee) && ee.ExitCode() > 0 {
+		return ee.ExitCode()
+	}
+	return 1
+}
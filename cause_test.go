@@ -0,0 +1,66 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestIsCanceled(t *testing.T) {
+	t.Parallel()
+
+	if !IsCanceled(nil) {
+		t.Error(`!IsCanceled(nil)`)
+	}
+	if !IsCanceled(signalError{sig: syscall.SIGTERM}) {
+		t.Error(`!IsCanceled(signalError{})`)
+	}
+	if !IsCanceled(fmt.Errorf("wrapped: %w", context.Canceled)) {
+		t.Error(`!IsCanceled(context.Canceled)`)
+	}
+	if IsCanceled(errors.New("failed")) {
+		t.Error(`IsCanceled(errors.New("failed"))`)
+	}
+}
+
+func TestCauseOf(t *testing.T) {
+	t.Parallel()
+
+	root := errors.New("root")
+	err := fmt.Errorf("a: %w", fmt.Errorf("b: %w", root))
+	if CauseOf(err) != root {
+		t.Error(`CauseOf(err) != root`, CauseOf(err))
+	}
+	if CauseOf(root) != root {
+		t.Error(`CauseOf(root) != root`)
+	}
+	if CauseOf(nil) != nil {
+		t.Error(`CauseOf(nil) != nil`)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	if ExitCode(nil) != 0 {
+		t.Error(`ExitCode(nil) != 0`)
+	}
+	if ExitCode(signalError{sig: syscall.SIGINT}) != 0 {
+		t.Error(`ExitCode(signalError{}) != 0`)
+	}
+	if ExitCode(errors.New("failed")) != 1 {
+		t.Error(`ExitCode(errors.New("failed")) != 1`)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	if code := ExitCode(fmt.Errorf("command failed: %w", err)); code != 3 {
+		t.Error(`code != 3`, code)
+	}
+}
@@ -0,0 +1,229 @@
+package well
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultCertWatchInterval = 5 * time.Second
+)
+
+// CertStore is a set of TLS certificates selected by the server name
+// indication (SNI) of clients.
+//
+// Certificates are loaded from pairs of "NAME.crt" and "NAME.key"
+// files in Dir.  A certificate is used for the DNS names in its
+// subject alternative names, or its common name if it has none.
+// Wildcard names like "*.example.com" match one label.  If no
+// certificate matches, or the client does not send SNI, the
+// certificate whose NAME comes first in lexical order is used.
+//
+// Load must be called once before use.  After that, certificates are
+// reloaded when the program receives SIGHUP (see OnReload) or when
+// files in Dir change.  New certificates replace the current ones
+// only if all of them are loaded successfully.
+//
+// To serve TLS, wrap listeners by NewListener and pass them to
+// Server.Serve or HTTPServer.Serve, or set GetCertificate to
+// tls.Config.GetCertificate.
+//
+// A CertStore must not be copied after first use.
+type CertStore struct {
+	// Dir is the directory of certificate and key files.
+	Dir string
+
+	// WatchInterval is the interval to check changes of the files.
+	// Zero is treated as 5 seconds.  Negative disables the check.
+	WatchInterval time.Duration
+
+	certs atomic.Pointer[certSet]
+
+	mu   sync.Mutex
+	hash [sha256.Size]byte
+}
+
+type certSet struct {
+	exact    map[string]*tls.Certificate
+	wildcard map[string]*tls.Certificate
+	fallback *tls.Certificate
+	names    []string
+}
+
+// Load loads certificates for the first time and starts watching Dir.
+func (s *CertStore) Load() error {
+	certs, hash, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.hash = hash
+	s.mu.Unlock()
+	s.certs.Store(certs)
+
+	OnReload(func(ctx context.Context) error {
+		return s.Reload()
+	})
+	if s.WatchInterval >= 0 {
+		go s.watch(defaultEnv.ctx.Done())
+	}
+	return nil
+}
+
+// Reload reloads certificates.  If the files are not changed, Reload
+// does nothing.
+func (s *CertStore) Reload() error {
+	certs, hash, err := s.load()
+	if err != nil {
+		log.Error("well: failed to reload certificates", map[string]interface{}{
+			"dir":       s.Dir,
+			log.FnError: err,
+		})
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hash == s.hash {
+		return nil
+	}
+	s.hash = hash
+	s.certs.Store(certs)
+	log.Info("well: certificates reloaded", map[string]interface{}{
+		"dir":   s.Dir,
+		"names": certs.names,
+	})
+	return nil
+}
+
+// GetCertificate returns a certificate for hello.
+// This can be used as tls.Config.GetCertificate.
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := s.certs.Load()
+	if certs == nil {
+		return nil, errors.New("no certificate is loaded")
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if len(name) > 0 {
+		if cert, ok := certs.exact[name]; ok {
+			return cert, nil
+		}
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			if cert, ok := certs.wildcard[name[i+1:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+	return certs.fallback, nil
+}
+
+// TLSConfig returns a new tls.Config that uses s for certificates.
+// HTTP/2 is enabled as HTTPServer.ListenAndServeTLS does.
+func (s *CertStore) TLSConfig() *tls.Config {
+	return &tls.Config{
+		NextProtos:         []string{"h2", "http/1.1"},
+		GetCertificate:     s.GetCertificate,
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+}
+
+// NewListener returns a TLS listener wrapping l that uses s for
+// certificates.
+func (s *CertStore) NewListener(l net.Listener) net.Listener {
+	return tls.NewListener(l, s.TLSConfig())
+}
+
+func (s *CertStore) load() (*certSet, [sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	crts, err := filepath.Glob(filepath.Join(s.Dir, "*.crt"))
+	if err != nil {
+		return nil, hash, err
+	}
+	if len(crts) == 0 {
+		return nil, hash, errors.New("no certificate in " + s.Dir)
+	}
+	sort.Strings(crts)
+
+	certs := &certSet{
+		exact:    make(map[string]*tls.Certificate),
+		wildcard: make(map[string]*tls.Certificate),
+	}
+	h := sha256.New()
+	for _, crt := range crts {
+		key := strings.TrimSuffix(crt, ".crt") + ".key"
+		crtPEM, err := os.ReadFile(crt)
+		if err != nil {
+			return nil, hash, err
+		}
+		keyPEM, err := os.ReadFile(key)
+		if err != nil {
+			return nil, hash, err
+		}
+		h.Write([]byte(crt))
+		h.Write(crtPEM)
+		h.Write(keyPEM)
+
+		cert, err := tls.X509KeyPair(crtPEM, keyPEM)
+		if err != nil {
+			return nil, hash, errors.New(crt + ": " + err.Error())
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, hash, errors.New(crt + ": " + err.Error())
+		}
+		cert.Leaf = leaf
+
+		names := leaf.DNSNames
+		if len(names) == 0 && len(leaf.Subject.CommonName) > 0 {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if strings.HasPrefix(name, "*.") {
+				certs.wildcard[name[2:]] = &cert
+			} else {
+				certs.exact[name] = &cert
+			}
+			certs.names = append(certs.names, name)
+		}
+		if certs.fallback == nil {
+			certs.fallback = &cert
+		}
+	}
+	copy(hash[:], h.Sum(nil))
+	return certs, hash, nil
+}
+
+func (s *CertStore) watch(done <-chan struct{}) {
+	interval := s.WatchInterval
+	if interval == 0 {
+		interval = defaultCertWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		// Reload does nothing if the files are not changed.
+		s.Reload()
+	}
+}
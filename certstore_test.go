@@ -0,0 +1,152 @@
+package well
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCert(t *testing.T, dir, name string, dnsNames ...string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), crt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertStore(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeTestCert(t, dir, "a", "a.example.com")
+	writeTestCert(t, dir, "b", "*.b.example.com", "b.example.com")
+
+	s := &CertStore{Dir: dir, WatchInterval: -1}
+	if _, err := s.GetCertificate(&tls.ClientHelloInfo{}); err == nil {
+		t.Error(`GetCertificate should fail before Load`)
+	}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"a.example.com":     "a",
+		"A.EXAMPLE.COM.":    "a",
+		"b.example.com":     "b",
+		"x.b.example.com":   "b",
+		"x.y.b.example.com": "a",
+		"unknown.com":       "a",
+		"":                  "a",
+	}
+	for name, expected := range cases {
+		cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.Leaf.Subject.CommonName != expected {
+			t.Error(name, cert.Leaf.Subject.CommonName, expected)
+		}
+	}
+
+	// replace certificates
+	writeTestCert(t, dir, "a", "c.example.com")
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: "c.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.Subject.CommonName != "a" {
+		t.Error(`cert.Leaf.Subject.CommonName != "a"`, cert.Leaf.Subject.CommonName)
+	}
+
+	// broken files keep the current certificates
+	if err := os.WriteFile(filepath.Join(dir, "a.key"), []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err == nil {
+		t.Error(`Reload should fail`)
+	}
+	cert2, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: "c.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert2 != cert {
+		t.Error(`certificates should be kept`)
+	}
+}
+
+func TestCertStoreListener(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeTestCert(t, dir, "server", "localhost")
+	s := &CertStore{Dir: dir, WatchInterval: -1}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tl := s.NewListener(l)
+	defer tl.Close()
+
+	go func() {
+		conn, err := tl.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{
+		ServerName:         "localhost",
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 || certs[0].DNSNames[0] != "localhost" {
+		t.Error(`unexpected peer certificate`, certs)
+	}
+}
@@ -0,0 +1,288 @@
+package well
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultCircuitFailureThreshold = 0.5
+	defaultCircuitMinRequests      = 20
+	defaultCircuitWindow           = 10 * time.Second
+	defaultCircuitOpenTimeout      = 10 * time.Second
+	defaultCircuitHalfOpenRequests = 1
+)
+
+// ErrCircuitOpen is returned by HTTPClient.Do when the circuit breaker
+// for the host is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+// Circuit breaker states.
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker is a per-host circuit breaker for HTTPClient.
+//
+// Each host starts in closed state and requests are sent as usual.
+// If the rate of failed requests in Window reaches FailureThreshold
+// after at least MinRequests requests, the circuit for the host opens
+// and requests fail immediately with ErrCircuitOpen.  After
+// OpenTimeout, the circuit becomes half-open and HalfOpenRequests
+// trial requests are sent.  If all of them succeed, the circuit
+// closes; otherwise it opens again.
+//
+// Stats returns metrics of each host, which can be published by
+// expvar.Func for example.
+//
+// A CircuitBreaker must not be copied after first use.
+type CircuitBreaker struct {
+	// FailureThreshold is the failure rate to open the circuit.
+	// Zero is treated as 0.5.
+	FailureThreshold float64
+
+	// MinRequests is the minimum number of requests in Window
+	// to open the circuit.  Zero is treated as 20.
+	MinRequests int
+
+	// Window is the period to count requests and failures.
+	// Zero is treated as 10 seconds.
+	Window time.Duration
+
+	// OpenTimeout is the period the circuit is kept open.
+	// Zero is treated as 10 seconds.
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of trial requests in half-open
+	// state.  Zero is treated as 1.
+	HalfOpenRequests int
+
+	// IsFailure decides if the result of a request is a failure.
+	// If nil, errors and responses with status 5xx are failures.
+	IsFailure func(resp *http.Response, err error) bool
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+// CircuitStats is the metrics of a circuit.
+type CircuitStats struct {
+	State    string `json:"state"`
+	Requests int64  `json:"requests"`
+	Failures int64  `json:"failures"`
+	Rejected int64  `json:"rejected"`
+	Opened   int64  `json:"opened"`
+}
+
+type circuit struct {
+	state       CircuitState
+	generation  uint64
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trials      int
+	successes   int
+
+	stats CircuitStats
+}
+
+func (cb *CircuitBreaker) failureThreshold() float64 {
+	if cb.FailureThreshold <= 0 {
+		return defaultCircuitFailureThreshold
+	}
+	return cb.FailureThreshold
+}
+
+func (cb *CircuitBreaker) minRequests() int {
+	if cb.MinRequests <= 0 {
+		return defaultCircuitMinRequests
+	}
+	return cb.MinRequests
+}
+
+func (cb *CircuitBreaker) window() time.Duration {
+	if cb.Window <= 0 {
+		return defaultCircuitWindow
+	}
+	return cb.Window
+}
+
+func (cb *CircuitBreaker) openTimeout() time.Duration {
+	if cb.OpenTimeout <= 0 {
+		return defaultCircuitOpenTimeout
+	}
+	return cb.OpenTimeout
+}
+
+func (cb *CircuitBreaker) halfOpenRequests() int {
+	if cb.HalfOpenRequests <= 0 {
+		return defaultCircuitHalfOpenRequests
+	}
+	return cb.HalfOpenRequests
+}
+
+func (cb *CircuitBreaker) isFailure(resp *http.Response, err error) bool {
+	if cb.IsFailure != nil {
+		return cb.IsFailure(resp, err)
+	}
+	return err != nil || resp.StatusCode >= 500
+}
+
+// State returns the current state of the circuit for host.
+func (cb *CircuitBreaker) State(host string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.hosts[host]
+	if !ok {
+		return CircuitClosed
+	}
+	return c.state
+}
+
+// Stats returns metrics of circuits keyed by host names.
+func (cb *CircuitBreaker) Stats() map[string]CircuitStats {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	stats := make(map[string]CircuitStats, len(cb.hosts))
+	for host, c := range cb.hosts {
+		s := c.stats
+		s.State = c.state.String()
+		stats[host] = s
+	}
+	return stats
+}
+
+// allow returns the generation of the circuit for host if a request
+// is allowed.
+func (cb *CircuitBreaker) allow(host string) (uint64, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.hosts == nil {
+		cb.hosts = make(map[string]*circuit)
+	}
+	c, ok := cb.hosts[host]
+	if !ok {
+		c = &circuit{windowStart: time.Now()}
+		cb.hosts[host] = c
+	}
+
+	now := time.Now()
+	switch c.state {
+	case CircuitOpen:
+		if now.Sub(c.openedAt) < cb.openTimeout() {
+			c.stats.Rejected++
+			return 0, false
+		}
+		cb.setState(host, c, CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if c.trials >= cb.halfOpenRequests() {
+			c.stats.Rejected++
+			return 0, false
+		}
+		c.trials++
+	default:
+		if now.Sub(c.windowStart) >= cb.window() {
+			c.windowStart = now
+			c.requests = 0
+			c.failures = 0
+		}
+	}
+	c.stats.Requests++
+	return c.generation, true
+}
+
+// record records the result of a request allowed by allow.
+func (cb *CircuitBreaker) record(host string, generation uint64, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.hosts[host]
+	if failed {
+		c.stats.Failures++
+	}
+	if c.generation != generation {
+		// the request was sent in the previous state.
+		return
+	}
+
+	switch c.state {
+	case CircuitHalfOpen:
+		if failed {
+			cb.setState(host, c, CircuitOpen)
+			return
+		}
+		c.successes++
+		if c.successes >= cb.halfOpenRequests() {
+			cb.setState(host, c, CircuitClosed)
+		}
+	case CircuitClosed:
+		c.requests++
+		if failed {
+			c.failures++
+		}
+		if c.requests >= cb.minRequests() &&
+			float64(c.failures) >= cb.failureThreshold()*float64(c.requests) {
+			cb.setState(host, c, CircuitOpen)
+		}
+	}
+}
+
+// release cancels a request allowed by allow without recording.
+func (cb *CircuitBreaker) release(host string, generation uint64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.hosts[host]
+	if c.generation == generation && c.state == CircuitHalfOpen {
+		c.trials--
+	}
+}
+
+func (cb *CircuitBreaker) setState(host string, c *circuit, state CircuitState) {
+	log.Warn("well: circuit breaker state changed", map[string]interface{}{
+		"host": host,
+		"from": c.state.String(),
+		"to":   state.String(),
+	})
+
+	c.state = state
+	c.generation++
+	c.trials = 0
+	c.successes = 0
+	switch state {
+	case CircuitOpen:
+		c.openedAt = time.Now()
+		c.stats.Opened++
+	case CircuitClosed:
+		c.windowStart = time.Now()
+		c.requests = 0
+		c.failures = 0
+	}
+}
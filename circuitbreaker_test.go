@@ -0,0 +1,78 @@
+package well
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	var failing int32 = 1
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+
+	cb := &CircuitBreaker{
+		MinRequests: 4,
+		OpenTimeout: 100 * time.Millisecond,
+	}
+	cl := &HTTPClient{
+		Client:         &http.Client{},
+		CircuitBreaker: cb,
+	}
+	do := func() error {
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		resp, err := cl.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := do(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	host := s.Listener.Addr().String()
+	if cb.State(host) != CircuitOpen {
+		t.Fatal(`cb.State(host) != CircuitOpen`, cb.State(host))
+	}
+	if err := do(); err != ErrCircuitOpen {
+		t.Error(`err != ErrCircuitOpen`, err)
+	}
+
+	// a failed trial opens the circuit again.
+	time.Sleep(150 * time.Millisecond)
+	if err := do(); err != nil {
+		t.Fatal(err)
+	}
+	if cb.State(host) != CircuitOpen {
+		t.Error(`cb.State(host) != CircuitOpen`, cb.State(host))
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(150 * time.Millisecond)
+	if err := do(); err != nil {
+		t.Fatal(err)
+	}
+	if cb.State(host) != CircuitClosed {
+		t.Error(`cb.State(host) != CircuitClosed`, cb.State(host))
+	}
+
+	stats := cb.Stats()[host]
+	if stats.State != "closed" {
+		t.Error(`stats.State != "closed"`, stats.State)
+	}
+	if stats.Requests != 6 || stats.Failures != 5 || stats.Rejected != 1 || stats.Opened != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
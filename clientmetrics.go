@@ -0,0 +1,231 @@
+package well
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ClientMetrics collects per-host metrics of HTTPClient.
+//
+// ClientMetrics implements expvar.Var, so it can be published as:
+//
+//	m := &well.ClientMetrics{}
+//	expvar.Publish("http_client", m)
+//	client := &well.HTTPClient{Client: &http.Client{}, Metrics: m}
+//
+// A ClientMetrics must not be copied after first use.
+type ClientMetrics struct {
+	mu    sync.Mutex
+	hosts map[string]*hostMetrics
+}
+
+// HostMetrics is a snapshot of metrics of a host.
+//
+// InFlight is the number of requests waiting for responses.
+// ReuseRatio is the ratio of requests sent over reused connections.
+// DNSSeconds, ConnectSeconds, and TLSSeconds are average latencies of
+// new connections.
+//
+// DNS, Connect, TLS, TTFB, and Total are histograms of latencies in
+// seconds.  TTFB is the time to the first response byte, and Total is
+// the time until the response body is closed.
+type HostMetrics struct {
+	InFlight       int64   `json:"in_flight"`
+	Requests       int64   `json:"requests"`
+	Errors         int64   `json:"errors"`
+	NewConns       int64   `json:"new_conns"`
+	ReusedConns    int64   `json:"reused_conns"`
+	ReuseRatio     float64 `json:"reuse_ratio"`
+	DNSSeconds     float64 `json:"dns_seconds"`
+	ConnectSeconds float64 `json:"connect_seconds"`
+	TLSSeconds     float64 `json:"tls_seconds"`
+
+	DNS     HistogramSnapshot `json:"dns"`
+	Connect HistogramSnapshot `json:"connect"`
+	TLS     HistogramSnapshot `json:"tls"`
+	TTFB    HistogramSnapshot `json:"ttfb"`
+	Total   HistogramSnapshot `json:"total"`
+}
+
+type hostMetrics struct {
+	HostMetrics
+
+	dns     *histogram
+	connect *histogram
+	tls     *histogram
+	ttfb    *histogram
+	total   *histogram
+}
+
+func newHostMetrics() *hostMetrics {
+	return &hostMetrics{
+		dns:     newHistogram(nil),
+		connect: newHistogram(nil),
+		tls:     newHistogram(nil),
+		ttfb:    newHistogram(nil),
+		total:   newHistogram(nil),
+	}
+}
+
+// Snapshot returns metrics keyed by host names.
+func (m *ClientMetrics) Snapshot() map[string]HostMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[string]HostMetrics, len(m.hosts))
+	for host, h := range m.hosts {
+		s := h.HostMetrics
+		if conns := s.NewConns + s.ReusedConns; conns > 0 {
+			s.ReuseRatio = float64(s.ReusedConns) / float64(conns)
+		}
+		s.DNS = h.dns.snapshot()
+		s.Connect = h.connect.snapshot()
+		s.TLS = h.tls.snapshot()
+		s.TTFB = h.ttfb.snapshot()
+		s.Total = h.total.snapshot()
+		s.DNSSeconds = s.DNS.Average()
+		s.ConnectSeconds = s.Connect.Average()
+		s.TLSSeconds = s.TLS.Average()
+		snapshot[host] = s
+	}
+	return snapshot
+}
+
+// String implements expvar.Var.
+func (m *ClientMetrics) String() string {
+	data, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+func (m *ClientMetrics) update(host string, f func(h *hostMetrics)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.hosts == nil {
+		m.hosts = make(map[string]*hostMetrics)
+	}
+	h, ok := m.hosts[host]
+	if !ok {
+		h = newHostMetrics()
+		m.hosts[host] = h
+	}
+	f(h)
+}
+
+// do sends req by send while collecting metrics.
+func (m *ClientMetrics) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	host := req.URL.Host
+
+	// hooks may be called concurrently, e.g. when dialing both
+	// IPv4 and IPv6 addresses.
+	var mu sync.Mutex
+	var dnsStart, tlsStart time.Time
+	connectStart := make(map[string]time.Time)
+	since := func(t *time.Time) (time.Duration, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if t.IsZero() {
+			return 0, false
+		}
+		return time.Since(*t), true
+	}
+	start := func(t *time.Time) {
+		mu.Lock()
+		*t = time.Now()
+		mu.Unlock()
+	}
+
+	st := time.Now()
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			d := time.Since(st)
+			m.update(host, func(h *hostMetrics) {
+				h.ttfb.observe(d.Seconds())
+			})
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			m.update(host, func(h *hostMetrics) {
+				if info.Reused {
+					h.ReusedConns++
+				} else {
+					h.NewConns++
+				}
+			})
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			start(&dnsStart)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			d, ok := since(&dnsStart)
+			if !ok || info.Err != nil {
+				return
+			}
+			m.update(host, func(h *hostMetrics) {
+				h.dns.observe(d.Seconds())
+			})
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connectStart[addr] = time.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			st, ok := connectStart[addr]
+			mu.Unlock()
+			if !ok || err != nil {
+				return
+			}
+			d := time.Since(st)
+			m.update(host, func(h *hostMetrics) {
+				h.connect.observe(d.Seconds())
+			})
+		},
+		TLSHandshakeStart: func() {
+			start(&tlsStart)
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			d, ok := since(&tlsStart)
+			if !ok || err != nil {
+				return
+			}
+			m.update(host, func(h *hostMetrics) {
+				h.tls.observe(d.Seconds())
+			})
+		},
+	}
+
+	m.update(host, func(h *hostMetrics) {
+		h.InFlight++
+		h.Requests++
+	})
+	resp, err := send(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	m.update(host, func(h *hostMetrics) {
+		h.InFlight--
+		if err != nil {
+			h.Errors++
+			h.total.observe(time.Since(st).Seconds())
+		}
+	})
+	if err != nil {
+		return resp, err
+	}
+
+	var once sync.Once
+	hookClose(resp, func() {
+		once.Do(func() {
+			d := time.Since(st)
+			m.update(host, func(h *hostMetrics) {
+				h.total.observe(d.Seconds())
+			})
+		})
+	})
+	return resp, nil
+}
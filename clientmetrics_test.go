@@ -0,0 +1,55 @@
+package well
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientMetrics(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	m := &ClientMetrics{}
+	cl := &HTTPClient{
+		Client:  &http.Client{Transport: TransportConfig{}.NewTransport()},
+		Metrics: m,
+	}
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		resp, err := cl.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	hm, ok := m.Snapshot()[s.Listener.Addr().String()]
+	if !ok {
+		t.Fatal(`no metrics for the host`)
+	}
+	if hm.Requests != 3 || hm.InFlight != 0 || hm.Errors != 0 {
+		t.Errorf("unexpected metrics: %+v", hm)
+	}
+	if hm.NewConns != 1 || hm.ReusedConns != 2 {
+		t.Errorf("connections should be reused: %+v", hm)
+	}
+	if hm.ConnectSeconds <= 0 {
+		t.Error(`hm.ConnectSeconds <= 0`, hm.ConnectSeconds)
+	}
+
+	if hm.TTFB.Count != 3 || hm.Total.Count != 3 || hm.Connect.Count != 1 {
+		t.Errorf("unexpected histograms: %+v", hm)
+	}
+	if n := len(hm.Total.Counts); n != len(DefaultHistogramBuckets) || hm.Total.Counts[n-1] != 3 {
+		t.Error(`all requests should be in the last bucket`, hm.Total.Counts)
+	}
+
+	var v map[string]HostMetrics
+	if err := json.Unmarshal([]byte(m.String()), &v); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,124 @@
+package well
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for timeouts and schedules.
+//
+// The clock is passed as a context value by WithClock.  Functions in
+// this package that wait for durations such as Graceful.ExitTimeout,
+// ShutdownTimeout of servers, Scheduler, Sleep, and Retry use the clock
+// in the context given to them or of their Environment.  By giving
+// a fake clock to NewEnvironment, tests can control these waits
+// without real sleeps.  See welltest.FakeClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a new Timer that sends the current time on its
+	// channel after at least duration d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the interface of timers created by Clock.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	C() <-chan time.Time
+
+	// Stop prevents the Timer from firing.  It returns false if the
+	// timer has already expired or been stopped.
+	Stop() bool
+}
+
+// RealClock is the Clock that uses the system time.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+const (
+	// ClockContextKey is a context key for Clock.
+	ClockContextKey contextKey = "clock"
+)
+
+// WithClock returns a new context with c as a value.
+func WithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, ClockContextKey, c)
+}
+
+// ClockFromContext returns Clock in ctx.
+// If ctx has no Clock, RealClock is returned.
+func ClockFromContext(ctx context.Context) Clock {
+	if c, ok := ctx.Value(ClockContextKey).(Clock); ok {
+		return c
+	}
+	return RealClock
+}
+
+// withClockTimeout is context.WithTimeout that measures d by the
+// clock in ctx.
+func withClockTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	clock := ClockFromContext(ctx)
+	if _, ok := clock.(realClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+
+	inner, cancel := context.WithCancel(ctx)
+	c := &clockTimeoutContext{
+		Context:  inner,
+		deadline: clock.Now().Add(d),
+	}
+	timer := clock.NewTimer(d)
+	go func() {
+		select {
+		case <-timer.C():
+			c.mu.Lock()
+			c.err = context.DeadlineExceeded
+			c.mu.Unlock()
+			cancel()
+		case <-inner.Done():
+			timer.Stop()
+		}
+	}()
+	return c, cancel
+}
+
+// clockTimeoutContext is a context canceled by a timer of Clock.
+type clockTimeoutContext struct {
+	context.Context
+	deadline time.Time
+
+	mu  sync.Mutex
+	err error
+}
+
+func (c *clockTimeoutContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *clockTimeoutContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.Context.Err()
+}
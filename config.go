@@ -0,0 +1,250 @@
+package well
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/cybozu-go/log"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultConfigWatchInterval = 5 * time.Second
+)
+
+// ConfigFile loads a configuration file into T and reloads it on
+// SIGHUP or when the file changes.
+//
+// The format is determined by the extension of Filename: ".toml",
+// ".yaml", ".yml", or ".json".  Fields of T should have tags for the
+// format, like LogConfig does.
+//
+// Load must be called once before Get.  After that, the file is
+// reloaded when the program receives SIGHUP (see OnReload) or when
+// the contents of the file change.  A new configuration replaces the
+// current one only if it is decoded and validated successfully, and
+// the names of changed keys are logged.  Values are not logged as
+// they may contain secrets.  Otherwise, the error is logged and the
+// current configuration is kept.  Watching reports the error of an
+// invalid file only once until the file changes again.
+//
+// Get returns the current configuration.  The returned value must
+// not be modified because it is shared by callers.
+//
+// A ConfigFile must not be copied after first use.
+type ConfigFile[T any] struct {
+	// Filename is the name of the configuration file.
+	Filename string
+
+	// Validate, if not nil, validates a loaded configuration.
+	Validate func(c *T) error
+
+	// OnChange, if not nil, is called after the configuration is
+	// replaced by reloading.
+	OnChange func(old, new *T)
+
+	// WatchInterval is the interval to check changes of the file.
+	// Zero is treated as 5 seconds.  Negative disables the check.
+	WatchInterval time.Duration
+
+	current   atomic.Pointer[T]
+	startOnce sync.Once
+
+	mu   sync.Mutex
+	hash [sha256.Size]byte
+
+	// failedHash is the hash of the file that failed to be reloaded
+	// last time, to report each bad revision only once.
+	failedHash [sha256.Size]byte
+}
+
+// Load loads the file for the first time and starts watching it.
+// Calling Load again loads the file again, but does not start
+// watching it twice.
+func (c *ConfigFile[T]) Load() error {
+	c.mu.Lock()
+	cfg, hash, err := c.load()
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.hash = hash
+	c.current.Store(cfg)
+	c.mu.Unlock()
+
+	c.startOnce.Do(func() {
+		OnReload(func(ctx context.Context) error {
+			return c.Reload()
+		})
+		if c.WatchInterval >= 0 {
+			go c.watch(defaultEnv.ctx.Done())
+		}
+	})
+	return nil
+}
+
+// Get returns the current configuration, or nil before Load.
+func (c *ConfigFile[T]) Get() *T {
+	return c.current.Load()
+}
+
+// Reload reloads the file.  If the file is not changed, Reload does
+// nothing.
+func (c *ConfigFile[T]) Reload() error {
+	// concurrent reloads are serialized so that an older file never
+	// replaces a newer one.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cfg, hash, err := c.load()
+	if err != nil {
+		c.failedHash = hash
+		log.Error("well: failed to reload config", map[string]interface{}{
+			"filename":  c.Filename,
+			log.FnError: err,
+		})
+		return err
+	}
+	c.failedHash = [sha256.Size]byte{}
+	if hash == c.hash {
+		return nil
+	}
+	c.hash = hash
+
+	old := c.current.Swap(cfg)
+	log.Info("well: config reloaded", map[string]interface{}{
+		"filename":     c.Filename,
+		"changed_keys": diffConfig(old, cfg),
+	})
+	if c.OnChange != nil {
+		c.OnChange(old, cfg)
+	}
+	return nil
+}
+
+func (c *ConfigFile[T]) load() (*T, [sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	data, err := os.ReadFile(c.Filename)
+	if err != nil {
+		return nil, hash, err
+	}
+	hash = sha256.Sum256(data)
+
+	cfg := new(T)
+	switch ext := strings.ToLower(filepath.Ext(c.Filename)); ext {
+	case ".toml":
+		_, err = toml.Decode(string(data), cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	default:
+		err = errors.New("unsupported config format: " + ext)
+	}
+	if err != nil {
+		return nil, hash, fmt.Errorf("%s: %w", c.Filename, err)
+	}
+
+	if c.Validate != nil {
+		if err := c.Validate(cfg); err != nil {
+			return nil, hash, fmt.Errorf("%s: %w", c.Filename, err)
+		}
+	}
+	return cfg, hash, nil
+}
+
+func (c *ConfigFile[T]) watch(done <-chan struct{}) {
+	interval := c.WatchInterval
+	if interval == 0 {
+		interval = defaultConfigWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(c.Filename)
+		if err != nil {
+			// the file may be being replaced.
+			continue
+		}
+		hash := sha256.Sum256(data)
+		c.mu.Lock()
+		changed := hash != c.hash && hash != c.failedHash
+		c.mu.Unlock()
+		if changed {
+			c.Reload()
+		}
+	}
+}
+
+// diffConfig returns the sorted list of keys whose values differ
+// between old and new.  Keys are the paths of JSON representations.
+func diffConfig(old, new interface{}) []string {
+	o := flattenConfig(old)
+	n := flattenConfig(new)
+
+	var keys []string
+	for k, v := range n {
+		if ov, ok := o[k]; !ok || ov != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range o {
+		if _, ok := n[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func flattenConfig(v interface{}) map[string]string {
+	m := make(map[string]string)
+	data, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return m
+	}
+
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				key := k
+				if len(prefix) > 0 {
+					key = prefix + "." + k
+				}
+				walk(key, child)
+			}
+		default:
+			data, _ := json.Marshal(v)
+			m[prefix] = string(data)
+		}
+	}
+	walk("", tree)
+	return m
+}
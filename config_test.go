@@ -0,0 +1,196 @@
+package well
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Name  string `toml:"name" json:"name" yaml:"name"`
+	Port  int    `toml:"port" json:"port" yaml:"port"`
+	Debug bool   `toml:"debug" json:"debug" yaml:"debug"`
+}
+
+func TestConfigFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.toml")
+	write := func(s string) {
+		if err := os.WriteFile(filename, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("name = \"foo\"\nport = 80\n")
+
+	changed := make(chan *testConfig, 1)
+	c := &ConfigFile[testConfig]{
+		Filename: filename,
+		Validate: func(c *testConfig) error {
+			if c.Port <= 0 {
+				return errors.New("invalid port")
+			}
+			return nil
+		},
+		OnChange: func(old, new *testConfig) {
+			changed <- new
+		},
+		WatchInterval: 10 * time.Millisecond,
+	}
+	if c.Get() != nil {
+		t.Error(`c.Get() != nil`)
+	}
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := c.Get(); cfg.Name != "foo" || cfg.Port != 80 {
+		t.Error(`unexpected config`, cfg)
+	}
+
+	write("name = \"foo\"\nport = -1\n")
+	if err := c.Reload(); err == nil {
+		t.Error(`invalid config should be rejected`)
+	}
+	if c.Get().Port != 80 {
+		t.Error(`c.Get().Port != 80`, c.Get().Port)
+	}
+
+	write("name = \"bar\"\nport = 8080\n")
+	select {
+	case cfg := <-changed:
+		if cfg.Name != "bar" || cfg.Port != 8080 {
+			t.Error(`unexpected config`, cfg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal(`change was not detected`)
+	}
+	if c.Get().Port != 8080 {
+		t.Error(`c.Get().Port != 8080`, c.Get().Port)
+	}
+}
+
+func TestConfigFileWatchInvalid(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.toml")
+	// replace the file atomically not to load partially written files.
+	write := func(s string) {
+		if err := os.WriteFile(filename+".tmp", []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filename+".tmp", filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("port = 80\n")
+
+	var invalid int32
+	c := &ConfigFile[testConfig]{
+		Filename: filename,
+		Validate: func(c *testConfig) error {
+			if c.Port <= 0 {
+				atomic.AddInt32(&invalid, 1)
+				return errors.New("invalid port")
+			}
+			return nil
+		},
+		WatchInterval: 10 * time.Millisecond,
+	}
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	write("port = -1\n")
+	time.Sleep(200 * time.Millisecond)
+	if n := atomic.LoadInt32(&invalid); n != 1 {
+		t.Error(`invalid file should be loaded only once`, n)
+	}
+
+	write("port = -2\n")
+	time.Sleep(200 * time.Millisecond)
+	if n := atomic.LoadInt32(&invalid); n != 2 {
+		t.Error(`new invalid file should be loaded once`, n)
+	}
+	if c.Get().Port != 80 {
+		t.Error(`c.Get().Port != 80`, c.Get().Port)
+	}
+}
+
+func TestConfigFileLoadTwice(t *testing.T) {
+	// this test counts global reload functions.
+
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(filename, []byte("port = 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloadMu.Lock()
+	n := len(reloadFuncs)
+	reloadMu.Unlock()
+
+	c := &ConfigFile[testConfig]{
+		Filename:      filename,
+		WatchInterval: -1,
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.Load(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reloadMu.Lock()
+	m := len(reloadFuncs)
+	reloadFuncs = reloadFuncs[:n]
+	reloadMu.Unlock()
+	if m != n+1 {
+		t.Error(`reload function should be registered once`, m-n)
+	}
+}
+
+func TestConfigFileFormats(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"c.yaml": "name: foo\nport: 80\n",
+		"c.yml":  "name: foo\nport: 80\n",
+		"c.json": `{"name": "foo", "port": 80}`,
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c := &ConfigFile[testConfig]{Filename: filename}
+		cfg, _, err := c.load()
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if cfg.Name != "foo" || cfg.Port != 80 {
+			t.Error(name, `unexpected config`, cfg)
+		}
+	}
+
+	c := &ConfigFile[testConfig]{Filename: filepath.Join(dir, "c.ini")}
+	if _, _, err := c.load(); err == nil {
+		t.Error(`unsupported format should be rejected`)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	t.Parallel()
+
+	old := &testConfig{Name: "foo", Port: 80}
+	new := &testConfig{Name: "foo", Port: 8080, Debug: true}
+	diffs := diffConfig(old, new)
+	expected := []string{"debug", "port"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Error(`unexpected diffs`, diffs)
+	}
+}
@@ -0,0 +1,232 @@
+package well
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultCrashLogLines = 100
+
+	// maxCrashStackSize limits the size of stacks of all goroutines.
+	maxCrashStackSize = 1 << 20
+)
+
+var (
+	crashMu     sync.Mutex
+	crashConfig *CrashReportConfig
+	crashLogs   *logRing
+)
+
+// CrashReportConfig configures crash reports.
+//
+// When applied, an unrecovered panic in a task started by Go and its
+// variants, or in a function that defers ReportPanic, writes a crash
+// report in JSON to a file named "crash-<time>-<pid>.json" in Dir
+// before the program exits.  The report contains:
+//
+//   - the panic value and the stack of the panicking goroutine,
+//   - stacks of all goroutines,
+//   - running tasks of the global environment,
+//   - the last LogLines logs of the default logger, and
+//   - build information of the program.
+//
+// Recent logs are captured by wrapping the formatter of the default
+// logger, so apply this after LogConfig.
+//
+// LogLines defaults to 100.
+type CrashReportConfig struct {
+	Dir      string `toml:"dir"       json:"dir"       yaml:"dir"`
+	LogLines int    `toml:"log_lines" json:"log_lines" yaml:"log_lines"`
+}
+
+// Apply enables crash reports.  Dir must not be empty.
+func (c CrashReportConfig) Apply() error {
+	if len(c.Dir) == 0 {
+		return fmt.Errorf("no directory for crash reports")
+	}
+	if c.LogLines <= 0 {
+		c.LogLines = defaultCrashLogLines
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+
+	ring := newLogRing(c.LogLines)
+	logger := log.DefaultLogger()
+	logger.SetFormatter(crashLogFormat{Formatter: logger.Formatter(), ring: ring})
+
+	crashMu.Lock()
+	crashConfig = &c
+	crashLogs = ring
+	crashMu.Unlock()
+	return nil
+}
+
+func getCrashConfig() (*CrashReportConfig, *logRing) {
+	crashMu.Lock()
+	defer crashMu.Unlock()
+	return crashConfig, crashLogs
+}
+
+// ReportPanic writes a crash report if the calling goroutine is
+// panicking and crash reports are enabled by CrashReportConfig.
+// The panic continues after the report is written.
+//
+// This must be called directly by a deferred function, e.g.:
+//
+//	func main() {
+//	    defer well.ReportPanic()
+//	    ...
+//	}
+//
+// Tasks started by Go and its variants do this automatically.
+func ReportPanic() {
+	c, ring := getCrashConfig()
+	if c == nil {
+		return
+	}
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	filename, err := c.write(r, debug.Stack(), ring)
+	if err != nil {
+		log.Error("well: failed to write crash report", map[string]interface{}{
+			log.FnError: err,
+		})
+	} else {
+		log.Critical("well: panic", map[string]interface{}{
+			"panic":    fmt.Sprint(r),
+			"filename": filename,
+		})
+	}
+	FlushLogs()
+	panic(r)
+}
+
+// crashReport is the content of crash reports.
+type crashReport struct {
+	Time       time.Time         `json:"time"`
+	PID        int               `json:"pid"`
+	Args       []string          `json:"args"`
+	Panic      string            `json:"panic"`
+	Stack      string            `json:"stack"`
+	Goroutines string            `json:"goroutines"`
+	Tasks      []string          `json:"tasks"`
+	Logs       []string          `json:"logs"`
+	Build      map[string]string `json:"build"`
+}
+
+func (c *CrashReportConfig) write(r interface{}, stack []byte, ring *logRing) (string, error) {
+	now := time.Now().UTC()
+	all := make([]byte, maxCrashStackSize)
+	all = all[:runtime.Stack(all, true)]
+
+	report := crashReport{
+		Time:       now,
+		PID:        os.Getpid(),
+		Args:       os.Args,
+		Panic:      fmt.Sprint(r),
+		Stack:      string(stack),
+		Goroutines: string(all),
+		Tasks:      defaultEnv.runningTasks(),
+		Logs:       ring.lines(),
+		Build:      buildInfo(),
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	name := "crash-" + now.Format("20060102T150405.000Z") + "-" + strconv.Itoa(report.PID) + ".json"
+	filename := filepath.Join(c.Dir, name)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+func buildInfo() map[string]string {
+	info := map[string]string{
+		"go_version": runtime.Version(),
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info["path"] = bi.Path
+	info["version"] = bi.Main.Version
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision", "vcs.time", "vcs.modified":
+			info[s.Key] = s.Value
+		}
+	}
+	return info
+}
+
+// logRing keeps the last formatted logs.
+type logRing struct {
+	mu   sync.Mutex
+	buf  []string
+	next int
+	full bool
+}
+
+func newLogRing(n int) *logRing {
+	return &logRing{buf: make([]string, n)}
+}
+
+func (r *logRing) add(line string) {
+	r.mu.Lock()
+	r.buf[r.next] = line
+	r.next++
+	if r.next == len(r.buf) {
+		r.next = 0
+		r.full = true
+	}
+	r.mu.Unlock()
+}
+
+func (r *logRing) lines() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]string(nil), r.buf[:r.next]...)
+	}
+	lines := make([]string, 0, len(r.buf))
+	lines = append(lines, r.buf[r.next:]...)
+	return append(lines, r.buf[:r.next]...)
+}
+
+// crashLogFormat implements log.Formatter to keep recent logs for
+// crash reports.
+type crashLogFormat struct {
+	log.Formatter
+	ring *logRing
+}
+
+func (f crashLogFormat) Format(buf []byte, l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) ([]byte, error) {
+	b, err := f.Formatter.Format(buf, l, t, severity, msg, fields)
+	if err == nil && len(b) > 0 {
+		f.ring.add(strings.TrimSuffix(string(b), "\n"))
+	}
+	return b, err
+}
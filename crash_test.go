@@ -0,0 +1,94 @@
+package well
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestReportPanic(t *testing.T) {
+	logger := log.DefaultLogger()
+	formatter := logger.Formatter()
+	logger.SetOutput(io.Discard)
+	defer func() {
+		logger.SetFormatter(formatter)
+		logger.SetOutput(os.Stderr)
+		crashMu.Lock()
+		crashConfig = nil
+		crashLogs = nil
+		crashMu.Unlock()
+	}()
+
+	dir := t.TempDir()
+	err := CrashReportConfig{Dir: dir, LogLines: 2}.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("log1", nil)
+	log.Info("log2", nil)
+	log.Info("log3", nil)
+
+	var recovered interface{}
+	func() {
+		defer func() {
+			recovered = recover()
+		}()
+		defer ReportPanic()
+		panic("boom")
+	}()
+	if recovered != "boom" {
+		t.Error(`panic should continue`, recovered)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatal(`len(files) != 1`, files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report crashReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Panic != "boom" {
+		t.Error(`report.Panic != "boom"`, report.Panic)
+	}
+	if report.PID != os.Getpid() {
+		t.Error(`report.PID != os.Getpid()`, report.PID)
+	}
+	if len(report.Stack) == 0 || len(report.Goroutines) == 0 {
+		t.Error(`no stacks`)
+	}
+	if len(report.Logs) != 2 {
+		t.Fatal(`len(report.Logs) != 2`, report.Logs)
+	}
+	if report.Build["go_version"] == "" {
+		t.Error(`no go_version`, report.Build)
+	}
+}
+
+func TestLogRing(t *testing.T) {
+	t.Parallel()
+
+	r := newLogRing(3)
+	if lines := r.lines(); len(lines) != 0 {
+		t.Error(`len(lines) != 0`, lines)
+	}
+	for _, l := range []string{"a", "b", "c", "d"} {
+		r.add(l)
+	}
+	lines := r.lines()
+	if len(lines) != 3 || lines[0] != "b" || lines[2] != "d" {
+		t.Error(`unexpected lines`, lines)
+	}
+}
@@ -0,0 +1,58 @@
+package well
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2024, 1, 31, 10, 30, 15, 0, time.Local)
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 31, 0, 0, time.Local)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 45, 0, 0, time.Local)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 31, 13, 0, 0, 0, time.Local)},
+		{"0 0 * * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.Local)},
+		{"30 5 29 feb *", time.Date(2024, 2, 29, 5, 30, 0, 0, time.Local)},
+		{"0 0 * * sun", time.Date(2024, 2, 4, 0, 0, 0, 0, time.Local)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.Local)},
+		{"0 0 15 * mon", time.Date(2024, 2, 5, 0, 0, 0, 0, time.Local)},
+		{"0,20 10 * * *", time.Date(2024, 2, 1, 10, 0, 0, 0, time.Local)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, c := range cases {
+		s, err := ParseCron(c.spec)
+		if err != nil {
+			t.Error(c.spec, err)
+			continue
+		}
+		next := s.Next(base)
+		if !next.Equal(c.next) {
+			t.Error(c.spec, next, c.next)
+		}
+	}
+
+	for _, spec := range []string{
+		"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "x * * * *",
+	} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Error(`ParseCron should fail:`, spec)
+		}
+	}
+}
+
+func TestEvery(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	if next := Every(time.Second).Next(now); !next.Equal(now.Add(time.Second)) {
+		t.Error(`next.Equal(now.Add(time.Second))`, next)
+	}
+}
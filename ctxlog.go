@@ -0,0 +1,75 @@
+package well
+
+import (
+	"context"
+
+	"github.com/cybozu-go/log"
+)
+
+// ContextLogger is a facade of log.Logger that automatically adds
+// fields from a context such as the request ID.
+//
+// Contexts given to HTTPServer handlers, Server handlers, and
+// functions started by GoWithID have request IDs.
+type ContextLogger struct {
+	ctx    context.Context
+	logger *log.Logger
+}
+
+// Log returns a ContextLogger for ctx using the default logger.
+//
+//	well.Log(ctx).Info("hello", map[string]interface{}{"foo": 1})
+func Log(ctx context.Context) *ContextLogger {
+	return LogWith(ctx, log.DefaultLogger())
+}
+
+// LogWith returns a ContextLogger for ctx using logger.
+func LogWith(ctx context.Context, logger *log.Logger) *ContextLogger {
+	return &ContextLogger{ctx: ctx, logger: logger}
+}
+
+// Enabled returns true if logs of level will be recorded.
+func (l *ContextLogger) Enabled(level int) bool {
+	return l.logger.Enabled(level)
+}
+
+// Log records a log with fields from the context.
+//
+// Fields given explicitly take precedence over the ones from the context.
+// fields is not modified.
+func (l *ContextLogger) Log(severity int, msg string, fields map[string]interface{}) error {
+	if !l.logger.Enabled(severity) {
+		return nil
+	}
+
+	f := FieldsFromContext(l.ctx)
+	for k, v := range fields {
+		f[k] = v
+	}
+	return l.logger.Log(severity, msg, f)
+}
+
+// Critical records a log of critical level.
+func (l *ContextLogger) Critical(msg string, fields map[string]interface{}) error {
+	return l.Log(log.LvCritical, msg, fields)
+}
+
+// Error records a log of error level.
+func (l *ContextLogger) Error(msg string, fields map[string]interface{}) error {
+	return l.Log(log.LvError, msg, fields)
+}
+
+// Warn records a log of warning level.
+func (l *ContextLogger) Warn(msg string, fields map[string]interface{}) error {
+	return l.Log(log.LvWarn, msg, fields)
+}
+
+// Info records a log of info level.
+func (l *ContextLogger) Info(msg string, fields map[string]interface{}) error {
+	return l.Log(log.LvInfo, msg, fields)
+}
+
+// Debug records a log of debug level.
+func (l *ContextLogger) Debug(msg string, fields map[string]interface{}) error {
+	return l.Log(log.LvDebug, msg, fields)
+}
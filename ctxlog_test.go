@@ -0,0 +1,47 @@
+package well
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestContextLogger(t *testing.T) {
+	t.Parallel()
+
+	logger := log.NewLogger()
+	logger.SetFormatter(log.JSONFormat{})
+	buf := new(bytes.Buffer)
+	logger.SetOutput(buf)
+
+	ctx := WithRequestID(context.Background(), testUUID)
+	fields := map[string]interface{}{"foo": "bar"}
+	err := LogWith(ctx, logger).Warn("hello", fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 1 {
+		t.Error(`fields should not be modified`)
+	}
+
+	var rec map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec[log.FnRequestID] != testUUID {
+		t.Error(`rec[log.FnRequestID] != testUUID`)
+	}
+	if rec["foo"] != "bar" {
+		t.Error(`rec["foo"] != "bar"`)
+	}
+
+	buf.Reset()
+	LogWith(context.Background(), logger).Debug("suppressed", nil)
+	if buf.Len() != 0 {
+		t.Error(`debug log should be suppressed`)
+	}
+}
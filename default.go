@@ -9,7 +9,23 @@ var (
 func init() {
 	defaultEnv = NewEnvironment(context.Background())
 	handleSignal(defaultEnv)
+	handleReadiness(defaultEnv)
+	handleEvents(defaultEnv)
 	handleSigPipe()
+	handleUserSignals()
+}
+
+// RunAsWindowsService makes the program respond to service control
+// requests of Windows.  Stop and Shutdown controls cancel the global
+// environment as SIGTERM does, and the service is reported as stopped
+// when Wait returns.
+//
+// This does nothing if the program is not running as a Windows
+// service, or on other operating systems.  Since the service control
+// dispatcher can run only once per process, do not call this if the
+// program calls svc.Run of golang.org/x/sys/windows/svc by itself.
+func RunAsWindowsService() error {
+	return handleServiceControl(defaultEnv)
 }
 
 // Stop just declares no further Go will be called.
@@ -33,6 +49,8 @@ func Stop() {
 //
 // This returns true if the caller is the first that calls Cancel.
 // For second and later calls, Cancel does nothing and returns false.
+//
+// When run as a systemd service, the first call sends STOPPING=1.
 func Cancel(err error) bool {
 	return defaultEnv.Cancel(err)
 }
@@ -43,8 +61,16 @@ func Cancel(err error) bool {
 // The returned err is the one passed to Cancel, or nil.
 // err can be tested by IsSignaled to determine whether the
 // program got SIGINT or SIGTERM.
+//
+// Logs buffered by the framework are flushed before Wait returns.
+// See FlushLogs.
 func Wait() error {
-	return defaultEnv.Wait()
+	err := defaultEnv.Wait()
+	markWaitDone()
+	recordWaitDuration(defaultEnv)
+	FlushLogs()
+	notifyServiceStopped()
+	return err
 }
 
 // Go starts a goroutine that executes f in the global environment.
@@ -68,3 +94,9 @@ func Go(f func(ctx context.Context) error) {
 func GoWithID(f func(ctx context.Context) error) {
 	defaultEnv.GoWithID(f)
 }
+
+// GoWithParent calls Go with a context having the values of parent.
+// See Environment.GoWithParent.
+func GoWithParent(parent context.Context, f func(ctx context.Context) error) {
+	defaultEnv.GoWithParent(parent, f)
+}
@@ -0,0 +1,56 @@
+package well
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"runtime"
+
+	"github.com/cybozu-go/log"
+)
+
+// DumpOnSignal installs a signal handler that logs stack traces of all
+// goroutines and the goroutines started by the global environment.
+// Unlike the default behavior of Go for SIGQUIT, the program continues
+// to run.  This helps to investigate deadlocks or stuck shutdowns.
+//
+// If no signal is given, SIGQUIT is used.  On Windows, signals must
+// be specified.
+func DumpOnSignal(sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = dumpSignals
+	}
+	for _, s := range sig {
+		HandleSignal(s, func(ctx context.Context) {
+			DumpGoroutines()
+		})
+	}
+}
+
+// DumpGoroutines logs stack traces of all goroutines and the function
+// names of goroutines started by the global environment.
+//
+// The stack trace of each goroutine is logged as a separate log
+// because the size of a log is limited.
+func DumpGoroutines() {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	stacks := bytes.Split(bytes.TrimSpace(buf), []byte("\n\n"))
+
+	log.Warn("well: goroutine dump", map[string]interface{}{
+		"goroutines": len(stacks),
+		"tasks":      defaultEnv.runningTasks(),
+	})
+	for _, s := range stacks {
+		log.Warn("well: goroutine", map[string]interface{}{
+			FnStack: string(s),
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package well
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestDumpGoroutines(t *testing.T) {
+	logger := log.DefaultLogger()
+	out := new(bytes.Buffer)
+	logger.SetOutput(out)
+	defer logger.SetOutput(os.Stderr)
+
+	DumpGoroutines()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !strings.Contains(lines[0], "well: goroutine dump") {
+		t.Error(`the first log should be the summary`, lines[0])
+	}
+	if !strings.Contains(out.String(), "TestDumpGoroutines") {
+		t.Error(`stack traces should be logged`)
+	}
+}
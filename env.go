@@ -2,7 +2,11 @@ package well
 
 import (
 	"context"
+	"reflect"
+	"runtime"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/cybozu-go/log"
 )
@@ -14,11 +18,29 @@ type Environment struct {
 	wg        sync.WaitGroup
 	generator *IDGenerator
 
-	mu       sync.RWMutex
-	stopped  bool
-	stopCh   chan struct{}
-	canceled bool
-	err      error
+	mu         sync.RWMutex
+	stopped    bool
+	stopCh     chan struct{}
+	canceled   bool
+	canceledAt time.Time
+	err        error
+
+	tasksMu sync.Mutex
+	taskID  uint64
+	tasks   map[uint64]string
+	hooks   TaskHooks
+}
+
+// TaskHooks are functions called when goroutines started by Go,
+// GoWithID, GoWithParent, and other functions of this package that
+// take Environment start and finish.  name is the name of the task,
+// usually the function name.  Either function may be nil.
+//
+// Started is called before Go returns.  Finished is called after
+// the goroutine returns err, and before Wait returns.
+type TaskHooks struct {
+	Started  func(name string)
+	Finished func(name string, err error)
 }
 
 // NewEnvironment creates a new Environment.
@@ -33,6 +55,7 @@ func NewEnvironment(ctx context.Context) *Environment {
 		cancel:    cancel,
 		generator: NewIDGenerator(),
 		stopCh:    make(chan struct{}),
+		tasks:     make(map[uint64]string),
 	}
 	return e
 }
@@ -73,6 +96,7 @@ func (e *Environment) Cancel(err error) bool {
 		return false
 	}
 	e.canceled = true
+	e.canceledAt = time.Now()
 	e.err = err
 	e.cancel()
 
@@ -90,7 +114,8 @@ func (e *Environment) Cancel(err error) bool {
 //
 // The returned err is the one passed to Cancel, or nil.
 // err can be tested by IsSignaled to determine whether the
-// program got SIGINT or SIGTERM.
+// program got SIGINT or SIGTERM.  IsCanceled and ExitCode help to
+// determine the exit status of the program.
 func (e *Environment) Wait() error {
 	<-e.stopCh
 	if log.Enabled(log.LvDebug) {
@@ -119,6 +144,50 @@ func (e *Environment) Wait() error {
 // f should watch ctx.Done() channel and return quickly when the
 // channel is closed.
 func (e *Environment) Go(f func(ctx context.Context) error) {
+	e.goTask(funcName(f), nil, f)
+}
+
+// GoWithID calls Go with a context having a new request tracking ID.
+func (e *Environment) GoWithID(f func(ctx context.Context) error) {
+	e.goTask(funcName(f), nil, func(ctx context.Context) error {
+		return f(WithRequestID(ctx, newActivityID(ctx, e.generator)))
+	})
+}
+
+// GoWithParent calls Go with a context having the values of parent,
+// such as the request tracking ID and TraceContext.
+//
+// Unlike the values, the cancellation of parent is not propagated.
+// This is useful to start background tasks from request handlers
+// whose contexts are canceled when the handlers return.
+func (e *Environment) GoWithParent(parent context.Context, f func(ctx context.Context) error) {
+	e.goTask(funcName(f), parent, f)
+}
+
+// valueContext is a context that has the values of parent in addition
+// to those of the embedded context.
+type valueContext struct {
+	context.Context
+	parent context.Context
+}
+
+func (c valueContext) Value(key interface{}) interface{} {
+	if v := c.parent.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+// SetTaskHooks sets hooks to observe tasks of the environment.
+// This is intended for tests, and should be called before starting
+// tasks.  See also welltest.Environment.
+func (e *Environment) SetTaskHooks(h TaskHooks) {
+	e.tasksMu.Lock()
+	e.hooks = h
+	e.tasksMu.Unlock()
+}
+
+func (e *Environment) goTask(name string, parent context.Context, f func(ctx context.Context) error) {
 	e.mu.RLock()
 	if e.stopped {
 		e.mu.RUnlock()
@@ -127,20 +196,59 @@ func (e *Environment) Go(f func(ctx context.Context) error) {
 	e.wg.Add(1)
 	e.mu.RUnlock()
 
+	e.tasksMu.Lock()
+	e.taskID++
+	id := e.taskID
+	e.tasks[id] = name
+	hooks := e.hooks
+	e.tasksMu.Unlock()
+
+	if hooks.Started != nil {
+		hooks.Started(name)
+	}
+
 	go func() {
+		defer ReportPanic()
 		ctx, cancel := context.WithCancel(e.ctx)
 		defer cancel()
+		if parent != nil {
+			ctx = valueContext{Context: ctx, parent: parent}
+		}
+		ctx, span := startTaskSpan(ctx, name)
 		err := f(ctx)
+		span.end(err)
 		if err != nil {
 			e.Cancel(err)
 		}
+		if hooks.Finished != nil {
+			hooks.Finished(name, err)
+		}
+
+		e.tasksMu.Lock()
+		delete(e.tasks, id)
+		e.tasksMu.Unlock()
 		e.wg.Done()
 	}()
 }
 
-// GoWithID calls Go with a context having a new request tracking ID.
-func (e *Environment) GoWithID(f func(ctx context.Context) error) {
-	e.Go(func(ctx context.Context) error {
-		return f(WithRequestID(ctx, e.generator.Generate()))
-	})
+// runningTasks returns the function names of running goroutines
+// started by Go or GoWithID.
+func (e *Environment) runningTasks() []string {
+	e.tasksMu.Lock()
+	defer e.tasksMu.Unlock()
+
+	names := make([]string, 0, len(e.tasks))
+	for _, name := range e.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	return fn.Name()
 }
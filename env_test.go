@@ -121,3 +121,32 @@ func TestEnvironmentID(t *testing.T) {
 		t.Error(`len(sid) != 36`)
 	}
 }
+
+func testTask(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestEnvironmentTasks(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(context.Background())
+	env.Go(testTask)
+	env.GoWithID(testTask)
+
+	tasks := env.runningTasks()
+	if len(tasks) != 2 {
+		t.Fatal(`len(tasks) != 2`, tasks)
+	}
+	for _, name := range tasks {
+		if name != "github.com/cybozu-go/well.testTask" {
+			t.Error(`unexpected task name:`, name)
+		}
+	}
+
+	env.Cancel(nil)
+	env.Wait()
+	if len(env.runningTasks()) != 0 {
+		t.Error(`finished tasks should be removed`)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"errors"
+
+	"github.com/cybozu-go/log"
+)
+
+func newEventLogFormat(source string, formatter log.Formatter) (log.Formatter, error) {
+	return nil, errors.New("event log is supported only on Windows")
+}
@@ -0,0 +1,76 @@
+//go:build windows
+// +build windows
+
+package well
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// eventLogFormat implements log.Formatter to write logs to
+// Windows Event Log instead of the output of the logger.
+//
+// The message of an event is the log formatted by formatter.
+// The event ID is the severity of the log, e.g. 3 for errors.
+type eventLogFormat struct {
+	formatter log.Formatter
+	elog      *eventlog.Log
+}
+
+// newEventLogFormat opens the event log of source.
+//
+// The source is registered using EventCreate.exe as the message
+// file if possible.  Registration requires the administrator
+// privilege, so failures are ignored.
+func newEventLogFormat(source string, formatter log.Formatter) (log.Formatter, error) {
+	eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info)
+
+	elog, err := eventlog.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogFormat{
+		formatter: formatter,
+		elog:      elog,
+	}, nil
+}
+
+// Close closes the event log.
+func (f *eventLogFormat) Close() error {
+	return f.elog.Close()
+}
+
+// String returns the name of the inner formatter.
+func (f *eventLogFormat) String() string {
+	return f.formatter.String()
+}
+
+// Format implements log.Formatter.
+func (f *eventLogFormat) Format(buf []byte, l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) ([]byte, error) {
+	b, err := f.formatter.Format(buf, l, t, severity, msg, fields)
+	if err != nil {
+		return nil, err
+	}
+	body := string(bytes.TrimRight(b, "\n"))
+
+	eid := uint32(severity)
+	switch {
+	case severity <= log.LvError:
+		err = f.elog.Error(eid, body)
+	case severity <= log.LvWarn:
+		err = f.elog.Warning(eid, body)
+	default:
+		err = f.elog.Info(eid, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing is written to the output of the logger.
+	return b[:0], nil
+}
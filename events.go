@@ -0,0 +1,149 @@
+package well
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const eventQueueSize = 64
+
+// EventType is the type of lifecycle events.
+type EventType int
+
+// Lifecycle events.
+const (
+	// EventReady is emitted when the program becomes ready.
+	// See SetReady.
+	EventReady EventType = iota + 1
+
+	// EventCanceled is emitted when the global environment is
+	// canceled.  Err is the error passed to Cancel.
+	EventCanceled
+
+	// EventDraining is emitted when servers start draining
+	// connections on shutdown.
+	EventDraining
+
+	// EventChildStarted is emitted when the master process of
+	// Graceful starts a child process.  PID and Generation are
+	// of the child.
+	EventChildStarted
+
+	// EventChildExited is emitted when a child process of Graceful
+	// exits.  PID and Generation are of the child, and Err is the
+	// error returned by exec.Cmd.Wait.
+	EventChildExited
+
+	// EventRestarted is emitted when a graceful restart completes,
+	// i.e. the new child becomes ready and the old child is being
+	// stopped.  PID and Generation are of the new child.
+	EventRestarted
+)
+
+// String returns the name of t.
+func (t EventType) String() string {
+	switch t {
+	case EventReady:
+		return "ready"
+	case EventCanceled:
+		return "canceled"
+	case EventDraining:
+		return "draining"
+	case EventChildStarted:
+		return "child_started"
+	case EventChildExited:
+		return "child_exited"
+	case EventRestarted:
+		return "restarted"
+	}
+	return "unknown"
+}
+
+// Event is a lifecycle event of the program.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Err is the error related to the event, if any.
+	Err error
+
+	// PID and Generation are set for events of Graceful children.
+	PID        int
+	Generation int
+}
+
+var (
+	eventsMu    sync.Mutex
+	subscribers []func(Event)
+	eventCh     chan Event
+)
+
+// Subscribe registers f to be called for lifecycle events.
+//
+// f is called serially in a goroutine in the order of events, so f
+// should return quickly.  Events emitted while f is slow are dropped
+// when the queue of 64 events is full.  Events emitted before the
+// first Subscribe are not delivered.
+func Subscribe(f func(Event)) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	if eventCh == nil {
+		eventCh = make(chan Event, eventQueueSize)
+		go dispatchEvents(eventCh)
+	}
+	subscribers = append(subscribers, f)
+}
+
+func dispatchEvents(ch <-chan Event) {
+	for ev := range ch {
+		eventsMu.Lock()
+		fs := subscribers
+		eventsMu.Unlock()
+
+		for _, f := range fs {
+			f(ev)
+		}
+	}
+}
+
+// emitEvent sends ev to subscribers, if any.
+func emitEvent(ev Event) {
+	eventsMu.Lock()
+	ch := eventCh
+	eventsMu.Unlock()
+	if ch == nil {
+		return
+	}
+
+	ev.Time = time.Now()
+	select {
+	case ch <- ev:
+	default:
+		log.Warn("well: dropped a lifecycle event", map[string]interface{}{
+			"event": ev.Type.String(),
+		})
+	}
+}
+
+// handleEvents emits EventCanceled and sends STOPPING=1 to systemd
+// when env, the global environment, is canceled.  This covers
+// cancellations by Go tasks returning errors as well as Cancel.
+func handleEvents(env *Environment) {
+	go func() {
+		<-env.ctx.Done()
+
+		env.mu.RLock()
+		canceled := env.canceled
+		err := env.err
+		env.mu.RUnlock()
+
+		// env is also canceled when Wait returns after Stop.
+		if canceled {
+			notifyStopping()
+			emitEvent(Event{Type: EventCanceled, Err: err})
+		}
+	}()
+}
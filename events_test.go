@@ -0,0 +1,49 @@
+package well
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	defer SetReady(true)
+
+	ch := make(chan Event, 10)
+	Subscribe(func(ev Event) {
+		select {
+		case ch <- ev:
+		default:
+		}
+	})
+
+	SetReady(false)
+	SetReady(true)
+	SetReady(true)
+	emitEvent(Event{Type: EventChildExited, PID: 10, Generation: 2, Err: errors.New("exit status 1")})
+
+	var events []Event
+	timeout := time.After(time.Second)
+	for len(events) < 2 {
+		select {
+		case ev := <-ch:
+			events = append(events, ev)
+		case <-timeout:
+			t.Fatal(`timed out`, events)
+		}
+	}
+
+	if events[0].Type != EventReady {
+		t.Error(`events[0].Type != EventReady`, events[0].Type)
+	}
+	ev := events[1]
+	if ev.Type != EventChildExited || ev.PID != 10 || ev.Generation != 2 || ev.Err == nil {
+		t.Error(`unexpected event`, ev)
+	}
+	if ev.Time.IsZero() {
+		t.Error(`ev.Time.IsZero()`)
+	}
+	if s := ev.Type.String(); s != "child_exited" {
+		t.Error(`s != "child_exited"`, s)
+	}
+}
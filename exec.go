@@ -3,7 +3,10 @@ package well
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os/exec"
+	"syscall"
 	"time"
 	"unicode/utf8"
 
@@ -25,6 +28,9 @@ func UTF8StringFromBytes(b []byte) string {
 // If command fails, log level will be log.LvError.
 // If command succeeds, log level will be log.LvInfo.
 //
+// Logs include the exit status, CPU times, and the maximum resident
+// set size of the command as well as the elapsed time.
+//
 // In most cases, use CommandContext function to prepare LogCmd.
 type LogCmd struct {
 	*exec.Cmd
@@ -42,6 +48,50 @@ type LogCmd struct {
 
 	// Logger for execution results.  If nil, the default logger is used.
 	Logger *log.Logger
+
+	// KillProcessGroup, if true, starts the command in a new process
+	// group and kills the whole group when the context given to
+	// CommandContext is done.  This prevents grandchildren such as
+	// commands in shell pipelines from surviving the cancellation.
+	//
+	// This is not implemented on Windows.
+	KillProcessGroup bool
+
+	// ParentDeathSignal, if not zero, is sent to the command when this
+	// program dies, e.g. by SIGKILL or OOM killer.  This prevents
+	// orphaned commands from running after abrupt deaths.
+	//
+	// This is implemented only on Linux.
+	ParentDeathSignal syscall.Signal
+
+	// Credential, if not nil, runs the command as the user and groups.
+	// The program needs privileges to change them.
+	//
+	// This is not implemented on Windows.
+	Credential *CommandCredential
+
+	// Umask, if not nil, is the umask of the command.
+	//
+	// Since the umask is shared by all threads of a process, the umask
+	// of this program is changed while starting the command.  Files
+	// created by other goroutines at the same time are affected.
+	//
+	// This is not implemented on Windows.
+	Umask *int
+
+	// OutputSeverity, if not zero, makes the command log each line of
+	// its stdout and stderr with this severity.  Logs have "command",
+	// "pid", and "stream" fields in addition to Fields.  Outputs are
+	// logged only if Cmd.Stdout or Cmd.Stderr is nil, respectively.
+	OutputSeverity int
+
+	outputs []*outputLogger
+
+	ctx         context.Context
+	gracePeriod time.Duration
+	done        chan struct{}
+	watcherDone chan struct{}
+	terminated  error
 }
 
 func (c *LogCmd) log(st time.Time, err error, output []byte) {
@@ -61,6 +111,14 @@ func (c *LogCmd) log(st time.Time, err error, output []byte) {
 	fields[log.FnResponseTime] = time.Since(st).Seconds()
 	fields["command"] = c.Cmd.Path
 	fields["args"] = c.Cmd.Args
+	if ps := c.Cmd.ProcessState; ps != nil {
+		fields["exit_status"] = ps.ExitCode()
+		fields["user_time"] = ps.UserTime().Seconds()
+		fields["system_time"] = ps.SystemTime().Seconds()
+		if rss, ok := maxRSS(ps); ok {
+			fields["max_rss"] = rss
+		}
+	}
 
 	if err == nil {
 		logger.Log(c.Severity, "well: exec", fields)
@@ -74,41 +132,135 @@ func (c *LogCmd) log(st time.Time, err error, output []byte) {
 	logger.Error("well: exec", fields)
 }
 
+// Start overrides exec.Cmd.Start to apply KillProcessGroup,
+// ParentDeathSignal, Credential, Umask, and OutputSeverity.
+func (c *LogCmd) Start() error {
+	var err error
+	if c.KillProcessGroup {
+		setProcessGroup(c.Cmd)
+	}
+	if c.ParentDeathSignal != 0 {
+		setParentDeathSignal(c.Cmd, c.ParentDeathSignal)
+	}
+	if c.Credential != nil {
+		if err = setCredential(c.Cmd, c.Credential); err != nil {
+			return err
+		}
+	}
+	c.outputs = nil
+	if c.OutputSeverity != 0 {
+		if c.Cmd.Stdout == nil {
+			c.Cmd.Stdout = c.newOutputLogger("stdout")
+		}
+		if c.Cmd.Stderr == nil {
+			c.Cmd.Stderr = c.newOutputLogger("stderr")
+		}
+	}
+	if c.gracePeriod > 0 {
+		// exec.CommandContext is not used to send SIGTERM first.
+		if err = c.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if c.Umask != nil {
+		err = startWithUmask(c.Cmd, *c.Umask)
+	} else {
+		err = c.Cmd.Start()
+	}
+	if err != nil {
+		return err
+	}
+	if c.ctx != nil && (c.KillProcessGroup || c.gracePeriod > 0) {
+		c.done = make(chan struct{})
+		c.watcherDone = make(chan struct{})
+		c.terminated = nil
+		go c.watch(c.Cmd.Process)
+	}
+	return nil
+}
+
+func (c *LogCmd) wait() error {
+	err := c.Cmd.Wait()
+	for _, o := range c.outputs {
+		o.flush()
+	}
+	if c.done == nil {
+		return err
+	}
+
+	close(c.done)
+	<-c.watcherDone
+	c.done = nil
+	if c.terminated != nil {
+		return fmt.Errorf("%w: %v", c.terminated, err)
+	}
+	return err
+}
+
+func (c *LogCmd) run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.wait()
+}
+
 // CombinedOutput overrides exec.Cmd.CombinedOutput to record the result.
 func (c *LogCmd) CombinedOutput() ([]byte, error) {
+	if c.Cmd.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	if c.Cmd.Stderr != nil {
+		return nil, errors.New("exec: Stderr already set")
+	}
+
 	st := time.Now()
-	data, err := c.Cmd.CombinedOutput()
+	var b bytes.Buffer
+	c.Cmd.Stdout = &b
+	c.Cmd.Stderr = &b
+	err := c.run()
 	c.log(st, err, nil)
-	return data, err
+	return b.Bytes(), err
 }
 
 // Output overrides exec.Cmd.Output to record the result.
-// If Cmd.Stderr is nil, Output logs outputs to stderr as well.
+// If Cmd.Stderr is nil and OutputSeverity is zero, Output logs outputs
+// to stderr as well.
 func (c *LogCmd) Output() ([]byte, error) {
+	if c.Cmd.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+
 	st := time.Now()
-	data, err := c.Cmd.Output()
-	if err != nil {
-		ee, ok := err.(*exec.ExitError)
-		if ok {
+	var stdout, stderr bytes.Buffer
+	c.Cmd.Stdout = &stdout
+	captureErr := c.Cmd.Stderr == nil && c.OutputSeverity == 0
+	if captureErr {
+		c.Cmd.Stderr = &stderr
+	}
+	err := c.run()
+	if err != nil && captureErr {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			ee.Stderr = stderr.Bytes()
 			c.log(st, err, ee.Stderr)
-			return data, err
+			return stdout.Bytes(), err
 		}
 	}
 	c.log(st, err, nil)
-	return data, err
+	return stdout.Bytes(), err
 }
 
 // Run overrides exec.Cmd.Run to record the result.
-// If both Cmd.Stdout and Cmd.Stderr are nil, this calls Output
-// instead to log stderr.
+// If both Cmd.Stdout and Cmd.Stderr are nil and OutputSeverity is zero,
+// this calls Output instead to log stderr.
 func (c *LogCmd) Run() error {
-	if c.Cmd.Stdout == nil && c.Cmd.Stderr == nil {
+	if c.Cmd.Stdout == nil && c.Cmd.Stderr == nil && c.OutputSeverity == 0 {
 		_, err := c.Output()
 		return err
 	}
 
 	st := time.Now()
-	err := c.Cmd.Run()
+	err := c.run()
 	c.log(st, err, nil)
 	return err
 }
@@ -116,7 +268,7 @@ func (c *LogCmd) Run() error {
 // Wait overrides exec.Cmd.Wait to record the result.
 func (c *LogCmd) Wait() error {
 	st := time.Now()
-	err := c.Cmd.Wait()
+	err := c.wait()
 	c.log(st, err, nil)
 	return err
 }
@@ -133,5 +285,6 @@ func CommandContext(ctx context.Context, name string, args ...string) *LogCmd {
 		Cmd:      exec.CommandContext(ctx, name, args...),
 		Severity: log.LvInfo,
 		Fields:   FieldsFromContext(ctx),
+		ctx:      ctx,
 	}
 }
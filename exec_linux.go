@@ -0,0 +1,22 @@
+//go:build linux
+// +build linux
+
+package well
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setParentDeathSignal sets PR_SET_PDEATHSIG of the command.
+//
+// Note that Linux sends the signal when the thread that started the
+// command exits.  Go runtime does not terminate threads unless
+// goroutines locked to them by runtime.LockOSThread exit without
+// unlocking, so this works as expected in most programs.
+func setParentDeathSignal(cmd *exec.Cmd, sig syscall.Signal) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Pdeathsig = sig
+}
@@ -0,0 +1,21 @@
+package well
+
+import (
+	"context"
+	"syscall"
+	"testing"
+)
+
+func TestLogCmdParentDeathSignal(t *testing.T) {
+	t.Parallel()
+
+	cmd := CommandContext(context.Background(), "true")
+	cmd.Severity = 0
+	cmd.ParentDeathSignal = syscall.SIGKILL
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.SysProcAttr.Pdeathsig != syscall.SIGKILL {
+		t.Error(`cmd.SysProcAttr.Pdeathsig != syscall.SIGKILL`)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package well
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setParentDeathSignal(cmd *exec.Cmd, sig syscall.Signal) {}
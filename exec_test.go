@@ -7,6 +7,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 	"unicode/utf8"
@@ -76,6 +80,12 @@ func TestLogCmd(t *testing.T) {
 	if execlog.RequestID != testUUID {
 		t.Error(`execlog.RequestID != testUUID`)
 	}
+	if execlog.ExitStatus != 0 {
+		t.Error(`execlog.ExitStatus != 0`)
+	}
+	if execlog.MaxRSS <= 0 {
+		t.Error(`execlog.MaxRSS <= 0`)
+	}
 }
 
 func TestLogCmdError(t *testing.T) {
@@ -109,4 +119,249 @@ func TestLogCmdError(t *testing.T) {
 	if execlog.Stderr != "hoge fuga\n" {
 		t.Error(`execlog.Stderr != "hoge fuga\n"`)
 	}
+	if execlog.ExitStatus != 3 {
+		t.Error(`execlog.ExitStatus != 3`, execlog.ExitStatus)
+	}
+}
+
+func TestLogCmdKillProcessGroup(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// sleep in background keeps stdout open after sh is killed.
+	cmd := CommandContext(ctx, "/bin/sh", "-c", "sleep 10 & wait")
+	cmd.Severity = 0
+	cmd.KillProcessGroup = true
+	st := time.Now()
+	_, err := cmd.Output()
+	if err == nil {
+		t.Error(`the command should be killed`)
+	}
+	if time.Since(st) > 5*time.Second {
+		t.Error(`the process group should be killed`)
+	}
+}
+
+func TestGracefulCommandContext(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	cmd := GracefulCommandContext(ctx, 5*time.Second, "/bin/sh", "-c", `trap "exit 0" TERM; sleep 10 & wait`)
+	cmd.Severity = 0
+	cmd.KillProcessGroup = true
+	err := cmd.Run()
+	if !errors.Is(err, ErrCommandTerminated) {
+		t.Error(`err should be ErrCommandTerminated`, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	st := time.Now()
+	cmd = GracefulCommandContext(ctx, 100*time.Millisecond, "/bin/sh", "-c", `trap "" TERM; sleep 10`)
+	cmd.Severity = 0
+	cmd.KillProcessGroup = true
+	err = cmd.Run()
+	if !errors.Is(err, ErrCommandKilled) {
+		t.Error(`err should be ErrCommandKilled`, err)
+	}
+	if time.Since(st) > 5*time.Second {
+		t.Error(`the command should be killed after the grace period`)
+	}
+
+	cmd = GracefulCommandContext(context.Background(), time.Second, "true")
+	cmd.Severity = 0
+	if err := cmd.Run(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGracefulCommandExited(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := GracefulCommandContext(ctx, time.Second, "true")
+	if err := cmd.Cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the process has exited by itself before cancellation.
+	cancel()
+	cmd.done = make(chan struct{})
+	cmd.watcherDone = make(chan struct{})
+	cmd.watch(cmd.Cmd.Process)
+	if cmd.terminated != nil {
+		t.Error(`exited command should not be reported as terminated`, cmd.terminated)
+	}
+}
+
+func TestLogCmdOutputSeverity(t *testing.T) {
+	t.Parallel()
+
+	logger := log.NewLogger()
+	logger.SetFormatter(log.JSONFormat{})
+	buf := new(bytes.Buffer)
+	logger.SetOutput(buf)
+
+	cmd := CommandContext(context.Background(), "/bin/sh", "-c", "echo hello; echo world 1>&2; printf tail")
+	cmd.Severity = 0
+	cmd.OutputSeverity = log.LvInfo
+	cmd.Logger = logger
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := make(map[string]string)
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte{'\n'}) {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(line, &fields); err != nil {
+			t.Fatal(err)
+		}
+		if fields["pid"] != float64(cmd.Process.Pid) {
+			t.Error(`fields["pid"] != cmd.Process.Pid`, fields["pid"])
+		}
+		if fields["command"] != "/bin/sh" {
+			t.Error(`fields["command"] != "/bin/sh"`, fields["command"])
+		}
+		stream, _ := fields["stream"].(string)
+		msg, _ := fields["message"].(string)
+		outputs[stream] += msg + ","
+	}
+	if outputs["stdout"] != "hello,tail," {
+		t.Error(`outputs["stdout"] != "hello,tail,"`, outputs["stdout"])
+	}
+	if outputs["stderr"] != "world," {
+		t.Error(`outputs["stderr"] != "world,"`, outputs["stderr"])
+	}
+}
+
+func TestRunWithRetry(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	p := &RetryPolicy{
+		MaxRetries: 3,
+		MinBackoff: time.Millisecond,
+	}
+
+	// succeeds at the third attempt.
+	attempts := 0
+	err := RunWithRetry(context.Background(), p, func(ctx context.Context) *LogCmd {
+		attempts++
+		cmd := CommandContext(ctx, "/bin/sh", "-c", `echo >> count; test $(wc -l < count) -ge 3`)
+		cmd.Dir = dir
+		cmd.Severity = 0
+		return cmd
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if attempts != 3 {
+		t.Error(`attempts != 3`, attempts)
+	}
+
+	attempts = 0
+	err = RunWithRetry(context.Background(), p, func(ctx context.Context) *LogCmd {
+		attempts++
+		return CommandContext(ctx, "false")
+	})
+	if err == nil {
+		t.Error(`RunWithRetry should fail`)
+	}
+	if attempts != 4 {
+		t.Error(`attempts != 4`, attempts)
+	}
+}
+
+func TestLogCmdCredential(t *testing.T) {
+	t.Parallel()
+
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	cred, err := LookupCredential("nobody")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	cmd := CommandContext(context.Background(), "id", "-u")
+	cmd.Severity = 0
+	cmd.Credential = cred
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bytes.TrimSpace(out)) != strconv.FormatUint(uint64(cred.UID), 10) {
+		t.Error(`the command should run as nobody`, string(out))
+	}
+}
+
+func TestLogCmdUmask(t *testing.T) {
+	t.Parallel()
+
+	umask := 027
+	cmd := CommandContext(context.Background(), "/bin/sh", "-c", "umask")
+	cmd.Umask = &umask
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(out)); s != "0027" {
+		t.Error(`s != "0027"`, s)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	t.Parallel()
+
+	p := NewPipeline(context.Background(),
+		[]string{"printf", `a\nb\nc\n`},
+		[]string{"grep", "-v", "b"},
+		[]string{"wc", "-l"},
+	)
+	out := new(bytes.Buffer)
+	p.Commands[2].Stdout = out
+	for _, c := range p.Commands {
+		c.Severity = 0
+	}
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != "2" {
+		t.Error(`unexpected output`, out.String())
+	}
+
+	p = NewPipeline(context.Background(),
+		[]string{"true"},
+		[]string{"false"},
+	)
+	err := p.Run()
+	var perr *PipelineError
+	if !errors.As(err, &perr) {
+		t.Fatal(`err should be *PipelineError`, err)
+	}
+	if perr.Errors[0] != nil || perr.Errors[1] == nil {
+		t.Error(`unexpected errors`, perr.Errors)
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	p := NewPipeline(ctx,
+		[]string{"sleep", "10"},
+		[]string{"cat"},
+	)
+	st := time.Now()
+	if err := p.Run(); err == nil {
+		t.Error(`pipeline should be killed`)
+	}
+	if time.Since(st) > 5*time.Second {
+		t.Error(`all commands should be killed`)
+	}
 }
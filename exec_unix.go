@@ -0,0 +1,70 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes temporary changes of the umask.
+var umaskMu sync.Mutex
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func killProcessGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+func terminateProcess(p *os.Process, group bool) error {
+	if group {
+		return syscall.Kill(-p.Pid, syscall.SIGTERM)
+	}
+	return p.Signal(syscall.SIGTERM)
+}
+
+// maxRSS returns the maximum resident set size of the process in bytes.
+func maxRSS(ps *os.ProcessState) (int64, bool) {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0, false
+	}
+	rss := int64(ru.Maxrss)
+	// ru_maxrss is in kilobytes except on macOS.
+	if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+		rss *= 1024
+	}
+	return rss, true
+}
+
+func setCredential(cmd *exec.Cmd, cred *CommandCredential) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    cred.UID,
+		Gid:    cred.GID,
+		Groups: cred.Groups,
+	}
+	return nil
+}
+
+// startWithUmask starts cmd with the umask.  Since the umask is
+// process-wide, it is changed temporarily while starting cmd.
+func startWithUmask(cmd *exec.Cmd, umask int) error {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+
+	old := syscall.Umask(umask)
+	defer syscall.Umask(old)
+	return cmd.Start()
+}
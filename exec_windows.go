@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package well
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(pid int) error {
+	return errors.New("not supported on Windows")
+}
+
+func terminateProcess(p *os.Process, group bool) error {
+	return errors.New("not supported on Windows")
+}
+
+func maxRSS(ps *os.ProcessState) (int64, bool) {
+	return 0, false
+}
+
+func setCredential(cmd *exec.Cmd, cred *CommandCredential) error {
+	return errors.New("Credential is not supported on Windows")
+}
+
+func startWithUmask(cmd *exec.Cmd, umask int) error {
+	return errors.New("Umask is not supported on Windows")
+}
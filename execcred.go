@@ -0,0 +1,50 @@
+package well
+
+import (
+	"os/user"
+	"strconv"
+)
+
+// CommandCredential is the user and groups to run commands.
+//
+// Groups are supplementary group IDs.  If Groups is empty, the command
+// runs without supplementary groups.
+type CommandCredential struct {
+	UID    uint32
+	GID    uint32
+	Groups []uint32
+}
+
+// LookupCredential returns CommandCredential of the user specified
+// by name.  The primary and supplementary groups of the user are used.
+func LookupCredential(name string) (*CommandCredential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &CommandCredential{
+		UID: uint32(uid),
+		GID: uint32(gid),
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range gids {
+		n, err := strconv.ParseUint(g, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		cred.Groups = append(cred.Groups, uint32(n))
+	}
+	return cred, nil
+}
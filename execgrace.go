@@ -0,0 +1,95 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// Errors returned by commands prepared by GracefulCommandContext.
+// They wrap the original error and can be tested with errors.Is.
+var (
+	// ErrCommandTerminated means that the command exited by SIGTERM
+	// sent on cancellation within the grace period.
+	ErrCommandTerminated = errors.New("command terminated on cancellation")
+
+	// ErrCommandKilled means that the command was killed by SIGKILL
+	// because it did not exit within the grace period.
+	ErrCommandKilled = errors.New("command killed after grace period")
+)
+
+// GracefulCommandContext is similar to CommandContext, but the command
+// is terminated gracefully when ctx is done.
+//
+// When ctx is done, SIGTERM is sent to the command, or to its process
+// group if KillProcessGroup is true.  If the command does not exit
+// within gracePeriod, it is killed by SIGKILL.  Run, Output, and Wait
+// return an error wrapping ErrCommandTerminated or ErrCommandKilled
+// in these cases.
+//
+// To limit the execution time, give a context created by
+// context.WithTimeout.
+//
+// On Windows, the command is killed immediately.
+func GracefulCommandContext(ctx context.Context, gracePeriod time.Duration, name string, args ...string) *LogCmd {
+	if gracePeriod <= 0 {
+		return CommandContext(ctx, name, args...)
+	}
+	return &LogCmd{
+		Cmd:         exec.Command(name, args...),
+		Severity:    log.LvInfo,
+		Fields:      FieldsFromContext(ctx),
+		ctx:         ctx,
+		gracePeriod: gracePeriod,
+	}
+}
+
+// watch terminates or kills the command when the context is done.
+func (c *LogCmd) watch(p *os.Process) {
+	defer close(c.watcherDone)
+
+	select {
+	case <-c.done:
+		return
+	case <-c.ctx.Done():
+	}
+
+	if c.gracePeriod > 0 {
+		err := terminateProcess(p, c.KillProcessGroup)
+		if processDone(err) {
+			// the command has exited by itself.
+			return
+		}
+		if err == nil {
+			timer := time.NewTimer(c.gracePeriod)
+			defer timer.Stop()
+			select {
+			case <-c.done:
+				c.terminated = ErrCommandTerminated
+				return
+			case <-timer.C:
+			}
+		}
+	}
+
+	killed := false
+	if c.KillProcessGroup {
+		killed = killProcessGroup(p.Pid) == nil
+	}
+	if err := p.Kill(); err == nil {
+		killed = true
+	}
+	if killed && c.gracePeriod > 0 {
+		c.terminated = ErrCommandKilled
+	}
+}
+
+// processDone returns true if err means that the process has exited.
+func processDone(err error) bool {
+	return errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH)
+}
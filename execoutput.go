@@ -0,0 +1,84 @@
+package well
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/cybozu-go/log"
+)
+
+// maxOutputLine is the maximum length of a line of command outputs.
+// Longer lines are split.
+const maxOutputLine = 64 << 10
+
+// outputLogger is an io.Writer that logs each line of command outputs.
+type outputLogger struct {
+	cmd    *LogCmd
+	stream string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (c *LogCmd) newOutputLogger(stream string) *outputLogger {
+	o := &outputLogger{cmd: c, stream: stream}
+	c.outputs = append(c.outputs, o)
+	return o
+}
+
+func (o *outputLogger) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.buf = append(o.buf, p...)
+	for {
+		idx := bytes.IndexByte(o.buf, '\n')
+		if idx < 0 {
+			if len(o.buf) < maxOutputLine {
+				break
+			}
+			idx = maxOutputLine
+		}
+		o.log(o.buf[:idx])
+		if idx < len(o.buf) && o.buf[idx] == '\n' {
+			idx++
+		}
+		o.buf = o.buf[idx:]
+	}
+	if len(o.buf) == 0 {
+		o.buf = nil
+	}
+	return len(p), nil
+}
+
+// flush logs the last line not terminated by a newline.
+func (o *outputLogger) flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.buf) > 0 {
+		o.log(o.buf)
+		o.buf = nil
+	}
+}
+
+func (o *outputLogger) log(line []byte) {
+	c := o.cmd
+	logger := c.Logger
+	if logger == nil {
+		logger = log.DefaultLogger()
+	}
+	if !logger.Enabled(c.OutputSeverity) {
+		return
+	}
+
+	fields := make(map[string]interface{}, len(c.Fields)+3)
+	for k, v := range c.Fields {
+		fields[k] = v
+	}
+	fields["command"] = c.Cmd.Path
+	// Process is set before exec.Cmd starts goroutines to copy outputs.
+	fields["pid"] = c.Cmd.Process.Pid
+	fields["stream"] = o.stream
+	logger.Log(c.OutputSeverity, UTF8StringFromBytes(bytes.TrimSuffix(line, []byte{'\r'})), fields)
+}
@@ -0,0 +1,44 @@
+package well
+
+import (
+	"context"
+
+	"github.com/cybozu-go/log"
+)
+
+// RunWithRetry runs a command prepared by newCmd and retries it with
+// jittered exponential backoff while it fails.
+//
+// newCmd is called for each attempt with ctx because exec.Cmd cannot
+// be reused.  Only MaxRetries, MinBackoff, and MaxBackoff of p are
+// used.  Each attempt is logged by LogCmd with "attempt" field.
+//
+// Retries stop when ctx is canceled.  Pass the context given to
+// functions started by Go to stop retries when the environment is
+// canceled.  The error of the last attempt is returned.
+func RunWithRetry(ctx context.Context, p *RetryPolicy, newCmd func(ctx context.Context) *LogCmd) error {
+	for attempt := 1; ; attempt++ {
+		cmd := newCmd(ctx)
+		if cmd.Fields == nil {
+			cmd.Fields = make(map[string]interface{})
+		}
+		cmd.Fields["attempt"] = attempt
+
+		err := cmd.Run()
+		if err == nil || attempt > p.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		d, _ := p.backoff(attempt, nil)
+		log.Warn("well: retrying command", map[string]interface{}{
+			"command":   cmd.Path,
+			"attempt":   attempt,
+			"backoff":   d.String(),
+			log.FnError: err.Error(),
+		})
+
+		if Sleep(ctx, d) != nil {
+			return err
+		}
+	}
+}
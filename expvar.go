@@ -0,0 +1,67 @@
+package well
+
+import (
+	"expvar"
+	"os"
+	"time"
+)
+
+// ExpvarName is the name of the expvar variable that holds statistics
+// of the framework.  It is published automatically and appears in
+// /debug/vars of expvar as follows:
+//
+//	"well": {
+//	    "environment": {"running_tasks": [...], "canceled": false, "uptime": 12.3, "error": ""},
+//	    "server": {"active_connections": 3, "active_requests": 1, "draining": false},
+//	    "graceful": {"master": false, "pid": 1234, "restarts": 2},
+//	    ...
+//	}
+const ExpvarName = "well"
+
+var startTime = time.Now()
+
+func init() {
+	// Do not panic if the program has published the same name.
+	if expvar.Get(ExpvarName) != nil {
+		return
+	}
+	expvar.Publish(ExpvarName, expvar.Func(expvarStats))
+}
+
+func expvarStats() interface{} {
+	s := ReadStats()
+
+	env := defaultEnv
+	env.mu.RLock()
+	canceled := env.canceled
+	err := env.err
+	env.mu.RUnlock()
+
+	var errStr string
+	if err != nil {
+		errStr = err.Error()
+	}
+
+	return map[string]interface{}{
+		"environment": map[string]interface{}{
+			"running_tasks": env.runningTasks(),
+			"canceled":      canceled,
+			"uptime":        time.Since(startTime).Seconds(),
+			"error":         errStr,
+			"wait_duration": s.WaitDuration.Seconds(),
+		},
+		"server": map[string]interface{}{
+			"active_connections":    s.ActiveConnections,
+			"active_requests":       s.ActiveRequests,
+			"draining":              s.Draining,
+			"http_request_duration": s.HTTPRequestDuration,
+		},
+		"graceful": map[string]interface{}{
+			"master":   isMaster(),
+			"pid":      os.Getpid(),
+			"restarts": s.Restarts,
+		},
+		"goroutines":   s.Goroutines,
+		"dropped_logs": s.DroppedLogs,
+	}
+}
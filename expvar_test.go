@@ -0,0 +1,39 @@
+package well
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+func TestExpvar(t *testing.T) {
+	t.Parallel()
+
+	v := expvar.Get(ExpvarName)
+	if v == nil {
+		t.Fatal(`expvar is not published`)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(v.String()), &raw); err != nil {
+		t.Fatal(err)
+	}
+	stats := make(map[string]map[string]interface{})
+	for _, k := range []string{"environment", "server", "graceful"} {
+		var m map[string]interface{}
+		if err := json.Unmarshal(raw[k], &m); err != nil {
+			t.Fatal(k, err)
+		}
+		stats[k] = m
+	}
+
+	if _, ok := stats["environment"]["uptime"].(float64); !ok {
+		t.Error(`no uptime`, stats["environment"])
+	}
+	if _, ok := stats["server"]["active_connections"]; !ok {
+		t.Error(`no active_connections`, stats["server"])
+	}
+	if _, ok := stats["graceful"]["pid"]; !ok {
+		t.Error(`no pid`, stats["graceful"])
+	}
+}
@@ -0,0 +1,316 @@
+package well
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultMaxFrameSize = 64 << 10
+
+// ErrFrameTooLarge is returned when a frame exceeds the maximum size.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// FrameReader reads frames from a stream.
+//
+// The returned frame is valid only until the next call of ReadFrame.
+// At the end of the stream, ReadFrame returns io.EOF.  If the stream
+// ends in the middle of a frame, io.ErrUnexpectedEOF is returned.
+type FrameReader interface {
+	ReadFrame() ([]byte, error)
+}
+
+// FrameWriter writes frames to a stream.
+// Multiple goroutines can safely call WriteFrame.
+type FrameWriter interface {
+	WriteFrame(frame []byte) error
+}
+
+// Codec creates FrameReader and FrameWriter of a framing protocol.
+type Codec interface {
+	NewFrameReader(r io.Reader) FrameReader
+	NewFrameWriter(w io.Writer) FrameWriter
+}
+
+func maxFrameSize(n int) int {
+	if n <= 0 {
+		return defaultMaxFrameSize
+	}
+	return n
+}
+
+// frameWriter serializes writes of frames encoded by encode.
+type frameWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	buf    []byte
+	encode func(buf, frame []byte) ([]byte, error)
+}
+
+func (w *frameWriter) WriteFrame(frame []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	buf, err := w.encode(w.buf[:0], frame)
+	if err != nil {
+		return err
+	}
+	w.buf = buf
+	_, err = w.w.Write(buf)
+	return err
+}
+
+// LineCodec is a Codec for newline-delimited frames.
+// Frames do not include the trailing "\n" or "\r\n".
+type LineCodec struct {
+	// MaxSize is the maximum size of a frame.
+	// Zero is treated as 64 KiB.
+	MaxSize int
+}
+
+// NewFrameReader implements Codec.
+func (c LineCodec) NewFrameReader(r io.Reader) FrameReader {
+	max := maxFrameSize(c.MaxSize)
+	return &lineReader{r: bufio.NewReaderSize(r, max+2), max: max}
+}
+
+// NewFrameWriter implements Codec.
+// WriteFrame returns an error if the frame contains "\n".
+func (c LineCodec) NewFrameWriter(w io.Writer) FrameWriter {
+	return &frameWriter{w: w, encode: encodeLine}
+}
+
+type lineReader struct {
+	r   *bufio.Reader
+	max int
+}
+
+func (r *lineReader) ReadFrame() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	switch {
+	case err == bufio.ErrBufferFull:
+		return nil, ErrFrameTooLarge
+	case err == io.EOF && len(line) > 0:
+		// the last line without "\n".
+	case err != nil:
+		return nil, err
+	}
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	if len(line) > r.max {
+		return nil, ErrFrameTooLarge
+	}
+	return line, nil
+}
+
+func encodeLine(buf, frame []byte) ([]byte, error) {
+	if bytes.IndexByte(frame, '\n') >= 0 {
+		return nil, errors.New("frame contains a newline")
+	}
+	buf = append(buf, frame...)
+	return append(buf, '\n'), nil
+}
+
+// LengthPrefixCodec is a Codec for frames prefixed by their lengths
+// as 4-byte big-endian unsigned integers.
+type LengthPrefixCodec struct {
+	// MaxSize is the maximum size of a frame.
+	// Zero is treated as 64 KiB.
+	MaxSize int
+}
+
+// NewFrameReader implements Codec.
+func (c LengthPrefixCodec) NewFrameReader(r io.Reader) FrameReader {
+	return &lengthPrefixReader{r: bufio.NewReader(r), max: maxFrameSize(c.MaxSize)}
+}
+
+// NewFrameWriter implements Codec.
+func (c LengthPrefixCodec) NewFrameWriter(w io.Writer) FrameWriter {
+	return &frameWriter{w: w, encode: encodeLengthPrefix}
+}
+
+type lengthPrefixReader struct {
+	r   *bufio.Reader
+	max int
+	buf []byte
+}
+
+func (r *lengthPrefixReader) ReadFrame() ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if uint64(n) > uint64(r.max) {
+		return nil, ErrFrameTooLarge
+	}
+	if cap(r.buf) < int(n) {
+		r.buf = make([]byte, n)
+	}
+	frame := r.buf[:n]
+	if _, err := io.ReadFull(r.r, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+func encodeLengthPrefix(buf, frame []byte) ([]byte, error) {
+	if uint64(len(frame)) > 0xffffffff {
+		return nil, ErrFrameTooLarge
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(frame)))
+	return append(buf, frame...), nil
+}
+
+// NetstringCodec is a Codec for netstrings, e.g. "5:hello,".
+// https://cr.yp.to/proto/netstrings.txt
+type NetstringCodec struct {
+	// MaxSize is the maximum size of a frame.
+	// Zero is treated as 64 KiB.
+	MaxSize int
+}
+
+// NewFrameReader implements Codec.
+func (c NetstringCodec) NewFrameReader(r io.Reader) FrameReader {
+	return &netstringReader{r: bufio.NewReader(r), max: maxFrameSize(c.MaxSize)}
+}
+
+// NewFrameWriter implements Codec.
+func (c NetstringCodec) NewFrameWriter(w io.Writer) FrameWriter {
+	return &frameWriter{w: w, encode: encodeNetstring}
+}
+
+type netstringReader struct {
+	r   *bufio.Reader
+	max int
+	buf []byte
+}
+
+func (r *netstringReader) ReadFrame() ([]byte, error) {
+	n := 0
+	for i := 0; ; i++ {
+		c, err := r.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if c == ':' && i > 0 {
+			break
+		}
+		if c < '0' || c > '9' || (i == 1 && n == 0) {
+			return nil, errors.New("invalid netstring length")
+		}
+		n = n*10 + int(c-'0')
+		if n > r.max {
+			return nil, ErrFrameTooLarge
+		}
+	}
+
+	if cap(r.buf) < n+1 {
+		r.buf = make([]byte, n+1)
+	}
+	frame := r.buf[:n+1]
+	if _, err := io.ReadFull(r.r, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if frame[n] != ',' {
+		return nil, errors.New("netstring does not end with a comma")
+	}
+	return frame[:n], nil
+}
+
+func encodeNetstring(buf, frame []byte) ([]byte, error) {
+	buf = strconv.AppendInt(buf, int64(len(frame)), 10)
+	buf = append(buf, ':')
+	buf = append(buf, frame...)
+	return append(buf, ','), nil
+}
+
+// ServeFrames reads frames from conn by codec, and calls handler for
+// each frame.  handler can send frames to the peer by w.
+//
+// ServeFrames returns nil when the peer closes the connection, or
+// the error from reading frames or handler.  When ctx is done,
+// the blocking read is interrupted and ctx.Err() is returned.
+//
+// This is intended to be called from Server.Handler:
+//
+//	Handler: func(ctx context.Context, conn net.Conn) {
+//		well.ServeFrames(ctx, conn, well.LineCodec{}, handleLine)
+//	}
+func ServeFrames(ctx context.Context, conn net.Conn, codec Codec, handler func(ctx context.Context, frame []byte, w FrameWriter) error) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblock ReadFrame.
+			conn.SetReadDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	r := codec.NewFrameReader(conn)
+	w := codec.NewFrameWriter(conn)
+	for {
+		frame, err := r.ReadFrame()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := handler(ctx, frame, w); err != nil {
+			return err
+		}
+	}
+}
+
+// ServeJSONLines reads JSON values separated by newlines from conn,
+// and calls handler with each value decoded into T.  If handler
+// returns a non-nil response, it is sent to the peer as a JSON line.
+//
+// maxSize is the maximum size of a line.  Zero is treated as 64 KiB.
+// Other behaviors are the same as ServeFrames.
+func ServeJSONLines[T any](ctx context.Context, conn net.Conn, maxSize int, handler func(ctx context.Context, req T) (interface{}, error)) error {
+	return ServeFrames(ctx, conn, LineCodec{MaxSize: maxSize}, func(ctx context.Context, frame []byte, w FrameWriter) error {
+		if len(bytes.TrimSpace(frame)) == 0 {
+			return nil
+		}
+		var req T
+		if err := json.Unmarshal(frame, &req); err != nil {
+			return err
+		}
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return err
+		}
+		if resp == nil {
+			return nil
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		return w.WriteFrame(data)
+	})
+}
@@ -0,0 +1,179 @@
+package well
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestCodecs(t *testing.T) {
+	t.Parallel()
+
+	frames := [][]byte{[]byte("hello"), {}, []byte("world, 12:34")}
+	codecs := map[string]Codec{
+		"line":          LineCodec{},
+		"length prefix": LengthPrefixCodec{},
+		"netstring":     NetstringCodec{},
+	}
+	for name, codec := range codecs {
+		buf := new(bytes.Buffer)
+		w := codec.NewFrameWriter(buf)
+		for _, f := range frames {
+			if err := w.WriteFrame(f); err != nil {
+				t.Fatal(name, err)
+			}
+		}
+
+		// partial reads must be handled.
+		r := codec.NewFrameReader(iotest.OneByteReader(buf))
+		for _, f := range frames {
+			got, err := r.ReadFrame()
+			if err != nil {
+				t.Fatal(name, err)
+			}
+			if !bytes.Equal(got, f) {
+				t.Error(name, `!bytes.Equal(got, f)`, string(got), string(f))
+			}
+		}
+		if _, err := r.ReadFrame(); err != io.EOF {
+			t.Error(name, `err != io.EOF`, err)
+		}
+	}
+
+	b, _ := encodeNetstring(nil, []byte("hello"))
+	if string(b) != "5:hello," {
+		t.Error(`string(b) != "5:hello,"`, string(b))
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	t.Parallel()
+
+	r := LineCodec{MaxSize: 4}.NewFrameReader(bytes.NewBufferString("abcd\r\nabcde\n"))
+	if f, err := r.ReadFrame(); err != nil || string(f) != "abcd" {
+		t.Error(`unexpected frame`, string(f), err)
+	}
+	if _, err := r.ReadFrame(); err != ErrFrameTooLarge {
+		t.Error(`err != ErrFrameTooLarge`, err)
+	}
+
+	r = LineCodec{}.NewFrameReader(bytes.NewBufferString("last"))
+	if f, err := r.ReadFrame(); err != nil || string(f) != "last" {
+		t.Error(`unexpected frame`, string(f), err)
+	}
+
+	if err := (LineCodec{}).NewFrameWriter(io.Discard).WriteFrame([]byte("a\nb")); err == nil {
+		t.Error(`newline in a frame should be rejected`)
+	}
+
+	r = LengthPrefixCodec{MaxSize: 4}.NewFrameReader(bytes.NewReader([]byte{0, 0, 0, 5, 1, 2, 3, 4, 5}))
+	if _, err := r.ReadFrame(); err != ErrFrameTooLarge {
+		t.Error(`err != ErrFrameTooLarge`, err)
+	}
+	r = LengthPrefixCodec{}.NewFrameReader(bytes.NewReader([]byte{0, 0, 0, 5, 1, 2}))
+	if _, err := r.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Error(`err != io.ErrUnexpectedEOF`, err)
+	}
+
+	for _, input := range []string{"5:hello;", "05:hello,", ":", "x:"} {
+		r = NetstringCodec{}.NewFrameReader(bytes.NewBufferString(input))
+		if _, err := r.ReadFrame(); err == nil {
+			t.Error(`invalid netstring should be rejected`, input)
+		}
+	}
+	r = NetstringCodec{MaxSize: 4}.NewFrameReader(bytes.NewBufferString("5:hello,"))
+	if _, err := r.ReadFrame(); err != ErrFrameTooLarge {
+		t.Error(`err != ErrFrameTooLarge`, err)
+	}
+}
+
+func TestServeFrames(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeFrames(ctx, c1, LineCodec{}, func(ctx context.Context, frame []byte, w FrameWriter) error {
+			return w.WriteFrame(bytes.ToUpper(frame))
+		})
+	}()
+
+	c2.Write([]byte("hello\n"))
+	line, err := bufio.NewReader(c2).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "HELLO\n" {
+		t.Error(`line != "HELLO\n"`, line)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Error(`!errors.Is(err, context.Canceled)`, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeFrames did not return")
+	}
+}
+
+func TestServeJSONLines(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	type request struct {
+		A, B int
+	}
+	type response struct {
+		Sum int `json:"sum"`
+	}
+
+	env := NewEnvironment(context.Background())
+	s := &Server{
+		Handler: func(ctx context.Context, conn net.Conn) {
+			ServeJSONLines(ctx, conn, 0, func(ctx context.Context, req request) (interface{}, error) {
+				return response{Sum: req.A + req.B}, nil
+			})
+		},
+		Env: env,
+	}
+	s.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn.Write([]byte("{\"A\":1,\"B\":2}\n\n{\"A\":3,\"B\":4}\n"))
+	br := bufio.NewReader(conn)
+	for _, expected := range []string{"{\"sum\":3}\n", "{\"sum\":7}\n"} {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expected {
+			t.Error(`line != expected`, line, expected)
+		}
+	}
+
+	env.Cancel(nil)
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+}
@@ -18,11 +18,123 @@ type Graceful struct {
 	// In case of errors, use os.Exit to exit.
 	Serve func(listeners []net.Listener)
 
+	// ListenPacket, if not nil, is a function to create packet
+	// sockets, e.g. UDP sockets for QUIC.  Like Listen, this is
+	// called in the master process and the sockets are passed to
+	// child processes.
+	ListenPacket func() ([]net.PacketConn, error)
+
+	// ServePacket is a function to serve packet sockets created by
+	// ListenPacket.  This is called in child processes before Serve,
+	// and must return without blocking, e.g. by using PacketServer.
+	//
+	// During a restart, packets are delivered to either the old or
+	// the new child until the old child closes the sockets.  As a
+	// result, connection-oriented protocols over UDP such as QUIC
+	// lose connections of the old child; see PacketServer.
+	ServePacket func(conns []net.PacketConn)
+
 	// ExitTimeout is duration before Run gives up waiting for
 	// a child to exit.  Zero disables timeout.
 	ExitTimeout time.Duration
 
+	// ReadyTimeout is duration before Run gives up waiting for
+	// a new child to become ready on restart.  Zero is treated as
+	// 1 minute.  This is ignored on Windows.
+	ReadyTimeout time.Duration
+
 	// Env is the environment for the master process.
 	// If nil, the global environment is used.
 	Env *Environment
+
+	// ChildLogFile, if not empty, is the name of files to which the
+	// master process writes the outputs of child processes as is, in
+	// addition to relaying them to its logger.  "%d" in ChildLogFile
+	// is replaced with the generation number of the child, which
+	// starts from 1 and increases on every restart.  For example,
+	// "/var/log/myapp/child-%d.log".  Files are opened in append mode.
+	//
+	// This is useful to isolate logs from the child that was just
+	// replaced by a restart.  This is ignored on Windows.
+	ChildLogFile string
+
+	// NotifyMainPID, if true, makes the master process send
+	// MAINPID=<child PID> to systemd every time it starts a child
+	// so that systemd tracks the child as the main process for
+	// watchdog and kill semantics.
+	//
+	// Since the master process is no longer the main process after
+	// the first notification, the unit must have NotifyAccess=all.
+	// This is ignored on Windows.
+	NotifyMainPID bool
+
+	// Dir, if not empty, is the working directory of child processes.
+	// Otherwise, children inherit the working directory of the master
+	// process.  This is ignored on Windows.
+	Dir string
+
+	// Umask, if not nil, is the umask of child processes, e.g. for
+	// UNIX domain sockets and temporary files created by children.
+	// Otherwise, children inherit the umask of the master process.
+	// This is ignored on Windows.
+	Umask *int
+
+	// Chroot, if not empty, makes child processes change their root
+	// directory to Chroot after inheriting listeners and before
+	// calling Serve.  The working directory is changed to the new
+	// root regardless of Dir.  Files needed by Serve, such as
+	// /etc/resolv.conf or time zone data, must be prepared in Chroot.
+	// This requires root privileges or CAP_SYS_CHROOT.
+	//
+	// Readiness of children is notified to systemd by the master
+	// process, but other notifications from children such as STATUS=
+	// cannot reach the master process after Chroot.
+	//
+	// This is ignored on Windows.
+	Chroot string
+
+	// MountNamespace, if true, runs child processes in new mount
+	// namespaces whose mounts do not propagate to and from the master
+	// process.  Combined with Chroot, this gives children a reduced
+	// view of the file system.  This requires root privileges or
+	// CAP_SYS_ADMIN.
+	//
+	// This is supported only on Linux.
+	MountNamespace bool
+
+	// SaveState, if not nil, is called in a child process after
+	// Serve returns to serialize its state, e.g. per-flow state of
+	// UDP sessions.  On restart, the returned data is handed over to
+	// RestoreState of the new child via the master process.  Data
+	// saved when the program stops is discarded.
+	//
+	// This is ignored on Windows.
+	SaveState func() ([]byte, error)
+
+	// RestoreState, if not nil, is called in a goroutine of a new
+	// child process with the data returned by SaveState of the old
+	// child.  Since the old child is stopped after the new child
+	// becomes ready, this is called while the new child is serving.
+	// This is not called if the old child has no state to hand over.
+	//
+	// This is ignored on Windows.
+	RestoreState func(data []byte)
+
+	// WatchBinary, if true, makes the master process watch the
+	// executable file of the program and restart the child gracefully
+	// as if it got SIGHUP when the file is replaced with a different
+	// content.  This allows to deploy a new version just by copying
+	// it over the old one.  Note that the master process itself keeps
+	// running the old version.
+	//
+	// This is ignored on Windows.
+	WatchBinary bool
+
+	// BinaryPath is the file to be watched for WatchBinary.
+	// If empty, the path of os.Args[0] is used.
+	BinaryPath string
+
+	// BinaryWatchInterval is the interval to check the file for
+	// WatchBinary.  Zero is treated as 5 seconds.
+	BinaryWatchInterval time.Duration
 }
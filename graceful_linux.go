@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+package well
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setMountNamespace makes the command run in a new mount namespace.
+func setMountNamespace(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNS
+	return nil
+}
+
+// makeMountsPrivate stops propagation of mount events between the
+// mount namespace of this process and others.
+func makeMountsPrivate() error {
+	return syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package well
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func setMountNamespace(cmd *exec.Cmd) error {
+	return errors.New("mount namespace is not supported")
+}
+
+func makeMountsPrivate() error {
+	return errors.New("mount namespace is not supported")
+}
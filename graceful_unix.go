@@ -4,14 +4,20 @@
 package well
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -20,10 +26,24 @@ import (
 
 const (
 	listenEnv = "CYBOZU_LISTEN_FDS"
+	packetEnv = "CYBOZU_PACKET_FDS"
+	readyEnv  = "CYBOZU_READY_FD"
 
-	restartWait = 10 * time.Millisecond
+	defaultReadyTimeout = time.Minute
 )
 
+var (
+	gracefulMasters int32
+
+	readyPipeMu sync.Mutex
+	readyPipe   *os.File
+)
+
+// gracefulRunning returns true if a graceful master is running.
+func gracefulRunning() bool {
+	return atomic.LoadInt32(&gracefulMasters) > 0
+}
+
 func isMaster() bool {
 	return len(os.Getenv(listenEnv)) == 0
 }
@@ -48,6 +68,45 @@ func listenerFiles(listeners []net.Listener) ([]*os.File, error) {
 	return files, nil
 }
 
+func packetConnFiles(conns []net.PacketConn) ([]*os.File, error) {
+	files := make([]*os.File, 0, len(conns))
+	for _, c := range conns {
+		fd, ok := c.(fileFunc)
+		if !ok {
+			return nil, errors.New("no File() method for " + c.LocalAddr().String())
+		}
+		f, err := fd.File()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// restorePacketConns restores packet sockets passed from the master
+// process.  They follow nlisteners listening sockets.
+func restorePacketConns(nlisteners int) ([]net.PacketConn, error) {
+	nfds, err := strconv.Atoi(os.Getenv(packetEnv))
+	os.Unsetenv(packetEnv)
+	if err != nil || nfds == 0 {
+		return nil, nil
+	}
+
+	conns := make([]net.PacketConn, 0, nfds)
+	for i := 0; i < nfds; i++ {
+		fd := 3 + nlisteners + i
+		f := os.NewFile(uintptr(fd), "FD"+strconv.Itoa(fd))
+		c, err := net.FilePacketConn(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, c)
+	}
+	return conns, nil
+}
+
 func restoreListeners(envvar string) ([]net.Listener, error) {
 	nfds, err := strconv.Atoi(os.Getenv(envvar))
 	defer os.Unsetenv(envvar)
@@ -72,12 +131,18 @@ func restoreListeners(envvar string) ([]net.Listener, error) {
 		if err != nil {
 			return nil, err
 		}
+		if ul, ok := l.(*net.UnixListener); ok {
+			// the socket file is owned by the master process.
+			ul.SetUnlinkOnClose(false)
+		}
 		ls = append(ls, l)
 	}
 	return ls, nil
 }
 
 // SystemdListeners returns listeners from systemd socket activation.
+// All sockets must be listening stream sockets.  To use datagram
+// sockets, use SystemdAllSockets instead.
 func SystemdListeners() ([]net.Listener, error) {
 	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
 	if err != nil {
@@ -89,13 +154,88 @@ func SystemdListeners() ([]net.Listener, error) {
 	return restoreListeners("LISTEN_FDS")
 }
 
+// openReadyPipe opens the pipe to notify the master process of the
+// readiness of this child process.
+func openReadyPipe() {
+	fd, err := strconv.Atoi(os.Getenv(readyEnv))
+	os.Unsetenv(readyEnv)
+	if err != nil {
+		return
+	}
+
+	readyPipeMu.Lock()
+	readyPipe = os.NewFile(uintptr(fd), "ready")
+	readyPipeMu.Unlock()
+}
+
+// notifyChildReady notifies the master process that this child
+// process has become ready.  Only the first call after
+// openReadyPipe does it.
+func notifyChildReady() {
+	readyPipeMu.Lock()
+	f := readyPipe
+	readyPipe = nil
+	readyPipeMu.Unlock()
+
+	if f == nil {
+		return
+	}
+	_, err := f.Write([]byte{1})
+	f.Close()
+	if err != nil {
+		log.Warn("well: failed to notify the master of readiness", map[string]interface{}{
+			log.FnError: err,
+		})
+	}
+	log.Info("well: child is ready", nil)
+}
+
+// isolate restricts the file system view of this child process.
+func (g *Graceful) isolate() error {
+	if g.MountNamespace {
+		if err := makeMountsPrivate(); err != nil {
+			return fmt.Errorf("failed to make mounts private: %w", err)
+		}
+	}
+	if len(g.Chroot) > 0 {
+		if err := syscall.Chroot(g.Chroot); err != nil {
+			return fmt.Errorf("failed to chroot to %s: %w", g.Chroot, err)
+		}
+		if err := os.Chdir("/"); err != nil {
+			return err
+		}
+		log.Info("well: changed root directory", map[string]interface{}{
+			"root": g.Chroot,
+		})
+	}
+	return nil
+}
+
 // Run runs the graceful restarting server.
 //
 // If this is the master process, Run starts a child process,
 // and installs SIGHUP handler to restarts the child process.
 //
+// On SIGHUP, the master process starts a new child and waits for it
+// to become ready before stopping the old child, so the old child
+// keeps serving until then.  If the new child exits or does not
+// become ready within ReadyTimeout, it is stopped and the old child
+// continues to serve.  By default, the new child is ready when it
+// calls g.Serve.  Call SetReady(false) before Run in the child to
+// delay this, e.g. until caches are warmed up.  See SetReady.
+// If WatchBinary is true, replacing the executable file of the
+// program also restarts the child in the same way.
+//
 // If this is a child process, Run simply calls g.Serve.
 //
+// When run as a systemd service of Type=notify, the master process
+// sends READY=1 when the child becomes ready, and RELOADING=1 when it
+// restarts the child.  Other notifications from the child, such as
+// STATUS=, are relayed by the master process.  Therefore, `systemctl reload` of
+// Type=notify-reload units gracefully restarts the child and waits
+// for the new child to be ready.  With Type=notify-reload, do not
+// set NotifyMainPID because systemd sends SIGHUP to the main process.
+//
 // Run returns immediately in the master process, and never
 // returns in the child process.
 func (g *Graceful) Run() {
@@ -108,17 +248,47 @@ func (g *Graceful) Run() {
 		return
 	}
 
+	if g.Umask != nil {
+		syscall.Umask(*g.Umask)
+	}
 	lns, err := restoreListeners(listenEnv)
 	if err != nil {
-		log.ErrorExit(err)
+		ErrorExit(err)
+	}
+	pcs, err := restorePacketConns(len(lns))
+	if err != nil {
+		ErrorExit(err)
+	}
+	if err := g.isolate(); err != nil {
+		ErrorExit(err)
 	}
 	log.DefaultLogger().SetDefaults(map[string]interface{}{
 		"pid": os.Getpid(),
 	})
 	log.Info("well: new child", nil)
+
+	openReadyPipe()
+	if IsReady() {
+		notifyChildReady()
+	}
+	state := openStateConn()
+	if state != nil && g.RestoreState != nil {
+		go g.restoreState(state)
+	}
+	if len(pcs) > 0 && g.ServePacket != nil {
+		g.ServePacket(pcs)
+	}
+	markChildServing()
 	g.Serve(lns)
+	if state != nil {
+		if g.SaveState != nil {
+			g.saveState(state)
+		}
+		state.Close()
+	}
 
 	// child process should not return.
+	FlushLogs()
 	os.Exit(0)
 }
 
@@ -135,13 +305,32 @@ func (g *Graceful) runMaster(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	if len(files) == 0 {
+	var pfiles []*os.File
+	if g.ListenPacket != nil {
+		conns, err := g.ListenPacket()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		pfiles, err = packetConnFiles(conns)
+		if err != nil {
+			return err
+		}
+	}
+	if len(files) == 0 && len(pfiles) == 0 {
 		return errors.New("no listener")
 	}
 	defer func() {
 		for _, f := range files {
 			f.Close()
 		}
+		for _, f := range pfiles {
+			f.Close()
+		}
 		// we cannot close listeners no sooner than this point
 		// because net.UnixListener removes the socket file on Close.
 		for _, l := range listeners {
@@ -149,101 +338,308 @@ func (g *Graceful) runMaster(ctx context.Context) error {
 		}
 	}()
 
+	relay, err := newNotifyRelay()
+	if err != nil {
+		return err
+	}
+	notifySocket := ""
+	if relay != nil {
+		defer relay.Close()
+		notifySocket = relay.path()
+	}
+
 	sighup := make(chan os.Signal, 2)
 	signal.Notify(sighup, syscall.SIGHUP)
+	g.startBinaryWatch(ctx, sighup)
+	atomic.AddInt32(&gracefulMasters, 1)
+	defer atomic.AddInt32(&gracefulMasters, -1)
 
-RESTART:
-	child := g.makeChild(files)
-	clog, err := child.StderrPipe()
+	generation := 1
+	child, err := g.startChild(logger, files, pfiles, notifySocket, generation)
 	if err != nil {
 		return err
 	}
-	copyDone := make(chan struct{})
-	// clog will be closed on child.Wait().
-	go copyLog(logger, clog, copyDone)
+	g.notifyMainPID(logger, child)
+	defer func() {
+		child.closeState()
+	}()
+
+	for {
+		select {
+		case err := <-child.done:
+			return err
+		case <-sighup:
+			if ctx.Err() != nil {
+				continue
+			}
+			// READY=1 sent when the new child becomes ready completes
+			// reloading.
+			notifyReloading()
+			log.Warn("well: got sighup", nil)
 
-	done := make(chan error, 1)
-	err = child.Start()
+			generation++
+			if relay != nil {
+				relay.setRestarts(generation - 1)
+			}
+			next, err := g.startChild(logger, files, pfiles, notifySocket, generation)
+			if err != nil {
+				logger.Error("well: failed to start a new child", map[string]interface{}{
+					log.FnError: err,
+				})
+				SdNotify("READY=1")
+				continue
+			}
+			if !g.waitReady(ctx, logger, next) {
+				next.closeState()
+				SdNotify("READY=1")
+				continue
+			}
+
+			// systemd must track the new child before the old one
+			// exits, or it may consider the service dead.
+			g.notifyMainPID(logger, next)
+			child.cmd.Process.Signal(syscall.SIGTERM)
+			if child.state != nil {
+				go handoverState(child.state, next.state)
+			}
+			child = next
+			atomic.AddInt64(&gracefulRestarts, 1)
+			emitEvent(Event{Type: EventRestarted, PID: child.cmd.Process.Pid, Generation: generation})
+		case <-ctx.Done():
+			child.cmd.Process.Signal(syscall.SIGTERM)
+			stop := extendStopTimeout()
+			defer stop()
+			if g.ExitTimeout == 0 {
+				<-child.done
+				return nil
+			}
+			timer := ClockFromContext(ctx).NewTimer(g.ExitTimeout)
+			defer timer.Stop()
+			select {
+			case <-child.done:
+				return nil
+			case <-timer.C():
+				logger.Warn("well: timeout child exit", nil)
+				return nil
+			}
+		}
+	}
+}
+
+// childProcess is a child process started by the master process.
+type childProcess struct {
+	cmd *exec.Cmd
+
+	// done receives the result of Wait.
+	done chan error
+
+	// ready is closed when the child becomes ready.
+	ready chan struct{}
+
+	// state is the connection to hand over state, if any.
+	state net.Conn
+}
+
+func (c *childProcess) closeState() {
+	if c.state != nil {
+		c.state.Close()
+	}
+}
+
+func (g *Graceful) startChild(logger *log.Logger, files, pfiles []*os.File, notifySocket string, generation int) (*childProcess, error) {
+	pr, pw, err := os.Pipe()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer pw.Close()
+
+	var state net.Conn
+	var stateFile *os.File
+	if g.handlesState() {
+		state, stateFile, err = stateSocketPair()
+		if err != nil {
+			pr.Close()
+			return nil, err
+		}
+		defer stateFile.Close()
+	}
+
+	cmd := g.makeChild(files, pfiles, notifySocket, pw, stateFile)
+	if g.MountNamespace {
+		err = setMountNamespace(cmd)
+	}
+	var clog io.ReadCloser
+	if err == nil {
+		clog, err = cmd.StderrPipe()
+	}
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		pr.Close()
+		if state != nil {
+			state.Close()
+		}
+		return nil, err
+	}
+
+	child := &childProcess{
+		cmd:   cmd,
+		done:  make(chan error, 1),
+		ready: make(chan struct{}),
+		state: state,
+	}
+	pid := cmd.Process.Pid
+	emitEvent(Event{Type: EventChildStarted, PID: pid, Generation: generation})
+
+	go func() {
+		defer pr.Close()
+		var buf [1]byte
+		if n, _ := pr.Read(buf[:]); n > 0 {
+			close(child.ready)
+
+			// the master notifies systemd on behalf of the child, whose
+			// NOTIFY_SOCKET may be unreachable, e.g. after Chroot.
+			if _, err := SdNotify("READY=1"); err != nil {
+				logger.Warn("well: failed to notify readiness", map[string]interface{}{
+					log.FnError: err,
+				})
+			}
+		}
+	}()
+
+	var childLog io.WriteCloser
+	if len(g.ChildLogFile) > 0 {
+		name := strings.ReplaceAll(g.ChildLogFile, "%d", strconv.Itoa(generation))
+		childLog, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			logger.Error("well: failed to open child log file", map[string]interface{}{
+				log.FnError: err,
+				"filename":  name,
+			})
+			childLog = nil
+		}
 	}
+
+	copyDone := make(chan struct{})
+	// clog will be closed on cmd.Wait().
+	go copyLog(logger, clog, map[string]interface{}{
+		"pid":        pid,
+		"generation": generation,
+	}, childLog, copyDone)
 	go func() {
 		<-copyDone
-		done <- child.Wait()
+		err := cmd.Wait()
+		emitEvent(Event{Type: EventChildExited, PID: pid, Generation: generation, Err: err})
+		child.done <- err
 	}()
 
+	return child, nil
+}
+
+// waitReady waits for a new child to become ready.  If the child
+// exits, does not become ready within ReadyTimeout, or ctx is
+// canceled, this stops the child and returns false.
+func (g *Graceful) waitReady(ctx context.Context, logger *log.Logger, child *childProcess) bool {
+	timeout := g.ReadyTimeout
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	timer := ClockFromContext(ctx).NewTimer(timeout)
+	defer timer.Stop()
+
+	pid := child.cmd.Process.Pid
 	select {
-	case err := <-done:
-		return err
-	case <-sighup:
-		child.Process.Signal(syscall.SIGTERM)
-		log.Warn("well: got sighup", nil)
-		time.Sleep(restartWait)
-		goto RESTART
-	case <-ctx.Done():
-		child.Process.Signal(syscall.SIGTERM)
-		if g.ExitTimeout == 0 {
-			<-done
-			return nil
+	case <-child.ready:
+		return true
+	case err := <-child.done:
+		fields := map[string]interface{}{
+			"pid": pid,
 		}
-		select {
-		case <-done:
-			return nil
-		case <-time.After(g.ExitTimeout):
-			logger.Warn("well: timeout child exit", nil)
-			return nil
+		if err != nil {
+			fields[log.FnError] = err.Error()
 		}
+		logger.Error("well: new child exited before ready", fields)
+		return false
+	case <-timer.C():
+		logger.Error("well: new child did not become ready", map[string]interface{}{
+			"pid":     pid,
+			"timeout": timeout.String(),
+		})
+	case <-ctx.Done():
+	}
+
+	child.cmd.Process.Signal(syscall.SIGTERM)
+	return false
+}
+
+func (g *Graceful) notifyMainPID(logger *log.Logger, child *childProcess) {
+	if !g.NotifyMainPID {
+		return
+	}
+	_, err := SdNotify("MAINPID=" + strconv.Itoa(child.cmd.Process.Pid))
+	if err != nil {
+		logger.Warn("well: failed to notify main PID", map[string]interface{}{
+			log.FnError: err,
+		})
 	}
 }
 
-func (g *Graceful) makeChild(files []*os.File) *exec.Cmd {
-	child := exec.Command(os.Args[0], os.Args[1:]...)
+func (g *Graceful) makeChild(files, pfiles []*os.File, notifySocket string, readyPipe, stateFile *os.File) *exec.Cmd {
+	name := os.Args[0]
+	if len(g.Dir) > 0 && strings.Contains(name, "/") && !filepath.IsAbs(name) {
+		// a relative path would be evaluated relative to Dir.
+		if abs, err := filepath.Abs(name); err == nil {
+			name = abs
+		}
+	}
+	child := exec.Command(name, os.Args[1:]...)
+	child.Dir = g.Dir
 	child.Env = os.Environ()
 	child.Env = append(child.Env, listenEnv+"="+strconv.Itoa(len(files)))
-	child.ExtraFiles = files
+	child.Env = append(child.Env, packetEnv+"="+strconv.Itoa(len(pfiles)))
+	child.Env = append(child.Env, readyEnv+"="+strconv.Itoa(3+len(files)+len(pfiles)))
+	if len(notifySocket) > 0 {
+		// exec.Cmd uses the last value for duplicate keys.
+		child.Env = append(child.Env, notifySocketEnv+"="+notifySocket)
+	}
+	child.ExtraFiles = append(files[:len(files):len(files)], pfiles...)
+	child.ExtraFiles = append(child.ExtraFiles, readyPipe)
+	if stateFile != nil {
+		child.Env = append(child.Env, stateEnv+"="+strconv.Itoa(3+len(child.ExtraFiles)))
+		child.ExtraFiles = append(child.ExtraFiles, stateFile)
+	}
 	return child
 }
 
-func copyLog(logger *log.Logger, r io.Reader, done chan<- struct{}) {
+// copyLog relays logs from a child process to logger line by line.
+// See relayLog for details.
+//
+// If w is not nil, lines are also written to w as is, and w is
+// closed when r is exhausted.
+func copyLog(logger *log.Logger, r io.Reader, annotations map[string]interface{}, w io.WriteCloser, done chan<- struct{}) {
 	defer func() {
+		if w != nil {
+			w.Close()
+		}
 		close(done)
 	}()
 
-	var unwritten []byte
-	buf := make([]byte, 1<<20)
-
+	br := bufio.NewReaderSize(r, maxLogSize)
 	for {
-		n, err := r.Read(buf)
-		if err != nil {
-			if len(unwritten) == 0 {
-				if n > 0 {
-					logger.WriteThrough(buf[0:n])
-				}
-				return
-			}
-			unwritten = append(unwritten, buf[0:n]...)
-			logger.WriteThrough(unwritten)
-			return
-		}
-		if n == 0 {
-			continue
-		}
-		if buf[n-1] != '\n' {
-			unwritten = append(unwritten, buf[0:n]...)
-			continue
+		// ReadSlice returns bufio.ErrBufferFull for too long lines.
+		// Such lines are relayed in pieces.
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 && w != nil {
+			w.Write(line)
 		}
-		if len(unwritten) == 0 {
-			err = logger.WriteThrough(buf[0:n])
-			if err != nil {
+		if len(line) > 0 {
+			if err := relayLog(logger, line, annotations); err != nil {
 				return
 			}
-			continue
 		}
-		unwritten = append(unwritten, buf[0:n]...)
-		err = logger.WriteThrough(unwritten)
-		if err != nil {
+		if err != nil && err != bufio.ErrBufferFull {
 			return
 		}
-		unwritten = unwritten[:0]
 	}
 }
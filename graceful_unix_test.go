@@ -5,7 +5,10 @@ package well
 
 import (
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sync/atomic"
 	"testing"
 )
 
@@ -29,3 +32,65 @@ func TestListenerFiles(t *testing.T) {
 		t.Error(`len(fl) != 1`)
 	}
 }
+
+func TestMakeChildDir(t *testing.T) {
+	args := os.Args
+	defer func() {
+		os.Args = args
+	}()
+	os.Args = []string{"./prog", "arg"}
+
+	g := &Graceful{Dir: "/tmp"}
+	cmd := g.makeChild(nil, nil, "", os.Stdin, nil)
+	if cmd.Dir != "/tmp" {
+		t.Error(`cmd.Dir != "/tmp"`, cmd.Dir)
+	}
+	if !filepath.IsAbs(cmd.Path) {
+		t.Error(`!filepath.IsAbs(cmd.Path)`, cmd.Path)
+	}
+
+	g = &Graceful{}
+	cmd = g.makeChild(nil, nil, "", os.Stdin, nil)
+	if cmd.Path != "./prog" || len(cmd.Dir) != 0 {
+		t.Error(`cmd.Path != "./prog" || len(cmd.Dir) != 0`, cmd.Path, cmd.Dir)
+	}
+}
+
+func TestMarkChildServing(t *testing.T) {
+	manual := atomic.LoadInt32(&readyManual)
+	defer func() {
+		atomic.StoreInt32(&readyManual, manual)
+		readyPipeMu.Lock()
+		readyPipe = nil
+		readyPipeMu.Unlock()
+	}()
+
+	for _, m := range []int32{1, 0} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		atomic.StoreInt32(&readyManual, m)
+		readyPipeMu.Lock()
+		readyPipe = w
+		readyPipeMu.Unlock()
+
+		markChildServing()
+		readyPipeMu.Lock()
+		if readyPipe != nil {
+			readyPipe.Close()
+			readyPipe = nil
+		}
+		readyPipeMu.Unlock()
+
+		buf := make([]byte, 1)
+		n, _ := r.Read(buf)
+		r.Close()
+		if m == 1 && n != 0 {
+			t.Error(`child was ready before SetReady(true)`)
+		}
+		if m == 0 && (n != 1 || buf[0] != 1) {
+			t.Error(`child was not ready on serving`, n, buf[0])
+		}
+	}
+}
@@ -3,17 +3,39 @@
 
 package well
 
-import "net"
+import (
+	"net"
+	"os"
+)
 
 func isMaster() bool {
 	return true
 }
 
+func gracefulRunning() bool {
+	return false
+}
+
+func notifyChildReady() {}
+
 // SystemdListeners returns (nil, nil) on Windows.
 func SystemdListeners() ([]net.Listener, error) {
 	return nil, nil
 }
 
+// SystemdSockets is a set of sockets passed by systemd socket activation.
+// This is not used on Windows.
+type SystemdSockets struct {
+	Listeners   []net.Listener
+	PacketConns []net.PacketConn
+	Files       []*os.File
+}
+
+// SystemdAllSockets returns (nil, nil) on Windows.
+func SystemdAllSockets() (*SystemdSockets, error) {
+	return nil, nil
+}
+
 // Run simply calls g.Listen then g.Serve on Windows.
 func (g *Graceful) Run() {
 	env := g.Env
@@ -27,5 +49,15 @@ func (g *Graceful) Run() {
 		env.Cancel(err)
 		return
 	}
+	if g.ListenPacket != nil {
+		conns, err := g.ListenPacket()
+		if err != nil {
+			env.Cancel(err)
+			return
+		}
+		if g.ServePacket != nil {
+			g.ServePacket(conns)
+		}
+	}
 	g.Serve(listeners)
 }
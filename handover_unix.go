@@ -0,0 +1,156 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	stateEnv = "CYBOZU_STATE_FD"
+
+	// maxStateSize limits the size of state handed over on restart.
+	maxStateSize = 256 << 20
+)
+
+// stateSocketPair creates a pair of connected UNIX domain sockets.
+// The first is for the master process, and the second is for a child.
+func stateSocketPair() (net.Conn, *os.File, error) {
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, nil, os.NewSyscallError("socketpair", err)
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "state")
+	defer f.Close()
+	conn, err := net.FileConn(f)
+	if err != nil {
+		syscall.Close(fds[1])
+		return nil, nil, err
+	}
+	return conn, os.NewFile(uintptr(fds[1]), "state"), nil
+}
+
+func writeState(w io.Writer, data []byte) error {
+	var hdr [8]byte
+	binary.BigEndian.PutUint64(hdr[:], uint64(len(data)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readState(r io.Reader) ([]byte, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint64(hdr[:])
+	if n > maxStateSize {
+		return nil, errors.New("too large state: " + strconv.FormatUint(n, 10))
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// handoverState relays the state saved by the old child to the new
+// child.  The connection to the old child is closed.
+func handoverState(old, next net.Conn) {
+	defer old.Close()
+
+	data, err := readState(old)
+	if err != nil {
+		if err != io.EOF {
+			log.Warn("well: failed to receive state from the old child", map[string]interface{}{
+				log.FnError: err,
+			})
+		}
+		return
+	}
+	if err := writeState(next, data); err != nil {
+		log.Warn("well: failed to hand over state to the new child", map[string]interface{}{
+			log.FnError: err,
+		})
+		return
+	}
+	log.Info("well: handed over state", map[string]interface{}{
+		"size": len(data),
+	})
+}
+
+// openStateConn opens the connection to the master process to hand
+// over state, or returns nil if the master did not set it up.
+func openStateConn() net.Conn {
+	fd, err := strconv.Atoi(os.Getenv(stateEnv))
+	os.Unsetenv(stateEnv)
+	if err != nil {
+		return nil
+	}
+
+	f := os.NewFile(uintptr(fd), "state")
+	defer f.Close()
+	conn, err := net.FileConn(f)
+	if err != nil {
+		log.Warn("well: failed to open state connection", map[string]interface{}{
+			log.FnError: err,
+		})
+		return nil
+	}
+	return conn
+}
+
+// restoreState receives state from the old child via conn and calls
+// g.RestoreState with it.
+func (g *Graceful) restoreState(conn net.Conn) {
+	data, err := readState(conn)
+	if err != nil {
+		// EOF means no state was handed over, and ErrClosed means
+		// the child is exiting.
+		if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+			log.Warn("well: failed to receive state", map[string]interface{}{
+				log.FnError: err,
+			})
+		}
+		return
+	}
+	g.RestoreState(data)
+}
+
+// saveState calls g.SaveState and sends the result to the master.
+func (g *Graceful) saveState(conn net.Conn) {
+	data, err := g.SaveState()
+	if err != nil {
+		log.Error("well: failed to save state", map[string]interface{}{
+			log.FnError: err,
+		})
+		return
+	}
+	if err := writeState(conn, data); err != nil {
+		log.Error("well: failed to send state", map[string]interface{}{
+			log.FnError: err,
+		})
+	}
+}
+
+func (g *Graceful) handlesState() bool {
+	return g.SaveState != nil || g.RestoreState != nil
+}
@@ -0,0 +1,62 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestStateFrame(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	if err := writeState(buf, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := readState(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Error(`string(data) != "hello"`, string(data))
+	}
+
+	var hdr [8]byte
+	binary.BigEndian.PutUint64(hdr[:], maxStateSize+1)
+	if _, err := readState(bytes.NewReader(hdr[:])); err == nil {
+		t.Error(`too large state should be rejected`)
+	}
+}
+
+func TestHandoverState(t *testing.T) {
+	t.Parallel()
+
+	oldMaster, oldChild, err := stateSocketPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldConn, err := net.FileConn(oldChild)
+	oldChild.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newMaster, newConn := net.Pipe()
+
+	go func() {
+		writeState(oldConn, []byte("flows"))
+		oldConn.Close()
+	}()
+	go handoverState(oldMaster, newMaster)
+
+	data, err := readState(newConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "flows" {
+		t.Error(`string(data) != "flows"`, string(data))
+	}
+}
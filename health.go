@@ -0,0 +1,190 @@
+package well
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultHealthCheckTimeout = 5 * time.Second
+)
+
+var (
+	healthMu     sync.Mutex
+	healthChecks = make(map[string]*healthCheck)
+)
+
+type healthCheck struct {
+	timeout time.Duration
+	f       func(ctx context.Context) error
+
+	// the last result protected by healthMu.
+	checked bool
+	err     error
+}
+
+// HealthResult is the result of a health check.
+type HealthResult struct {
+	Name     string        `json:"name"`
+	Healthy  bool          `json:"healthy"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// RegisterHealthCheck registers a health check f named name.
+// If a check of the same name exists, it is replaced.
+//
+// f is called by CheckHealth with a context that is canceled after
+// timeout, and should return non-nil error if the component is not
+// healthy.  Zero or negative timeout is treated as 5 seconds.
+func RegisterHealthCheck(name string, timeout time.Duration, f func(ctx context.Context) error) {
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+
+	healthMu.Lock()
+	healthChecks[name] = &healthCheck{timeout: timeout, f: f}
+	healthMu.Unlock()
+}
+
+// UnregisterHealthCheck removes the health check named name.
+func UnregisterHealthCheck(name string) {
+	healthMu.Lock()
+	delete(healthChecks, name)
+	healthMu.Unlock()
+}
+
+// CheckHealth runs all registered health checks concurrently and
+// returns their results sorted by name.
+//
+// A check that does not return within its timeout is reported as
+// unhealthy without waiting for it.
+func CheckHealth(ctx context.Context) []HealthResult {
+	healthMu.Lock()
+	checks := make(map[string]*healthCheck, len(healthChecks))
+	for name, hc := range healthChecks {
+		checks[name] = hc
+	}
+	healthMu.Unlock()
+
+	results := make([]HealthResult, 0, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, hc := range checks {
+		wg.Add(1)
+		go func(name string, hc *healthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := hc.run(ctx)
+			r := HealthResult{
+				Name:     name,
+				Healthy:  err == nil,
+				Duration: time.Since(start),
+			}
+			if err != nil {
+				r.Error = err.Error()
+			}
+
+			healthMu.Lock()
+			hc.checked = true
+			hc.err = err
+			healthMu.Unlock()
+
+			mu.Lock()
+			results = append(results, r)
+			mu.Unlock()
+		}(name, hc)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+func (hc *healthCheck) run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.timeout)
+	defer cancel()
+
+	ch := make(chan error, 1)
+	go func() {
+		ch <- hc.f(ctx)
+	}()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HealthHandler returns an http.Handler that runs CheckHealth and
+// responds the results in JSON with 200 OK if all checks pass, or
+// 503 Service Unavailable otherwise.  Unhealthy checks are logged.
+//
+// The handler can be served on any listener including a UNIX domain
+// socket by HTTPServer.
+func HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results := CheckHealth(r.Context())
+
+		status := http.StatusOK
+		for _, res := range results {
+			if res.Healthy {
+				continue
+			}
+			status = http.StatusServiceUnavailable
+			log.Warn("well: health check failed", map[string]interface{}{
+				"name":      res.Name,
+				log.FnError: res.Error,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(results)
+	})
+}
+
+// hasHealthChecks returns true if any health checks are registered.
+func hasHealthChecks() bool {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	return len(healthChecks) > 0
+}
+
+// healthStatus returns a human-readable summary of the last results
+// of health checks, or an empty string if no checks have run.
+func healthStatus() string {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	var checked int
+	var failed []string
+	for name, hc := range healthChecks {
+		if !hc.checked {
+			continue
+		}
+		checked++
+		if hc.err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if checked == 0 {
+		return ""
+	}
+	if len(failed) == 0 {
+		return "healthy"
+	}
+	sort.Strings(failed)
+	return "unhealthy: " + strings.Join(failed, " ")
+}
@@ -0,0 +1,73 @@
+package well
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	defer func() {
+		UnregisterHealthCheck("ok")
+		UnregisterHealthCheck("fail")
+		UnregisterHealthCheck("slow")
+	}()
+
+	RegisterHealthCheck("ok", 0, func(ctx context.Context) error {
+		return nil
+	})
+	if status := healthStatus(); status != "" {
+		t.Error(`status != ""`, status)
+	}
+
+	w := httptest.NewRecorder()
+	HealthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != 200 {
+		t.Error(`w.Code != 200`, w.Code)
+	}
+	if status := healthStatus(); status != "healthy" {
+		t.Error(`status != "healthy"`, status)
+	}
+
+	RegisterHealthCheck("fail", 0, func(ctx context.Context) error {
+		return errors.New("broken")
+	})
+	RegisterHealthCheck("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	w = httptest.NewRecorder()
+	HealthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error(`timeout did not work`, time.Since(start))
+	}
+	if w.Code != 503 {
+		t.Error(`w.Code != 503`, w.Code)
+	}
+
+	var results []HealthResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatal(`len(results) != 3`, results)
+	}
+	if results[0].Name != "fail" || results[0].Healthy || results[0].Error != "broken" {
+		t.Error(`unexpected result`, results[0])
+	}
+	if results[1].Name != "ok" || !results[1].Healthy {
+		t.Error(`unexpected result`, results[1])
+	}
+	if results[2].Name != "slow" || results[2].Healthy {
+		t.Error(`unexpected result`, results[2])
+	}
+
+	if status := healthStatus(); status != "unhealthy: fail slow" {
+		t.Error(`status != "unhealthy: fail slow"`, status)
+	}
+}
@@ -0,0 +1,73 @@
+package well
+
+import "sort"
+
+// DefaultHistogramBuckets are the upper bounds of histogram buckets
+// of latencies in seconds.
+var DefaultHistogramBuckets = []float64{
+	0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// HistogramSnapshot is a snapshot of a histogram.
+//
+// Counts[i] is the cumulative number of observations less than or
+// equal to Buckets[i].  Count is the total number of observations
+// including those greater than the last bucket, and Sum is the sum
+// of observations.
+type HistogramSnapshot struct {
+	Buckets []float64 `json:"buckets"`
+	Counts  []int64   `json:"counts"`
+	Count   int64     `json:"count"`
+	Sum     float64   `json:"sum"`
+}
+
+// Average returns the average of observations, or zero if none.
+func (s HistogramSnapshot) Average() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// histogram is a histogram with fixed buckets.
+// This is not safe for concurrent use.
+type histogram struct {
+	buckets []float64
+	counts  []int64
+	count   int64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	if buckets == nil {
+		buckets = DefaultHistogramBuckets
+	}
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]int64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{
+		Buckets: h.buckets,
+		Counts:  make([]int64, len(h.counts)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+	var cum int64
+	for i, c := range h.counts {
+		cum += c
+		s.Counts[i] = cum
+	}
+	return s
+}
@@ -0,0 +1,30 @@
+package well
+
+import "testing"
+
+func TestHistogram(t *testing.T) {
+	t.Parallel()
+
+	h := newHistogram([]float64{1, 2, 4})
+	for _, v := range []float64{0.5, 1, 1.5, 3, 5} {
+		h.observe(v)
+	}
+
+	s := h.snapshot()
+	expected := []int64{2, 3, 4}
+	for i, c := range expected {
+		if s.Counts[i] != c {
+			t.Error(`unexpected counts`, s.Counts)
+			break
+		}
+	}
+	if s.Count != 5 {
+		t.Error(`s.Count != 5`, s.Count)
+	}
+	if s.Sum != 11 {
+		t.Error(`s.Sum != 11`, s.Sum)
+	}
+	if s.Average() != 2.2 {
+		t.Error(`s.Average() != 2.2`, s.Average())
+	}
+}
@@ -7,11 +7,13 @@ import (
 	"context"
 	"crypto/tls"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cybozu-go/log"
@@ -50,7 +52,7 @@ func RequestIDHeader() string {
 // http.Server members are replaced as following:
 //   - Handler is replaced with a wrapper handler that logs requests.
 //   - ReadTimeout is set to 30 seconds if it is zero.
-//   - ConnState is replaced with the one provided by the framework.
+//   - ConnState is wrapped to count active connections.
 type HTTPServer struct {
 	*http.Server
 
@@ -59,11 +61,30 @@ type HTTPServer struct {
 	AccessLog *log.Logger
 
 	// ShutdownTimeout is the maximum duration the server waits for
-	// all connections to be closed before shutdown.
+	// all connections to be closed before shutdown.  Connections still
+	// open after that are closed forcibly.
 	//
 	// Zero duration disables timeout.
+	//
+	// HTTP/2 clients are sent GOAWAY as soon as the server starts
+	// draining, so that they send new requests over new connections,
+	// e.g. to the new child of Graceful, while their in-flight streams
+	// continue until ShutdownTimeout.
+	//
+	// When run as a systemd service, EXTEND_TIMEOUT_USEC is sent
+	// periodically while waiting so that systemd does not kill the
+	// service by TimeoutStopSec.
 	ShutdownTimeout time.Duration
 
+	// Compression enables compression of responses if not nil.
+	// Access logs of compressed responses record "content_encoding",
+	// "uncompressed_size", and "compression_ratio" in addition to
+	// the response size on the wire.
+	Compression *CompressionConfig
+
+	// CORS enables Cross-Origin Resource Sharing if not nil.
+	CORS *CORSConfig
+
 	// Env is the environment where this server runs.
 	//
 	// The global environment is used if Env is nil.
@@ -73,6 +94,9 @@ type HTTPServer struct {
 	shutdownErr error
 	generator   *IDGenerator
 
+	fcgiMu        sync.Mutex
+	fcgiListeners []*fcgiListener
+
 	initOnce sync.Once
 }
 
@@ -172,6 +196,37 @@ func (w *logResponseWriter2) Size() int64 {
 	return w.size
 }
 
+type logResponseWriterBasic struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *logResponseWriterBasic) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *logResponseWriterBasic) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *logResponseWriterBasic) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *logResponseWriterBasic) Status() int {
+	return w.status
+}
+
+func (w *logResponseWriterBasic) Size() int64 {
+	return w.size
+}
+
 func createLogWriter(w http.ResponseWriter) (http.ResponseWriter, logWriter) {
 	if srw1, ok := w.(StdResponseWriter); ok {
 		t := &logResponseWriter{srw1, http.StatusOK, 0}
@@ -183,26 +238,47 @@ func createLogWriter(w http.ResponseWriter) (http.ResponseWriter, logWriter) {
 		return t, t
 	}
 
-	panic("unexpected ResponseWriter implementation")
+	// e.g. FastCGI
+	t := &logResponseWriterBasic{w, http.StatusOK, 0}
+	return t, t
 }
 
 // ServeHTTP implements http.Handler interface.
 func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
+	atomic.AddInt64(&activeRequests, 1)
+	defer atomic.AddInt64(&activeRequests, -1)
 
 	w, lw := createLogWriter(w)
 
 	ctx, cancel := context.WithCancel(s.Env.ctx)
 	defer cancel()
 
+	if tc, ok := traceContextFromRequest(r); ok {
+		ctx = WithTraceContext(ctx, tc)
+	}
 	reqid := r.Header.Get(requestIDHeader)
 	if len(reqid) == 0 {
-		reqid = s.generator.Generate()
+		reqid = newActivityID(ctx, s.generator)
 	}
 	ctx = WithRequestID(ctx, reqid)
 
-	s.handler.ServeHTTP(w, r.WithContext(ctx))
+	var cw *compressResponseWriter
+	if s.Compression != nil {
+		if enc := s.Compression.negotiate(r); enc != "" {
+			cw = newCompressResponseWriter(w, s.Compression, enc)
+			w = cw
+		}
+	}
+
+	if s.CORS == nil || !s.CORS.handle(w, r) {
+		s.handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+	if cw != nil {
+		cw.close()
+	}
 	status := lw.Status()
+	observeHTTPRequest(time.Since(startTime))
 
 	fields := map[string]interface{}{
 		log.FnType:           "access",
@@ -226,6 +302,13 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if len(reqid) > 0 {
 		fields[log.FnRequestID] = reqid
 	}
+	if cw != nil && cw.compressed {
+		fields["content_encoding"] = cw.encoding
+		fields["uncompressed_size"] = cw.size
+		if cw.size > 0 {
+			fields["compression_ratio"] = float64(lw.Size()) / float64(cw.size)
+		}
+	}
 
 	lv := log.LvInfo
 	switch {
@@ -239,15 +322,31 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (s *HTTPServer) init() {
 	s.generator = NewIDGenerator()
+	startStatusNotifier()
 
 	if s.Server.Handler == nil {
 		panic("Handler must not be nil")
 	}
+	if s.CORS != nil && s.CORS.AllowCredentials && s.CORS.anyOrigin() {
+		panic("CORS: AllowCredentials cannot be used with \"*\" origin")
+	}
 	s.handler = s.Server.Handler
 	s.Server.Handler = s
 	if s.Server.ReadTimeout == 0 {
 		s.Server.ReadTimeout = defaultHTTPReadTimeout
 	}
+	connState := s.Server.ConnState
+	s.Server.ConnState = func(c net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			atomic.AddInt64(&activeConns, 1)
+		case http.StateHijacked, http.StateClosed:
+			atomic.AddInt64(&activeConns, -1)
+		}
+		if connState != nil {
+			connState(c, state)
+		}
+	}
 
 	if s.AccessLog == nil {
 		s.AccessLog = log.DefaultLogger()
@@ -265,14 +364,27 @@ func (s *HTTPServer) wait(ctx context.Context) error {
 
 	s.Server.SetKeepAlivesEnabled(false)
 
-	ctx = context.Background()
+	done := StartDraining()
+	defer done()
+
+	// keep values such as Clock, but not the cancellation.
+	ctx = valueContext{Context: context.Background(), parent: ctx}
 	if s.ShutdownTimeout != 0 {
-		ctx2, cancel := context.WithTimeout(ctx, s.ShutdownTimeout)
+		ctx2, cancel := withClockTimeout(ctx, s.ShutdownTimeout)
 		defer cancel()
 		ctx = ctx2
 	}
 
+	// Shutdown sends GOAWAY to HTTP/2 connections, then waits for
+	// HTTP/1 and HTTP/2 connections to become idle.
 	err := s.Server.Shutdown(ctx)
+	if err != nil {
+		// the hard-close deadline.
+		s.Server.Close()
+	}
+	if ferr := s.drainFastCGI(ctx); err == nil {
+		err = ferr
+	}
 	if err != nil {
 		log.Warn("well: unclean shutdown", map[string]interface{}{
 			log.FnError: err,
@@ -306,6 +418,7 @@ func (s *HTTPServer) Serve(l net.Listener) error {
 		s.Server.Serve(l)
 	}()
 
+	markReady(s.Env)
 	return nil
 }
 
@@ -376,6 +489,15 @@ func (s *HTTPServer) ListenAndServeTLS(certFile, keyFile string) error {
 // the passed request's context brings a request tracking ID.  Do
 // also records the request log to Logger.
 //
+// Contexts given to HTTPServer handlers, Server handlers, and functions
+// started by GoWithID have request tracking IDs, so requests made with
+// them are tracked across services without extra code.
+//
+// W3C Trace Context headers, traceparent and tracestate, are also
+// added from TraceContext in the context, or derived from the request
+// tracking ID.  HTTPServer puts TraceContext of incoming requests in
+// the context of handlers.
+//
 // Do not use Get/Head/Post/PostForm.  They panics.
 type HTTPClient struct {
 	*http.Client
@@ -388,40 +510,180 @@ type HTTPClient struct {
 	// Errors are always logged with log.LvError.
 	Severity int
 
+	// ClientErrorSeverity is used to log responses with status 4xx.
+	// Zero means Severity.
+	ClientErrorSeverity int
+
+	// ServerErrorSeverity is used to log responses with status 5xx.
+	// Zero means Severity.
+	ServerErrorSeverity int
+
+	// SampleRate is the fraction of responses with status less than
+	// 400 to be logged, e.g. 0.01 logs 1% of them.
+	// Zero or values not less than 1 log all.
+	SampleRate float64
+
+	// Fields are added to every request log of this client.
+	Fields map[string]interface{}
+
 	// Logger for HTTP request.  If nil, the default logger is used.
 	Logger *log.Logger
+
+	// DefaultTimeout is the time limit for requests including retries
+	// and reading the response body.  This is applied only when the
+	// request context has no deadline and Client.Timeout is zero.
+	// Use WithRequestTimeout to override the time limit per request.
+	//
+	// Zero limits the time until the response headers are received,
+	// including dialing and retries, to 1 minute.  Reading the response
+	// body is not limited so that streaming responses are not cut off.
+	// Negative disables the time limit.
+	DefaultTimeout time.Duration
+
+	// DrainTimeout, if positive, lets requests in flight continue for
+	// the duration after Env is canceled, even if their contexts are
+	// canceled by the cancellation of Env.  Requests canceled by other
+	// reasons are aborted immediately.  Idle connections are closed
+	// when all requests complete after Env is canceled.
+	DrainTimeout time.Duration
+
+	// RequestIDHeader is the name of the header to send the request
+	// tracking ID.  If empty, the value of RequestIDHeader function
+	// is used.
+	RequestIDHeader string
+
+	// Retry configures automatic retries.  If nil, requests are
+	// not retried.
+	Retry *RetryPolicy
+
+	// Hedge, if not nil, sends a second attempt of slow requests.
+	Hedge *HedgePolicy
+
+	// Metrics, if not nil, collects per-host metrics of requests.
+	Metrics *ClientMetrics
+
+	// CircuitBreaker, if not nil, makes requests to failing hosts
+	// fail immediately with ErrCircuitOpen.
+	CircuitBreaker *CircuitBreaker
+
+	// Env is the environment where this client runs.
+	//
+	// The global environment is used if Env is nil.
+	Env *Environment
+
+	inFlight int64
 }
 
 // Do overrides http.Client.Do.
 //
 // req's context should have been set by http.Request.WithContext
 // for request tracking and context-based cancelation.
+//
+// If c.Retry is set, failed requests may be retried.  See RetryPolicy.
 func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
 	ctx := req.Context()
 	v := ctx.Value(RequestIDContextKey)
 	if v != nil {
-		req.Header.Set(requestIDHeader, v.(string))
+		header := c.RequestIDHeader
+		if len(header) == 0 {
+			header = requestIDHeader
+		}
+		req.Header.Set(header, v.(string))
+	}
+	injectTraceContext(req)
+
+	timeout, headerOnly := c.timeout(ctx)
+	if timeout <= 0 && c.DrainTimeout <= 0 {
+		return c.doRequest(req)
+	}
+
+	ctx, cancel := c.drainContext(ctx)
+	var headerTimer *time.Timer
+	switch {
+	case timeout > 0 && headerOnly:
+		var cancelHeader context.CancelFunc
+		ctx, cancelHeader = context.WithCancel(ctx)
+		headerTimer = time.AfterFunc(timeout, cancelHeader)
+		cancelDrain := cancel
+		cancel = func() {
+			cancelHeader()
+			cancelDrain()
+		}
+	case timeout > 0:
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancelDrain := cancel
+		cancel = func() {
+			cancelTimeout()
+			cancelDrain()
+		}
+	}
+	resp, err := c.doRequest(req.WithContext(ctx))
+	if headerTimer != nil && !headerTimer.Stop() {
+		// the response headers were not received in time.
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, errResponseHeaderTimeout
 	}
+	if err != nil {
+		cancel()
+		return resp, err
+	}
+	hookClose(resp, cancel)
+	return resp, nil
+}
+
+func (c *HTTPClient) doRequest(req *http.Request) (*http.Response, error) {
+	if c.Retry != nil {
+		return c.doWithRetry(req)
+	}
+	return c.do(req, 0)
+}
+
+// do sends req and logs the result.  attempt is logged if positive.
+func (c *HTTPClient) do(req *http.Request, attempt int) (*http.Response, error) {
+	ctx := req.Context()
 	st := time.Now()
-	resp, err := c.Client.Do(req)
+	var resp *http.Response
+	var err error
+	if c.Hedge != nil {
+		resp, err = c.Hedge.do(req, c.send)
+	} else {
+		resp, err = c.send(req)
+	}
 
 	logger := c.Logger
 	if logger == nil {
 		logger = log.DefaultLogger()
 	}
 
-	if err == nil && (c.Severity == 0 || !logger.Enabled(c.Severity)) {
-		// successful logs are suppressed if c.Severity is 0 or
-		// logger threshold is under c.Severity.
+	severity := log.LvError
+	if err == nil {
+		severity = c.severity(resp.StatusCode)
+	}
+	if severity == 0 || !logger.Enabled(severity) {
+		// logs are suppressed if severity is 0 or
+		// logger threshold is under severity.
+		return resp, err
+	}
+	if err == nil && resp.StatusCode < 400 && !c.sample() {
 		return resp, err
 	}
 
 	fields := FieldsFromContext(ctx)
+	for k, v := range c.Fields {
+		fields[k] = v
+	}
 	fields[log.FnType] = "http"
 	fields[log.FnResponseTime] = time.Since(st).Seconds()
 	fields[log.FnHTTPMethod] = req.Method
 	fields[log.FnURL] = req.URL.String()
 	fields[log.FnStartAt] = st
+	if attempt > 0 {
+		fields["attempt"] = attempt
+	}
 
 	if err != nil {
 		fields["error"] = err.Error()
@@ -430,10 +692,56 @@ func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
 	}
 
 	fields[log.FnHTTPStatusCode] = resp.StatusCode
-	logger.Log(c.Severity, "well: http", fields)
+	logger.Log(severity, "well: http", fields)
+	return resp, err
+}
+
+// send sends req through the circuit breaker, if any.
+func (c *HTTPClient) send(req *http.Request) (*http.Response, error) {
+	cb := c.CircuitBreaker
+	if cb == nil {
+		return c.roundTrip(req)
+	}
+
+	host := req.URL.Host
+	generation, ok := cb.allow(host)
+	if !ok {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := c.roundTrip(req)
+	if err != nil && req.Context().Err() != nil {
+		// canceled requests tell nothing about the host.
+		cb.release(host, generation)
+		return resp, err
+	}
+	cb.record(host, generation, cb.isFailure(resp, err))
 	return resp, err
 }
 
+func (c *HTTPClient) roundTrip(req *http.Request) (*http.Response, error) {
+	if c.Metrics == nil {
+		return c.Client.Do(req)
+	}
+	return c.Metrics.do(req, c.Client.Do)
+}
+
+func (c *HTTPClient) severity(status int) int {
+	switch {
+	case status >= 500 && c.ServerErrorSeverity != 0:
+		return c.ServerErrorSeverity
+	case status >= 400 && status < 500 && c.ClientErrorSeverity != 0:
+		return c.ClientErrorSeverity
+	}
+	return c.Severity
+}
+
+func (c *HTTPClient) sample() bool {
+	if c.SampleRate <= 0 || c.SampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < c.SampleRate
+}
+
 // Get panics.
 func (c *HTTPClient) Get(url string) (*http.Response, error) {
 	panic("Use Do")
@@ -128,7 +128,7 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	reqid := r.Header.Get(requestIDHeader)
 	if len(reqid) == 0 {
-		reqid = s.generator.Generate()
+		reqid = newActivityID(ctx, s.generator)
 	}
 	ctx = WithRequestID(ctx, reqid)
 
@@ -7,7 +7,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
 	"runtime"
 	"testing"
 	"time"
@@ -276,6 +279,93 @@ func testAccessLog(r io.Reader, t *testing.T, helloLength int64) {
 	}
 }
 
+func TestHTTPServerGoAway(t *testing.T) {
+	t.Parallel()
+
+	cert, err := tls.LoadX509KeyPair("testdata/cert.pem", "testdata/key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{
+		NextProtos:   []string{"h2", "http/1.1"},
+		Certificates: []tls.Certificate{cert},
+	}
+
+	env := NewEnvironment(context.Background())
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(500 * time.Millisecond)
+		io.WriteString(w, "slow")
+	})
+	mux.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "fast")
+	})
+	s := &HTTPServer{
+		Server: &http.Server{
+			Handler:   mux,
+			TLSConfig: config,
+		},
+		ShutdownTimeout: 5 * time.Second,
+		Env:             env,
+	}
+	s.Serve(tls.NewListener(ln, config))
+
+	cl := newHTTPClient()
+	url := "https://" + ln.Addr().String()
+	slowCh := make(chan error, 1)
+	go func() {
+		resp, err := cl.Get(url + "/slow")
+		if err != nil {
+			slowCh <- err
+			return
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err == nil && (resp.ProtoMajor != 2 || string(data) != "slow") {
+			err = fmt.Errorf("unexpected response: %s %s", resp.Proto, data)
+		}
+		slowCh <- err
+	}()
+
+	<-started
+	env.Cancel(nil)
+	time.Sleep(100 * time.Millisecond)
+
+	// GOAWAY makes the client open a new connection.
+	var reused bool
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused = info.Reused
+		},
+	}
+	req, _ := http.NewRequest("GET", url+"/fast", nil)
+	req = req.WithContext(httptrace.WithClientTrace(context.Background(), trace))
+	resp, err := cl.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if reused {
+		t.Error(`connection was reused after GOAWAY`)
+	}
+
+	// the in-flight stream finishes.
+	if err := <-slowCh; err != nil {
+		t.Error(err)
+	}
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+	if s.TimedOut() {
+		t.Error(`s.TimedOut()`)
+	}
+}
+
 func TestHTTPServerTimeout(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("windows doesn't support FileListener")
@@ -436,3 +526,114 @@ func TestHTTPClient(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestHTTPClientLogging(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/404":
+			w.WriteHeader(http.StatusNotFound)
+		case "/500":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+
+	logger := log.NewLogger()
+	logger.SetFormatter(log.JSONFormat{})
+	logger.SetThreshold(log.LvDebug)
+	buf := new(bytes.Buffer)
+	logger.SetOutput(buf)
+
+	cl := HTTPClient{
+		Client:              &http.Client{},
+		Severity:            log.LvDebug,
+		ServerErrorSeverity: log.LvError,
+		Logger:              logger,
+		Fields:              map[string]interface{}{"upstream": "test"},
+	}
+
+	testCases := []struct {
+		path     string
+		severity string
+	}{
+		{"/", "debug"},
+		{"/404", "debug"},
+		{"/500", "error"},
+	}
+	for _, tc := range testCases {
+		buf.Reset()
+		req, _ := http.NewRequest("GET", s.URL+tc.path, nil)
+		resp, err := cl.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+			t.Fatal(tc.path, err)
+		}
+		if fields["severity"] != tc.severity {
+			t.Error(`fields["severity"] != tc.severity`, tc.path, fields["severity"])
+		}
+		if fields["upstream"] != "test" {
+			t.Error(`fields["upstream"] != "test"`, fields["upstream"])
+		}
+	}
+
+	// sampling does not apply to errors
+	cl.SampleRate = 1e-9
+	buf.Reset()
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		resp, err := cl.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if buf.Len() != 0 {
+		t.Error(`successful requests should be sampled`, buf.String())
+	}
+	req, _ := http.NewRequest("GET", s.URL+"/500", nil)
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if buf.Len() == 0 {
+		t.Error(`5xx should not be sampled`)
+	}
+}
+
+func TestHTTPClientRequestIDHeader(t *testing.T) {
+	t.Parallel()
+
+	var reqid, defaultHeader string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqid = r.Header.Get("X-Request-ID")
+		defaultHeader = r.Header.Get(requestIDHeader)
+	}))
+	defer s.Close()
+
+	cl := &HTTPClient{
+		Client:          &http.Client{},
+		RequestIDHeader: "X-Request-ID",
+	}
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req = req.WithContext(WithRequestID(context.Background(), testUUID))
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if reqid != testUUID {
+		t.Error(`reqid != testUUID`, reqid)
+	}
+	if len(defaultHeader) != 0 {
+		t.Error(`len(defaultHeader) != 0`, defaultHeader)
+	}
+}
@@ -0,0 +1,333 @@
+package well
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultCompressionMinSize = 1024
+
+var defaultCompressionContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/javascript",
+	"application/xml",
+	"application/*+xml",
+	"image/svg+xml",
+}
+
+// CompressionConfig configures compression of responses by HTTPServer.
+//
+// A response is compressed when the client accepts one of the
+// encodings, its Content-Type matches ContentTypes, and its body is
+// larger than or equal to MinSize.  Responses that already have
+// Content-Encoding, partial responses, and responses without bodies
+// are not compressed.
+//
+// gzip and deflate are supported by default.  Other encodings such as
+// br can be added by Encoders.
+type CompressionConfig struct {
+	// ContentTypes is the list of media types to be compressed.
+	// Wildcards of path.Match such as "text/*" can be used.
+	// If empty, common textual types such as "text/*" and
+	// "application/json" are compressed.
+	ContentTypes []string
+
+	// MinSize is the minimum size of response bodies to be compressed.
+	// If the handler flushes the response before writing MinSize bytes,
+	// the response is not compressed.
+	// Zero is treated as 1024.
+	MinSize int
+
+	// Level is the compression level of gzip and deflate.
+	// Zero is treated as the default compression level.
+	Level int
+
+	// Encoders are additional encodings keyed by the names in
+	// Accept-Encoding, e.g. "br".  They are preferred over gzip and
+	// deflate when the client accepts them equally.  If the returned
+	// writer has "Flush() error" method, it is called when the handler
+	// flushes the response.
+	Encoders map[string]func(w io.Writer) io.WriteCloser
+}
+
+// negotiate returns the encoding to be used for r, or "" if none.
+func (c *CompressionConfig) negotiate(r *http.Request) string {
+	accepted := parseAcceptEncoding(r.Header.Values("Accept-Encoding"))
+
+	candidates := make([]string, 0, len(c.Encoders)+2)
+	for name := range c.Encoders {
+		candidates = append(candidates, strings.ToLower(name))
+	}
+	sort.Strings(candidates)
+	candidates = append(candidates, "gzip", "deflate")
+
+	var best string
+	var bestQ float64
+	for _, name := range candidates {
+		q, ok := accepted[name]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+func (c *CompressionConfig) newEncoder(name string, w io.Writer) io.WriteCloser {
+	for n, f := range c.Encoders {
+		if strings.ToLower(n) == name {
+			return f(w)
+		}
+	}
+
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	switch name {
+	case "gzip":
+		if gw, err := gzip.NewWriterLevel(w, level); err == nil {
+			return gw
+		}
+		return gzip.NewWriter(w)
+	case "deflate":
+		if fw, err := flate.NewWriter(w, level); err == nil {
+			return fw
+		}
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	}
+	return nil
+}
+
+func (c *CompressionConfig) compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	patterns := c.ContentTypes
+	if len(patterns) == 0 {
+		patterns = defaultCompressionContentTypes
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), mt); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAcceptEncoding returns the q-values of encodings.
+// Encodings with q=0 are kept to exclude them from "*".
+func parseAcceptEncoding(values []string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			params := strings.Split(item, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			if name == "" {
+				continue
+			}
+			q := 1.0
+			for _, p := range params[1:] {
+				p = strings.TrimSpace(p)
+				if !strings.HasPrefix(p, "q=") {
+					continue
+				}
+				f, err := strconv.ParseFloat(p[2:], 64)
+				if err == nil {
+					q = f
+				}
+			}
+			accepted[name] = q
+		}
+	}
+	return accepted
+}
+
+// compressResponseWriter buffers the beginning of the response body
+// to decide whether to compress the response.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	config   *CompressionConfig
+	encoding string
+	minSize  int
+
+	status     int
+	decided    bool
+	compressed bool
+	buf        []byte
+	encoder    io.WriteCloser
+
+	// size is the number of bytes written by the handler.
+	size int64
+}
+
+func newCompressResponseWriter(w http.ResponseWriter, c *CompressionConfig, encoding string) *compressResponseWriter {
+	minSize := c.MinSize
+	if minSize == 0 {
+		minSize = defaultCompressionMinSize
+	}
+	return &compressResponseWriter{
+		ResponseWriter: w,
+		config:         c,
+		encoding:       encoding,
+		minSize:        minSize,
+	}
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	if status < 200 {
+		// informational responses such as 103 Early Hints.
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *compressResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.size += int64(len(data))
+
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.minSize {
+			return len(data), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+
+	if w.compressed {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressResponseWriter) WriteString(data string) (int, error) {
+	return w.Write([]byte(data))
+}
+
+func (w *compressResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(writerOnly{w}, r)
+}
+
+// writerOnly hides ReadFrom to avoid recursion in io.Copy.
+type writerOnly struct {
+	io.Writer
+}
+
+// decide decides whether to compress the response, then sends the
+// header and the buffered data.
+func (w *compressResponseWriter) decide() error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	h := w.Header()
+	if len(w.buf) >= w.minSize && w.canCompress(h) {
+		w.encoder = w.config.newEncoder(w.encoding, w.ResponseWriter)
+		w.compressed = w.encoder != nil
+	}
+	if w.compressed {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+	}
+	if w.compressed || (h.Get("Content-Encoding") == "" && w.config.compressible(h.Get("Content-Type"))) {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.compressed {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *compressResponseWriter) canCompress(h http.Header) bool {
+	switch {
+	case w.status == http.StatusNoContent, w.status == http.StatusNotModified:
+		return false
+	case w.status == http.StatusPartialContent, h.Get("Content-Range") != "":
+		return false
+	case h.Get("Content-Encoding") != "":
+		return false
+	}
+	if h.Get("Content-Type") == "" {
+		// net/http would sniff the content type.
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	return w.config.compressible(h.Get("Content-Type"))
+}
+
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok && w.compressed {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (w *compressResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// close sends the buffered data and finishes compression.
+func (w *compressResponseWriter) close() error {
+	if !w.decided {
+		if w.status == 0 {
+			// nothing was written by the handler.
+			return nil
+		}
+		if err := w.decide(); err != nil {
+			return err
+		}
+	}
+	if w.compressed {
+		return w.encoder.Close()
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package well
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestParseAcceptEncoding(t *testing.T) {
+	t.Parallel()
+
+	accepted := parseAcceptEncoding([]string{"gzip;q=0.5, deflate", "br;q=0, *;q=0.1"})
+	if accepted["gzip"] != 0.5 {
+		t.Error(`accepted["gzip"] != 0.5`, accepted["gzip"])
+	}
+	if accepted["deflate"] != 1 {
+		t.Error(`accepted["deflate"] != 1`, accepted["deflate"])
+	}
+	if q, ok := accepted["br"]; !ok || q != 0 {
+		t.Error(`br should be rejected`, q, ok)
+	}
+	if accepted["*"] != 0.1 {
+		t.Error(`accepted["*"] != 0.1`, accepted["*"])
+	}
+}
+
+func TestCompressionNegotiate(t *testing.T) {
+	t.Parallel()
+
+	c := &CompressionConfig{
+		Encoders: map[string]func(w io.Writer) io.WriteCloser{
+			"br": func(w io.Writer) io.WriteCloser { return nil },
+		},
+	}
+	testCases := []struct {
+		accept   string
+		expected string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip, br", "br"},
+		{"*", "br"},
+		{"*, br;q=0", "gzip"},
+	}
+	for _, tc := range testCases {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept-Encoding", tc.accept)
+		}
+		if enc := c.negotiate(r); enc != tc.expected {
+			t.Error(`enc != tc.expected`, tc.accept, enc)
+		}
+	}
+}
+
+func TestHTTPServerCompression(t *testing.T) {
+	t.Parallel()
+
+	large := strings.Repeat("hello, world\n", 200)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "2600")
+		io.WriteString(w, large)
+	})
+	mux.HandleFunc("/sniff", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html>"+large+"</html>")
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.WriteString(w, large)
+	})
+	mux.HandleFunc("/encoded", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "identity")
+		io.WriteString(w, large)
+	})
+	mux.HandleFunc("/notfound", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"message":"`+large+`"}`)
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	out := new(syncBuffer)
+	logger.SetOutput(out)
+	logger.SetFormatter(log.JSONFormat{})
+	s := &HTTPServer{
+		Server:      &http.Server{Handler: mux},
+		AccessLog:   logger,
+		Compression: &CompressionConfig{},
+		Env:         env,
+	}
+	if err := s.Serve(l); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		env.Cancel(nil)
+		env.Wait()
+	}()
+
+	cl := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	get := func(path, accept string) (*http.Response, []byte) {
+		req, _ := http.NewRequest("GET", "http://"+l.Addr().String()+path, nil)
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		}
+		resp, err := cl.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, data
+	}
+
+	resp, data := get("/text", "gzip")
+	if enc := resp.Header.Get("Content-Encoding"); enc != "gzip" {
+		t.Fatal(`enc != "gzip"`, enc)
+	}
+	if resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Error(`no Vary header`)
+	}
+	if len(data) >= len(large) {
+		t.Error(`not compressed`, len(data))
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != large {
+		t.Error(`string(decoded) != large`)
+	}
+
+	resp, data = get("/sniff", "deflate")
+	if enc := resp.Header.Get("Content-Encoding"); enc != "deflate" {
+		t.Fatal(`enc != "deflate"`, enc)
+	}
+	decoded, err = io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(decoded), "<html>") {
+		t.Error(`unexpected body`)
+	}
+
+	resp, _ = get("/notfound", "gzip")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error(`resp.StatusCode != http.StatusNotFound`, resp.StatusCode)
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "gzip" {
+		t.Error(`enc != "gzip"`, enc)
+	}
+
+	for _, path := range []string{"/small", "/binary", "/encoded"} {
+		resp, data = get(path, "gzip")
+		if enc := resp.Header.Get("Content-Encoding"); enc == "gzip" {
+			t.Error(`compressed`, path)
+		}
+		if len(data) == 0 {
+			t.Error(`len(data) == 0`, path)
+		}
+	}
+
+	resp, data = get("/text", "")
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" {
+		t.Error(`enc != ""`, enc)
+	}
+	if string(data) != large {
+		t.Error(`string(data) != large`)
+	}
+
+	var found bool
+	for _, line := range bytes.Split(out.Bytes(), []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry[log.FnURL] != "/text" || entry["content_encoding"] != "gzip" {
+			continue
+		}
+		found = true
+		if entry["uncompressed_size"] != float64(len(large)) {
+			t.Error(`unexpected uncompressed_size`, entry["uncompressed_size"])
+		}
+		ratio, _ := entry["compression_ratio"].(float64)
+		if ratio <= 0 || ratio >= 1 {
+			t.Error(`unexpected compression_ratio`, ratio)
+		}
+		if entry[log.FnResponseSize].(float64) >= float64(len(large)) {
+			t.Error(`response_size is not the compressed size`, entry[log.FnResponseSize])
+		}
+	}
+	if !found {
+		t.Error(`no access log of compressed response`)
+	}
+}
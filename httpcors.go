@@ -0,0 +1,168 @@
+package well
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// CORSConfig configures Cross-Origin Resource Sharing for HTTPServer.
+//
+// Preflight requests from allowed origins are answered by HTTPServer
+// with 204 No Content without calling the handler.  Preflight requests
+// with disallowed origins, methods, or headers are answered with
+// 403 Forbidden.  Other requests are passed to the handler, with CORS
+// headers added if the origin is allowed.
+type CORSConfig struct {
+	// AllowedOrigins is the list of allowed origins such as
+	// "https://example.com".  Wildcards of path.Match can be used,
+	// e.g. "https://*.example.com".  "*" allows any origin.
+	AllowedOrigins []string
+
+	// AllowedMethods is the list of allowed methods.
+	// If empty, GET, HEAD, and POST are allowed.
+	AllowedMethods []string
+
+	// AllowedHeaders is the list of allowed request headers.
+	// "*" allows any header.
+	AllowedHeaders []string
+
+	// ExposedHeaders is the list of response headers exposed to
+	// scripts in browsers.
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests with credentials such as
+	// cookies.  The origin of the request is sent back in
+	// Access-Control-Allow-Origin.
+	//
+	// AllowCredentials cannot be used with "*" in AllowedOrigins,
+	// as it would allow any site to make requests with credentials.
+	// HTTPServer panics for such a configuration.
+	AllowCredentials bool
+
+	// MaxAge is the duration browsers may cache preflight results.
+	// Zero does not send Access-Control-Max-Age.
+	MaxAge time.Duration
+}
+
+func (c *CORSConfig) allowedOrigin(origin string) bool {
+	for _, p := range c.AllowedOrigins {
+		if p == "*" || strings.EqualFold(p, origin) {
+			return true
+		}
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(origin)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORSConfig) anyOrigin() bool {
+	for _, p := range c.AllowedOrigins {
+		if p == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORSConfig) methods() []string {
+	if len(c.AllowedMethods) == 0 {
+		return defaultCORSMethods
+	}
+	return c.AllowedMethods
+}
+
+func (c *CORSConfig) allowedMethod(method string) bool {
+	for _, m := range c.methods() {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORSConfig) allowedHeader(header string) bool {
+	for _, h := range c.AllowedHeaders {
+		if h == "*" || strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// setOrigin sets Access-Control-Allow-Origin and related headers.
+// Credentials are never allowed for "*" origin.
+func (c *CORSConfig) setOrigin(h http.Header, origin string) {
+	if c.anyOrigin() {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// handle adds CORS headers to the response.  It returns true if the
+// request is a preflight request and the response has been sent.
+func (c *CORSConfig) handle(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	reqMethod := r.Header.Get("Access-Control-Request-Method")
+	preflight := r.Method == http.MethodOptions && reqMethod != ""
+
+	h := w.Header()
+	if !c.anyOrigin() {
+		h.Add("Vary", "Origin")
+	}
+	if origin == "" {
+		return false
+	}
+
+	if !preflight {
+		if !c.allowedOrigin(origin) {
+			return false
+		}
+		c.setOrigin(h, origin)
+		if len(c.ExposedHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+		}
+		return false
+	}
+
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if !c.allowedOrigin(origin) || !c.allowedMethod(reqMethod) {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	var headers []string
+	for _, v := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !c.allowedHeader(name) {
+				w.WriteHeader(http.StatusForbidden)
+				return true
+			}
+			headers = append(headers, name)
+		}
+	}
+
+	c.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(c.methods(), ", "))
+	if len(headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if c.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,226 @@
+package well
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCORSConfig(t *testing.T) {
+	t.Parallel()
+
+	c := &CORSConfig{
+		AllowedOrigins:   []string{"https://example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "PUT"},
+		AllowedHeaders:   []string{"Content-Type", "X-Token"},
+		ExposedHeaders:   []string{"X-Count"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+
+	// simple request from an allowed origin.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://api.example.org")
+	w := httptest.NewRecorder()
+	if c.handle(w, r) {
+		t.Error(`simple request was handled`)
+	}
+	h := w.Header()
+	if v := h.Get("Access-Control-Allow-Origin"); v != "https://api.example.org" {
+		t.Error(`unexpected Access-Control-Allow-Origin`, v)
+	}
+	if v := h.Get("Access-Control-Allow-Credentials"); v != "true" {
+		t.Error(`unexpected Access-Control-Allow-Credentials`, v)
+	}
+	if v := h.Get("Access-Control-Expose-Headers"); v != "X-Count" {
+		t.Error(`unexpected Access-Control-Expose-Headers`, v)
+	}
+	if v := h.Get("Vary"); v != "Origin" {
+		t.Error(`unexpected Vary`, v)
+	}
+
+	// simple request from a disallowed origin.
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://evil.example.net")
+	w = httptest.NewRecorder()
+	if c.handle(w, r) {
+		t.Error(`simple request was handled`)
+	}
+	if v := w.Header().Get("Access-Control-Allow-Origin"); v != "" {
+		t.Error(`unexpected Access-Control-Allow-Origin`, v)
+	}
+
+	// preflight request.
+	r = httptest.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	r.Header.Set("Access-Control-Request-Headers", "content-type, x-token")
+	w = httptest.NewRecorder()
+	if !c.handle(w, r) {
+		t.Fatal(`preflight request was not handled`)
+	}
+	if w.Code != http.StatusNoContent {
+		t.Error(`w.Code != http.StatusNoContent`, w.Code)
+	}
+	h = w.Header()
+	if v := h.Get("Access-Control-Allow-Origin"); v != "https://example.com" {
+		t.Error(`unexpected Access-Control-Allow-Origin`, v)
+	}
+	if v := h.Get("Access-Control-Allow-Methods"); v != "GET, PUT" {
+		t.Error(`unexpected Access-Control-Allow-Methods`, v)
+	}
+	if v := h.Get("Access-Control-Allow-Headers"); v != "content-type, x-token" {
+		t.Error(`unexpected Access-Control-Allow-Headers`, v)
+	}
+	if v := h.Get("Access-Control-Max-Age"); v != "600" {
+		t.Error(`unexpected Access-Control-Max-Age`, v)
+	}
+
+	// preflight requests with disallowed method or header.
+	for _, hdr := range [][2]string{{"DELETE", ""}, {"GET", "X-Other"}} {
+		r = httptest.NewRequest("OPTIONS", "/", nil)
+		r.Header.Set("Origin", "https://example.com")
+		r.Header.Set("Access-Control-Request-Method", hdr[0])
+		if hdr[1] != "" {
+			r.Header.Set("Access-Control-Request-Headers", hdr[1])
+		}
+		w = httptest.NewRecorder()
+		if !c.handle(w, r) {
+			t.Fatal(`preflight request was not handled`)
+		}
+		if w.Code != http.StatusForbidden {
+			t.Error(`w.Code != http.StatusForbidden`, hdr, w.Code)
+		}
+		if v := w.Header().Get("Access-Control-Allow-Origin"); v != "" {
+			t.Error(`unexpected Access-Control-Allow-Origin`, v)
+		}
+	}
+}
+
+func TestCORSConfigAnyOrigin(t *testing.T) {
+	t.Parallel()
+
+	c := &CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"*"},
+	}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	c.handle(w, r)
+	if v := w.Header().Get("Access-Control-Allow-Origin"); v != "*" {
+		t.Error(`unexpected Access-Control-Allow-Origin`, v)
+	}
+	if v := w.Header().Get("Vary"); v != "" {
+		t.Error(`unexpected Vary`, v)
+	}
+
+	r = httptest.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	r.Header.Set("Access-Control-Request-Headers", "X-Anything")
+	w = httptest.NewRecorder()
+	if !c.handle(w, r) {
+		t.Fatal(`preflight request was not handled`)
+	}
+	if w.Code != http.StatusNoContent {
+		t.Error(`w.Code != http.StatusNoContent`, w.Code)
+	}
+	if v := w.Header().Get("Access-Control-Allow-Headers"); v != "X-Anything" {
+		t.Error(`unexpected Access-Control-Allow-Headers`, v)
+	}
+	if v := w.Header().Get("Access-Control-Max-Age"); v != "" {
+		t.Error(`unexpected Access-Control-Max-Age`, v)
+	}
+}
+
+func TestHTTPServerCORS(t *testing.T) {
+	t.Parallel()
+
+	var called int32
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvironment(context.Background())
+	s := &HTTPServer{
+		Server: &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&called, 1)
+			}),
+		},
+		CORS: &CORSConfig{AllowedOrigins: []string{"https://example.com"}},
+		Env:  env,
+	}
+	if err := s.Serve(l); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		env.Cancel(nil)
+		env.Wait()
+	}()
+
+	url := "http://" + l.Addr().String() + "/"
+	req, _ := http.NewRequest("OPTIONS", url, nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Error(`resp.StatusCode != http.StatusNoContent`, resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest("GET", url, nil)
+	req.Header.Set("Origin", "https://example.com")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if v := resp.Header.Get("Access-Control-Allow-Origin"); v != "https://example.com" {
+		t.Error(`unexpected Access-Control-Allow-Origin`, v)
+	}
+	if n := atomic.LoadInt32(&called); n != 1 {
+		t.Error(`n != 1`, n)
+	}
+}
+
+func TestCORSConfigAnyOriginCredentials(t *testing.T) {
+	t.Parallel()
+
+	c := &CORSConfig{
+		AllowedOrigins:   []string{"*"},
+		AllowCredentials: true,
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://evil.example.net")
+	w := httptest.NewRecorder()
+	c.handle(w, r)
+	if v := w.Header().Get("Access-Control-Allow-Origin"); v != "*" {
+		t.Error(`unexpected Access-Control-Allow-Origin`, v)
+	}
+	if v := w.Header().Get("Access-Control-Allow-Credentials"); v != "" {
+		t.Error(`credentials should not be allowed for any origin`, v)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error(`HTTPServer should panic`)
+		}
+	}()
+	s := &HTTPServer{
+		Server: &http.Server{Handler: http.NotFoundHandler()},
+		CORS:   c,
+		Env:    NewEnvironment(context.Background()),
+	}
+	s.init()
+}
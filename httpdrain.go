@@ -0,0 +1,71 @@
+package well
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// detachedContext is a context that has values of the parent but
+// is never canceled by the parent.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+func (c *HTTPClient) env() *Environment {
+	if c.Env == nil {
+		return defaultEnv
+	}
+	return c.Env
+}
+
+// drainContext returns a context for a request with ctx.
+//
+// If DrainTimeout is positive, the returned context is canceled when
+// ctx is done, or after DrainTimeout if ctx is done because of the
+// cancellation of the environment.  The returned function must be
+// called when the request completes.
+func (c *HTTPClient) drainContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.DrainTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	env := c.env()
+	dctx, cancel := context.WithCancel(detachedContext{ctx})
+	atomic.AddInt64(&c.inFlight, 1)
+
+	go func() {
+		defer c.drained(env)
+
+		select {
+		case <-dctx.Done():
+			return
+		case <-ctx.Done():
+		}
+		if env.ctx.Err() == nil {
+			cancel()
+			return
+		}
+
+		timer := ClockFromContext(env.ctx).NewTimer(c.DrainTimeout)
+		defer timer.Stop()
+		select {
+		case <-dctx.Done():
+		case <-timer.C():
+			cancel()
+		}
+	}()
+	return dctx, cancel
+}
+
+// drained is called when a request completes.
+func (c *HTTPClient) drained(env *Environment) {
+	if atomic.AddInt64(&c.inFlight, -1) == 0 && env.ctx.Err() != nil {
+		c.Client.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,85 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testHTTPClientDrain(t *testing.T, drain time.Duration) error {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer s.Close()
+
+	env := NewEnvironment(context.Background())
+	cl := &HTTPClient{
+		Client:       &http.Client{},
+		DrainTimeout: drain,
+		Env:          env,
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		env.Cancel(nil)
+	}()
+
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	resp, err := cl.Do(req.WithContext(env.ctx))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestHTTPClientDrain(t *testing.T) {
+	t.Parallel()
+
+	if err := testHTTPClientDrain(t, time.Second); err != nil {
+		t.Error(`requests should be drained`, err)
+	}
+
+	err := testHTTPClientDrain(t, 10*time.Millisecond)
+	if !errors.Is(err, context.Canceled) {
+		t.Error(`requests should be canceled after DrainTimeout`, err)
+	}
+
+	err = testHTTPClientDrain(t, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Error(`requests should be canceled without DrainTimeout`, err)
+	}
+}
+
+func TestHTTPClientDrainCanceled(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer s.Close()
+
+	cl := &HTTPClient{
+		Client:       &http.Client{},
+		DrainTimeout: time.Minute,
+		Env:          NewEnvironment(context.Background()),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	st := time.Now()
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	_, err := cl.Do(req.WithContext(ctx))
+	if !errors.Is(err, context.Canceled) {
+		t.Error(`err should be context.Canceled`, err)
+	}
+	if time.Since(st) > 500*time.Millisecond {
+		t.Error(`requests canceled by callers should not be drained`)
+	}
+}
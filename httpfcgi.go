@@ -0,0 +1,147 @@
+package well
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"sync"
+)
+
+// ServeFastCGI starts a goroutine to serve FastCGI requests accepted
+// on l by the handler of s, e.g. for deployments behind nginx using
+// fastcgi_pass.  l can be a listener restored by Graceful or systemd
+// socket activation.  Requests are logged and counted in the same
+// way as HTTP requests.
+//
+// Like Serve, this method returns immediately.  When the environment
+// is canceled, l is closed and the server waits for running requests
+// to finish within ShutdownTimeout, then closes FastCGI connections.
+//
+// ServeFastCGI always returns nil.
+func (s *HTTPServer) ServeFastCGI(l net.Listener) error {
+	s.initOnce.Do(s.init)
+
+	fl := &fcgiListener{
+		Listener: l,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.fcgiMu.Lock()
+	s.fcgiListeners = append(s.fcgiListeners, fl)
+	s.fcgiMu.Unlock()
+
+	go func() {
+		fcgi.Serve(fl, fl.track(s))
+	}()
+
+	markReady(s.Env)
+	return nil
+}
+
+// drainFastCGI closes FastCGI listeners and waits for running requests
+// until ctx is done, then closes connections.
+func (s *HTTPServer) drainFastCGI(ctx context.Context) error {
+	s.fcgiMu.Lock()
+	listeners := s.fcgiListeners
+	s.fcgiMu.Unlock()
+
+	var err error
+	for _, fl := range listeners {
+		if e := fl.drain(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// fcgiListener tracks connections and running requests of FastCGI.
+type fcgiListener struct {
+	net.Listener
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	active   int
+	idle     chan struct{}
+	draining bool
+}
+
+func (l *fcgiListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.draining {
+		conn.Close()
+		return nil, net.ErrClosed
+	}
+	l.conns[conn] = struct{}{}
+	return &fcgiConn{Conn: conn, l: l}, nil
+}
+
+func (l *fcgiListener) track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		l.active++
+		l.mu.Unlock()
+
+		defer func() {
+			l.mu.Lock()
+			l.active--
+			if l.active == 0 && l.idle != nil {
+				close(l.idle)
+				l.idle = nil
+			}
+			l.mu.Unlock()
+		}()
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (l *fcgiListener) drain(ctx context.Context) error {
+	l.Listener.Close()
+
+	l.mu.Lock()
+	l.draining = true
+	var idle chan struct{}
+	if l.active > 0 {
+		idle = make(chan struct{})
+		l.idle = idle
+	}
+	l.mu.Unlock()
+
+	var err error
+	if idle != nil {
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	l.mu.Lock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+	return err
+}
+
+// fcgiConn removes itself from the listener when closed.
+type fcgiConn struct {
+	net.Conn
+	l    *fcgiListener
+	once sync.Once
+}
+
+func (c *fcgiConn) Close() error {
+	c.once.Do(func() {
+		c.l.mu.Lock()
+		delete(c.l.conns, c.Conn)
+		c.l.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,144 @@
+package well
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// fcgiRecord writes a FastCGI record of request ID 1.
+func fcgiRecord(w io.Writer, typ byte, content []byte) {
+	hdr := []byte{1, typ, 0, 1, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(hdr[4:], uint16(len(content)))
+	w.Write(hdr)
+	w.Write(content)
+}
+
+func fcgiParam(buf *bytes.Buffer, k, v string) {
+	buf.WriteByte(byte(len(k)))
+	buf.WriteByte(byte(len(v)))
+	buf.WriteString(k)
+	buf.WriteString(v)
+}
+
+// fcgiGet sends a GET request over conn and returns the output.
+func fcgiGet(conn net.Conn, uri string) (string, error) {
+	const (
+		typeBeginRequest = 1
+		typeEndRequest   = 3
+		typeParams       = 4
+		typeStdin        = 5
+		typeStdout       = 6
+	)
+
+	w := bufio.NewWriter(conn)
+	// role responder, keep connection
+	fcgiRecord(w, typeBeginRequest, []byte{0, 1, 1, 0, 0, 0, 0, 0})
+	params := new(bytes.Buffer)
+	fcgiParam(params, "REQUEST_METHOD", "GET")
+	fcgiParam(params, "REQUEST_URI", uri)
+	fcgiParam(params, "SERVER_PROTOCOL", "HTTP/1.1")
+	fcgiParam(params, "HTTP_HOST", "localhost")
+	fcgiRecord(w, typeParams, params.Bytes())
+	fcgiRecord(w, typeParams, nil)
+	fcgiRecord(w, typeStdin, nil)
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+
+	out := new(bytes.Buffer)
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+			return "", err
+		}
+		content := make([]byte, int(binary.BigEndian.Uint16(hdr[4:]))+int(hdr[6]))
+		if _, err := io.ReadFull(conn, content); err != nil {
+			return "", err
+		}
+		switch hdr[1] {
+		case typeStdout:
+			out.Write(content[:binary.BigEndian.Uint16(hdr[4:])])
+		case typeEndRequest:
+			return out.String(), nil
+		}
+	}
+}
+
+func TestHTTPServerFastCGI(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	logger.SetOutput(io.Discard)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("slow"))
+	})
+
+	s := &HTTPServer{
+		Server:          &http.Server{Handler: mux},
+		AccessLog:       logger,
+		ShutdownTimeout: 5 * time.Second,
+		Env:             env,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ServeFastCGI(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	out, err := fcgiGet(conn, "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out, "hello") {
+		t.Error(`unexpected output`, out)
+	}
+
+	// a running request finishes after the environment is canceled.
+	result := make(chan string, 1)
+	go func() {
+		out, err := fcgiGet(conn, "/slow")
+		if err != nil {
+			t.Error(err)
+		}
+		result <- out
+	}()
+	<-started
+	env.Cancel(nil)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+	if out := <-result; !strings.HasSuffix(out, "slow") {
+		t.Error(`unexpected output`, out)
+	}
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Error(`listener should be closed`)
+	}
+}
@@ -0,0 +1,177 @@
+package well
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgeDelay      = 100 * time.Millisecond
+	hedgeMaxSamples        = 1000
+	hedgeMinSamples        = 20
+	hedgeSamplesPerRefresh = 100
+)
+
+// HedgePolicy configures hedged requests of HTTPClient.
+//
+// When a hedged request does not complete within a delay, a second
+// attempt is sent and the response that arrives first is used.  The
+// other attempt is canceled.  This reduces tail latency at the cost
+// of extra load on servers.
+//
+// Only idempotent requests are hedged.  See RetryPolicy for what
+// requests are idempotent.
+//
+// A HedgePolicy must not be copied after first use.
+type HedgePolicy struct {
+	// Percentile, if in (0, 100), sets the delay to the percentile of
+	// latencies of recent successful requests.  For example, 95 sends
+	// the second attempt when the first one is slower than 95% of
+	// recent requests.  Delay is used until enough requests complete.
+	Percentile float64
+
+	// Delay is the delay to send the second attempt.
+	// Zero is treated as 100 milliseconds.
+	Delay time.Duration
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	added   int
+	delay   time.Duration
+}
+
+func (h *HedgePolicy) hedgeDelay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.delay > 0 {
+		return h.delay
+	}
+	if h.Delay <= 0 {
+		return defaultHedgeDelay
+	}
+	return h.Delay
+}
+
+func (h *HedgePolicy) record(d time.Duration) {
+	if h.Percentile <= 0 || h.Percentile >= 100 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < hedgeMaxSamples {
+		h.samples = append(h.samples, d)
+	} else {
+		h.samples[h.next] = d
+		h.next = (h.next + 1) % hedgeMaxSamples
+	}
+	h.added++
+
+	// sorting samples for each request is too expensive.
+	if len(h.samples) < hedgeMinSamples {
+		return
+	}
+	interval := len(h.samples) / 10
+	if interval > hedgeSamplesPerRefresh {
+		interval = hedgeSamplesPerRefresh
+	}
+	if h.delay > 0 && h.added < interval {
+		return
+	}
+	h.added = 0
+
+	sorted := make([]time.Duration, len(h.samples))
+	copy(sorted, h.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(float64(len(sorted)) * h.Percentile / 100)
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	h.delay = sorted[idx]
+	if h.delay <= 0 {
+		h.delay = time.Nanosecond
+	}
+}
+
+type hedgeResult struct {
+	resp    *http.Response
+	err     error
+	cancel  context.CancelFunc
+	elapsed time.Duration
+}
+
+// do sends req by send, and sends a second attempt if req is not
+// completed within the delay.
+func (h *HedgePolicy) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if !isRewindable(req) || !isIdempotent(req) {
+		return send(req)
+	}
+
+	ctx := req.Context()
+	results := make(chan hedgeResult, 2)
+	start := func(r *http.Request, cancel context.CancelFunc) {
+		st := time.Now()
+		resp, err := send(r)
+		results <- hedgeResult{resp, err, cancel, time.Since(st)}
+	}
+
+	ctx1, cancel1 := context.WithCancel(ctx)
+	go start(req.WithContext(ctx1), cancel1)
+
+	timer := time.NewTimer(h.hedgeDelay())
+	select {
+	case res := <-results:
+		timer.Stop()
+		return h.finish(res)
+	case <-ctx.Done():
+		timer.Stop()
+		return h.finish(<-results)
+	case <-timer.C:
+	}
+
+	ctx2, cancel2 := context.WithCancel(ctx)
+	req2, err := rewind(ctx2, req)
+	if err != nil {
+		cancel2()
+		return h.finish(<-results)
+	}
+	go start(req2, cancel2)
+
+	first := <-results
+	if first.err != nil && ctx.Err() == nil {
+		// the other attempt may succeed.
+		second := <-results
+		if second.err == nil {
+			first.cancel()
+			return h.finish(second)
+		}
+		second.cancel()
+		return h.finish(first)
+	}
+
+	go func() {
+		loser := <-results
+		loser.cancel()
+		if loser.resp != nil {
+			loser.resp.Body.Close()
+		}
+	}()
+	return h.finish(first)
+}
+
+// finish returns the result of the winner attempt.
+func (h *HedgePolicy) finish(res hedgeResult) (*http.Response, error) {
+	if res.err != nil {
+		res.cancel()
+		return res.resp, res.err
+	}
+	h.record(res.elapsed)
+	hookClose(res.resp, res.cancel)
+	return res.resp, nil
+}
@@ -0,0 +1,90 @@
+package well
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientHedge(t *testing.T) {
+	t.Parallel()
+
+	var count int32
+	var canceled int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		if n == 1 {
+			// the first attempt is slow.
+			select {
+			case <-r.Context().Done():
+				atomic.StoreInt32(&canceled, 1)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte("fast"))
+	}))
+	defer s.Close()
+
+	cl := &HTTPClient{
+		Client: &http.Client{},
+		Hedge:  &HedgePolicy{Delay: 50 * time.Millisecond},
+	}
+	st := time.Now()
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "fast" {
+		t.Error(`string(data) != "fast"`, string(data))
+	}
+	if time.Since(st) > 2*time.Second {
+		t.Error(`hedged request should complete fast`)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&canceled) != 1 {
+		t.Error(`the slow attempt should be canceled`)
+	}
+
+	// non-idempotent requests are not hedged.
+	atomic.StoreInt32(&count, 1)
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	resp, err = cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := atomic.LoadInt32(&count); n != 2 {
+		t.Error(`POST should not be hedged`, n)
+	}
+}
+
+func TestHedgePolicyPercentile(t *testing.T) {
+	t.Parallel()
+
+	h := &HedgePolicy{Percentile: 90, Delay: time.Hour}
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	if d := h.hedgeDelay(); d < 80*time.Millisecond || d > 91*time.Millisecond {
+		t.Error(`delay should be about 90th percentile`, d)
+	}
+
+	h = &HedgePolicy{Percentile: 90}
+	for i := 1; i < hedgeMinSamples; i++ {
+		h.record(time.Second)
+	}
+	if d := h.hedgeDelay(); d != defaultHedgeDelay {
+		t.Error(`d != defaultHedgeDelay`, d)
+	}
+}
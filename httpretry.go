@@ -0,0 +1,206 @@
+package well
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryMinBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 10 * time.Second
+
+	// maxDrainSize is the maximum size of response bodies read before
+	// retrying to reuse connections.
+	maxDrainSize = 64 << 10
+)
+
+// RetryPolicy configures automatic retries of HTTPClient.
+// This is also used by RunWithRetry to retry commands, and by Retry
+// to retry arbitrary functions.
+//
+// Requests are retried with jittered exponential backoff starting
+// from MinBackoff up to MaxBackoff.  If the response has Retry-After
+// header, its value is used as the backoff instead.  If Retry-After
+// is longer than MaxBackoff, the response is returned without retry.
+//
+// Only idempotent requests are retried unless RetryNonIdempotent
+// is true.  Requests are idempotent if the method is GET, HEAD,
+// OPTIONS, TRACE, PUT, or DELETE, or they have Idempotency-Key header.
+// Requests having a body are retried only when http.Request.GetBody
+// is set, as done by http.NewRequest for common body types.
+//
+// Retries stop when the request context or the environment of
+// HTTPClient is canceled.  In that case, the result of the last
+// attempt is returned.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of retries.
+	// Zero disables retries.
+	MaxRetries int
+
+	// MinBackoff is the backoff before the first retry.
+	// Zero is treated as 100 milliseconds.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum backoff.
+	// Zero is treated as 10 seconds.
+	MaxBackoff time.Duration
+
+	// RetryNonIdempotent allows retries of non-idempotent requests.
+	RetryNonIdempotent bool
+
+	// ShouldRetry decides if the result of an attempt should be
+	// retried.  If nil, errors and responses with status 429, 502,
+	// 503, and 504 are retried.
+	ShouldRetry func(resp *http.Response, err error) bool
+}
+
+func (p *RetryPolicy) shouldRetry(resp *http.Response, err error) bool {
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(resp, err)
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryable(req *http.Request) bool {
+	if !isRewindable(req) {
+		return false
+	}
+	return p.RetryNonIdempotent || isIdempotent(req)
+}
+
+// isRewindable returns true if req can be sent again.
+func isRewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	return ok
+}
+
+// rewind returns a copy of req with a new body.
+func rewind(ctx context.Context, req *http.Request) (*http.Request, error) {
+	r := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+// backoff returns the duration to wait before the retry-th retry.
+// It returns false if the request should not be retried.
+func (p *RetryPolicy) backoff(retry int, resp *http.Response) (time.Duration, bool) {
+	minBackoff := p.MinBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultRetryMinBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+
+	if resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if d > maxBackoff {
+				return 0, false
+			}
+			return d, true
+		}
+	}
+
+	d := minBackoff
+	for i := 1; i < retry && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	// equal jitter: [d/2, d)
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1)), true
+}
+
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if len(v) == 0 {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		if sec < 0 {
+			return 0, false
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	d := time.Until(t)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+func (c *HTTPClient) doWithRetry(req *http.Request) (*http.Response, error) {
+	p := c.Retry
+	canRetry := p.MaxRetries > 0 && p.retryable(req)
+
+	env := c.env()
+	ctx := req.Context()
+	r := req
+	for attempt := 1; ; attempt++ {
+		resp, err := c.do(r, attempt)
+		if !canRetry || attempt > p.MaxRetries || !p.shouldRetry(resp, err) {
+			return resp, err
+		}
+		if ctx.Err() != nil {
+			return resp, err
+		}
+		d, ok := p.backoff(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+
+		timer := ClockFromContext(ctx).NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-env.ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C():
+		}
+
+		if resp != nil {
+			io.CopyN(io.Discard, resp.Body, maxDrainSize)
+			resp.Body.Close()
+		}
+
+		r, err = rewind(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package well
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newFlakyServer(failures int32, retryAfter string) (*httptest.Server, *int32) {
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) <= failures {
+			if len(retryAfter) > 0 {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return s, &count
+}
+
+func TestHTTPClientRetry(t *testing.T) {
+	t.Parallel()
+
+	s, count := newFlakyServer(2, "")
+	defer s.Close()
+
+	cl := &HTTPClient{
+		Client: &http.Client{},
+		Retry: &RetryPolicy{
+			MaxRetries: 3,
+			MinBackoff: time.Millisecond,
+		},
+		Env: NewEnvironment(context.Background()),
+	}
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Error(`resp.StatusCode != http.StatusOK`, resp.StatusCode)
+	}
+	if *count != 3 {
+		t.Error(`*count != 3`, *count)
+	}
+}
+
+func TestHTTPClientRetryLimit(t *testing.T) {
+	t.Parallel()
+
+	s, count := newFlakyServer(10, "")
+	defer s.Close()
+
+	cl := &HTTPClient{
+		Client: &http.Client{},
+		Retry: &RetryPolicy{
+			MaxRetries: 2,
+			MinBackoff: time.Millisecond,
+		},
+		Env: NewEnvironment(context.Background()),
+	}
+	req, _ := http.NewRequest("PUT", s.URL, strings.NewReader("data"))
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Error(`resp.StatusCode != http.StatusServiceUnavailable`, resp.StatusCode)
+	}
+	if *count != 3 {
+		t.Error(`*count != 3`, *count)
+	}
+}
+
+func TestHTTPClientRetryNonIdempotent(t *testing.T) {
+	t.Parallel()
+
+	s, count := newFlakyServer(1, "")
+	defer s.Close()
+
+	cl := &HTTPClient{
+		Client: &http.Client{},
+		Retry: &RetryPolicy{
+			MaxRetries: 2,
+			MinBackoff: time.Millisecond,
+		},
+		Env: NewEnvironment(context.Background()),
+	}
+	req, _ := http.NewRequest("POST", s.URL, strings.NewReader("data"))
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if *count != 1 {
+		t.Error(`POST should not be retried`, *count)
+	}
+
+	cl.Retry.RetryNonIdempotent = true
+	req, _ = http.NewRequest("POST", s.URL, strings.NewReader("data"))
+	resp, err = cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Error(`resp.StatusCode != http.StatusOK`, resp.StatusCode)
+	}
+}
+
+func TestHTTPClientRetryCanceled(t *testing.T) {
+	t.Parallel()
+
+	s, count := newFlakyServer(10, "3")
+	defer s.Close()
+
+	env := NewEnvironment(context.Background())
+	cl := &HTTPClient{
+		Client: &http.Client{},
+		Retry: &RetryPolicy{
+			MaxRetries: 2,
+		},
+		Env: env,
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		env.Cancel(nil)
+	}()
+
+	st := time.Now()
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if time.Since(st) > 2*time.Second {
+		t.Error(`retries should stop on cancellation`)
+	}
+	if *count != 1 {
+		t.Error(`*count != 1`, *count)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	if d, ok := parseRetryAfter("3"); !ok || d != 3*time.Second {
+		t.Error(`parseRetryAfter("3")`, d, ok)
+	}
+	if _, ok := parseRetryAfter("foo"); ok {
+		t.Error(`parseRetryAfter("foo")`)
+	}
+	v := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(v); !ok || d < 59*time.Minute {
+		t.Error(`parseRetryAfter(date)`, d, ok)
+	}
+}
@@ -0,0 +1,84 @@
+package well
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// requestTimeoutContextKey is a context key for WithRequestTimeout.
+	requestTimeoutContextKey contextKey = "request_timeout"
+)
+
+var (
+	// defaultHTTPClientTimeout is the default time limit until response
+	// headers are received.  This is a variable to be shortened in tests.
+	defaultHTTPClientTimeout = time.Minute
+
+	// errResponseHeaderTimeout is returned by HTTPClient.Do when the
+	// response headers are not received within the default time limit.
+	errResponseHeaderTimeout = fmt.Errorf("timeout awaiting response headers: %w", context.DeadlineExceeded)
+)
+
+// WithRequestTimeout returns a new context that makes HTTPClient.Do
+// limit the time of the request to d instead of DefaultTimeout of
+// HTTPClient.  The time limit includes retries and reading the
+// response body.  Zero or negative d disables the time limit, though
+// Client.Timeout still applies if set.
+//
+// Unlike context.WithTimeout, the time limit starts when Do is called
+// and callers need not cancel the context.
+func WithRequestTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutContextKey, d)
+}
+
+// timeout returns the time limit for a request with ctx.
+// Zero means that Do need not set the time limit.  If headerOnly is
+// true, the time limit ends when the response headers are received
+// so that streaming responses are not cut off.
+func (c *HTTPClient) timeout(ctx context.Context) (d time.Duration, headerOnly bool) {
+	if d, ok := ctx.Value(requestTimeoutContextKey).(time.Duration); ok {
+		return d, false
+	}
+	if c.Client.Timeout > 0 {
+		return 0, false
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return 0, false
+	}
+	if c.DefaultTimeout == 0 {
+		return defaultHTTPClientTimeout, true
+	}
+	if c.DefaultTimeout < 0 {
+		return 0, false
+	}
+	return c.DefaultTimeout, false
+}
+
+// hookClose arranges hook to be called when resp.Body is closed.
+//
+// The body of a 101 Switching Protocols response is an io.ReadWriteCloser
+// for the upgraded connection and must not be wrapped, so hook is called
+// immediately for such a response.
+func hookClose(resp *http.Response, hook func()) {
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		hook()
+		return
+	}
+	resp.Body = &closeHookBody{ReadCloser: resp.Body, hook: hook}
+}
+
+// closeHookBody calls hook when the response body is closed.
+type closeHookBody struct {
+	io.ReadCloser
+	hook func()
+}
+
+func (b *closeHookBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.hook()
+	return err
+}
@@ -0,0 +1,196 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientTimeout(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer s.Close()
+
+	cl := &HTTPClient{
+		Client:         &http.Client{},
+		DefaultTimeout: 100 * time.Millisecond,
+	}
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	_, err := cl.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(`err should be context.DeadlineExceeded`, err)
+	}
+
+	// per-request override
+	st := time.Now()
+	ctx := WithRequestTimeout(context.Background(), 50*time.Millisecond)
+	cl.DefaultTimeout = time.Hour
+	req, _ = http.NewRequest("GET", s.URL, nil)
+	_, err = cl.Do(req.WithContext(ctx))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(`err should be context.DeadlineExceeded`, err)
+	}
+	if time.Since(st) > 2*time.Second {
+		t.Error(`WithRequestTimeout should override DefaultTimeout`)
+	}
+}
+
+func TestHTTPClientTimeoutBody(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer s.Close()
+
+	cl := &HTTPClient{Client: &http.Client{}}
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// the time limit must not be canceled until the body is closed.
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Error(`string(data) != "hello"`, string(data))
+	}
+}
+
+func TestHTTPClientTimeoutValue(t *testing.T) {
+	t.Parallel()
+
+	cl := &HTTPClient{Client: &http.Client{}}
+	if d, headerOnly := cl.timeout(context.Background()); d != defaultHTTPClientTimeout || !headerOnly {
+		t.Error(`the default should limit the time until response headers`, d, headerOnly)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	if d, _ := cl.timeout(ctx); d != 0 {
+		t.Error(`contexts with deadline should not be limited`, d)
+	}
+
+	cl.Client.Timeout = time.Second
+	if d, _ := cl.timeout(context.Background()); d != 0 {
+		t.Error(`Client.Timeout should take precedence`, d)
+	}
+
+	cl = &HTTPClient{Client: &http.Client{}, DefaultTimeout: time.Second}
+	if d, headerOnly := cl.timeout(context.Background()); d != time.Second || headerOnly {
+		t.Error(`DefaultTimeout should limit the whole request`, d, headerOnly)
+	}
+
+	cl = &HTTPClient{Client: &http.Client{}, DefaultTimeout: -1}
+	if d, _ := cl.timeout(context.Background()); d != 0 {
+		t.Error(`negative DefaultTimeout should disable the time limit`, d)
+	}
+}
+
+func TestHTTPClientDefaultTimeout(t *testing.T) {
+	saved := defaultHTTPClientTimeout
+	defaultHTTPClientTimeout = 200 * time.Millisecond
+	defer func() {
+		defaultHTTPClientTimeout = saved
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("hello\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	cl := &HTTPClient{Client: &http.Client{}}
+	req, _ := http.NewRequest("GET", s.URL+"/slow", nil)
+	_, err := cl.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(`err should be context.DeadlineExceeded`, err)
+	}
+
+	// reading streaming responses is not limited by default.
+	req, _ = http.NewRequest("GET", s.URL+"/stream", nil)
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 24 {
+		t.Error(`len(data) != 24`, len(data))
+	}
+}
+
+func TestHTTPClientSwitchingProtocols(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		brw.Flush()
+		line, _ := brw.ReadString('\n')
+		brw.WriteString(line)
+		brw.Flush()
+	}))
+	defer s.Close()
+
+	cl := &HTTPClient{Client: &http.Client{}}
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal(`unexpected status`, resp.StatusCode)
+	}
+
+	rw, ok := resp.Body.(io.ReadWriter)
+	if !ok {
+		t.Fatal(`body of 101 response should be writable`)
+	}
+	if _, err := rw.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(rw, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello\n" {
+		t.Error(`unexpected echo`, string(buf))
+	}
+}
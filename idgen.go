@@ -1,6 +1,7 @@
 package well
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"sync/atomic"
@@ -85,8 +86,9 @@ func (g *IDGenerator) Generate() string {
 	return string(strbuf[:])
 }
 
-// GenerateID genereates an ID using the default generator.
+// GenerateID genereates an ID using the default generator, or
+// the generator set by SetActivityIDGenerator.
 // Multiple goroutines can safely call this.
 func GenerateID() string {
-	return defaultGenerator.Generate()
+	return newActivityID(context.Background(), defaultGenerator)
 }
@@ -0,0 +1,235 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultJobQueueSize          = 100
+	defaultJobQueueRetryInterval = time.Second
+)
+
+var (
+	// ErrQueueFull is returned by JobQueue.Enqueue when the queue is full.
+	ErrQueueFull = errors.New("job queue is full")
+
+	// ErrQueueClosed is returned by JobQueue.Enqueue when the queue
+	// no longer accepts jobs.
+	ErrQueueClosed = errors.New("job queue is closed")
+)
+
+// JobQueue is a bounded in-process queue of jobs processed by
+// worker goroutines running as tasks of an Environment.
+//
+// When the environment is canceled, the queue stops accepting jobs.
+// If Persist is nil, workers then process all queued jobs before they
+// exit.  Otherwise, jobs not yet processed are passed to Persist so
+// that they can be restored and enqueued again after restart.
+// In both cases, this happens before Wait returns.
+//
+// Handler is called with a context that is not canceled by the
+// environment so that jobs being processed can complete.
+type JobQueue[T any] struct {
+	// Env is the environment where workers run.
+	// If nil, the global environment is used.
+	Env *Environment
+
+	// Handler processes a job.  Required.
+	Handler func(ctx context.Context, job T) error
+
+	// Workers is the number of worker goroutines.
+	// Zero is treated as 1.
+	Workers int
+
+	// Size is the maximum number of queued jobs.
+	// Zero is treated as 100.
+	Size int
+
+	// MaxRetries is the maximum number of retries for a failed job.
+	// Zero disables retries.
+	MaxRetries int
+
+	// RetryInterval is the interval before the first retry.
+	// It doubles for each subsequent retry.
+	// Zero is treated as 1 second.
+	RetryInterval time.Duration
+
+	// Persist, if not nil, is called with unprocessed jobs on shutdown.
+	Persist func(jobs []T) error
+
+	// Logger is the logger for failed jobs.
+	// If nil, the default logger is used.
+	Logger *log.Logger
+
+	mu       sync.RWMutex
+	ch       chan T
+	closed   bool
+	leftover []T
+	workers  sync.WaitGroup
+}
+
+// Start starts workers.  It must be called only once.
+func (q *JobQueue[T]) Start() {
+	env := q.Env
+	if env == nil {
+		env = defaultEnv
+	}
+	size := q.Size
+	if size == 0 {
+		size = defaultJobQueueSize
+	}
+	workers := q.Workers
+	if workers == 0 {
+		workers = 1
+	}
+
+	q.mu.Lock()
+	q.ch = make(chan T, size)
+	q.mu.Unlock()
+
+	q.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		env.goTask("well.JobQueue.worker", nil, q.work)
+	}
+	env.goTask("well.JobQueue", nil, q.drain)
+}
+
+// Enqueue adds a job to the queue.  It does not block; if the queue
+// is full, ErrQueueFull is returned.  After the environment is
+// canceled, ErrQueueClosed is returned.
+func (q *JobQueue[T]) Enqueue(job T) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.ch == nil || q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.ch <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Len returns the number of queued jobs.
+func (q *JobQueue[T]) Len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return len(q.ch)
+}
+
+func (q *JobQueue[T]) logger() *log.Logger {
+	if q.Logger == nil {
+		return log.DefaultLogger()
+	}
+	return q.Logger
+}
+
+func (q *JobQueue[T]) work(ctx context.Context) error {
+	defer q.workers.Done()
+	jobCtx := valueContext{Context: context.Background(), parent: ctx}
+
+	for ctx.Err() == nil {
+		select {
+		case job := <-q.ch:
+			q.process(ctx, jobCtx, job)
+		case <-ctx.Done():
+		}
+	}
+
+	q.close()
+	if q.Persist != nil {
+		return nil
+	}
+	for {
+		select {
+		case job := <-q.ch:
+			q.process(ctx, jobCtx, job)
+		default:
+			return nil
+		}
+	}
+}
+
+func (q *JobQueue[T]) process(ctx, jobCtx context.Context, job T) {
+	interval := q.RetryInterval
+	if interval == 0 {
+		interval = defaultJobQueueRetryInterval
+	}
+
+	for i := 0; ; i++ {
+		err := q.Handler(jobCtx, job)
+		if err == nil {
+			return
+		}
+
+		fields := map[string]interface{}{
+			"attempts":  i + 1,
+			log.FnError: err.Error(),
+		}
+		if i >= q.MaxRetries {
+			q.logger().Error("well: queued job failed", fields)
+			return
+		}
+		q.logger().Warn("well: queued job failed; retrying", fields)
+
+		timer := ClockFromContext(ctx).NewTimer(interval)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			if q.Persist != nil {
+				timer.Stop()
+				q.mu.Lock()
+				q.leftover = append(q.leftover, job)
+				q.mu.Unlock()
+				return
+			}
+			<-timer.C()
+		}
+		interval *= 2
+	}
+}
+
+// close stops accepting jobs.
+func (q *JobQueue[T]) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+}
+
+func (q *JobQueue[T]) drain(ctx context.Context) error {
+	<-ctx.Done()
+
+	q.close()
+
+	q.workers.Wait()
+	if q.Persist == nil {
+		return nil
+	}
+
+	jobs := q.leftover
+	for len(q.ch) > 0 {
+		jobs = append(jobs, <-q.ch)
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	if err := q.Persist(jobs); err != nil {
+		q.logger().Error("well: failed to persist queued jobs", map[string]interface{}{
+			"jobs":      len(jobs),
+			log.FnError: err.Error(),
+		})
+		return nil
+	}
+	q.logger().Info("well: persisted queued jobs", map[string]interface{}{
+		"jobs": len(jobs),
+	})
+	return nil
+}
@@ -0,0 +1,155 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestJobQueue(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	logger.SetOutput(new(syncBuffer))
+
+	var mu sync.Mutex
+	var done []int
+	var attempts int32
+	q := &JobQueue[int]{
+		Env:           env,
+		Workers:       2,
+		Size:          10,
+		MaxRetries:    2,
+		RetryInterval: time.Millisecond,
+		Logger:        logger,
+		Handler: func(ctx context.Context, job int) error {
+			if job == 0 && atomic.AddInt32(&attempts, 1) < 3 {
+				return errors.New("retry")
+			}
+			mu.Lock()
+			done = append(done, job)
+			mu.Unlock()
+			return nil
+		},
+	}
+	if err := q.Enqueue(1); err != ErrQueueClosed {
+		t.Error(`err != ErrQueueClosed`, err)
+	}
+	q.Start()
+
+	for i := 0; i < 5; i++ {
+		if err := q.Enqueue(i); err != nil {
+			t.Error(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	env.Cancel(nil)
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+
+	if len(done) != 5 {
+		t.Error(`len(done) != 5`, done)
+	}
+	if atomic.LoadInt32(&attempts) != 3 {
+		t.Error(`attempts != 3`, attempts)
+	}
+	if err := q.Enqueue(5); err != ErrQueueClosed {
+		t.Error(`err != ErrQueueClosed`, err)
+	}
+}
+
+func TestJobQueueDrain(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	logger.SetOutput(new(syncBuffer))
+
+	block := make(chan struct{})
+	var processed int32
+	q := &JobQueue[int]{
+		Env:    env,
+		Size:   3,
+		Logger: logger,
+		Handler: func(ctx context.Context, job int) error {
+			<-block
+			if ctx.Err() != nil {
+				t.Error(`handler context is canceled`)
+			}
+			atomic.AddInt32(&processed, 1)
+			return nil
+		},
+	}
+	q.Start()
+
+	for i := 0; i < 4; i++ {
+		if err := q.Enqueue(i); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			// let the worker take the first job.
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if err := q.Enqueue(4); err != ErrQueueFull {
+		t.Error(`err != ErrQueueFull`, err)
+	}
+
+	env.Cancel(nil)
+	close(block)
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+	if atomic.LoadInt32(&processed) != 4 {
+		t.Error(`processed != 4`, processed)
+	}
+}
+
+func TestJobQueuePersist(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	logger.SetOutput(new(syncBuffer))
+
+	block := make(chan struct{})
+	var persisted []int
+	q := &JobQueue[int]{
+		Env:    env,
+		Logger: logger,
+		Handler: func(ctx context.Context, job int) error {
+			<-block
+			return nil
+		},
+		Persist: func(jobs []int) error {
+			persisted = jobs
+			return nil
+		},
+	}
+	q.Start()
+
+	for i := 0; i < 3; i++ {
+		if err := q.Enqueue(i); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	env.Cancel(nil)
+	close(block)
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+	if len(persisted) != 2 || persisted[0] != 1 || persisted[1] != 2 {
+		t.Error(`persisted != [1 2]`, persisted)
+	}
+}
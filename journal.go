@@ -0,0 +1,132 @@
+package well
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// JournalFormat implements log.Formatter to format logs in the
+// native protocol of systemd-journald.
+//
+// The message is recorded as MESSAGE field, the severity as PRIORITY,
+// and the topic of the logger as SYSLOG_IDENTIFIER.  Other fields are
+// recorded with their names in upper case.  Values containing newlines
+// or binary data are encoded safely, so they are not flattened.
+//
+// Each formatted log must be sent as a datagram.  Use DialJournal.
+//
+// https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+type JournalFormat struct{}
+
+// String returns "journal".
+func (f JournalFormat) String() string {
+	return "journal"
+}
+
+// Format implements log.Formatter.
+func (f JournalFormat) Format(buf []byte, l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) ([]byte, error) {
+	buf = appendJournalField(buf, "MESSAGE", []byte(msg))
+	buf = appendJournalField(buf, "PRIORITY", strconv.AppendInt(nil, int64(severity), 10))
+	buf = appendJournalField(buf, "SYSLOG_IDENTIFIER", []byte(l.Topic()))
+	buf = appendJournalField(buf, "SYSLOG_TIMESTAMP", []byte(t.UTC().Format(log.RFC3339Micro)))
+
+	for k, v := range fields {
+		buf = appendJournalField(buf, journalKey(k), journalValue(v))
+	}
+	for k, v := range l.Defaults() {
+		if _, ok := fields[k]; ok {
+			continue
+		}
+		buf = appendJournalField(buf, journalKey(k), journalValue(v))
+	}
+	return buf, nil
+}
+
+// journalKey converts a field name to a journal field name.
+// Leading underscores are removed as they are reserved for
+// trusted fields added by journald.
+func journalKey(k string) string {
+	k = strings.TrimLeft(strings.ToUpper(k), "_")
+	if len(k) == 0 {
+		return "FIELD"
+	}
+	return k
+}
+
+func journalValue(v interface{}) []byte {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(t)
+	case []byte:
+		return t
+	case time.Time:
+		return []byte(t.UTC().Format(log.RFC3339Micro))
+	case error:
+		return []byte(t.Error())
+	case fmt.Stringer:
+		return []byte(t.String())
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return []byte(fmt.Sprint(t))
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return []byte(fmt.Sprintf("%v", v))
+	}
+	return data
+}
+
+func appendJournalField(buf []byte, key string, value []byte) []byte {
+	buf = append(buf, key...)
+	if bytes.IndexByte(value, '\n') == -1 {
+		buf = append(buf, '=')
+		buf = append(buf, value...)
+		return append(buf, '\n')
+	}
+
+	// binary-safe encoding for values containing newlines.
+	buf = append(buf, '\n')
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(value)))
+	buf = append(buf, value...)
+	return append(buf, '\n')
+}
+
+// journalEntryWriter wraps data that are not formatted by JournalFormat
+// into journal entries, as journald discards them.  Such data are
+// written by Logger.WriteThrough, e.g. child outputs that could not
+// be formatted.
+type journalEntryWriter struct {
+	w      io.Writer
+	logger *log.Logger
+}
+
+func (w journalEntryWriter) Write(p []byte) (int, error) {
+	if bytes.HasPrefix(p, []byte("MESSAGE=")) || bytes.HasPrefix(p, []byte("MESSAGE\n")) {
+		return w.w.Write(p)
+	}
+
+	msg := bytes.TrimRight(p, "\r\n")
+	if len(msg) == 0 {
+		return len(p), nil
+	}
+	b, err := JournalFormat{}.Format(nil, w.logger, time.Now(), log.LvInfo, string(msg), nil)
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.w.Write(b)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,69 @@
+package well
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+type journalWriter struct {
+	conn *net.UnixConn
+}
+
+// DialJournal connects to systemd-journald to send logs formatted by
+// JournalFormat.  Each Write sends a log entry as a datagram.
+//
+// Entries too large for a datagram are passed via a memfd.
+func DialJournal() (io.WriteCloser, error) {
+	return dialJournal(journalSocket)
+}
+
+func dialJournal(path string) (io.WriteCloser, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalWriter{conn: conn}, nil
+}
+
+func (w *journalWriter) Write(p []byte) (int, error) {
+	_, err := w.conn.Write(p)
+	if err == nil {
+		return len(p), nil
+	}
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return 0, err
+	}
+
+	// send large entries via a sealed memfd.
+	fd, err := unix.MemfdCreate("well-journal", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return 0, err
+	}
+	f := os.NewFile(uintptr(fd), "well-journal")
+	defer f.Close()
+
+	_, err = f.Write(p)
+	if err != nil {
+		return 0, err
+	}
+	_, err = unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL)
+	if err != nil {
+		return 0, err
+	}
+	_, _, err = w.conn.WriteMsgUnix(nil, unix.UnixRights(int(f.Fd())), nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *journalWriter) Close() error {
+	return w.conn.Close()
+}
@@ -0,0 +1,137 @@
+package well
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+func parseJournalEntry(t *testing.T, data []byte) map[string]string {
+	entry := make(map[string]string)
+	for len(data) > 0 {
+		eol := bytes.IndexByte(data, '\n')
+		if eol == -1 {
+			t.Fatal(`unterminated field`)
+		}
+		line := data[:eol]
+		data = data[eol+1:]
+		if eq := bytes.IndexByte(line, '='); eq != -1 {
+			entry[string(line[:eq])] = string(line[eq+1:])
+			continue
+		}
+		n := binary.LittleEndian.Uint64(data)
+		entry[string(line)] = string(data[8 : 8+n])
+		data = data[8+n+1:]
+	}
+	return entry
+}
+
+func TestJournal(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	w, err := dialJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	logger := log.NewLogger()
+	logger.SetTopic("well.test")
+	logger.SetFormatter(JournalFormat{})
+	logger.SetOutput(w)
+	err = logger.Error("multi\nline", map[string]interface{}{
+		"_private": "x",
+		"count":    3,
+		"data":     []byte("a\x00b"),
+		"tags":     []string{"foo", "bar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := parseJournalEntry(t, buf[:n])
+
+	expected := map[string]string{
+		"MESSAGE":           "multi\nline",
+		"PRIORITY":          "3",
+		"SYSLOG_IDENTIFIER": "well.test",
+		"PRIVATE":           "x",
+		"COUNT":             "3",
+		"DATA":              "a\x00b",
+		"TAGS":              `["foo","bar"]`,
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("entry[%s] = %q", k, entry[k])
+		}
+	}
+}
+
+func TestJournalRawLine(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	w, err := dialJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	logger := log.NewLogger()
+	logger.SetTopic("well.test")
+	logger.SetFormatter(JournalFormat{})
+	logger.SetOutput(journalEntryWriter{w: w, logger: logger})
+
+	// a raw line relayed from a child process.
+	err = relayLog(logger, []byte("panic: test\n"), map[string]interface{}{"generation": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// raw data written through, e.g. by the fallback of relayLog.
+	err = logger.WriteThrough([]byte("goroutine 1 [running]:\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, expected := range []map[string]string{
+		{"MESSAGE": "panic: test", "PRIORITY": "6", "SYSLOG_IDENTIFIER": "well.test", "GENERATION": "2"},
+		{"MESSAGE": "goroutine 1 [running]:", "PRIORITY": "6", "SYSLOG_IDENTIFIER": "well.test"},
+	} {
+		n, err := server.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := parseJournalEntry(t, buf[:n])
+		for k, v := range expected {
+			if entry[k] != v {
+				t.Errorf("entry[%s] = %q", k, entry[k])
+			}
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package well
+
+import (
+	"errors"
+	"io"
+)
+
+// DialJournal is not supported other than Linux.
+func DialJournal() (io.WriteCloser, error) {
+	return nil, errors.New("journald is supported only on Linux")
+}
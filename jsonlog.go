@@ -60,4 +60,9 @@ type ExecLog struct {
 	RequestID string   `json:"request_id"`
 	Error     string   `json:"error"`
 	Stderr    string   `json:"stderr"`
+
+	ExitStatus int     `json:"exit_status"` // -1 if killed by a signal.
+	UserTime   float64 `json:"user_time"`   // floating point number of seconds.
+	SystemTime float64 `json:"system_time"` // floating point number of seconds.
+	MaxRSS     int64   `json:"max_rss"`     // bytes.  Not available on Windows.
 }
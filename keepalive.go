@@ -0,0 +1,76 @@
+package well
+
+import (
+	"net"
+	"time"
+)
+
+// KeepAliveConfig configures TCP keep-alive of accepted connections.
+//
+// Keep-alive probes let the server detect dead peers while it is
+// draining connections, so that such connections do not hold the
+// process until ShutdownTimeout or Graceful.ExitTimeout expires.
+type KeepAliveConfig struct {
+	// Enable enables TCP keep-alive.  If false, keep-alive is
+	// disabled and other fields are ignored.
+	Enable bool
+
+	// Idle is the duration a connection needs to be idle before
+	// the first keep-alive probe is sent.
+	//
+	// Zero is treated as the system default.
+	Idle time.Duration
+
+	// Interval is the duration between keep-alive probes.
+	//
+	// Zero is treated as the system default.
+	// Non-zero values are supported only on Linux.
+	Interval time.Duration
+
+	// Count is the number of unacknowledged probes before the
+	// connection is considered dead.
+	//
+	// Zero is treated as the system default.
+	// Non-zero values are supported only on Linux.
+	Count int
+}
+
+// apply configures conn if it is a *net.TCPConn.
+// Other connections are left untouched.
+func (c *KeepAliveConfig) apply(conn net.Conn) error {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if err := tc.SetKeepAlive(c.Enable); err != nil {
+		return err
+	}
+	if !c.Enable {
+		return nil
+	}
+
+	// SetKeepAlivePeriod sets both the idle time and the interval.
+	// The interval is overwritten below if specified.
+	if c.Idle > 0 {
+		if err := tc.SetKeepAlivePeriod(c.Idle); err != nil {
+			return err
+		}
+	}
+	if c.Interval <= 0 && c.Count <= 0 {
+		return nil
+	}
+
+	rc, err := tc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		serr = setKeepAliveParams(fd, c.Interval, c.Count)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
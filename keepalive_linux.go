@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+package well
+
+import (
+	"syscall"
+	"time"
+)
+
+func setKeepAliveParams(fd uintptr, interval time.Duration, count int) error {
+	if interval > 0 {
+		secs := int((interval + time.Second - 1) / time.Second)
+		err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, secs)
+		if err != nil {
+			return err
+		}
+	}
+	if count > 0 {
+		err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package well
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func getTCPOpt(t *testing.T, conn net.Conn, level, opt int) int {
+	rc, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var val int
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		val, serr = syscall.GetsockoptInt(int(fd), level, opt)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	return val
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	type opts struct {
+		enabled, idle, interval, count int
+	}
+	ch := make(chan opts, 1)
+	handler := func(ctx context.Context, conn net.Conn) {
+		ch <- opts{
+			enabled:  getTCPOpt(t, conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE),
+			idle:     getTCPOpt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE),
+			interval: getTCPOpt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL),
+			count:    getTCPOpt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT),
+		}
+	}
+
+	env := NewEnvironment(context.Background())
+	s := &Server{
+		Handler: handler,
+		KeepAlive: &KeepAliveConfig{
+			Enable:   true,
+			Idle:     30 * time.Second,
+			Interval: 5 * time.Second,
+			Count:    3,
+		},
+		Env: env,
+	}
+	s.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var o opts
+	select {
+	case o = <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler was not called")
+	}
+	if o.enabled == 0 {
+		t.Error(`o.enabled == 0`)
+	}
+	if o.idle != 30 {
+		t.Error(`o.idle != 30`, o.idle)
+	}
+	if o.interval != 5 {
+		t.Error(`o.interval != 5`, o.interval)
+	}
+	if o.count != 3 {
+		t.Error(`o.count != 3`, o.count)
+	}
+
+	env.Cancel(nil)
+	env.Wait()
+}
+
+func TestServerKeepAliveDisable(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	ch := make(chan int, 1)
+	handler := func(ctx context.Context, conn net.Conn) {
+		ch <- getTCPOpt(t, conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE)
+	}
+
+	env := NewEnvironment(context.Background())
+	s := &Server{
+		Handler:   handler,
+		KeepAlive: &KeepAliveConfig{},
+		Env:       env,
+	}
+	s.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case enabled := <-ch:
+		if enabled != 0 {
+			t.Error(`enabled != 0`, enabled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler was not called")
+	}
+
+	env.Cancel(nil)
+	env.Wait()
+}
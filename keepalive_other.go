@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package well
+
+import (
+	"errors"
+	"time"
+)
+
+func setKeepAliveParams(fd uintptr, interval time.Duration, count int) error {
+	return errors.New("keep-alive interval and count are not supported")
+}
@@ -0,0 +1,92 @@
+package well
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultPreStopDelay = 5 * time.Second
+	defaultGracePeriod  = 30 * time.Second
+
+	// gracePeriodMargin is the time left to log and flush before
+	// the end of the grace period.
+	gracePeriodMargin = time.Second
+)
+
+var (
+	kubernetesMu     sync.Mutex
+	kubernetesConfig *KubernetesConfig
+)
+
+// KubernetesConfig configures the termination of the program running
+// in a Kubernetes pod.
+//
+// When applied, a stop signal makes the global environment do the
+// following instead of waiting for CANCELLATION_DELAY_SECONDS:
+//
+//  1. Mark the program not ready.  See SetReady and ReadinessHandler.
+//  2. Wait for PreStopDelay so that the pod is removed from endpoints.
+//  3. Cancel the global environment.
+//  4. Exit with status 3 if Wait does not return within GracePeriod
+//     from the signal, just before Kubernetes sends SIGKILL.
+//     Running tasks are logged and logs are flushed before exit.
+//
+// PreStopDelay defaults to 5 seconds.  GracePeriod should be the same
+// as terminationGracePeriodSeconds of the pod, and defaults to 30
+// seconds.  If the pod has a preStop hook that sleeps, the sleep time
+// should be subtracted from GracePeriod.
+type KubernetesConfig struct {
+	PreStopDelay time.Duration `toml:"pre_stop_delay" json:"pre_stop_delay" yaml:"pre_stop_delay"`
+	GracePeriod  time.Duration `toml:"grace_period"   json:"grace_period"   yaml:"grace_period"`
+}
+
+// Apply applies configurations to the global environment.
+func (c KubernetesConfig) Apply() {
+	if c.PreStopDelay <= 0 {
+		c.PreStopDelay = defaultPreStopDelay
+	}
+	if c.GracePeriod <= 0 {
+		c.GracePeriod = defaultGracePeriod
+	}
+
+	kubernetesMu.Lock()
+	kubernetesConfig = &c
+	kubernetesMu.Unlock()
+}
+
+func getKubernetesConfig() *KubernetesConfig {
+	kubernetesMu.Lock()
+	defer kubernetesMu.Unlock()
+	return kubernetesConfig
+}
+
+// terminate stops env by the Kubernetes way.
+func (c *KubernetesConfig) terminate(env *Environment, s os.Signal) {
+	start := time.Now()
+	setReady(false)
+	log.Warn("well: got signal, terminating", map[string]interface{}{
+		"signal":         s.String(),
+		"pre_stop_delay": c.PreStopDelay.String(),
+		"grace_period":   c.GracePeriod.String(),
+	})
+
+	timer := time.AfterFunc(c.GracePeriod-gracePeriodMargin, func() {
+		log.Error("well: grace period is running out, exiting", map[string]interface{}{
+			"elapsed": time.Since(start).String(),
+			"tasks":   env.runningTasks(),
+		})
+		FlushLogs()
+		os.Exit(forceExitCode)
+	})
+	go func() {
+		env.Wait()
+		timer.Stop()
+	}()
+
+	time.Sleep(c.PreStopDelay)
+	env.Cancel(signalError{sig: s})
+}
@@ -0,0 +1,39 @@
+package well
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKubernetesTerminate(t *testing.T) {
+	defer SetReady(true)
+
+	env := NewEnvironment(context.Background())
+	env.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	env.Stop()
+
+	c := &KubernetesConfig{
+		PreStopDelay: 100 * time.Millisecond,
+		GracePeriod:  time.Minute,
+	}
+	start := time.Now()
+	go c.terminate(env, syscall.SIGTERM)
+
+	time.Sleep(10 * time.Millisecond)
+	if IsReady() {
+		t.Error(`IsReady()`)
+	}
+
+	err := env.Wait()
+	if SignalFrom(err) != syscall.SIGTERM {
+		t.Error(`SignalFrom(err) != syscall.SIGTERM`, err)
+	}
+	if time.Since(start) < c.PreStopDelay {
+		t.Error(`canceled before PreStopDelay`)
+	}
+}
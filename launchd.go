@@ -0,0 +1,46 @@
+package well
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// LaunchdListeners returns listeners of the socket named name in
+// the Sockets dictionary of the launchd.plist.  This is the equivalent
+// of launch_activate_socket(3) and SystemdListeners for macOS daemons
+// managed by launchd.
+//
+// If the process is not managed by launchd or not on macOS, this
+// returns (nil, nil).  On macOS, this requires cgo.
+func LaunchdListeners(name string) ([]net.Listener, error) {
+	fds, err := launchdActivateSocket(name)
+	if err == syscall.ESRCH {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("launch_activate_socket: " + name + ": " + err.Error())
+	}
+
+	files := make([]*os.File, len(fds))
+	for i, fd := range fds {
+		files[i] = os.NewFile(uintptr(fd), "FD"+strconv.Itoa(fd))
+	}
+
+	ls := make([]net.Listener, 0, len(files))
+	for i, f := range files {
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, f := range files[i+1:] {
+				f.Close()
+			}
+			ListenerGroup(ls).Close()
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
@@ -0,0 +1,34 @@
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package well
+
+/*
+#include <launch.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func launchdActivateSocket(name string) ([]int, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var fds *C.int
+	var cnt C.size_t
+	ret := C.launch_activate_socket(cname, &fds, &cnt)
+	if ret != 0 {
+		return nil, syscall.Errno(ret)
+	}
+	defer C.free(unsafe.Pointer(fds))
+
+	result := make([]int, 0, int(cnt))
+	for _, fd := range unsafe.Slice(fds, int(cnt)) {
+		result = append(result, int(fd))
+	}
+	return result, nil
+}
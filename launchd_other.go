@@ -0,0 +1,17 @@
+//go:build !darwin || !cgo
+// +build !darwin !cgo
+
+package well
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+)
+
+func launchdActivateSocket(name string) ([]int, error) {
+	if runtime.GOOS == "darwin" {
+		return nil, errors.New("cgo is required")
+	}
+	return nil, syscall.ESRCH
+}
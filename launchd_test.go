@@ -0,0 +1,22 @@
+package well
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestLaunchdListeners(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "darwin" {
+		t.Skip("the result depends on cgo and launchd")
+	}
+
+	ls, err := LaunchdListeners("Listeners")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls != nil {
+		t.Error(`ls != nil`, ls)
+	}
+}
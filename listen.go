@@ -0,0 +1,267 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Listen creates a listener from an address spec.  Specs are:
+//
+//   - "tcp://HOST:PORT", "tcp4://HOST:PORT", "tcp6://HOST:PORT"
+//   - "tcp46://:PORT" for ListenAll only, see ListenAll
+//   - "HOST:PORT", same as "tcp://HOST:PORT"
+//   - "unix:///PATH", optionally with "mode", "owner", "group", and
+//     "remove_stale" options of UnixListenerConfig as a query string,
+//     e.g. "unix:///run/app.sock?mode=0660&group=app&remove_stale=true"
+//   - "sctp://HOST:PORT", "sctp4://HOST:PORT", "sctp6://HOST:PORT"
+//     for SCTP listeners, see ListenSCTP
+//   - "fd://N" for an inherited listening socket of file descriptor N
+//   - "systemd://NAME" for a socket passed by systemd socket activation
+//     whose FileDescriptorName= is NAME
+//
+// TCP specs accept the following options as a query string, e.g.
+// "tcp://:443?fastopen=256&defer_accept=5s":
+//
+//   - "fastopen=N" enables TCP Fast Open with the queue length N
+//   - "defer_accept=DURATION" wakes up Accept only when data arrives
+//     or DURATION passes
+//
+// These options are supported only on Linux.
+//
+// "sctp://" is supported only on Linux.
+// "fd://" and "systemd://" are not supported on Windows.
+// "systemd://" cannot be used together with SystemdListeners or
+// SystemdAllSockets.
+func Listen(spec string) (net.Listener, error) {
+	if !strings.Contains(spec, "://") {
+		return net.Listen("tcp", spec)
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6":
+		if len(u.Host) == 0 {
+			return nil, errors.New("no address in " + spec)
+		}
+		opts, err := parseTCPOptions(u)
+		if err != nil {
+			return nil, err
+		}
+		return opts.listenConfig(false).Listen(context.Background(), u.Scheme, u.Host)
+	case "sctp", "sctp4", "sctp6":
+		if len(u.Host) == 0 {
+			return nil, errors.New("no address in " + spec)
+		}
+		return ListenSCTP(u.Scheme, u.Host)
+	case "unix":
+		return listenUnix(u)
+	case "fd":
+		fd, err := strconv.Atoi(u.Host)
+		if err != nil || fd < 0 {
+			return nil, errors.New("invalid file descriptor in " + spec)
+		}
+		return listenFD(fd)
+	case "systemd":
+		if len(u.Host) == 0 {
+			return nil, errors.New("no socket name in " + spec)
+		}
+		return listenSystemd(u.Host)
+	case "tcp46":
+		return nil, errors.New("tcp46 is supported only by ListenAll")
+	}
+	return nil, errors.New("unsupported listener: " + spec)
+}
+
+// ListenerGroup is a group of listeners that serve one logical service,
+// e.g. on IPv4, IPv6, and a UNIX domain socket.
+type ListenerGroup []net.Listener
+
+// Close closes all listeners and returns the first error, if any.
+func (g ListenerGroup) Close() error {
+	var firstErr error
+	for _, l := range g {
+		if err := l.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Addrs returns the addresses of listeners.
+func (g ListenerGroup) Addrs() []net.Addr {
+	addrs := make([]net.Addr, len(g))
+	for i, l := range g {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// ListenAll creates listeners from address specs by Listen.
+// If any of specs fails, listeners already created are closed.
+//
+// In addition to specs of Listen, ListenAll accepts "tcp46://:PORT"
+// that creates two listeners for all IPv4 addresses and all IPv6
+// addresses on PORT.  The IPv6 listener does not accept IPv4
+// connections.  If PORT is 0, the IPv6 listener uses the port chosen
+// for the IPv4 listener.
+//
+// This can be used to implement Graceful.Listen.
+func ListenAll(specs []string) (ListenerGroup, error) {
+	g := make(ListenerGroup, 0, len(specs))
+	for _, spec := range specs {
+		var err error
+		if strings.HasPrefix(spec, "tcp46://") {
+			var ls []net.Listener
+			ls, err = listenDualStack(spec)
+			g = append(g, ls...)
+		} else {
+			var l net.Listener
+			l, err = Listen(spec)
+			if err == nil {
+				g = append(g, l)
+			}
+		}
+		if err != nil {
+			g.Close()
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// listenDualStack creates an IPv4 listener and an IPv6-only listener
+// on the same port.
+func listenDualStack(spec string) ([]net.Listener, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if len(host) > 0 {
+		return nil, errors.New("tcp46 does not accept host: " + spec)
+	}
+	opts, err := parseTCPOptions(u)
+	if err != nil {
+		return nil, err
+	}
+
+	l4, err := opts.listenConfig(false).Listen(context.Background(), "tcp4", net.JoinHostPort("0.0.0.0", port))
+	if err != nil {
+		return nil, err
+	}
+	port = strconv.Itoa(l4.Addr().(*net.TCPAddr).Port)
+
+	l6, err := opts.listenConfig(true).Listen(context.Background(), "tcp6", net.JoinHostPort("::", port))
+	if err != nil {
+		l4.Close()
+		return nil, err
+	}
+	return []net.Listener{l4, l6}, nil
+}
+
+// tcpOptions are socket options of TCP listeners given as the query
+// string of specs.
+type tcpOptions struct {
+	fastOpen    int
+	deferAccept time.Duration
+}
+
+func parseTCPOptions(u *url.URL) (tcpOptions, error) {
+	var opts tcpOptions
+	for k, v := range u.Query() {
+		switch k {
+		case "fastopen":
+			n, err := strconv.Atoi(v[0])
+			if err != nil || n <= 0 {
+				return opts, errors.New("invalid fastopen in " + u.String())
+			}
+			opts.fastOpen = n
+		case "defer_accept":
+			d, err := time.ParseDuration(v[0])
+			if err != nil || d <= 0 {
+				return opts, errors.New("invalid defer_accept in " + u.String())
+			}
+			opts.deferAccept = d
+		default:
+			return opts, errors.New("unknown option " + k + " in " + u.String())
+		}
+	}
+	return opts, nil
+}
+
+func (o tcpOptions) listenConfig(ipv6Only bool) *net.ListenConfig {
+	if o == (tcpOptions{}) && !ipv6Only {
+		return &net.ListenConfig{}
+	}
+
+	return &net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var serr error
+			err := c.Control(func(fd uintptr) {
+				if ipv6Only {
+					if serr = setIPv6Only(fd); serr != nil {
+						return
+					}
+				}
+				if o.fastOpen > 0 {
+					if serr = setTCPFastOpen(fd, o.fastOpen); serr != nil {
+						return
+					}
+				}
+				if o.deferAccept > 0 {
+					serr = setTCPDeferAccept(fd, o.deferAccept)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return serr
+		},
+	}
+}
+
+func listenUnix(u *url.URL) (net.Listener, error) {
+	path := u.Path
+	if len(u.Host) > 0 {
+		// unix://relative/path
+		path = u.Host + path
+	}
+	if len(path) == 0 {
+		return nil, errors.New("no socket path in " + u.String())
+	}
+
+	q := u.Query()
+	cfg := &UnixListenerConfig{
+		Owner: q.Get("owner"),
+		Group: q.Get("group"),
+	}
+	if m := q.Get("mode"); len(m) > 0 {
+		n, err := strconv.ParseUint(m, 8, 32)
+		if err != nil || n > 0777 {
+			return nil, errors.New("invalid mode in " + u.String())
+		}
+		cfg.Mode = os.FileMode(n)
+	}
+	if st := q.Get("remove_stale"); len(st) > 0 {
+		b, err := strconv.ParseBool(st)
+		if err != nil {
+			return nil, errors.New("invalid remove_stale in " + u.String())
+		}
+		cfg.RemoveStale = b
+	}
+	return CreateUnixListener(path, cfg)
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package well
+
+import (
+	"syscall"
+	"time"
+)
+
+// tcpFastOpen is TCP_FASTOPEN, which is missing in package syscall.
+const tcpFastOpen = 0x17
+
+func setTCPFastOpen(fd uintptr, qlen int) error {
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpen, qlen)
+}
+
+func setTCPDeferAccept(fd uintptr, d time.Duration) error {
+	secs := int((d + time.Second - 1) / time.Second)
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT, secs)
+}
@@ -0,0 +1,38 @@
+package well
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestListenTCPOptions(t *testing.T) {
+	t.Parallel()
+
+	l, err := Listen("tcp://127.0.0.1:0?fastopen=16&defer_accept=2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	n, err := syscall.GetsockoptInt(int(f.Fd()), syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Error(`TCP_DEFER_ACCEPT is not set`)
+	}
+	n, err = syscall.GetsockoptInt(int(f.Fd()), syscall.IPPROTO_TCP, tcpFastOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 16 {
+		t.Error(`n != 16`, n)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package well
+
+import (
+	"errors"
+	"time"
+)
+
+func setTCPFastOpen(fd uintptr, qlen int) error {
+	return errors.New("fastopen is not supported")
+}
+
+func setTCPDeferAccept(fd uintptr, d time.Duration) error {
+	return errors.New("defer_accept is not supported")
+}
@@ -0,0 +1,92 @@
+package well
+
+import (
+	"net"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range []string{"127.0.0.1:0", "tcp://127.0.0.1:0", "tcp4://127.0.0.1:0"} {
+		l, err := Listen(spec)
+		if err != nil {
+			t.Error(spec, err)
+			continue
+		}
+		if _, ok := l.Addr().(*net.TCPAddr); !ok {
+			t.Error(spec, l.Addr())
+		}
+		l.Close()
+	}
+
+	for _, spec := range []string{
+		"tcp://", "udp://127.0.0.1:0", "unix://", "fd://x", "fd://-1", "systemd://",
+		"unix:///tmp/well.sock?mode=999", "tcp://127.0.0.1:0?fastopen=0",
+		"tcp://127.0.0.1:0?defer_accept=x", "tcp://127.0.0.1:0?unknown=1",
+	} {
+		if l, err := Listen(spec); err == nil {
+			l.Close()
+			t.Error(`Listen should fail:`, spec)
+		}
+	}
+}
+
+func TestListenAll(t *testing.T) {
+	t.Parallel()
+
+	ls, err := ListenAll([]string{"127.0.0.1:0", "tcp://127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 2 {
+		t.Error(`len(ls) != 2`, len(ls))
+	}
+	if len(ls.Addrs()) != 2 {
+		t.Error(`len(ls.Addrs()) != 2`, ls.Addrs())
+	}
+	if err := ls.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := ListenAll([]string{"127.0.0.1:0", "bad://"}); err == nil {
+		t.Error(`ListenAll should fail`)
+	}
+}
+
+func TestListenAllDualStack(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available")
+	}
+	l.Close()
+
+	ls, err := ListenAll([]string{"tcp46://:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+
+	if len(ls) != 2 {
+		t.Fatal(`len(ls) != 2`, len(ls))
+	}
+	a4 := ls[0].Addr().(*net.TCPAddr)
+	a6 := ls[1].Addr().(*net.TCPAddr)
+	if a4.IP.To4() == nil || a6.IP.To4() != nil {
+		t.Error(`unexpected addresses`, a4, a6)
+	}
+	if a4.Port != a6.Port {
+		t.Error(`a4.Port != a6.Port`, a4.Port, a6.Port)
+	}
+
+	for _, spec := range []string{"tcp46://127.0.0.1:0", "tcp46://x"} {
+		if _, err := ListenAll([]string{spec}); err == nil {
+			t.Error(`ListenAll should fail:`, spec)
+		}
+	}
+	if _, err := Listen("tcp46://:0"); err == nil {
+		t.Error(`Listen should fail for tcp46`)
+	}
+}
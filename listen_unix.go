@@ -0,0 +1,87 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var (
+	systemdNamedMu     sync.Mutex
+	systemdNamedLoaded bool
+	systemdNamedFDs    map[string][]int
+)
+
+func listenFD(fd int) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), "FD"+strconv.Itoa(fd))
+	if f == nil {
+		return nil, errors.New("invalid file descriptor: " + strconv.Itoa(fd))
+	}
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// listenSystemd returns a listener passed by systemd socket activation
+// by its name.  If there are multiple sockets of the same name, they
+// are returned in order by successive calls.
+func listenSystemd(name string) (net.Listener, error) {
+	systemdNamedMu.Lock()
+	defer systemdNamedMu.Unlock()
+
+	if !systemdNamedLoaded {
+		systemdNamedLoaded = true
+		pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+		if err == nil && pid == os.Getpid() {
+			nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+			os.Unsetenv("LISTEN_FDS")
+			if err != nil {
+				return nil, err
+			}
+			systemdNamedFDs = groupSystemdFDs(nfds, os.Getenv("LISTEN_FDNAMES"))
+		}
+	}
+
+	fds := systemdNamedFDs[name]
+	if len(fds) == 0 {
+		return nil, errors.New("no systemd socket named " + name)
+	}
+	systemdNamedFDs[name] = fds[1:]
+	f := os.NewFile(uintptr(fds[0]), name)
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// groupSystemdFDs groups file descriptors passed by systemd by
+// their names.  Unnamed sockets are named "unknown" as systemd does.
+func groupSystemdFDs(nfds int, fdnames string) map[string][]int {
+	var names []string
+	if len(fdnames) > 0 {
+		names = strings.Split(fdnames, ":")
+	}
+
+	m := make(map[string][]int)
+	for i := 0; i < nfds; i++ {
+		fd := 3 + i
+		name := "unknown"
+		if i < len(names) && len(names[i]) > 0 {
+			name = names[i]
+		}
+		m[name] = append(m[name], fd)
+	}
+	return m
+}
+
+func setIPv6Only(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 1)
+}
+
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "test.sock")
+	l, err := Listen("unix://" + p + "?mode=0600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Error(`fi.Mode().Perm() != 0600`, fi.Mode().Perm())
+	}
+}
+
+func TestListenFD(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Listen takes the ownership of fd.
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l2, err := Listen("fd://" + strconv.Itoa(fd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	if l2.Addr().String() != l.Addr().String() {
+		t.Error(`l2.Addr() != l.Addr()`, l2.Addr(), l.Addr())
+	}
+}
+
+func TestGroupSystemdFDs(t *testing.T) {
+	t.Parallel()
+
+	m := groupSystemdFDs(4, "http:https::http")
+	if len(m["http"]) != 2 || len(m["https"]) != 1 || len(m["unknown"]) != 1 {
+		t.Error(`unexpected grouping`, m)
+	}
+	if m["http"][0] != 3 || m["http"][1] != 6 {
+		t.Error(`unexpected fds`, m["http"])
+	}
+}
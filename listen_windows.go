@@ -0,0 +1,29 @@
+//go:build windows
+// +build windows
+
+package well
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+func listenFD(fd int) (net.Listener, error) {
+	return nil, errors.New("fd:// is not supported on Windows")
+}
+
+func listenSystemd(name string) (net.Listener, error) {
+	return nil, errors.New("systemd:// is not supported on Windows")
+}
+
+func setIPv6Only(fd uintptr) error {
+	return syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 1)
+}
+
+// wsaeconnrefused is WSAECONNREFUSED.
+const wsaeconnrefused = syscall.Errno(10061)
+
+func isConnRefused(err error) bool {
+	return errors.Is(err, wsaeconnrefused)
+}
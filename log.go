@@ -4,18 +4,30 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"io"
+	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/cybozu-go/log"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+const (
+	// environment variables to configure logging.
+	// CYBOZU_LOG_LEVEL is defined in cybozu-go/log as log.EnvLogLevel.
+	logFileEnv    = "CYBOZU_LOG_FILE"
+	logFormatEnv  = "CYBOZU_LOG_FORMAT"
+	logModulesEnv = "CYBOZU_LOG_MODULES"
+)
+
 var (
 	// empty default values indicates unspecified condition.
 	logFilename = flag.String("logfile", "", "Log filename")
 	logLevel    = flag.String("loglevel", "", "Log level [critical,error,warning,info,debug]")
 	logFormat   = flag.String("logformat", "", "Log format [plain,logfmt,json]")
+	logModules  = flag.String("logmodules", "", "Log levels of modules [NAME=LEVEL,...]")
 
 	ignoreLogFilename bool
 )
@@ -29,11 +41,18 @@ func init() {
 	pflag.String("logfile", "", "Log filename")
 	pflag.String("loglevel", "", "Log level [critical,error,warning,info,debug]")
 	pflag.String("logformat", "", "Log format [plain,logfmt,json]")
+	pflag.String("logmodules", "", "Log levels of modules [NAME=LEVEL,...]")
 	viper.BindPFlag("log.file", pflag.Lookup("logfile"))
 	viper.BindPFlag("log.level", pflag.Lookup("loglevel"))
 	viper.BindPFlag("log.format", pflag.Lookup("logformat"))
+	viper.BindPFlag("log.modules", pflag.Lookup("logmodules"))
 }
 
+// primaryFormats keeps the formatter of the primary output for each
+// *log.Logger configured by LogConfig.  Unlike the formatter of the
+// logger, it does not write to additional outputs nor export to OTLP.
+var primaryFormats sync.Map
+
 // LogConfig configures cybozu-go/log's default logger.
 //
 // Filename, if not an empty string, specifies the output filename.
@@ -46,16 +65,89 @@ func init() {
 // Available formatters are "plain", "logfmt", and "json".
 // Empty string is treated as "plain".
 //
+// Modules specifies threshold levels of module loggers in the form
+// of "NAME=LEVEL,...".  See SetModuleLevels and Module.
+//
+// StackTrace, if true, attaches stack traces and goroutine IDs to
+// logs of error and higher severities.  See StackTraceFormat.
+//
+// Async, if true, buffers logs in memory and writes them by a
+// background goroutine.  See AsyncWriter.  Buffered logs are flushed
+// by FlushLogs, Wait, and ErrorExit.
+//
+// Sample, if not nil, suppresses repeated log messages in all
+// destinations by LogSampler.  The number of suppressed logs is
+// reported at the end of each window.
+//
+// Redact is a list of case-insensitive regular expressions that
+// match the names of sensitive fields such as "password" or "token".
+// Values of matching fields, including the entries of map values,
+// are replaced by "[REDACTED]" in all destinations.  See LogRedactor.
+//
+// Syslog, if not an empty string, specifies the address of a syslog
+// server to send logs in RFC 5424 format.  See DialSyslog for the
+// address format.  Syslog and Filename are exclusive.
+// With syslog, Format specifies the format of the message part.
+//
+// SyslogFacility is the syslog facility name such as "daemon" or
+// "local0".  Empty string is treated as "user".
+//
+// EventLog, if not an empty string, specifies the source name to
+// write logs to Windows Event Log instead of the standard error.
+// Event types are chosen by log severities, and the event ID is the
+// severity number.  Format specifies the format of event messages.
+// EventLog is exclusive with Filename and Syslog, and is available
+// only on Windows.
+//
+// Journald, if true, sends logs to systemd-journald using its native
+// protocol instead of writing them to the standard error.  Fields are
+// recorded as journal fields, so Format is ignored.  Journald is
+// exclusive with Filename, Syslog, and EventLog, and is available only
+// on Linux.  See JournalFormat.
+//
+// Outputs specifies additional destinations of logs, each with its
+// own level and format.  When Outputs is not empty, the threshold of
+// the default logger is set to the most verbose level among all
+// destinations, and each destination filters logs by its own level.
+//
+// OTLPEndpoint, if not an empty string, specifies the URL of an
+// OTLP/HTTP logs endpoint such as "http://localhost:4318/v1/logs".
+// Logs are exported to the endpoint in addition to the local output.
+// OTEL_EXPORTER_OTLP_LOGS_ENDPOINT environment variable takes
+// precedence over this.  See OTLPExporter and FlushLogs.
+//
 // For details, see https://godoc.org/github.com/cybozu-go/log .
 type LogConfig struct {
 	Filename string `toml:"filename" json:"filename" yaml:"filename"`
 	Level    string `toml:"level"    json:"level"    yaml:"level"`
 	Format   string `toml:"format"   json:"format"   yaml:"format"`
+	Modules  string `toml:"modules"  json:"modules"  yaml:"modules"`
+
+	StackTrace bool `toml:"stack_trace" json:"stack_trace" yaml:"stack_trace"`
+	Async      bool `toml:"async"       json:"async"       yaml:"async"`
+
+	Sample *LogSampleConfig `toml:"sample" json:"sample" yaml:"sample"`
+
+	Redact []string `toml:"redact" json:"redact" yaml:"redact"`
+
+	Syslog         string `toml:"syslog"          json:"syslog"          yaml:"syslog"`
+	SyslogFacility string `toml:"syslog_facility" json:"syslog_facility" yaml:"syslog_facility"`
+
+	EventLog string `toml:"event_log" json:"event_log" yaml:"event_log"`
+	Journald bool   `toml:"journald"  json:"journald"  yaml:"journald"`
+
+	Outputs []LogOutput `toml:"outputs" json:"outputs" yaml:"outputs"`
+
+	OTLPEndpoint string `toml:"otlp_endpoint" json:"otlp_endpoint" yaml:"otlp_endpoint"`
 }
 
 // Apply applies configurations to the default logger.
 //
-// Command-line flags take precedence over the struct member values.
+// Environment variables CYBOZU_LOG_FILE, CYBOZU_LOG_LEVEL,
+// CYBOZU_LOG_FORMAT, and CYBOZU_LOG_MODULES take precedence over
+// the struct member values.
+//
+// Command-line flags take precedence over the environment variables.
 //
 // When used with github.com/spf13/{pflag,viper}, pflag values are
 // bound to viper database, and Apply look for following keys
@@ -63,18 +155,57 @@ type LogConfig struct {
 //   - log.file
 //   - log.level
 //   - log.format
+//   - log.modules
 //
-// If they are not empty, they take precedence over the struct member values.
+// If they are not empty, they take precedence over the struct member
+// values and the environment variables.
+//
+// Apply can be called again, e.g. to reload the configuration.  Log
+// files, connections, and buffers opened by the previous call are
+// flushed and closed after the new configuration takes effect.
 func (c LogConfig) Apply() error {
-	logger := log.DefaultLogger()
+	return c.apply(log.DefaultLogger(), logFlagValues{
+		filename: *logFilename,
+		level:    *logLevel,
+		format:   *logFormat,
+		modules:  *logModules,
+	}, true)
+}
 
-	filename := c.Filename
-	if len(*logFilename) > 0 {
-		filename = *logFilename
+// logFlagValues is a set of values given by command-line flags.
+type logFlagValues struct {
+	filename string
+	level    string
+	format   string
+	modules  string
+}
+
+func (c LogConfig) apply(logger *log.Logger, fv logFlagValues, useViper bool) (err error) {
+	res := new(logResources)
+	defer func() {
+		if err != nil {
+			res.release()
+		}
+	}()
+
+	key := func(k string) string {
+		if !useViper {
+			return ""
+		}
+		return k
+	}
+
+	filename := configValue(c.Filename, logFileEnv, fv.filename, key("log.file"))
+	if len(filename) > 0 && len(c.Syslog) > 0 {
+		return errors.New("both filename and syslog are specified")
+	}
+	if len(c.EventLog) > 0 && (len(filename) > 0 || len(c.Syslog) > 0) {
+		return errors.New("event log cannot be used with filename or syslog")
 	}
-	if v := viper.GetString("log.file"); len(v) > 0 {
-		filename = v
+	if c.Journald && (len(filename) > 0 || len(c.Syslog) > 0 || len(c.EventLog) > 0) {
+		return errors.New("journald cannot be used with filename, syslog, or event log")
 	}
+	var output io.Writer
 	if len(filename) > 0 && !ignoreLogFilename {
 		abspath, err := filepath.Abs(filename)
 		if err != nil {
@@ -84,43 +215,190 @@ func (c LogConfig) Apply() error {
 		if err != nil {
 			return err
 		}
-		logger.SetOutput(w)
+		res.addCloser(w)
+		output = w
 	}
 
-	level := c.Level
-	if len(*logLevel) > 0 {
-		level = *logLevel
-	}
-	if v := viper.GetString("log.level"); len(v) > 0 {
-		level = v
-	}
+	level := configValue(c.Level, log.EnvLogLevel, fv.level, key("log.level"))
 	if len(level) == 0 {
 		level = "info"
 	}
-	err := logger.SetThresholdByName(level)
+	err = logger.SetThresholdByName(level)
+	if err != nil {
+		return err
+	}
+
+	modules := configValue(c.Modules, logModulesEnv, fv.modules, key("log.modules"))
+	err = SetModuleLevels(modules)
 	if err != nil {
 		return err
 	}
 
-	format := c.Format
-	if len(*logFormat) > 0 {
-		format = *logFormat
+	format := configValue(c.Format, logFormatEnv, fv.format, key("log.format"))
+	formatter, err := formatterByName(format)
+	if err != nil {
+		return err
+	}
+	if c.Journald && !ignoreLogFilename {
+		formatter = JournalFormat{}
+	}
+	if c.StackTrace {
+		formatter = StackTraceFormat{Formatter: formatter}
 	}
-	if v := viper.GetString("log.format"); len(v) > 0 {
-		format = v
+	var redactor *LogRedactor
+	if len(c.Redact) > 0 {
+		redactor, err = NewLogRedactor(c.Redact...)
+		if err != nil {
+			return err
+		}
 	}
+
+	// Unlike log files and journald, child processes of graceful
+	// restarting server connect to syslog, additional outputs, and
+	// OTLP endpoints by themselves so that their logs are recorded
+	// with their PIDs.  The master process relays the standard error
+	// outputs of children only to its primary output.  See relayLog.
+	if len(c.Syslog) > 0 {
+		facility, err := SyslogFacility(c.SyslogFacility)
+		if err != nil {
+			return err
+		}
+		w, err := DialSyslog(c.Syslog)
+		if err != nil {
+			return err
+		}
+		res.addCloser(w)
+		output = w
+		formatter = SyslogFormat{Facility: facility, Body: formatter}
+	}
+
+	if c.Journald && !ignoreLogFilename {
+		w, err := DialJournal()
+		if err != nil {
+			return err
+		}
+		res.addCloser(w)
+		output = journalEntryWriter{w: w, logger: logger}
+	}
+
+	if len(c.EventLog) > 0 {
+		formatter, err = newEventLogFormat(c.EventLog, formatter)
+		if err != nil {
+			return err
+		}
+		if cl, ok := formatter.(io.Closer); ok {
+			res.addCloser(cl)
+		}
+	}
+
+	primary := formatter
+
+	otlpEndpoint := c.OTLPEndpoint
+	if v := os.Getenv(otlpLogsEndpointEnv); len(v) > 0 {
+		otlpEndpoint = v
+	}
+	if len(otlpEndpoint) > 0 {
+		exporter := &OTLPExporter{Endpoint: otlpEndpoint}
+		res.addCloser(exporter)
+		res.addFlusher(exporter.Flush)
+		formatter = OTLPFormat{Formatter: formatter, Exporter: exporter}
+	}
+
+	var tf *teeFormat
+	if len(c.Outputs) > 0 {
+		tf, err = newTeeFormat(formatter, logger.Threshold(), c.Outputs)
+		if err != nil {
+			return err
+		}
+		logger.SetThreshold(tf.setThreshold(logger.Threshold()))
+		formatter = tf
+	}
+	if c.Async {
+		if output == nil {
+			output = os.Stderr
+		}
+		aw := NewAsyncWriter(output, 0)
+		res.addCloser(aw)
+		res.addFlusher(aw.Flush)
+		output = aw
+	}
+	var oldRes *logResources
+	if v, ok := loggerResources.Load(logger); ok {
+		oldRes = v.(*logResources)
+	}
+	res.output = output
+	switch {
+	case output != nil:
+		logger.SetOutput(output)
+	case oldRes != nil && oldRes.output != nil:
+		// stop writing to the output of the previous configuration.
+		logger.SetOutput(os.Stderr)
+	}
+	if c.Sample != nil {
+		formatter = &LogSampler{
+			Formatter:  formatter,
+			Window:     c.Sample.Window,
+			Burst:      c.Sample.Burst,
+			Thereafter: c.Sample.Thereafter,
+		}
+	}
+	// redact fields before they reach any of the destinations.
+	if redactor != nil {
+		formatter = RedactFormat{Formatter: formatter, Redactor: redactor}
+		primary = RedactFormat{Formatter: primary, Redactor: redactor}
+	}
+	primaryFormats.Store(logger, primary)
+	oldTee := loggerTee(logger)
+	if tf != nil {
+		teeFormats.Store(logger, tf)
+	} else {
+		teeFormats.Delete(logger)
+	}
+	logger.SetFormatter(formatter)
+	if oldTee != nil {
+		oldTee.close()
+	}
+
+	// release the resources of the previous configuration after
+	// the logger stops using them.
+	loggerResources.Store(logger, res)
+	if oldRes != nil {
+		oldRes.release()
+	}
+
+	return nil
+}
+
+// configValue returns the effective value of a configuration item.
+// Non-empty values are prioritized in the order of viper key,
+// command-line flag, environment variable, and v.
+// Empty key skips viper.
+func configValue(v, env, flagValue, key string) string {
+	if e := os.Getenv(env); len(e) > 0 {
+		v = e
+	}
+	if len(flagValue) > 0 {
+		v = flagValue
+	}
+	if len(key) == 0 {
+		return v
+	}
+	if e := viper.GetString(key); len(e) > 0 {
+		v = e
+	}
+	return v
+}
+
+func formatterByName(format string) (log.Formatter, error) {
 	switch format {
 	case "", "plain":
-		logger.SetFormatter(log.PlainFormat{})
+		return log.PlainFormat{}, nil
 	case "logfmt":
-		logger.SetFormatter(log.Logfmt{})
+		return log.Logfmt{}, nil
 	case "json":
-		logger.SetFormatter(log.JSONFormat{})
-	default:
-		return errors.New("invalid format: " + format)
+		return log.JSONFormat{}, nil
 	}
-
-	return nil
+	return nil, errors.New("invalid format: " + format)
 }
 
 // FieldsFromContext returns a map of fields containing
@@ -38,6 +38,12 @@ func TestLogConfig(t *testing.T) {
 	if c1.Log.Format != "json" {
 		t.Error(`c1.Log.Format != "json"`)
 	}
+	if len(c1.Log.Outputs) != 1 {
+		t.Fatal(`len(c1.Log.Outputs) != 1`)
+	}
+	if c1.Log.Outputs[0] != (LogOutput{Filename: "/abc/ghi", Level: "warning", Format: "logfmt"}) {
+		t.Error(`unexpected c1.Log.Outputs[0]`, c1.Log.Outputs[0])
+	}
 
 	f, err := os.Open("testdata/log.json")
 	if err != nil {
@@ -83,6 +89,15 @@ func TestLogConfigApply(t *testing.T) {
 		t.Error(`logger.Formatter().String() != "json"`)
 	}
 
+	c.Format = "logfmt"
+	err = c.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logger.Formatter().String() != "logfmt" {
+		t.Error(`logger.Formatter().String() != "logfmt"`)
+	}
+
 	c.Format = "bad_format"
 	err = c.Apply()
 	if err == nil {
@@ -152,3 +167,39 @@ func TestLogFlags(t *testing.T) {
 		t.Error(`!bytes.Contains(data, []byte("hoge fuga"))`)
 	}
 }
+
+func TestLogConfigEnv(t *testing.T) {
+	t.Setenv(logFormatEnv, "logfmt")
+
+	if v := configValue("json", logFormatEnv, "", "log.format"); v != "logfmt" {
+		t.Error(`environment variable should take precedence over the struct member`, v)
+	}
+	if v := configValue("json", logFormatEnv, "plain", "log.format"); v != "plain" {
+		t.Error(`command-line flag should take precedence over environment variable`, v)
+	}
+	if v := configValue("json", logFileEnv, "", "log.file"); v != "json" {
+		t.Error(`the struct member should be used if others are empty`, v)
+	}
+}
+
+func TestLogFlagsCustomFlagSet(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := NewLogFlags(fs, LogFlagNames{Level: "verbosity"}.WithPrefix("app-"))
+	err := fs.Parse([]string{"-app-verbosity=bad_level", "-app-logformat=json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.Lookup("app-logfile") == nil {
+		t.Error(`fs.Lookup("app-logfile") == nil`)
+	}
+	if fs.Lookup("app-logmodules") == nil {
+		t.Error(`fs.Lookup("app-logmodules") == nil`)
+	}
+
+	err = LogConfig{Level: "info"}.ApplyFlags(f)
+	if err == nil {
+		t.Error(`bad_level should cause an error`)
+	}
+}
@@ -0,0 +1,210 @@
+package well
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultAsyncBufferSize = 1 << 20
+)
+
+// AsyncWriter is an io.Writer that buffers writes in memory and
+// writes them to the underlying writer by a background goroutine.
+//
+// This takes slow writes such as disk I/O off the caller of loggers.
+// The buffer is bounded; when it is full, Write blocks until the
+// background goroutine writes out the buffered data.
+//
+// Each Write is passed to the underlying writer by a separate call,
+// so datagram-based writers such as DialSyslog or DialJournal work.
+//
+// Call Flush or FlushLogs before the program exits, otherwise
+// buffered data may be lost.
+type AsyncWriter struct {
+	w       io.Writer
+	maxSize int
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	buf       []byte
+	ends      []int // end offsets of each Write in buf
+	spare     []byte
+	spareEnds []int
+	writing   bool
+	closed    bool
+	err       error
+}
+
+// NewAsyncWriter creates an AsyncWriter for w.
+// size is the maximum size of the buffer in bytes.
+// Zero or negative size is treated as 1 MiB.
+func NewAsyncWriter(w io.Writer, size int) *AsyncWriter {
+	if size <= 0 {
+		size = defaultAsyncBufferSize
+	}
+	a := &AsyncWriter{
+		w:       w,
+		maxSize: size,
+	}
+	a.cond = sync.NewCond(&a.mu)
+	go a.run()
+	return a
+}
+
+func (a *AsyncWriter) run() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for {
+		for len(a.buf) == 0 && !a.closed {
+			a.cond.Wait()
+		}
+		if len(a.buf) == 0 {
+			return
+		}
+
+		data, ends := a.buf, a.ends
+		a.buf, a.ends = a.spare[:0], a.spareEnds[:0]
+		a.writing = true
+		a.cond.Broadcast()
+		a.mu.Unlock()
+
+		var err error
+		start := 0
+		for _, end := range ends {
+			if _, err2 := a.w.Write(data[start:end]); err2 != nil && err == nil {
+				err = err2
+			}
+			start = end
+		}
+
+		a.mu.Lock()
+		a.writing = false
+		a.spare, a.spareEnds = data[:0], ends[:0]
+		if err != nil && a.err == nil {
+			a.err = err
+		}
+		a.cond.Broadcast()
+	}
+}
+
+// Write copies p into the buffer.
+// p may be larger than the buffer size; in that case, Write waits
+// for the buffer to become empty.
+//
+// Write returns the error of the last failed write to the
+// underlying writer, if any.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for len(a.buf) > 0 && len(a.buf)+len(p) > a.maxSize && !a.closed {
+		a.cond.Wait()
+	}
+	if a.closed {
+		return 0, errors.New("write to closed AsyncWriter")
+	}
+	if err := a.err; err != nil {
+		a.err = nil
+		return 0, err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	a.buf = append(a.buf, p...)
+	a.ends = append(a.ends, len(a.buf))
+	a.cond.Broadcast()
+	return len(p), nil
+}
+
+// Flush waits for the buffered data to be written.
+// It returns the error of the last failed write, if any.
+func (a *AsyncWriter) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for len(a.buf) > 0 || a.writing {
+		a.cond.Wait()
+	}
+	err := a.err
+	a.err = nil
+	return err
+}
+
+// Close flushes the buffer and stops the background goroutine.
+// The underlying writer is not closed.
+func (a *AsyncWriter) Close() error {
+	err := a.Flush()
+
+	a.mu.Lock()
+	a.closed = true
+	a.cond.Broadcast()
+	a.mu.Unlock()
+	return err
+}
+
+type logFlusher struct {
+	flush func() error
+}
+
+var (
+	logFlushersMu sync.Mutex
+	logFlushers   []*logFlusher
+)
+
+// registerLogFlusher registers f to be called by FlushLogs.
+// The returned function unregisters f.
+func registerLogFlusher(f func() error) (unregister func()) {
+	lf := &logFlusher{flush: f}
+	logFlushersMu.Lock()
+	logFlushers = append(logFlushers, lf)
+	logFlushersMu.Unlock()
+
+	return func() {
+		logFlushersMu.Lock()
+		defer logFlushersMu.Unlock()
+		flushers := make([]*logFlusher, 0, len(logFlushers))
+		for _, f := range logFlushers {
+			if f != lf {
+				flushers = append(flushers, f)
+			}
+		}
+		logFlushers = flushers
+	}
+}
+
+// FlushLogs writes or sends logs buffered by the framework, such as
+// logs in AsyncWriter configured by LogConfig and logs and spans queued
+// for OTLP export, and returns the first error.
+//
+// Call FlushLogs before the program exits.
+func FlushLogs() error {
+	logFlushersMu.Lock()
+	flushers := logFlushers
+	logFlushersMu.Unlock()
+
+	var firstErr error
+	for _, f := range flushers {
+		if err := f.flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ErrorExit logs err, flushes buffered logs by FlushLogs, and
+// exits the program with status 1.
+//
+// Use this instead of log.ErrorExit when logs are buffered
+// by AsyncWriter or OTLPExporter.
+func ErrorExit(err error) {
+	log.Error(err.Error(), nil)
+	FlushLogs()
+	os.Exit(1)
+}
@@ -0,0 +1,74 @@
+package well
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+type slowWriter struct {
+	syncBuffer
+	delay  time.Duration
+	writes int
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	w.writes++
+	return w.syncBuffer.Write(p)
+}
+
+type errorWriter struct{}
+
+func (errorWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write error")
+}
+
+func TestAsyncWriter(t *testing.T) {
+	t.Parallel()
+
+	w := &slowWriter{delay: 10 * time.Millisecond}
+	aw := NewAsyncWriter(w, 16)
+
+	logger := log.NewLogger()
+	logger.SetFormatter(log.Logfmt{})
+	logger.SetOutput(aw)
+	for i := 0; i < 10; i++ {
+		logger.Info("hello", nil)
+	}
+
+	err := aw.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.writes != 10 {
+		t.Error(`each write should be passed separately`, w.writes)
+	}
+	data := w.Bytes()
+	if strings.Count(string(data), "message=\"hello\"") != 10 {
+		t.Error(`some logs are lost`, string(data))
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		t.Error(`logs are partially written`)
+	}
+
+	err = aw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = aw.Write([]byte("foo\n"))
+	if err == nil {
+		t.Error(`write to closed writer should fail`)
+	}
+
+	aw = NewAsyncWriter(errorWriter{}, 0)
+	defer aw.Close()
+	aw.Write([]byte("foo\n"))
+	if aw.Flush() == nil {
+		t.Error(`write error should be reported`)
+	}
+}
@@ -1,15 +1,102 @@
-//go:build !windows
-// +build !windows
-
 package well
 
 import (
-	"io"
-	"syscall"
+	"os"
+	"sync"
+)
 
-	"github.com/cybozu-go/log"
+var (
+	logFilesMu sync.Mutex
+	logFiles   []*logFile
 )
 
-func openLogFile(filename string) (io.Writer, error) {
-	return log.NewFileReopener(filename, syscall.SIGUSR1)
+// logFile is an io.Writer that writes to a file and can reopen it.
+type logFile struct {
+	filename string
+
+	mu  sync.Mutex
+	f   *os.File
+	err error
+}
+
+func openLogFile(filename string) (*logFile, error) {
+	lf := &logFile{filename: filename}
+	if err := lf.reopen(); err != nil {
+		return nil, err
+	}
+
+	logFilesMu.Lock()
+	logFiles = append(logFiles, lf)
+	logFilesMu.Unlock()
+	return lf, nil
+}
+
+func (lf *logFile) reopen() error {
+	f, err := os.OpenFile(lf.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if err != nil {
+		// keep writing to the old file, if any.
+		lf.err = err
+		return err
+	}
+	if lf.f != nil {
+		lf.f.Close()
+	}
+	lf.f = f
+	lf.err = nil
+	return nil
+}
+
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return 0, lf.err
+	}
+	return lf.f.Write(p)
+}
+
+// Close closes the file.  Closed files are not reopened.
+func (lf *logFile) Close() error {
+	logFilesMu.Lock()
+	files := make([]*logFile, 0, len(logFiles))
+	for _, f := range logFiles {
+		if f != lf {
+			files = append(files, f)
+		}
+	}
+	logFiles = files
+	logFilesMu.Unlock()
+
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	lf.err = os.ErrClosed
+	return err
+}
+
+// ReopenLogFiles reopens log files opened by LogConfig for log rotation.
+// It returns the first error, if any.  Files that cannot be reopened
+// continue to be written.
+//
+// By default, this is called when the program receives SIGUSR1.
+// See SetSIGUSR1Hook.
+func ReopenLogFiles() error {
+	logFilesMu.Lock()
+	files := logFiles
+	logFilesMu.Unlock()
+
+	var firstErr error
+	for _, lf := range files {
+		if err := lf.reopen(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
@@ -0,0 +1,191 @@
+package well
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func registeredLogFile(lf *logFile) bool {
+	logFilesMu.Lock()
+	defer logFilesMu.Unlock()
+	for _, f := range logFiles {
+		if f == lf {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogFileReopen(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("open files cannot be renamed on Windows")
+	}
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.log")
+	lf, err := openLogFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+
+	if _, err := lf.Write([]byte("foo\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filename, filename+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lf.Write([]byte("bar\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "foo\n" {
+		t.Error(`unexpected rotated file`, string(data))
+	}
+	data, err = os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "bar\n" {
+		t.Error(`unexpected reopened file`, string(data))
+	}
+}
+
+func TestLogFileReopenError(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("open files cannot be renamed on Windows")
+	}
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.log")
+	lf, err := openLogFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+
+	// make reopen fail by a directory of the same name.
+	if err := os.Rename(filename, filename+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filename, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.reopen(); err == nil {
+		t.Error(`reopen should fail`)
+	}
+
+	// logs are written to the old file.
+	if _, err := lf.Write([]byte("foo\n")); err != nil {
+		t.Error(`write after failed reopen should succeed`, err)
+	}
+	data, err := os.ReadFile(filename + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "foo\n" {
+		t.Error(`unexpected old file`, string(data))
+	}
+
+	if err := os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lf.Write([]byte("bar\n")); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "bar\n" {
+		t.Error(`unexpected reopened file`, string(data))
+	}
+}
+
+func TestLogFileOpenError(t *testing.T) {
+	t.Parallel()
+
+	_, err := openLogFile(t.TempDir())
+	if err == nil {
+		t.Error(`directory should not be opened as a log file`)
+	}
+}
+
+func TestLogFileClose(t *testing.T) {
+	t.Parallel()
+
+	lf, err := openLogFile(filepath.Join(t.TempDir(), "test.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !registeredLogFile(lf) {
+		t.Error(`opened file should be registered`)
+	}
+
+	if err := lf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if registeredLogFile(lf) {
+		t.Error(`closed file should not be registered`)
+	}
+	if _, err := lf.Write([]byte("foo\n")); !errors.Is(err, os.ErrClosed) {
+		t.Error(`write to closed file should fail`, err)
+	}
+	if err := lf.Close(); err != nil {
+		t.Error(`second close should succeed`, err)
+	}
+}
+
+func TestLogConfigReplaceFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	logger := log.NewLogger()
+	c := LogConfig{Filename: filepath.Join(dir, "1.log")}
+	if err := c.apply(logger, logFlagValues{}, false); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := loggerResources.Load(logger)
+	lf1 := v.(*logResources).output.(*logFile)
+
+	c.Filename = filepath.Join(dir, "2.log")
+	if err := c.apply(logger, logFlagValues{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if registeredLogFile(lf1) {
+		t.Error(`replaced file should be closed`)
+	}
+	if err := logger.Info("foo", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	v, _ = loggerResources.Load(logger)
+	v.(*logResources).release()
+	loggerResources.Delete(logger)
+	primaryFormats.Delete(logger)
+
+	data, err := os.ReadFile(filepath.Join(dir, "2.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		t.Error(`logs should be written to the new file`)
+	}
+}
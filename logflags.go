@@ -0,0 +1,76 @@
+package well
+
+import (
+	"flag"
+
+	"github.com/cybozu-go/log"
+)
+
+// LogFlagNames is a set of names of command-line flags for logging.
+//
+// Empty names are replaced with the default names,
+// i.e. "logfile", "loglevel", "logformat", and "logmodules".
+type LogFlagNames struct {
+	Filename string
+	Level    string
+	Format   string
+	Modules  string
+}
+
+// WithPrefix returns a copy of n with prefix prepended to every name.
+func (n LogFlagNames) WithPrefix(prefix string) LogFlagNames {
+	n = n.fill()
+	return LogFlagNames{
+		Filename: prefix + n.Filename,
+		Level:    prefix + n.Level,
+		Format:   prefix + n.Format,
+		Modules:  prefix + n.Modules,
+	}
+}
+
+func (n LogFlagNames) fill() LogFlagNames {
+	if len(n.Filename) == 0 {
+		n.Filename = "logfile"
+	}
+	if len(n.Level) == 0 {
+		n.Level = "loglevel"
+	}
+	if len(n.Format) == 0 {
+		n.Format = "logformat"
+	}
+	if len(n.Modules) == 0 {
+		n.Modules = "logmodules"
+	}
+	return n
+}
+
+// LogFlags is a set of command-line flags for logging registered
+// on a custom flag.FlagSet.
+//
+// Use NewLogFlags to register flags, and LogConfig.ApplyFlags to
+// apply them after the flag set is parsed.
+type LogFlags struct {
+	values logFlagValues
+}
+
+// NewLogFlags registers command-line flags for logging on fs
+// with the given names.
+//
+// This is useful when the fixed flag names on the global flag set
+// collide with those of the application.  For github.com/spf13/pflag,
+// add fs to a pflag.FlagSet by its AddGoFlagSet method.
+func NewLogFlags(fs *flag.FlagSet, names LogFlagNames) *LogFlags {
+	names = names.fill()
+	f := new(LogFlags)
+	fs.StringVar(&f.values.filename, names.Filename, "", "Log filename")
+	fs.StringVar(&f.values.level, names.Level, "", "Log level [critical,error,warning,info,debug]")
+	fs.StringVar(&f.values.format, names.Format, "", "Log format [plain,logfmt,json]")
+	fs.StringVar(&f.values.modules, names.Modules, "", "Log levels of modules [NAME=LEVEL,...]")
+	return f
+}
+
+// ApplyFlags is the same as Apply except that it looks for command-line
+// flags in f instead of the global flag set and the viper database.
+func (c LogConfig) ApplyFlags(f *LogFlags) error {
+	return c.apply(log.DefaultLogger(), f.values, false)
+}
@@ -0,0 +1,132 @@
+package well
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/cybozu-go/log"
+)
+
+// LogLevel returns the name of the current threshold level
+// of the default logger.
+func LogLevel() string {
+	return log.LevelName(loggerLevel(log.DefaultLogger()))
+}
+
+// loggerLevel returns the threshold of logger.  If logger has additional
+// outputs configured by LogConfig, the threshold of the primary output
+// is returned.
+func loggerLevel(logger *log.Logger) int {
+	if tf := loggerTee(logger); tf != nil {
+		return tf.Threshold()
+	}
+	return logger.Threshold()
+}
+
+// SetLogLevel changes the threshold level of the default logger
+// at runtime.  Valid levels are "critical", "error", "warning",
+// "info", and "debug".
+func SetLogLevel(level string) error {
+	return setLogLevel(log.DefaultLogger(), level)
+}
+
+func setLogLevel(logger *log.Logger, level string) error {
+	th, err := levelByName(level)
+	if err != nil {
+		return err
+	}
+	old := loggerLevel(logger)
+	if tf := loggerTee(logger); tf != nil {
+		logger.SetThreshold(tf.setThreshold(th))
+	} else {
+		logger.SetThreshold(th)
+	}
+	if old != th {
+		logger.Warn("well: log level changed", map[string]interface{}{
+			"from": log.LevelName(old),
+			"to":   log.LevelName(th),
+		})
+	}
+	return nil
+}
+
+// LogLevelHandler is an http.Handler to read or change the
+// threshold level of a logger at runtime.
+//
+// GET returns the current level name.  PUT or POST changes the
+// level to the one given in the request body or "level" form value.
+//
+// Note that for graceful restarting servers, the handler affects
+// only the process that serves it.
+type LogLevelHandler struct {
+	// Logger to be controlled.  If nil, the default logger is used.
+	Logger *log.Logger
+}
+
+// ServeHTTP implements http.Handler.
+func (h LogLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger
+	if logger == nil {
+		logger = log.DefaultLogger()
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut, http.MethodPost:
+		level := r.FormValue("level")
+		if len(level) == 0 {
+			data, err := io.ReadAll(io.LimitReader(r.Body, 64))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			level = strings.TrimSpace(string(data))
+		}
+		err := setLogLevel(logger, level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, log.LevelName(loggerLevel(logger))+"\n")
+}
+
+var debugToggleOnce sync.Once
+
+// ToggleDebugLogOnSignal installs a signal handler that switches
+// the default logger between the debug level and the level used
+// before the signal was received.
+//
+// This is intended to turn on debug logging temporarily during an
+// incident without restarting the program.  Only the first call
+// takes effect.
+func ToggleDebugLogOnSignal(sig ...os.Signal) {
+	debugToggleOnce.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, sig...)
+
+		go func() {
+			logger := log.DefaultLogger()
+			saved := loggerLevel(logger)
+			for range ch {
+				level := log.LvDebug
+				if loggerLevel(logger) == log.LvDebug {
+					level = saved
+				} else {
+					saved = loggerLevel(logger)
+				}
+				setLogLevel(logger, log.LevelName(level))
+			}
+		}()
+	})
+}
@@ -0,0 +1,61 @@
+package well
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	t.Parallel()
+
+	logger := log.NewLogger()
+	logger.SetOutput(io.Discard)
+	h := LogLevelHandler{Logger: logger}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatal(`w.Code != http.StatusOK`)
+	}
+	if w.Body.String() != "info\n" {
+		t.Error(`w.Body.String() != "info\n"`)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/", strings.NewReader("debug\n")))
+	if w.Code != http.StatusOK {
+		t.Fatal(`w.Code != http.StatusOK`)
+	}
+	if logger.Threshold() != log.LvDebug {
+		t.Error(`logger.Threshold() != log.LvDebug`)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/?level=error", nil))
+	if w.Code != http.StatusOK {
+		t.Fatal(`w.Code != http.StatusOK`)
+	}
+	if logger.Threshold() != log.LvError {
+		t.Error(`logger.Threshold() != log.LvError`)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/", strings.NewReader("bad_level")))
+	if w.Code != http.StatusBadRequest {
+		t.Error(`w.Code != http.StatusBadRequest`)
+	}
+	if logger.Threshold() != log.LvError {
+		t.Error(`logger.Threshold() != log.LvError`)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("DELETE", "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error(`w.Code != http.StatusMethodNotAllowed`)
+	}
+}
@@ -0,0 +1,165 @@
+package well
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	// RedactedValue replaces values of redacted fields.
+	RedactedValue = "[REDACTED]"
+
+	maxRedactDepth = 8
+)
+
+// LogRedactor replaces sensitive values in log fields by RedactedValue.
+//
+// Values of maps having string keys, such as http.Header or a map
+// decoded from a request body, and elements of slices are inspected
+// recursively.
+type LogRedactor struct {
+	// Fields matches the names of fields or map keys to be redacted.
+	// If nil, no field is redacted by name.
+	Fields *regexp.Regexp
+
+	// Matchers are called for each field or map entry.
+	// If any of them returns true, the value is redacted.
+	Matchers []func(key string, value interface{}) bool
+}
+
+// NewLogRedactor creates a LogRedactor that redacts fields whose
+// names match any of patterns.  Patterns are case-insensitive
+// regular expressions.
+func NewLogRedactor(patterns ...string) (*LogRedactor, error) {
+	if len(patterns) == 0 {
+		return &LogRedactor{}, nil
+	}
+	re, err := regexp.Compile("(?i)(?:" + strings.Join(patterns, ")|(?:") + ")")
+	if err != nil {
+		return nil, err
+	}
+	return &LogRedactor{Fields: re}, nil
+}
+
+func (r *LogRedactor) match(key string, value interface{}) bool {
+	if r.Fields != nil && r.Fields.MatchString(key) {
+		return true
+	}
+	for _, m := range r.Matchers {
+		if m(key, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns a copy of fields with sensitive values replaced.
+// fields is not modified.  If nothing is redacted, fields itself
+// is returned.
+func (r *LogRedactor) Redact(fields map[string]interface{}) map[string]interface{} {
+	var redacted map[string]interface{}
+	for k, v := range fields {
+		v2, changed := r.redactValue(k, v, 0)
+		if !changed {
+			continue
+		}
+		if redacted == nil {
+			redacted = make(map[string]interface{}, len(fields))
+			for k, v := range fields {
+				redacted[k] = v
+			}
+		}
+		redacted[k] = v2
+	}
+	if redacted == nil {
+		return fields
+	}
+	return redacted
+}
+
+func (r *LogRedactor) redactValue(key string, v interface{}, depth int) (interface{}, bool) {
+	if r.match(key, v) {
+		return RedactedValue, true
+	}
+	if v == nil || depth == maxRedactDepth {
+		return v, false
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			return v, false
+		}
+		// elements are inspected with the key of the slice.
+		var redacted []interface{}
+		for i := 0; i < value.Len(); i++ {
+			v2, changed := r.redactValue(key, value.Index(i).Interface(), depth+1)
+			if !changed {
+				continue
+			}
+			if redacted == nil {
+				redacted = make([]interface{}, value.Len())
+				for j := 0; j < value.Len(); j++ {
+					redacted[j] = value.Index(j).Interface()
+				}
+			}
+			redacted[i] = v2
+		}
+		if redacted == nil {
+			return v, false
+		}
+		return redacted, true
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return v, false
+		}
+	default:
+		return v, false
+	}
+
+	var redacted map[string]interface{}
+	for iter := value.MapRange(); iter.Next(); {
+		k := iter.Key().String()
+		v2, changed := r.redactValue(k, iter.Value().Interface(), depth+1)
+		if !changed {
+			continue
+		}
+		if redacted == nil {
+			redacted = make(map[string]interface{}, value.Len())
+			for iter := value.MapRange(); iter.Next(); {
+				redacted[iter.Key().String()] = iter.Value().Interface()
+			}
+		}
+		redacted[k] = v2
+	}
+	if redacted == nil {
+		return v, false
+	}
+	return redacted, true
+}
+
+// RedactFormat implements log.Formatter to redact sensitive fields
+// by Redactor before formatting logs by Formatter.
+type RedactFormat struct {
+	// Formatter formats logs.  This must not be nil.
+	Formatter log.Formatter
+
+	// Redactor redacts fields.  This must not be nil.
+	Redactor *LogRedactor
+}
+
+// String returns the name of the inner formatter.
+func (f RedactFormat) String() string {
+	return f.Formatter.String()
+}
+
+// Format implements log.Formatter.
+func (f RedactFormat) Format(buf []byte, l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) ([]byte, error) {
+	return f.Formatter.Format(buf, l, t, severity, msg, f.Redactor.Redact(fields))
+}
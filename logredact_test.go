@@ -0,0 +1,85 @@
+package well
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestLogRedactor(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewLogRedactor("(")
+	if err == nil {
+		t.Error(`invalid pattern should be an error`)
+	}
+
+	r, err := NewLogRedactor("PASSWORD", "^token$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Matchers = append(r.Matchers, func(key string, value interface{}) bool {
+		s, ok := value.(string)
+		return ok && strings.HasPrefix(s, "Bearer ")
+	})
+
+	fields := map[string]interface{}{
+		"user":        "alice",
+		"db_password": "p@ss",
+		"token":       "xyz",
+		"tokens":      3,
+		"headers": http.Header{
+			"Authorization": []string{"Bearer xyz"},
+		},
+		"body": map[string]interface{}{
+			"new_password": "secret",
+			"auth":         "Bearer abc",
+			"name":         "bob",
+		},
+	}
+
+	logger := log.NewLogger()
+	logger.SetFormatter(RedactFormat{Formatter: log.JSONFormat{}, Redactor: r})
+	buf := new(bytes.Buffer)
+	logger.SetOutput(buf)
+	logger.Info("hello", fields)
+
+	if fields["db_password"] != "p@ss" {
+		t.Error(`fields should not be modified`)
+	}
+
+	var rec map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec["user"] != "alice" {
+		t.Error(`rec["user"] != "alice"`, rec["user"])
+	}
+	if rec["db_password"] != RedactedValue {
+		t.Error(`rec["db_password"] != RedactedValue`, rec["db_password"])
+	}
+	if rec["token"] != RedactedValue {
+		t.Error(`rec["token"] != RedactedValue`, rec["token"])
+	}
+	if rec["tokens"] != 3.0 {
+		t.Error(`rec["tokens"] != 3`, rec["tokens"])
+	}
+	if s := buf.String(); strings.Contains(s, "secret") || strings.Contains(s, "xyz") || strings.Contains(s, "abc") {
+		t.Error(`sensitive values are logged`, s)
+	}
+	if !strings.Contains(buf.String(), "bob") {
+		t.Error(`non-sensitive values in maps should be kept`, buf.String())
+	}
+
+	plain := map[string]interface{}{"user": "alice"}
+	if reflect.ValueOf(r.Redact(plain)).Pointer() != reflect.ValueOf(plain).Pointer() {
+		t.Error(`unchanged fields should be returned as is`)
+	}
+}
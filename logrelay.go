@@ -0,0 +1,349 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// logRecord is a log parsed from a formatted line.
+type logRecord struct {
+	loggedAt time.Time
+	topic    string
+	severity int
+	msg      string
+	fields   map[string]interface{}
+}
+
+// relayLog writes a log line from a child process to logger.
+//
+// Lines in plain, JSON, or logfmt format are parsed and re-formatted
+// by logger so that topics, severities and fields are preserved even
+// when logger uses another format.  Other lines such as panic messages
+// are written as the message of a log with info severity and logger's
+// topic.  annotations are added to the fields of both.
+//
+// The threshold of logger is not applied because the child has
+// already filtered its logs by its own threshold.  Logs are written
+// only to the primary output of logger, since children write to
+// additional outputs configured by LogConfig by themselves.
+func relayLog(logger *log.Logger, line []byte, annotations map[string]interface{}) error {
+	rec, ok := parseLogLine(line)
+	if !ok {
+		msg := bytes.TrimRight(line, "\r\n")
+		if len(msg) == 0 {
+			return nil
+		}
+		rec = &logRecord{
+			loggedAt: time.Now(),
+			severity: log.LvInfo,
+			msg:      string(msg),
+			fields:   make(map[string]interface{}),
+		}
+	}
+	for k, v := range annotations {
+		rec.fields[k] = v
+	}
+	// child processes write to additional outputs by themselves.
+	formatter := logger.Formatter()
+	if f, ok := primaryFormats.Load(logger); ok {
+		formatter = f.(log.Formatter)
+	}
+	l := logger
+	if rec.topic != "" && rec.topic != logger.Topic() {
+		l = topicLogger(logger, rec.topic)
+	}
+	err := writeLogWith(l, formatter, rec.loggedAt, rec.severity, rec.msg, rec.fields)
+	if err != nil {
+		// fallback for formatting errors.
+		return logger.WriteThrough(line)
+	}
+	return nil
+}
+
+// topicLogger returns a logger that formats logs with topic and the
+// default fields of logger, and writes them through logger.
+func topicLogger(logger *log.Logger, topic string) *log.Logger {
+	l := log.NewLogger()
+	l.SetTopic(topic)
+	l.SetDefaults(logger.Defaults())
+	l.SetOutput(writeThrough{logger})
+	// errors are handled by logger.
+	l.SetErrorHandler(func(err error) error { return err })
+	return l
+}
+
+// writeThrough is an io.Writer that writes formatted logs to a logger.
+type writeThrough struct {
+	logger *log.Logger
+}
+
+func (w writeThrough) Write(p []byte) (int, error) {
+	if err := w.logger.WriteThrough(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func parseLogLine(line []byte) (*logRecord, bool) {
+	line = bytes.TrimSpace(line)
+	var fields map[string]interface{}
+	switch {
+	case bytes.HasPrefix(line, []byte("{")):
+		if err := json.Unmarshal(line, &fields); err != nil {
+			return nil, false
+		}
+	case bytes.HasPrefix(line, []byte("topic=")):
+		var ok bool
+		fields, ok = parseLogfmt(line)
+		if !ok {
+			return nil, false
+		}
+	default:
+		var ok bool
+		fields, ok = parsePlain(line)
+		if !ok {
+			return nil, false
+		}
+	}
+
+	sv, _ := fields[log.FnSeverity].(string)
+	msg, ok := fields[log.FnMessage].(string)
+	if !ok {
+		return nil, false
+	}
+	severity, err := levelByName(sv)
+	if err != nil {
+		return nil, false
+	}
+	topic, _ := fields[log.FnTopic].(string)
+	rec := &logRecord{
+		loggedAt: time.Now(),
+		topic:    topic,
+		severity: severity,
+		msg:      msg,
+		fields:   make(map[string]interface{}, len(fields)),
+	}
+	if s, ok := fields[log.FnLoggedAt].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			rec.loggedAt = t
+		}
+	}
+	for k, v := range fields {
+		if !log.IsValidKey(k) {
+			continue
+		}
+		rec.fields[k] = v
+	}
+	return rec, true
+}
+
+// parsePlain parses a line formatted by log.PlainFormat, that is
+// DATETIME UTSNAME TOPIC SEVERITY: MESSAGE [OPTIONAL FIELDS...]
+func parsePlain(line []byte) (map[string]interface{}, bool) {
+	header := bytes.SplitN(line, []byte(" "), 5)
+	if len(header) != 5 {
+		return nil, false
+	}
+	sv := header[3]
+	if len(sv) < 2 || sv[len(sv)-1] != ':' {
+		return nil, false
+	}
+	if _, err := time.Parse(time.RFC3339Nano, string(header[0])); err != nil {
+		return nil, false
+	}
+
+	// the rest is the same as logfmt except for the message key.
+	fields, ok := parseLogfmt(append([]byte("message="), header[4]...))
+	if !ok {
+		return nil, false
+	}
+	fields[log.FnLoggedAt] = string(header[0])
+	fields[log.FnUtsname] = string(header[1])
+	fields[log.FnTopic] = string(header[2])
+	fields[log.FnSeverity] = string(sv[:len(sv)-1])
+	return fields, true
+}
+
+// parseLogfmt parses a line formatted by log.Logfmt.
+func parseLogfmt(line []byte) (map[string]interface{}, bool) {
+	fields := make(map[string]interface{})
+	s := string(line)
+	for len(s) > 0 {
+		eq := 0
+		for eq < len(s) && s[eq] != '=' && s[eq] != ' ' {
+			eq++
+		}
+		if eq == 0 || eq == len(s) || s[eq] != '=' {
+			return nil, false
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		n, ok := logfmtValueLength(s)
+		if !ok {
+			return nil, false
+		}
+		raw := s[:n]
+		s = s[n:]
+		if len(s) > 0 {
+			if s[0] != ' ' {
+				return nil, false
+			}
+			s = s[1:]
+		}
+
+		v, ok := logfmtValue(raw)
+		if !ok {
+			return nil, false
+		}
+		fields[key] = v
+	}
+	return fields, true
+}
+
+// logfmtValue parses a value formatted by log.Logfmt.
+// Lists and maps are parsed into []interface{} and map[string]interface{}
+// so that they are formatted in the same way again.
+func logfmtValue(raw string) (interface{}, bool) {
+	switch {
+	case len(raw) > 0 && raw[0] == '"':
+		v, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, false
+		}
+		return v, true
+	case len(raw) > 1 && raw[0] == '[' && raw[len(raw)-1] == ']':
+		return logfmtList(raw[1 : len(raw)-1])
+	case len(raw) > 1 && raw[0] == '{' && raw[len(raw)-1] == '}':
+		return logfmtMap(raw[1 : len(raw)-1])
+	}
+	return logfmtScalar(raw), true
+}
+
+// logfmtElements splits s into space-separated values.
+func logfmtElements(s string) ([]string, bool) {
+	var elems []string
+	for len(s) > 0 {
+		n, ok := logfmtValueLength(s)
+		if !ok || n == 0 {
+			return nil, false
+		}
+		elems = append(elems, s[:n])
+		s = s[n:]
+		if len(s) > 0 {
+			s = s[1:]
+		}
+	}
+	return elems, true
+}
+
+func logfmtList(s string) (interface{}, bool) {
+	elems, ok := logfmtElements(s)
+	if !ok {
+		return nil, false
+	}
+	l := make([]interface{}, 0, len(elems))
+	for _, e := range elems {
+		v, ok := logfmtValue(e)
+		if !ok {
+			return nil, false
+		}
+		l = append(l, v)
+	}
+	return l, true
+}
+
+func logfmtMap(s string) (interface{}, bool) {
+	elems, ok := logfmtElements(s)
+	if !ok {
+		return nil, false
+	}
+	m := make(map[string]interface{}, len(elems))
+	for _, e := range elems {
+		// keys are quoted unless they are valid keys.
+		eq := strings.IndexByte(e, '=')
+		if e[0] == '"' {
+			eq = -1
+			for i := 1; i < len(e); i++ {
+				if e[i] == '\\' {
+					i++
+					continue
+				}
+				if e[i] == '"' {
+					eq = i + 1
+					break
+				}
+			}
+		}
+		if eq <= 0 || eq >= len(e) || e[eq] != '=' {
+			return nil, false
+		}
+		key := e[:eq]
+		if key[0] == '"' {
+			k, err := strconv.Unquote(key)
+			if err != nil {
+				return nil, false
+			}
+			key = k
+		}
+		v, ok := logfmtValue(e[eq+1:])
+		if !ok {
+			return nil, false
+		}
+		m[key] = v
+	}
+	return m, true
+}
+
+// logfmtValueLength returns the length of the value at the head of s.
+// Quoted strings, lists "[...]", and maps "{...}" may contain spaces.
+func logfmtValueLength(s string) (int, bool) {
+	depth := 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuote && c == '\\':
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ' ' && depth == 0:
+			return i, true
+		}
+	}
+	if inQuote || depth != 0 {
+		return 0, false
+	}
+	return len(s), true
+}
+
+func logfmtScalar(raw string) interface{} {
+	switch raw {
+	case "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f
+	}
+	return raw
+}
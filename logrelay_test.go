@@ -0,0 +1,239 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestParseLogLine(t *testing.T) {
+	t.Parallel()
+
+	rec, ok := parseLogLine([]byte(`{"topic":"test","logged_at":"2023-01-02T03:04:05.000006Z","severity":"warning","utsname":"host","message":"hello","pid":123,"bad-key":1}` + "\n"))
+	if !ok {
+		t.Fatal(`failed to parse JSON`)
+	}
+	if rec.severity != log.LvWarn {
+		t.Error(`rec.severity != log.LvWarn`)
+	}
+	if rec.msg != "hello" {
+		t.Error(`rec.msg != "hello"`)
+	}
+	if !rec.loggedAt.Equal(time.Date(2023, 1, 2, 3, 4, 5, 6000, time.UTC)) {
+		t.Error(`unexpected rec.loggedAt`, rec.loggedAt)
+	}
+	if len(rec.fields) != 1 || rec.fields["pid"] != 123.0 {
+		t.Error(`unexpected rec.fields`, rec.fields)
+	}
+
+	rec, ok = parseLogLine([]byte(`topic=test logged_at=2023-01-02T03:04:05.000006Z severity=error utsname=host message="hello world" n=12 f=1.5 b=true list=[1 "a b" []] m={x=1 "a b"=[true]} s="a\"b"` + "\n"))
+	if !ok {
+		t.Fatal(`failed to parse logfmt`)
+	}
+	if rec.topic != "test" {
+		t.Error(`rec.topic != "test"`)
+	}
+	if rec.severity != log.LvError {
+		t.Error(`rec.severity != log.LvError`)
+	}
+	if rec.msg != "hello world" {
+		t.Error(`rec.msg != "hello world"`)
+	}
+	expected := map[string]interface{}{
+		"n":    int64(12),
+		"f":    1.5,
+		"b":    true,
+		"list": []interface{}{int64(1), "a b", []interface{}{}},
+		"m":    map[string]interface{}{"x": int64(1), "a b": []interface{}{true}},
+		"s":    `a"b`,
+	}
+	for k, v := range expected {
+		if !reflect.DeepEqual(rec.fields[k], v) {
+			t.Errorf("rec.fields[%s] = %#v", k, rec.fields[k])
+		}
+	}
+
+	rec, ok = parseLogLine([]byte(`2023-01-02T03:04:05.000006Z host test info: "hello world" pid=10` + "\n"))
+	if !ok {
+		t.Fatal(`failed to parse plain`)
+	}
+	if rec.severity != log.LvInfo {
+		t.Error(`rec.severity != log.LvInfo`)
+	}
+	if rec.msg != "hello world" {
+		t.Error(`rec.msg != "hello world"`)
+	}
+	if len(rec.fields) != 1 || rec.fields["pid"] != int64(10) {
+		t.Error(`unexpected rec.fields`, rec.fields)
+	}
+
+	for _, line := range []string{
+		"2023-01-02T03:04:05.000006Z host test info hello\n",
+		"panic: runtime error: invalid memory address\n",
+		`{"severity":"info"}`,
+		`{"severity":"unknown","message":"hello"}`,
+		`topic=test message="unterminated`,
+		`topic=test severity=info message=hello list=[1 "a]`,
+		`topic=test severity=info message=hello m={"a b"}`,
+		"{broken json\n",
+	} {
+		if _, ok := parseLogLine([]byte(line)); ok {
+			t.Error(`should not be parsed:`, line)
+		}
+	}
+}
+
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestCopyLog(t *testing.T) {
+	t.Parallel()
+
+	logger := log.NewLogger()
+	logger.SetFormatter(log.JSONFormat{})
+	out := new(bytes.Buffer)
+	logger.SetOutput(out)
+
+	input := strings.Join([]string{
+		`topic=test logged_at=2023-01-02T03:04:05.000006Z severity=error utsname=host message="relayed" pid=10`,
+		`plain text`,
+		`topic=test logged_at=2023-01-02T03:04:05.000006Z severity=debug utsname=host message="not filtered"`,
+		`no newline`,
+	}, "\n")
+
+	raw := new(closeBuffer)
+	done := make(chan struct{})
+	copyLog(logger, strings.NewReader(input), map[string]interface{}{
+		"pid":        20,
+		"generation": 3,
+	}, raw, done)
+	<-done
+
+	if raw.String() != input {
+		t.Error(`child outputs should be written as is`, raw.String())
+	}
+	if !raw.closed {
+		t.Error(`child log file should be closed`)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatal(`unexpected output:`, out.String())
+	}
+	var rec map[string]interface{}
+	err := json.Unmarshal([]byte(lines[0]), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec["severity"] != "error" || rec["message"] != "relayed" || rec["pid"] != 20.0 || rec["generation"] != 3.0 {
+		t.Error(`unexpected relayed log`, rec)
+	}
+	if rec["logged_at"] != "2023-01-02T03:04:05.000006Z" {
+		t.Error(`logged_at should be preserved`, rec["logged_at"])
+	}
+	rec = nil
+	err = json.Unmarshal([]byte(lines[1]), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec["severity"] != "info" || rec["message"] != "plain text" || rec["pid"] != 20.0 || rec["generation"] != 3.0 {
+		t.Error(`raw lines should be annotated`, rec)
+	}
+	rec = nil
+	err = json.Unmarshal([]byte(lines[2]), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec["severity"] != "debug" || rec["message"] != "not filtered" {
+		t.Error(`child logs should not be filtered by the master's threshold`, rec)
+	}
+	rec = nil
+	err = json.Unmarshal([]byte(lines[3]), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec["message"] != "no newline" {
+		t.Error(`unexpected relayed log`, rec)
+	}
+}
+
+func TestRelayLogPrimaryOnly(t *testing.T) {
+	t.Parallel()
+
+	primary := new(bytes.Buffer)
+	extra := new(bytes.Buffer)
+
+	logger := log.NewLogger()
+	logger.SetOutput(primary)
+	logger.SetFormatter(&teeFormat{
+		primary:   log.JSONFormat{},
+		threshold: log.LvInfo,
+		outputs: []*teeOutput{
+			{formatter: log.Logfmt{}, threshold: log.LvDebug, w: extra},
+		},
+	})
+	primaryFormats.Store(logger, log.JSONFormat{})
+	defer primaryFormats.Delete(logger)
+
+	err := relayLog(logger, []byte(`topic=test logged_at=2023-01-02T03:04:05.000006Z severity=info utsname=host message="relayed"`+"\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(primary.String(), `"message":"relayed"`) {
+		t.Error(`relayed log should be written to the primary output`, primary.String())
+	}
+	if extra.Len() != 0 {
+		t.Error(`relayed log should not be written to additional outputs`, extra.String())
+	}
+}
+
+func TestRelayLogTopic(t *testing.T) {
+	t.Parallel()
+
+	out := new(bytes.Buffer)
+	logger := log.NewLogger()
+	logger.SetTopic("master")
+	logger.SetFormatter(log.Logfmt{})
+	logger.SetOutput(out)
+
+	line := `topic=child logged_at=2023-01-02T03:04:05.000006Z severity=info utsname=host message="relayed" list=[1 "a b"] m={x=[true]}`
+	err := relayLog(logger, []byte(line+"\n"), map[string]interface{}{"pid": 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayed := out.String()
+	if !strings.HasPrefix(relayed, "topic=child ") {
+		t.Error(`the topic of the child should be kept`, relayed)
+	}
+	for _, field := range []string{` list=[1 "a b"]`, ` m={x=[true]}`, ` pid=20`} {
+		if !strings.Contains(relayed, field) {
+			t.Error(`field should be relayed as is:`, field, relayed)
+		}
+	}
+	if logger.Topic() != "master" {
+		t.Error(`the topic of logger should not be changed`, logger.Topic())
+	}
+
+	out.Reset()
+	if err := relayLog(logger, []byte("panic: foo\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "topic=master ") {
+		t.Error(`raw lines should be logged with the topic of logger`, out.String())
+	}
+}
@@ -0,0 +1,44 @@
+package well
+
+import (
+	"io"
+	"sync"
+)
+
+// logResources is a set of resources opened by LogConfig for a
+// *log.Logger, such as log files, connections to syslog, and
+// background goroutines of AsyncWriter and OTLPExporter.
+type logResources struct {
+	// output is the output of the logger set by LogConfig, if any.
+	output io.Writer
+
+	closers    []io.Closer
+	unregister []func()
+}
+
+// loggerResources keeps logResources of each *log.Logger to release
+// them when LogConfig is applied again.
+var loggerResources sync.Map
+
+func (r *logResources) addCloser(c io.Closer) {
+	r.closers = append(r.closers, c)
+}
+
+// addFlusher registers f to be called by FlushLogs until release.
+func (r *logResources) addFlusher(f func() error) {
+	r.unregister = append(r.unregister, registerLogFlusher(f))
+}
+
+// release unregisters flushers and closes resources in the reverse
+// order of addition, so that buffered logs are written before the
+// underlying outputs are closed.
+func (r *logResources) release() {
+	for _, f := range r.unregister {
+		f()
+	}
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		r.closers[i].Close()
+	}
+	r.closers = nil
+	r.unregister = nil
+}
@@ -0,0 +1,95 @@
+package well
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func countLogFlushers() int {
+	logFlushersMu.Lock()
+	defer logFlushersMu.Unlock()
+	return len(logFlushers)
+}
+
+func TestLogConfigReleaseResources(t *testing.T) {
+	// this test counts global log flushers.
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	logger := log.NewLogger()
+	defer func() {
+		if v, ok := loggerResources.Load(logger); ok {
+			v.(*logResources).release()
+		}
+		loggerResources.Delete(logger)
+		primaryFormats.Delete(logger)
+	}()
+
+	n := countLogFlushers()
+	c := LogConfig{
+		Filename:     filepath.Join(dir, "1.log"),
+		Async:        true,
+		OTLPEndpoint: srv.URL,
+	}
+	if err := c.apply(logger, logFlagValues{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if m := countLogFlushers(); m != n+2 {
+		t.Error(`flushers of AsyncWriter and OTLPExporter should be registered`, m-n)
+	}
+	v, _ := loggerResources.Load(logger)
+	res := v.(*logResources)
+	aw := res.output.(*AsyncWriter)
+	lf := res.closers[0].(*logFile)
+	exporter := res.closers[1].(*OTLPExporter)
+
+	c = LogConfig{}
+	if err := c.apply(logger, logFlagValues{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if m := countLogFlushers(); m != n {
+		t.Error(`flushers should be unregistered`, m-n)
+	}
+	if _, err := aw.Write([]byte("foo\n")); err == nil {
+		t.Error(`AsyncWriter should be closed`)
+	}
+	if registeredLogFile(lf) {
+		t.Error(`log file should be closed`)
+	}
+	select {
+	case <-exporter.closeCh:
+	default:
+		t.Error(`OTLPExporter should be closed`)
+	}
+}
+
+func TestLogConfigReleaseOnError(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "test.log")
+	logger := log.NewLogger()
+	c := LogConfig{
+		Filename: filename,
+		Format:   "bad_format",
+	}
+	if err := c.apply(logger, logFlagValues{}, false); err == nil {
+		t.Fatal(`bad format should cause an error`)
+	}
+
+	logFilesMu.Lock()
+	defer logFilesMu.Unlock()
+	for _, lf := range logFiles {
+		if lf.filename == filename {
+			t.Error(`log file should be closed on error`)
+		}
+	}
+	if _, ok := loggerResources.Load(logger); ok {
+		t.Error(`resources should not be kept on error`)
+	}
+}
@@ -0,0 +1,147 @@
+package well
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultSampleWindow = 10 * time.Second
+	defaultSampleBurst  = 10
+)
+
+// LogSampleConfig configures LogSampler installed by LogConfig.
+// See LogSampler for the fields.
+type LogSampleConfig struct {
+	Window     time.Duration `toml:"window"     json:"window"     yaml:"window"`
+	Burst      int           `toml:"burst"      json:"burst"      yaml:"burst"`
+	Thereafter int           `toml:"thereafter" json:"thereafter" yaml:"thereafter"`
+}
+
+// LogSampler implements log.Formatter to suppress repeated log messages.
+//
+// Logs are grouped by severity and message text.  In each Window,
+// the first Burst logs of a group are formatted by Formatter.  After
+// that, only every Thereafter-th log is formatted, or none if
+// Thereafter is zero.  When the window ends, the number of dropped
+// logs is reported like "message X repeated 1432 times in 10s".
+//
+// LogConfig installs LogSampler by its Sample field.  To install it
+// manually, wrap the current formatter of a logger:
+//
+//	logger.SetFormatter(&well.LogSampler{Formatter: logger.Formatter()})
+//
+// A LogSampler must not be copied after first use.
+type LogSampler struct {
+	// Formatter formats logs that are not suppressed.  This must not be nil.
+	Formatter log.Formatter
+
+	// Window is the period to count repeated logs.
+	// Zero is treated as 10 seconds.
+	Window time.Duration
+
+	// Burst is the number of logs passed through in each window.
+	// Zero is treated as 10.
+	Burst int
+
+	// Thereafter, if not zero, passes every Thereafter-th log
+	// after Burst logs.
+	Thereafter int
+
+	mu     sync.Mutex
+	groups map[sampleKey]*sampleGroup
+}
+
+type sampleKey struct {
+	severity int
+	msg      string
+}
+
+type sampleGroup struct {
+	count   int
+	dropped int
+}
+
+// String returns the name of the inner formatter.
+func (s *LogSampler) String() string {
+	return s.Formatter.String()
+}
+
+// Format implements log.Formatter.
+func (s *LogSampler) Format(buf []byte, l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) ([]byte, error) {
+	if !s.pass(l, severity, msg) {
+		return buf[:0], nil
+	}
+	return s.Formatter.Format(buf, l, t, severity, msg, fields)
+}
+
+func (s *LogSampler) window() time.Duration {
+	if s.Window == 0 {
+		return defaultSampleWindow
+	}
+	return s.Window
+}
+
+func (s *LogSampler) pass(l *log.Logger, severity int, msg string) bool {
+	burst := s.Burst
+	if burst == 0 {
+		burst = defaultSampleBurst
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.groups == nil {
+		s.groups = make(map[sampleKey]*sampleGroup)
+	}
+
+	key := sampleKey{severity, msg}
+	g, ok := s.groups[key]
+	if !ok {
+		g = new(sampleGroup)
+		s.groups[key] = g
+		time.AfterFunc(s.window(), func() {
+			s.flush(l, key)
+		})
+	}
+
+	g.count++
+	if g.count <= burst {
+		return true
+	}
+	if s.Thereafter > 0 && (g.count-burst)%s.Thereafter == 0 {
+		return true
+	}
+	g.dropped++
+	atomic.AddInt64(&droppedLogs, 1)
+	return false
+}
+
+func (s *LogSampler) flush(l *log.Logger, key sampleKey) {
+	s.mu.Lock()
+	g := s.groups[key]
+	delete(s.groups, key)
+	s.mu.Unlock()
+
+	if g == nil || g.dropped == 0 {
+		return
+	}
+
+	buf := logBufPool.Get().(*[]byte)
+	defer logBufPool.Put(buf)
+
+	b, err := s.Formatter.Format((*buf)[:0], l, time.Now(), key.severity,
+		"well: log message repeated", map[string]interface{}{
+			"repeated_message": key.msg,
+			"repeated":         g.dropped,
+			"window":           s.window().String(),
+		})
+	if err != nil {
+		return
+	}
+	l.WriteThrough(b)
+}
@@ -0,0 +1,114 @@
+package well
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func TestLogSampler(t *testing.T) {
+	t.Parallel()
+
+	logger := log.NewLogger()
+	buf := new(syncBuffer)
+	logger.SetOutput(buf)
+	logger.SetFormatter(&LogSampler{
+		Formatter:  log.JSONFormat{},
+		Window:     100 * time.Millisecond,
+		Burst:      2,
+		Thereafter: 5,
+	})
+
+	for i := 0; i < 12; i++ {
+		logger.Error("accept error", nil)
+	}
+	logger.Error("another error", nil)
+
+	time.Sleep(300 * time.Millisecond)
+
+	var logs []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for decoder.More() {
+		var m map[string]interface{}
+		err := decoder.Decode(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, m)
+	}
+
+	// 2 bursts + 2 sampled + 1 another + 1 summary
+	if len(logs) != 6 {
+		t.Fatal(`len(logs) != 6`, len(logs))
+	}
+	summary := logs[5]
+	if summary["message"] != "well: log message repeated" {
+		t.Error(`summary["message"] != "well: log message repeated"`)
+	}
+	if summary["repeated_message"] != "accept error" {
+		t.Error(`summary["repeated_message"] != "accept error"`)
+	}
+	if summary["repeated"] != 8.0 {
+		t.Error(`summary["repeated"] != 8`, summary["repeated"])
+	}
+	if summary["severity"] != "error" {
+		t.Error(`summary["severity"] != "error"`)
+	}
+}
+
+func TestLogConfigSample(t *testing.T) {
+	t.Parallel()
+
+	logger := log.NewLogger()
+	buf := new(syncBuffer)
+	logger.SetOutput(buf)
+	defer primaryFormats.Delete(logger)
+
+	c := LogConfig{
+		Format: "json",
+		Sample: &LogSampleConfig{Window: time.Hour, Burst: 2},
+	}
+	if err := c.apply(logger, logFlagValues{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := logger.Formatter().(*LogSampler); !ok {
+		t.Fatal(`LogSampler is not installed`, logger.Formatter())
+	}
+
+	for i := 0; i < 5; i++ {
+		logger.Error("accept error", nil)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte("accept error")); n != 2 {
+		t.Error(`repeated logs should be sampled`, n)
+	}
+
+	// applying again without Sample removes the sampler.
+	c.Sample = nil
+	if err := c.apply(logger, logFlagValues{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := logger.Formatter().(*LogSampler); ok {
+		t.Error(`LogSampler should be removed`)
+	}
+}
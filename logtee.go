@@ -0,0 +1,184 @@
+package well
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// LogOutput configures an additional destination of logs.
+//
+// Filename, if not an empty string, specifies the output filename.
+// Empty string means the standard error.
+//
+// Level and Format are the same as those of LogConfig.
+// Empty Level is treated as "info", and empty Format as "plain".
+type LogOutput struct {
+	Filename string `toml:"filename" json:"filename" yaml:"filename"`
+	Level    string `toml:"level"    json:"level"    yaml:"level"`
+	Format   string `toml:"format"   json:"format"   yaml:"format"`
+}
+
+type teeOutput struct {
+	formatter log.Formatter
+	threshold int
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// teeFormat implements log.Formatter to write logs to multiple
+// destinations with different formats and thresholds.
+//
+// The primary destination is the output of the logger.
+// Additional destinations are written directly by Format.
+//
+// As the logger must pass logs for all destinations to Format, the
+// threshold of the logger is the most verbose one among destinations.
+// The threshold of the primary destination is kept in teeFormat and
+// changed by setLogLevel.
+type teeFormat struct {
+	primary   log.Formatter
+	threshold int32
+	outputs   []*teeOutput
+}
+
+// teeFormats keeps *teeFormat installed by LogConfig for each *log.Logger.
+var teeFormats sync.Map
+
+// loggerTee returns the teeFormat installed for logger, or nil.
+func loggerTee(logger *log.Logger) *teeFormat {
+	tf, ok := teeFormats.Load(logger)
+	if !ok {
+		return nil
+	}
+	return tf.(*teeFormat)
+}
+
+func (o LogOutput) threshold() (int, error) {
+	level := o.Level
+	if len(level) == 0 {
+		level = "info"
+	}
+	return levelByName(level)
+}
+
+func newTeeFormat(primary log.Formatter, threshold int, outputs []LogOutput) (*teeFormat, error) {
+	tf := &teeFormat{
+		primary:   primary,
+		threshold: int32(threshold),
+	}
+	for _, o := range outputs {
+		formatter, err := formatterByName(o.Format)
+		if err != nil {
+			tf.close()
+			return nil, err
+		}
+		th, err := o.threshold()
+		if err != nil {
+			tf.close()
+			return nil, err
+		}
+
+		var w io.Writer = os.Stderr
+		if len(o.Filename) > 0 {
+			abspath, err := filepath.Abs(o.Filename)
+			if err != nil {
+				tf.close()
+				return nil, err
+			}
+			w, err = openLogFile(abspath)
+			if err != nil {
+				tf.close()
+				return nil, err
+			}
+		}
+		tf.outputs = append(tf.outputs, &teeOutput{
+			formatter: formatter,
+			threshold: th,
+			w:         w,
+		})
+	}
+	return tf, nil
+}
+
+// String returns the name of the primary formatter.
+func (f *teeFormat) String() string {
+	return f.primary.String()
+}
+
+// Threshold returns the threshold of the primary destination.
+func (f *teeFormat) Threshold() int {
+	return int(atomic.LoadInt32(&f.threshold))
+}
+
+// setThreshold sets the threshold of the primary destination, and
+// returns the threshold to be set to the logger.
+func (f *teeFormat) setThreshold(threshold int) int {
+	atomic.StoreInt32(&f.threshold, int32(threshold))
+	for _, o := range f.outputs {
+		if o.threshold > threshold {
+			threshold = o.threshold
+		}
+	}
+	return threshold
+}
+
+// primaryEnabled returns true if the log should be written to the
+// primary destination.  Logs of ModuleLogger follow the threshold
+// of the module as they do without teeFormat.
+func (f *teeFormat) primaryEnabled(severity int, fields map[string]interface{}) bool {
+	if name, ok := fields[FnModule].(string); ok {
+		if m := lookupModule(name); m != nil {
+			return m.Enabled(severity)
+		}
+	}
+	return severity <= f.Threshold()
+}
+
+// Format implements log.Formatter.
+func (f *teeFormat) Format(buf []byte, l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) ([]byte, error) {
+	for _, o := range f.outputs {
+		if severity > o.threshold {
+			continue
+		}
+		o.write(l, t, severity, msg, fields)
+	}
+
+	if !f.primaryEnabled(severity, fields) {
+		return buf[:0], nil
+	}
+	return f.primary.Format(buf, l, t, severity, msg, fields)
+}
+
+// close closes files of the additional destinations.
+func (f *teeFormat) close() {
+	for _, o := range f.outputs {
+		if c, ok := o.w.(io.Closer); ok && o.w != io.Writer(os.Stderr) {
+			o.mu.Lock()
+			c.Close()
+			o.mu.Unlock()
+		}
+	}
+}
+
+func (o *teeOutput) write(l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) {
+	buf := logBufPool.Get().(*[]byte)
+	defer logBufPool.Put(buf)
+
+	b, err := o.formatter.Format((*buf)[:0], l, t, severity, msg, fields)
+	if err != nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.w.Write(b)
+}
@@ -0,0 +1,136 @@
+package well
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestTeeFormat(t *testing.T) {
+	t.Parallel()
+
+	primary := new(bytes.Buffer)
+	extra := new(bytes.Buffer)
+
+	tf := &teeFormat{
+		primary:   log.JSONFormat{},
+		threshold: log.LvWarn,
+		outputs: []*teeOutput{
+			{formatter: log.Logfmt{}, threshold: log.LvDebug, w: extra},
+		},
+	}
+	th := tf.setThreshold(log.LvWarn)
+	if th != log.LvDebug {
+		t.Error(`th != log.LvDebug`)
+	}
+	if tf.String() != "json" {
+		t.Error(`tf.String() != "json"`)
+	}
+
+	logger := log.NewLogger()
+	logger.SetOutput(primary)
+	logger.SetFormatter(tf)
+	logger.SetThreshold(th)
+
+	logger.Debug("debug message", nil)
+	logger.Error("error message", nil)
+
+	if strings.Contains(primary.String(), "debug message") {
+		t.Error(`debug message should not be written to the primary output`)
+	}
+	if !strings.Contains(primary.String(), `"message":"error message"`) {
+		t.Error(`error message should be written to the primary output in JSON`)
+	}
+	if !strings.Contains(extra.String(), `message="debug message"`) {
+		t.Error(`debug message should be written to the extra output in logfmt`)
+	}
+	if !strings.Contains(extra.String(), `message="error message"`) {
+		t.Error(`error message should be written to the extra output in logfmt`)
+	}
+}
+
+func TestTeeFormatLogLevel(t *testing.T) {
+	t.Parallel()
+
+	primary := new(bytes.Buffer)
+	extra := new(bytes.Buffer)
+
+	tf := &teeFormat{
+		primary:   log.Logfmt{},
+		threshold: log.LvInfo,
+		outputs: []*teeOutput{
+			{formatter: log.Logfmt{}, threshold: log.LvWarn, w: extra},
+		},
+	}
+	logger := log.NewLogger()
+	logger.SetOutput(primary)
+	logger.SetFormatter(tf)
+	logger.SetThreshold(log.LvInfo)
+	teeFormats.Store(logger, tf)
+	defer teeFormats.Delete(logger)
+
+	err := setLogLevel(logger, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loggerLevel(logger) != log.LvDebug {
+		t.Error(`loggerLevel(logger) != log.LvDebug`)
+	}
+	logger.Debug("debug message", nil)
+	if !strings.Contains(primary.String(), `message="debug message"`) {
+		t.Error(`debug message should be written to the primary output`)
+	}
+	if strings.Contains(extra.String(), "debug message") {
+		t.Error(`debug message should not be written to the extra output`)
+	}
+
+	err = setLogLevel(logger, "error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logger.Threshold() != log.LvWarn {
+		t.Error(`logger.Threshold() != log.LvWarn`, logger.Threshold())
+	}
+	logger.Warn("warning message", nil)
+	if strings.Contains(primary.String(), "warning message") {
+		t.Error(`warning message should not be written to the primary output`)
+	}
+	if !strings.Contains(extra.String(), `message="warning message"`) {
+		t.Error(`warning message should be written to the extra output`)
+	}
+
+	// logs of modules follow the thresholds of the modules.
+	Module("well.test.tee").SetThreshold(log.LvDebug)
+	writeLog(logger, log.LvDebug, "module message", map[string]interface{}{
+		FnModule: "well.test.tee",
+	})
+	if !strings.Contains(primary.String(), `message="module message"`) {
+		t.Error(`module message should be written to the primary output`)
+	}
+}
+
+func TestTeeFormatClose(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "extra.log")
+	tf, err := newTeeFormat(log.PlainFormat{}, log.LvInfo, []LogOutput{{Filename: filename}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf := tf.outputs[0].w.(*logFile)
+
+	tf.close()
+	if _, err := lf.Write([]byte("foo\n")); err == nil {
+		t.Error(`closed file should not be written`)
+	}
+	logFilesMu.Lock()
+	for _, f := range logFiles {
+		if f == lf {
+			t.Error(`closed file should not be reopened`)
+		}
+	}
+	logFilesMu.Unlock()
+}
@@ -0,0 +1,48 @@
+package well
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	// the same as the maximum log size of cybozu-go/log.
+	maxLogSize = 1 << 20
+)
+
+var logBufPool = &sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, maxLogSize)
+		return &b
+	},
+}
+
+// writeLog formats a log record by logger's formatter and writes it
+// to logger's output regardless of logger's threshold.
+//
+// Formatters of cybozu-go/log expect a buffer of large capacity,
+// so the buffer is taken from a pool.
+func writeLog(logger *log.Logger, severity int, msg string, fields map[string]interface{}) error {
+	return writeLogAt(logger, time.Now(), severity, msg, fields)
+}
+
+// writeLogAt is the same as writeLog except that the log is
+// recorded as if it was logged at t.
+func writeLogAt(logger *log.Logger, t time.Time, severity int, msg string, fields map[string]interface{}) error {
+	return writeLogWith(logger, logger.Formatter(), t, severity, msg, fields)
+}
+
+// writeLogWith is the same as writeLogAt except that the log is
+// formatted by f instead of logger's formatter.
+func writeLogWith(logger *log.Logger, f log.Formatter, t time.Time, severity int, msg string, fields map[string]interface{}) error {
+	buf := logBufPool.Get().(*[]byte)
+	defer logBufPool.Put(buf)
+
+	b, err := f.Format((*buf)[:0], logger, t, severity, msg, fields)
+	if err != nil {
+		return err
+	}
+	return logger.WriteThrough(b)
+}
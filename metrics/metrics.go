@@ -0,0 +1,115 @@
+// Package metrics exports statistics of github.com/cybozu-go/well
+// as Prometheus metrics.
+//
+// This is a separate package so that programs that do not use
+// Prometheus do not depend on its client library.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/cybozu-go/well"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "well"
+
+var (
+	goroutinesDesc = prometheus.NewDesc(
+		namespace+"_goroutines",
+		"The number of goroutines.",
+		nil, nil)
+	runningTasksDesc = prometheus.NewDesc(
+		namespace+"_running_tasks",
+		"The number of tasks started by well.Go and still running.",
+		nil, nil)
+	activeConnectionsDesc = prometheus.NewDesc(
+		namespace+"_active_connections",
+		"The number of connections handled by servers.",
+		nil, nil)
+	activeRequestsDesc = prometheus.NewDesc(
+		namespace+"_active_requests",
+		"The number of requests handled by HTTP servers.",
+		nil, nil)
+	drainingDesc = prometheus.NewDesc(
+		namespace+"_draining",
+		"1 if servers are draining connections, 0 otherwise.",
+		nil, nil)
+	restartsDesc = prometheus.NewDesc(
+		namespace+"_restarts_total",
+		"The number of graceful restarts.",
+		nil, nil)
+	droppedLogsDesc = prometheus.NewDesc(
+		namespace+"_dropped_logs_total",
+		"The number of dropped logs.",
+		nil, nil)
+	waitDurationDesc = prometheus.NewDesc(
+		namespace+"_wait_duration_seconds",
+		"The time well.Wait took after the environment was canceled.",
+		nil, nil)
+	httpRequestDurationDesc = prometheus.NewDesc(
+		namespace+"_http_request_duration_seconds",
+		"The time HTTP servers took to handle requests.",
+		nil, nil)
+)
+
+type collector struct{}
+
+// NewCollector returns a prometheus.Collector that collects
+// statistics returned by well.ReadStats.
+func NewCollector() prometheus.Collector {
+	return collector{}
+}
+
+// Register registers the collector returned by NewCollector to r.
+func Register(r prometheus.Registerer) error {
+	return r.Register(NewCollector())
+}
+
+// Handler returns an http.Handler that exposes the metrics of this
+// package with its own registry.  Mount it on any mux, e.g.:
+//
+//	mux.Handle("/metrics", metrics.Handler())
+func Handler() http.Handler {
+	r := prometheus.NewRegistry()
+	r.MustRegister(NewCollector())
+	return promhttp.HandlerFor(r, promhttp.HandlerOpts{})
+}
+
+func (collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- goroutinesDesc
+	ch <- runningTasksDesc
+	ch <- activeConnectionsDesc
+	ch <- activeRequestsDesc
+	ch <- drainingDesc
+	ch <- restartsDesc
+	ch <- droppedLogsDesc
+	ch <- waitDurationDesc
+	ch <- httpRequestDurationDesc
+}
+
+func (collector) Collect(ch chan<- prometheus.Metric) {
+	s := well.ReadStats()
+
+	var draining float64
+	if s.Draining {
+		draining = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(goroutinesDesc, prometheus.GaugeValue, float64(s.Goroutines))
+	ch <- prometheus.MustNewConstMetric(runningTasksDesc, prometheus.GaugeValue, float64(s.RunningTasks))
+	ch <- prometheus.MustNewConstMetric(activeConnectionsDesc, prometheus.GaugeValue, float64(s.ActiveConnections))
+	ch <- prometheus.MustNewConstMetric(activeRequestsDesc, prometheus.GaugeValue, float64(s.ActiveRequests))
+	ch <- prometheus.MustNewConstMetric(drainingDesc, prometheus.GaugeValue, draining)
+	ch <- prometheus.MustNewConstMetric(restartsDesc, prometheus.CounterValue, float64(s.Restarts))
+	ch <- prometheus.MustNewConstMetric(droppedLogsDesc, prometheus.CounterValue, float64(s.DroppedLogs))
+	ch <- prometheus.MustNewConstMetric(waitDurationDesc, prometheus.GaugeValue, s.WaitDuration.Seconds())
+
+	h := s.HTTPRequestDuration
+	buckets := make(map[float64]uint64, len(h.Buckets))
+	for i, b := range h.Buckets {
+		buckets[b] = uint64(h.Counts[i])
+	}
+	ch <- prometheus.MustNewConstHistogram(httpRequestDurationDesc, uint64(h.Count), h.Sum, buckets)
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Fatal(`resp.StatusCode != 200`, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(data)
+
+	for _, name := range []string{
+		"well_goroutines",
+		"well_running_tasks",
+		"well_active_connections",
+		"well_active_requests",
+		"well_draining",
+		"well_restarts_total",
+		"well_dropped_logs_total",
+		"well_wait_duration_seconds",
+		"well_http_request_duration_seconds_count",
+	} {
+		if !strings.Contains(body, "\n"+name+" ") {
+			t.Error(`missing metric`, name)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	r := prometheus.NewRegistry()
+	if err := Register(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(r); err == nil {
+		t.Error(`duplicate registration should fail`)
+	}
+}
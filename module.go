@@ -0,0 +1,179 @@
+package well
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	// FnModule is the log field name for module names.
+	FnModule = "module"
+
+	// inheritThreshold indicates that the threshold of the default
+	// logger is used.
+	inheritThreshold = -1
+)
+
+var (
+	modulesMu sync.Mutex
+	modules   = make(map[string]*ModuleLogger)
+)
+
+// ModuleLogger is a logger for a named module that has its own
+// threshold level independent of the default logger.
+//
+// Logs are formatted and written by the default logger with
+// the module name as "module" field.  Unless a threshold is set,
+// ModuleLogger follows the threshold of the default logger.
+//
+// Use Module to obtain a ModuleLogger.
+type ModuleLogger struct {
+	name      string
+	threshold int32
+}
+
+// Module returns the ModuleLogger for name.
+// The same name always returns the same ModuleLogger.
+//
+// Names are conventionally dot-separated such as "well.server".
+func Module(name string) *ModuleLogger {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+
+	m, ok := modules[name]
+	if !ok {
+		m = &ModuleLogger{name: name, threshold: inheritThreshold}
+		modules[name] = m
+	}
+	return m
+}
+
+// lookupModule returns the ModuleLogger for name, or nil if none.
+func lookupModule(name string) *ModuleLogger {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	return modules[name]
+}
+
+// SetModuleLevels sets threshold levels of module loggers.
+//
+// spec is a comma-separated list of "NAME=LEVEL" such as
+// "well.server=debug,app=info".  Levels of modules not listed
+// in spec are not changed.
+func SetModuleLevels(spec string) error {
+	levels, err := parseModuleLevels(spec)
+	if err != nil {
+		return err
+	}
+	for name, level := range levels {
+		Module(name).SetThreshold(level)
+	}
+	return nil
+}
+
+func parseModuleLevels(spec string) (map[string]int, error) {
+	levels := make(map[string]int)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			return nil, errors.New("invalid module level: " + item)
+		}
+		level, err := levelByName(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(kv[0])] = level
+	}
+	return levels, nil
+}
+
+func levelByName(name string) (int, error) {
+	// SetThresholdByName is the only API of cybozu-go/log that
+	// parses level names.
+	l := log.NewLogger()
+	err := l.SetThresholdByName(name)
+	if err != nil {
+		return 0, err
+	}
+	return l.Threshold(), nil
+}
+
+// Name returns the module name.
+func (m *ModuleLogger) Name() string {
+	return m.name
+}
+
+// Threshold returns the current threshold of the module.
+func (m *ModuleLogger) Threshold() int {
+	th := int(atomic.LoadInt32(&m.threshold))
+	if th == inheritThreshold {
+		return loggerLevel(log.DefaultLogger())
+	}
+	return th
+}
+
+// SetThreshold sets the threshold of the module.
+// Negative values reset the threshold to follow the default logger.
+func (m *ModuleLogger) SetThreshold(level int) {
+	if level < 0 {
+		level = inheritThreshold
+	}
+	atomic.StoreInt32(&m.threshold, int32(level))
+}
+
+// Enabled returns true if logs of level will be recorded.
+func (m *ModuleLogger) Enabled(level int) bool {
+	return level <= m.Threshold()
+}
+
+// Log records a log with the module name.
+func (m *ModuleLogger) Log(severity int, msg string, fields map[string]interface{}) error {
+	if !m.Enabled(severity) {
+		return nil
+	}
+
+	f := make(map[string]interface{}, len(fields)+1)
+	for k, v := range fields {
+		f[k] = v
+	}
+	f[FnModule] = m.name
+
+	logger := log.DefaultLogger()
+	if logger.Enabled(severity) {
+		return logger.Log(severity, msg, f)
+	}
+	return writeLog(logger, severity, msg, f)
+}
+
+// Critical records a log of critical level.
+func (m *ModuleLogger) Critical(msg string, fields map[string]interface{}) error {
+	return m.Log(log.LvCritical, msg, fields)
+}
+
+// Error records a log of error level.
+func (m *ModuleLogger) Error(msg string, fields map[string]interface{}) error {
+	return m.Log(log.LvError, msg, fields)
+}
+
+// Warn records a log of warning level.
+func (m *ModuleLogger) Warn(msg string, fields map[string]interface{}) error {
+	return m.Log(log.LvWarn, msg, fields)
+}
+
+// Info records a log of info level.
+func (m *ModuleLogger) Info(msg string, fields map[string]interface{}) error {
+	return m.Log(log.LvInfo, msg, fields)
+}
+
+// Debug records a log of debug level.
+func (m *ModuleLogger) Debug(msg string, fields map[string]interface{}) error {
+	return m.Log(log.LvDebug, msg, fields)
+}
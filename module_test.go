@@ -0,0 +1,88 @@
+package well
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestParseModuleLevels(t *testing.T) {
+	t.Parallel()
+
+	levels, err := parseModuleLevels("well.server=debug, app=warning,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != 2 {
+		t.Fatal(`len(levels) != 2`)
+	}
+	if levels["well.server"] != log.LvDebug {
+		t.Error(`levels["well.server"] != log.LvDebug`)
+	}
+	if levels["app"] != log.LvWarn {
+		t.Error(`levels["app"] != log.LvWarn`)
+	}
+
+	for _, spec := range []string{"app", "=debug", "app=bad_level"} {
+		_, err := parseModuleLevels(spec)
+		if err == nil {
+			t.Error(spec + " should cause an error")
+		}
+	}
+}
+
+func TestModuleLogger(t *testing.T) {
+	// not parallel as this test modifies the default logger.
+	logger := log.DefaultLogger()
+	buf := new(bytes.Buffer)
+	logger.SetOutput(buf)
+	logger.SetFormatter(log.JSONFormat{})
+	defer func() {
+		logger.SetOutput(os.Stderr)
+		logger.SetFormatter(log.PlainFormat{})
+	}()
+
+	m := Module("test.module")
+	if Module("test.module") != m {
+		t.Error(`Module should return the same logger`)
+	}
+	if m.Threshold() != logger.Threshold() {
+		t.Error(`m.Threshold() != logger.Threshold()`)
+	}
+
+	err := SetModuleLevels("test.module=debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.SetThreshold(-1)
+
+	err = m.Debug("hello", map[string]interface{}{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec["severity"] != "debug" {
+		t.Error(`rec["severity"] != "debug"`)
+	}
+	if rec[FnModule] != "test.module" {
+		t.Error(`rec[FnModule] != "test.module"`)
+	}
+	if rec["foo"] != "bar" {
+		t.Error(`rec["foo"] != "bar"`)
+	}
+
+	buf.Reset()
+	m.SetThreshold(log.LvError)
+	m.Warn("hello", nil)
+	if buf.Len() != 0 {
+		t.Error(`warning should not be logged`)
+	}
+}
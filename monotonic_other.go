@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package well
+
+// monotonicUsec is not implemented other than Linux.
+func monotonicUsec() (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,418 @@
+package well
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	otlpLogsEndpointEnv = "OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"
+
+	defaultOTLPQueueSize     = 8192
+	defaultOTLPBatchSize     = 512
+	defaultOTLPFlushInterval = time.Second
+	defaultOTLPTimeout       = 10 * time.Second
+
+	otlpScopeName = "github.com/cybozu-go/well"
+)
+
+// OTLPExporter ships logs to an OpenTelemetry collector using
+// OTLP/HTTP with JSON encoding.
+//
+// Logs are queued and sent in batches by a background goroutine.
+// When the queue is full, new logs are dropped.  Call Flush before
+// the program exits to send the queued logs.
+//
+// If a log has a request ID, it is recorded as "request_id" attribute.
+// In addition, request IDs generated by IDGenerator are valid 128-bit
+// hex strings, so they are also set as the trace ID of the log record
+// for correlation.
+type OTLPExporter struct {
+	// Endpoint is the URL of OTLP/HTTP logs endpoint,
+	// e.g. "http://localhost:4318/v1/logs".  This must not be empty.
+	Endpoint string
+
+	// Headers are added to export requests.
+	Headers map[string]string
+
+	// Client is used to send requests.
+	// If nil, a client with 10 seconds timeout is used.
+	Client *http.Client
+
+	// QueueSize is the maximum number of queued logs.
+	// Zero is treated as 8192.
+	QueueSize int
+
+	// BatchSize is the maximum number of logs in a request.
+	// Zero is treated as 512.
+	BatchSize int
+
+	// FlushInterval is the interval to send queued logs.
+	// Zero is treated as 1 second.
+	FlushInterval time.Duration
+
+	initOnce  sync.Once
+	notifyCh  chan struct{}
+	closeOnce sync.Once
+	closeCh   chan struct{}
+
+	utsname string
+
+	mu      sync.Mutex
+	queue   []otlpLogRecord
+	topic   string
+	dropped int
+	lastErr error
+
+	flushMu sync.Mutex
+}
+
+type otlpAnyValue struct {
+	StringValue *string          `json:"stringValue,omitempty"`
+	BoolValue   *bool            `json:"boolValue,omitempty"`
+	IntValue    *string          `json:"intValue,omitempty"`
+	DoubleValue *float64         `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue  `json:"arrayValue,omitempty"`
+	KvlistValue *otlpKvlistValue `json:"kvlistValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+type otlpKvlistValue struct {
+	Values []otlpKeyValue `json:"values"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID              string         `json:"traceId,omitempty"`
+}
+
+func otlpSeverity(severity int) int {
+	switch {
+	case severity <= log.LvCritical:
+		return 21 // FATAL
+	case severity <= log.LvError:
+		return 17 // ERROR
+	case severity <= log.LvWarn:
+		return 13 // WARN
+	case severity <= log.LvInfo:
+		return 9 // INFO
+	}
+	return 5 // DEBUG
+}
+
+func otlpString(s string) otlpAnyValue {
+	return otlpAnyValue{StringValue: &s}
+}
+
+func otlpValue(v interface{}) otlpAnyValue {
+	switch t := v.(type) {
+	case nil:
+		return otlpAnyValue{}
+	case string:
+		return otlpString(t)
+	case bool:
+		return otlpAnyValue{BoolValue: &t}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprint(t)
+		return otlpAnyValue{IntValue: &s}
+	case float32:
+		f := float64(t)
+		return otlpAnyValue{DoubleValue: &f}
+	case float64:
+		return otlpAnyValue{DoubleValue: &t}
+	case time.Time:
+		return otlpString(t.UTC().Format(log.RFC3339Micro))
+	case error:
+		return otlpString(t.Error())
+	case fmt.Stringer:
+		return otlpString(t.String())
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			break
+		}
+		kv := &otlpKvlistValue{}
+		for iter := value.MapRange(); iter.Next(); {
+			kv.Values = append(kv.Values, otlpKeyValue{
+				Key:   iter.Key().String(),
+				Value: otlpValue(iter.Value().Interface()),
+			})
+		}
+		return otlpAnyValue{KvlistValue: kv}
+	case reflect.Slice, reflect.Array:
+		av := &otlpArrayValue{Values: []otlpAnyValue{}}
+		for i := 0; i < value.Len(); i++ {
+			av.Values = append(av.Values, otlpValue(value.Index(i).Interface()))
+		}
+		return otlpAnyValue{ArrayValue: av}
+	}
+	return otlpString(fmt.Sprintf("%v", v))
+}
+
+// otlpTraceID returns the trace ID derived from a request ID, if valid.
+func otlpTraceID(reqid string) string {
+	id := strings.ReplaceAll(reqid, "-", "")
+	if len(id) != 32 {
+		return ""
+	}
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return ""
+	}
+	for _, c := range b {
+		if c != 0 {
+			return strings.ToLower(id)
+		}
+	}
+	return ""
+}
+
+func (e *OTLPExporter) init() {
+	e.notifyCh = make(chan struct{}, 1)
+	e.closeCh = make(chan struct{})
+	e.utsname, _ = os.Hostname()
+
+	go func() {
+		interval := e.FlushInterval
+		if interval == 0 {
+			interval = defaultOTLPFlushInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-e.notifyCh:
+			case <-e.closeCh:
+				return
+			}
+			e.Flush()
+		}
+	}()
+}
+
+// Export queues a log to be sent.
+// Fields are converted immediately, so the caller may reuse fields.
+func (e *OTLPExporter) Export(l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) {
+	e.initOnce.Do(e.init)
+
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	rec := otlpLogRecord{
+		TimeUnixNano:         strconv.FormatInt(t.UnixNano(), 10),
+		ObservedTimeUnixNano: now,
+		SeverityNumber:       otlpSeverity(severity),
+		SeverityText:         strings.ToUpper(log.LevelName(severity)),
+		Body:                 otlpString(msg),
+	}
+	add := func(k string, v interface{}) {
+		rec.Attributes = append(rec.Attributes, otlpKeyValue{Key: k, Value: otlpValue(v)})
+		if k == log.FnRequestID {
+			if s, ok := v.(string); ok {
+				rec.TraceID = otlpTraceID(s)
+			}
+		}
+	}
+	for k, v := range fields {
+		add(k, v)
+	}
+	for k, v := range l.Defaults() {
+		if _, ok := fields[k]; ok {
+			continue
+		}
+		add(k, v)
+	}
+
+	batchSize := e.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultOTLPBatchSize
+	}
+	queueSize := e.QueueSize
+	if queueSize == 0 {
+		queueSize = defaultOTLPQueueSize
+	}
+
+	e.mu.Lock()
+	e.topic = l.Topic()
+	if len(e.queue) >= queueSize {
+		e.dropped++
+		atomic.AddInt64(&droppedLogs, 1)
+		e.mu.Unlock()
+		return
+	}
+	e.queue = append(e.queue, rec)
+	full := len(e.queue) >= batchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.notifyCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush sends all queued logs synchronously.
+func (e *OTLPExporter) Flush() error {
+	e.initOnce.Do(e.init)
+
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
+
+	batchSize := e.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultOTLPBatchSize
+	}
+
+	for {
+		e.mu.Lock()
+		n := len(e.queue)
+		if n > batchSize {
+			n = batchSize
+		}
+		batch := make([]otlpLogRecord, n)
+		copy(batch, e.queue)
+		e.queue = e.queue[n:]
+		if len(e.queue) == 0 {
+			e.queue = nil
+		}
+		topic := e.topic
+		dropped := e.dropped
+		e.dropped = 0
+		e.mu.Unlock()
+
+		if dropped > 0 {
+			fmt.Fprintf(os.Stderr, "well: dropped %d logs for OTLP export\n", dropped)
+		}
+		if n == 0 {
+			return nil
+		}
+
+		err := e.send(topic, batch)
+		e.mu.Lock()
+		if err != nil && e.lastErr == nil {
+			// report only the first error of consecutive errors.
+			fmt.Fprintf(os.Stderr, "well: failed to export logs: %v\n", err)
+		}
+		e.lastErr = err
+		e.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close sends all queued logs and stops the background goroutine.
+// Logs exported after Close are sent only by Flush.
+func (e *OTLPExporter) Close() error {
+	err := e.Flush()
+	e.closeOnce.Do(func() {
+		close(e.closeCh)
+	})
+	return err
+}
+
+func (e *OTLPExporter) send(topic string, batch []otlpLogRecord) error {
+	if len(e.Endpoint) == 0 {
+		return errors.New("no OTLP endpoint")
+	}
+
+	payload := map[string]interface{}{
+		"resourceLogs": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpKeyValue{
+						{Key: "service.name", Value: otlpString(topic)},
+						{Key: "host.name", Value: otlpString(e.utsname)},
+						{Key: "process.pid", Value: otlpValue(os.Getpid())},
+					},
+				},
+				"scopeLogs": []interface{}{
+					map[string]interface{}{
+						"scope":      map[string]interface{}{"name": otlpScopeName},
+						"logRecords": batch,
+					},
+				},
+			},
+		},
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultOTLPTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New("OTLP export failed: " + resp.Status)
+	}
+	return nil
+}
+
+// OTLPFormat implements log.Formatter to export logs by Exporter
+// in addition to formatting them by Formatter for local output.
+type OTLPFormat struct {
+	// Formatter formats logs for the local output.  This must not be nil.
+	Formatter log.Formatter
+
+	// Exporter exports logs.  This must not be nil.
+	Exporter *OTLPExporter
+}
+
+// String returns the name of the inner formatter.
+func (f OTLPFormat) String() string {
+	return f.Formatter.String()
+}
+
+// Format implements log.Formatter.
+func (f OTLPFormat) Format(buf []byte, l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) ([]byte, error) {
+	f.Exporter.Export(l, t, severity, msg, fields)
+	return f.Formatter.Format(buf, l, t, severity, msg, fields)
+}
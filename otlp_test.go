@@ -0,0 +1,118 @@
+package well
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var payloads []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("X-Test") != "ok" {
+			http.Error(w, "no header", http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		var p map[string]interface{}
+		if err := json.Unmarshal(data, &p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		payloads = append(payloads, p)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	exporter := &OTLPExporter{
+		Endpoint:      srv.URL + "/v1/logs",
+		Headers:       map[string]string{"X-Test": "ok"},
+		FlushInterval: time.Hour,
+	}
+	logger := log.NewLogger()
+	logger.SetOutput(io.Discard)
+	logger.SetFormatter(OTLPFormat{Formatter: log.JSONFormat{}, Exporter: exporter})
+
+	logger.Error("hello", map[string]interface{}{
+		log.FnRequestID: testUUID,
+		"count":         3,
+		"list":          []string{"a", "b"},
+	})
+	logger.Info("world", nil)
+
+	err := exporter.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(payloads) != 1 {
+		t.Fatal(`len(payloads) != 1`)
+	}
+
+	rl := payloads[0]["resourceLogs"].([]interface{})[0].(map[string]interface{})
+	sl := rl["scopeLogs"].([]interface{})[0].(map[string]interface{})
+	records := sl["logRecords"].([]interface{})
+	if len(records) != 2 {
+		t.Fatal(`len(records) != 2`)
+	}
+
+	rec := records[0].(map[string]interface{})
+	if rec["severityNumber"] != 17.0 {
+		t.Error(`rec["severityNumber"] != 17`)
+	}
+	if rec["severityText"] != "ERROR" {
+		t.Error(`rec["severityText"] != "ERROR"`)
+	}
+	if rec["body"].(map[string]interface{})["stringValue"] != "hello" {
+		t.Error(`unexpected body`, rec["body"])
+	}
+	if rec["traceId"] != "cad48be9285c4b70817733e41550a3c8" {
+		t.Error(`unexpected traceId`, rec["traceId"])
+	}
+
+	attrs := make(map[string]interface{})
+	for _, a := range rec["attributes"].([]interface{}) {
+		kv := a.(map[string]interface{})
+		attrs[kv["key"].(string)] = kv["value"]
+	}
+	if attrs["count"].(map[string]interface{})["intValue"] != "3" {
+		t.Error(`unexpected count`, attrs["count"])
+	}
+	if len(attrs["list"].(map[string]interface{})["arrayValue"].(map[string]interface{})["values"].([]interface{})) != 2 {
+		t.Error(`unexpected list`, attrs["list"])
+	}
+
+	if _, ok := records[1].(map[string]interface{})["traceId"]; ok {
+		t.Error(`traceId should be omitted without request ID`)
+	}
+}
+
+func TestOTLPTraceID(t *testing.T) {
+	t.Parallel()
+
+	if otlpTraceID("not-a-uuid") != "" {
+		t.Error(`invalid request ID should not be a trace ID`)
+	}
+	if otlpTraceID("00000000-0000-0000-0000-000000000000") != "" {
+		t.Error(`all zero trace ID is invalid`)
+	}
+	if otlpTraceID(testUUID) != "cad48be9285c4b70817733e41550a3c8" {
+		t.Error(`otlpTraceID(testUUID) != "cad48be9285c4b70817733e41550a3c8"`)
+	}
+}
@@ -0,0 +1,372 @@
+package well
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	otlpTracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+
+	// span kind and status code of OTLP.
+	otlpSpanKindInternal = 1
+	otlpStatusCodeError  = 2
+
+	traceFlagSampled = 1
+)
+
+var (
+	spanExporterMu sync.Mutex
+	spanExporter   *OTLPSpanExporter
+)
+
+// TracingConfig configures tracing of tasks started by Go, GoWithID,
+// and GoWithParent of environments.
+//
+// When applied with an endpoint, each task is recorded as a span
+// named after the function of the task.  The span is a child of the
+// TraceContext in the context of the task, if any, and a span of
+// failed tasks has an error status with the error message.  The
+// context given to the task has the TraceContext of the span, so
+// requests sent by HTTPClient in the task are traced as its children.
+//
+// The service name of spans is the topic of the default logger.
+type TracingConfig struct {
+	// OTLPEndpoint is the URL of an OTLP/HTTP traces endpoint such
+	// as "http://localhost:4318/v1/traces".
+	//
+	// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT environment variable takes
+	// precedence over this.  If both are empty, tracing is disabled.
+	OTLPEndpoint string `toml:"otlp_endpoint" json:"otlp_endpoint" yaml:"otlp_endpoint"`
+}
+
+// Apply applies configurations to the global environment.
+// Spans are sent in batches in background, and flushed by FlushLogs.
+func (c TracingConfig) Apply() {
+	endpoint := c.OTLPEndpoint
+	if v := os.Getenv(otlpTracesEndpointEnv); len(v) > 0 {
+		endpoint = v
+	}
+
+	var exporter *OTLPSpanExporter
+	if len(endpoint) > 0 {
+		exporter = &OTLPSpanExporter{Endpoint: endpoint}
+		registerLogFlusher(exporter.Flush)
+	}
+
+	spanExporterMu.Lock()
+	spanExporter = exporter
+	spanExporterMu.Unlock()
+}
+
+func getSpanExporter() *OTLPSpanExporter {
+	spanExporterMu.Lock()
+	defer spanExporterMu.Unlock()
+	return spanExporter
+}
+
+// OTLPSpanExporter ships spans to an OpenTelemetry collector using
+// OTLP/HTTP with JSON encoding.  Spans are queued and sent in batches
+// in the same way as OTLPExporter.
+type OTLPSpanExporter struct {
+	// Endpoint is the URL of OTLP/HTTP traces endpoint,
+	// e.g. "http://localhost:4318/v1/traces".  This must not be empty.
+	Endpoint string
+
+	// Headers are added to export requests.
+	Headers map[string]string
+
+	// Client is used to send requests.
+	// If nil, a client with 10 seconds timeout is used.
+	Client *http.Client
+
+	// QueueSize is the maximum number of queued spans.
+	// Zero is treated as 8192.
+	QueueSize int
+
+	// BatchSize is the maximum number of spans in a request.
+	// Zero is treated as 512.
+	BatchSize int
+
+	// FlushInterval is the interval to send queued spans.
+	// Zero is treated as 1 second.
+	FlushInterval time.Duration
+
+	initOnce sync.Once
+	notifyCh chan struct{}
+
+	utsname string
+
+	mu      sync.Mutex
+	queue   []otlpSpan
+	dropped int
+	lastErr error
+
+	flushMu sync.Mutex
+}
+
+type otlpSpanStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpSpanStatus `json:"status"`
+}
+
+func (e *OTLPSpanExporter) init() {
+	e.notifyCh = make(chan struct{}, 1)
+	e.utsname, _ = os.Hostname()
+
+	go func() {
+		interval := e.FlushInterval
+		if interval == 0 {
+			interval = defaultOTLPFlushInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-e.notifyCh:
+			}
+			e.Flush()
+		}
+	}()
+}
+
+func (e *OTLPSpanExporter) export(span otlpSpan) {
+	e.initOnce.Do(e.init)
+
+	batchSize := e.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultOTLPBatchSize
+	}
+	queueSize := e.QueueSize
+	if queueSize == 0 {
+		queueSize = defaultOTLPQueueSize
+	}
+
+	e.mu.Lock()
+	if len(e.queue) >= queueSize {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.queue = append(e.queue, span)
+	full := len(e.queue) >= batchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.notifyCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush sends all queued spans synchronously.
+func (e *OTLPSpanExporter) Flush() error {
+	e.initOnce.Do(e.init)
+
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
+
+	batchSize := e.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultOTLPBatchSize
+	}
+
+	for {
+		e.mu.Lock()
+		n := len(e.queue)
+		if n > batchSize {
+			n = batchSize
+		}
+		batch := make([]otlpSpan, n)
+		copy(batch, e.queue)
+		e.queue = e.queue[n:]
+		if len(e.queue) == 0 {
+			e.queue = nil
+		}
+		dropped := e.dropped
+		e.dropped = 0
+		e.mu.Unlock()
+
+		if dropped > 0 {
+			fmt.Fprintf(os.Stderr, "well: dropped %d spans for OTLP export\n", dropped)
+		}
+		if n == 0 {
+			return nil
+		}
+
+		err := e.send(batch)
+		e.mu.Lock()
+		if err != nil && e.lastErr == nil {
+			// report only the first error of consecutive errors.
+			fmt.Fprintf(os.Stderr, "well: failed to export spans: %v\n", err)
+		}
+		e.lastErr = err
+		e.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *OTLPSpanExporter) send(batch []otlpSpan) error {
+	if len(e.Endpoint) == 0 {
+		return errors.New("no OTLP endpoint")
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpKeyValue{
+						{Key: "service.name", Value: otlpString(log.DefaultLogger().Topic())},
+						{Key: "host.name", Value: otlpString(e.utsname)},
+						{Key: "process.pid", Value: otlpValue(os.Getpid())},
+					},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": otlpScopeName},
+						"spans": batch,
+					},
+				},
+			},
+		},
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultOTLPTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New("OTLP export failed: " + resp.Status)
+	}
+	return nil
+}
+
+// taskSpan is a span of a task started by Environment.
+type taskSpan struct {
+	exporter *OTLPSpanExporter
+	span     otlpSpan
+	start    time.Time
+}
+
+// startTaskSpan starts a span named name if tracing is enabled.
+// The returned context has the TraceContext of the span.
+// The returned span is nil if tracing is disabled.
+func startTaskSpan(ctx context.Context, name string) (context.Context, *taskSpan) {
+	exporter := getSpanExporter()
+	if exporter == nil {
+		return ctx, nil
+	}
+
+	spanID, err := randomHex(8)
+	if err != nil {
+		return ctx, nil
+	}
+
+	parent, ok := TraceContextFromContext(ctx)
+	if !ok {
+		reqid, _ := ctx.Value(RequestIDContextKey).(string)
+		traceID := otlpTraceID(reqid)
+		if len(traceID) == 0 {
+			traceID, err = randomHex(16)
+			if err != nil {
+				return ctx, nil
+			}
+		}
+		parent = TraceContext{TraceID: traceID, Flags: traceFlagSampled}
+	}
+
+	tc := parent
+	tc.ParentID = spanID
+	ctx = WithTraceContext(ctx, tc)
+	if parent.Flags&traceFlagSampled == 0 {
+		return ctx, nil
+	}
+
+	return ctx, &taskSpan{
+		exporter: exporter,
+		span: otlpSpan{
+			TraceID:      parent.TraceID,
+			SpanID:       spanID,
+			ParentSpanID: parent.ParentID,
+			TraceState:   parent.State,
+			Name:         name,
+			Kind:         otlpSpanKindInternal,
+		},
+		start: time.Now(),
+	}
+}
+
+// end records the result of the task and exports the span.
+// It does nothing if s is nil.
+func (s *taskSpan) end(err error) {
+	if s == nil {
+		return
+	}
+
+	end := time.Now()
+	s.span.StartTimeUnixNano = strconv.FormatInt(s.start.UnixNano(), 10)
+	s.span.EndTimeUnixNano = strconv.FormatInt(end.UnixNano(), 10)
+	if err != nil {
+		s.span.Status = otlpSpanStatus{
+			Code:    otlpStatusCodeError,
+			Message: err.Error(),
+		}
+	}
+	s.exporter.export(s.span)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,119 @@
+package well
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTaskSpans(t *testing.T) {
+	var mu sync.Mutex
+	var spans []otlpSpan
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		var p struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.Unmarshal(data, &p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		for _, rs := range p.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	exporter := &OTLPSpanExporter{
+		Endpoint:      srv.URL + "/v1/traces",
+		FlushInterval: time.Hour,
+	}
+	spanExporterMu.Lock()
+	spanExporter = exporter
+	spanExporterMu.Unlock()
+	defer func() {
+		spanExporterMu.Lock()
+		spanExporter = nil
+		spanExporterMu.Unlock()
+	}()
+
+	parent := WithTraceContext(context.Background(), TraceContext{
+		TraceID:  "0af7651916cd43dd8448eb211c80319c",
+		ParentID: "b7ad6b7169203331",
+		Flags:    1,
+	})
+	var childTC TraceContext
+	env := NewEnvironment(context.Background())
+	env.GoWithParent(parent, func(ctx context.Context) error {
+		childTC, _ = TraceContextFromContext(ctx)
+		return nil
+	})
+	env.Go(func(ctx context.Context) error {
+		return errors.New("failed")
+	})
+	env.Stop()
+	env.Wait()
+
+	if err := exporter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(spans) != 2 {
+		t.Fatal(`len(spans) != 2`, spans)
+	}
+
+	var ok, failed otlpSpan
+	for _, s := range spans {
+		if s.Status.Code == otlpStatusCodeError {
+			failed = s
+		} else {
+			ok = s
+		}
+	}
+	if ok.TraceID != "0af7651916cd43dd8448eb211c80319c" {
+		t.Error(`ok.TraceID != "0af7651916cd43dd8448eb211c80319c"`, ok.TraceID)
+	}
+	if ok.ParentSpanID != "b7ad6b7169203331" {
+		t.Error(`ok.ParentSpanID != "b7ad6b7169203331"`, ok.ParentSpanID)
+	}
+	if childTC.ParentID != ok.SpanID {
+		t.Error(`childTC.ParentID != ok.SpanID`, childTC.ParentID, ok.SpanID)
+	}
+	if failed.Status.Message != "failed" {
+		t.Error(`failed.Status.Message != "failed"`, failed.Status.Message)
+	}
+	if len(failed.TraceID) != 32 || len(failed.ParentSpanID) != 0 {
+		t.Error(`failed span should be a root span`, failed)
+	}
+}
+
+func TestTaskSpansDisabled(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctx2, span := startTaskSpan(ctx, "test")
+	if span != nil || ctx2 != ctx {
+		t.Error(`tracing should be disabled`)
+	}
+	span.end(nil)
+}
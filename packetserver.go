@@ -0,0 +1,124 @@
+package well
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// PacketHandler is the interface of servers that serve a packet socket.
+//
+// http3.Server of github.com/quic-go/quic-go satisfies this interface
+// through its Serve(net.PacketConn) and Close methods.
+//
+// If the server also has Shutdown(context.Context) error method,
+// PacketServer calls it instead of Close to drain connections.
+type PacketHandler interface {
+	Serve(conn net.PacketConn) error
+	Close() error
+}
+
+type packetShutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// PacketServer is a wrapper for packet based servers such as
+// HTTP/3 (QUIC) servers.
+//
+// Combined with Graceful.ListenPacket and Graceful.ServePacket,
+// the UDP socket is handed to the next child process on restart.
+//
+// Connections are drained only when the program stops.  On restart,
+// the old and the new child share the UDP socket, and the kernel may
+// deliver packets of the connections of the old child to the new
+// child, which does not know them and resets them.  Therefore, QUIC
+// connections in flight during a restart are not drained, and clients
+// have to reconnect.
+type PacketServer struct {
+	// Server serves the packet socket.  This must not be nil.
+	Server PacketHandler
+
+	// ShutdownTimeout is the maximum duration the server waits for
+	// connections to be drained before shutdown.  This applies only
+	// when Server implements Shutdown(context.Context) error.
+	//
+	// Zero duration disables timeout.
+	ShutdownTimeout time.Duration
+
+	// Env is the environment where this server runs.
+	//
+	// The global environment is used if Env is nil.
+	Env *Environment
+
+	timedout int32
+}
+
+// Serve starts a managed goroutine to serve packets from conn.
+//
+// Serve itself returns immediately.  When the environment is canceled,
+// the server drains connections and conn is closed.
+func (s *PacketServer) Serve(conn net.PacketConn) {
+	env := s.Env
+	if env == nil {
+		env = defaultEnv
+	}
+
+	StartServing(env)
+
+	served := make(chan struct{})
+	env.Go(func(ctx context.Context) error {
+		defer close(served)
+		err := s.Server.Serve(conn)
+		if ctx.Err() == nil && err != nil {
+			return err
+		}
+		return nil
+	})
+
+	env.Go(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+		case <-served:
+			conn.Close()
+			return nil
+		}
+		s.stop(ctx)
+		conn.Close()
+		<-served
+		return nil
+	})
+}
+
+func (s *PacketServer) stop(ctx context.Context) {
+	done := StartDraining()
+	defer done()
+
+	sd, ok := s.Server.(packetShutdowner)
+	if !ok {
+		s.Server.Close()
+		return
+	}
+
+	ctx = valueContext{Context: context.Background(), parent: ctx}
+	if s.ShutdownTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = withClockTimeout(ctx, s.ShutdownTimeout)
+		defer cancel()
+	}
+	err := sd.Shutdown(ctx)
+	if err == nil {
+		return
+	}
+	serverLog.Warn("well: timeout waiting for shutdown", map[string]interface{}{
+		"error": err.Error(),
+	})
+	atomic.StoreInt32(&s.timedout, 1)
+	s.Server.Close()
+}
+
+// TimedOut returns true if the server shut down before all connections
+// got drained.
+func (s *PacketServer) TimedOut() bool {
+	return atomic.LoadInt32(&s.timedout) != 0
+}
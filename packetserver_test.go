@@ -0,0 +1,180 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type echoPacketServer struct {
+	mu       sync.Mutex
+	conn     net.PacketConn
+	closed   bool
+	shutdown bool
+	inflight sync.WaitGroup
+}
+
+func (s *echoPacketServer) Serve(conn net.PacketConn) error {
+	s.mu.Lock()
+	s.conn = conn
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return errors.New("server closed")
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return errors.New("server closed")
+			}
+			return err
+		}
+		conn.WriteTo(buf[:n], addr)
+	}
+}
+
+func (s *echoPacketServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn != nil {
+		s.conn.SetReadDeadline(time.Now())
+	}
+	return nil
+}
+
+type drainPacketServer struct {
+	echoPacketServer
+}
+
+func (s *drainPacketServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	s.mu.Unlock()
+
+	ch := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(ch)
+	}()
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.Close()
+}
+
+func listenUDP(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	return conn
+}
+
+func TestPacketServer(t *testing.T) {
+	t.Parallel()
+
+	pc := listenUDP(t)
+	env := NewEnvironment(context.Background())
+	srv := &echoPacketServer{}
+	s := &PacketServer{
+		Server: srv,
+		Env:    env,
+	}
+	s.Serve(pc)
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Error(`string(buf[:n]) != "hello"`, string(buf[:n]))
+	}
+
+	env.Cancel(nil)
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+	if s.TimedOut() {
+		t.Error(`s.TimedOut()`)
+	}
+
+	// pc must have been closed.
+	if _, err := pc.WriteTo([]byte("x"), conn.LocalAddr()); err == nil {
+		t.Error(`pc is not closed`)
+	}
+}
+
+func TestPacketServerShutdown(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(context.Background())
+	srv := &drainPacketServer{}
+	srv.inflight.Add(1)
+	s := &PacketServer{
+		Server: srv,
+		Env:    env,
+	}
+	s.Serve(listenUDP(t))
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		srv.inflight.Done()
+	}()
+
+	env.Cancel(nil)
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+	if !srv.shutdown {
+		t.Error(`!srv.shutdown`)
+	}
+	if s.TimedOut() {
+		t.Error(`s.TimedOut()`)
+	}
+}
+
+func TestPacketServerTimeout(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(context.Background())
+	srv := &drainPacketServer{}
+	srv.inflight.Add(1)
+	defer srv.inflight.Done()
+	s := &PacketServer{
+		Server:          srv,
+		ShutdownTimeout: 100 * time.Millisecond,
+		Env:             env,
+	}
+	s.Serve(listenUDP(t))
+
+	env.Cancel(nil)
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+	if !s.TimedOut() {
+		t.Error(`!s.TimedOut()`)
+	}
+}
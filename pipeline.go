@@ -0,0 +1,133 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Pipeline is a pipeline of commands like "cmd1 | cmd2 | cmd3".
+//
+// The standard output of each command is connected to the standard
+// input of the next command.  Commands can be customized before Start
+// or Run, e.g. to set Stdin of the first command, Stdout of the last
+// command, or Severity.
+//
+// All commands are killed when the context given to NewPipeline is
+// done.  To make Wait of the environment wait for the pipeline, run it
+// in a function started by Go with the given context.
+type Pipeline struct {
+	Commands []*LogCmd
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started int
+}
+
+// PipelineError is returned by Pipeline when commands fail.
+type PipelineError struct {
+	// Errors are errors of commands in order.
+	// Elements for successful commands are nil.
+	Errors []error
+
+	names []string
+}
+
+func (e *PipelineError) Error() string {
+	var msgs []string
+	for i, err := range e.Errors {
+		if err == nil {
+			continue
+		}
+		msgs = append(msgs, "stage "+strconv.Itoa(i)+" ("+e.names[i]+"): "+err.Error())
+	}
+	return "pipeline failed: " + strings.Join(msgs, "; ")
+}
+
+// NewPipeline creates a Pipeline.  Each element of cmds is a command
+// name and its arguments.
+func NewPipeline(ctx context.Context, cmds ...[]string) *Pipeline {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Pipeline{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for _, c := range cmds {
+		p.Commands = append(p.Commands, CommandContext(ctx, c[0], c[1:]...))
+	}
+	return p
+}
+
+// Start starts all commands.  If any command fails to start, commands
+// already started are killed.
+func (p *Pipeline) Start() error {
+	if len(p.Commands) == 0 {
+		return errors.New("empty pipeline")
+	}
+
+	var pipes []*os.File
+	closePipes := func() {
+		for _, f := range pipes {
+			f.Close()
+		}
+	}
+	for i := 0; i < len(p.Commands)-1; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closePipes()
+			return err
+		}
+		pipes = append(pipes, r, w)
+		p.Commands[i].Stdout = w
+		p.Commands[i+1].Stdin = r
+	}
+
+	for i, c := range p.Commands {
+		if err := c.Start(); err != nil {
+			closePipes()
+			p.cancel()
+			for _, started := range p.Commands[:i] {
+				started.wait()
+			}
+			return err
+		}
+		p.started++
+	}
+
+	// commands have their own copies.
+	closePipes()
+	return nil
+}
+
+// Wait waits for all commands to exit.
+// If any command fails, it returns *PipelineError.
+func (p *Pipeline) Wait() error {
+	defer p.cancel()
+
+	perr := &PipelineError{
+		Errors: make([]error, len(p.Commands)),
+		names:  make([]string, len(p.Commands)),
+	}
+	failed := false
+	for i, c := range p.Commands[:p.started] {
+		perr.names[i] = c.Path
+		if err := c.Wait(); err != nil {
+			perr.Errors[i] = err
+			failed = true
+		}
+	}
+	if failed {
+		return perr
+	}
+	return nil
+}
+
+// Run starts all commands and waits for them to exit.
+func (p *Pipeline) Run() error {
+	if err := p.Start(); err != nil {
+		return err
+	}
+	return p.Wait()
+}
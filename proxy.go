@@ -0,0 +1,142 @@
+package well
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const defaultProxyDialTimeout = 10 * time.Second
+
+// TCPProxy is a L4 proxy that forwards connections to an upstream
+// address.  It is built on Server, so that connections are drained
+// on shutdown and listeners are handed over by Graceful on restart.
+//
+// Examples of uses are sidecar-style forwarders, and exposing a UNIX
+// domain socket over TCP, or vice versa.
+//
+// Data are relayed by Relay, which uses splice(2) on Linux.
+// Each connection is logged with the numbers of bytes transferred
+// in both directions.
+type TCPProxy struct {
+	// Network is the network of the upstream such as "tcp" or "unix".
+	// If empty, "tcp" is used.
+	Network string
+
+	// Address is the address of the upstream.  This must not be empty.
+	Address string
+
+	// DialTimeout is the maximum duration to connect to the upstream.
+	// Zero is treated as 10 seconds.
+	DialTimeout time.Duration
+
+	// ShutdownTimeout is the maximum duration to wait for connections
+	// to be closed by peers after the environment is canceled.
+	// Connections are forcibly closed after that.
+	//
+	// Zero disables timeout.
+	ShutdownTimeout time.Duration
+
+	// MaxConns limits the number of connections forwarded at the same
+	// time.  Zero means no limit.
+	MaxConns int
+
+	// Logger is the logger for connection logs.
+	// If nil, the default logger is used.
+	Logger *log.Logger
+
+	// Env is the environment where this proxy runs.
+	//
+	// The global environment is used if Env is nil.
+	Env *Environment
+
+	once   sync.Once
+	server *Server
+}
+
+// Serve starts forwarding connections accepted by l.
+// Serve itself returns immediately.  See Server.Serve.
+func (p *TCPProxy) Serve(l net.Listener) {
+	p.once.Do(func() {
+		p.server = &Server{
+			Handler:         p.handle,
+			ShutdownTimeout: p.ShutdownTimeout,
+			MaxConns:        p.MaxConns,
+			Env:             p.Env,
+		}
+	})
+	p.server.Serve(l)
+}
+
+// TimedOut returns true if the proxy shut down before all connections
+// got closed.
+func (p *TCPProxy) TimedOut() bool {
+	return p.server != nil && p.server.TimedOut()
+}
+
+func (p *TCPProxy) logger() *log.Logger {
+	if p.Logger == nil {
+		return log.DefaultLogger()
+	}
+	return p.Logger
+}
+
+func (p *TCPProxy) handle(ctx context.Context, conn net.Conn) {
+	network := p.Network
+	if network == "" {
+		network = "tcp"
+	}
+	timeout := p.DialTimeout
+	if timeout == 0 {
+		timeout = defaultProxyDialTimeout
+	}
+
+	clock := ClockFromContext(ctx)
+	st := clock.Now()
+	fields := FieldsFromContext(ctx)
+	fields["remote"] = conn.RemoteAddr().String()
+	fields["upstream"] = p.Address
+
+	dctx, cancel := withClockTimeout(ctx, timeout)
+	var d net.Dialer
+	upstream, err := d.DialContext(dctx, network, p.Address)
+	cancel()
+	if err != nil {
+		fields[log.FnError] = err.Error()
+		p.logger().Error("well: proxy failed to connect upstream", fields)
+		return
+	}
+	defer upstream.Close()
+
+	// ctx is canceled when the environment is canceled.  Connections
+	// continue until ShutdownTimeout expires.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		if p.ShutdownTimeout == 0 {
+			return
+		}
+		timer := clock.NewTimer(p.ShutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C():
+			conn.Close()
+			upstream.Close()
+		}
+	}()
+
+	sent, received, _ := Relay(conn, upstream)
+	fields["bytes_sent"] = sent
+	fields["bytes_received"] = received
+	fields[log.FnResponseTime] = clock.Now().Sub(st).Seconds()
+	p.logger().Info("well: proxy connection closed", fields)
+}
@@ -0,0 +1,185 @@
+package well
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+func startEchoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l
+}
+
+func echoOnce(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != msg {
+		t.Error(`string(buf) != msg`, string(buf))
+	}
+}
+
+func TestTCPProxy(t *testing.T) {
+	t.Parallel()
+
+	upstream := startEchoServer(t)
+	defer upstream.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	buf := new(syncBuffer)
+	logger.SetOutput(buf)
+	logger.SetFormatter(log.Logfmt{})
+	p := &TCPProxy{
+		Address: upstream.Addr().String(),
+		Logger:  logger,
+		Env:     env,
+	}
+	p.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	echoOnce(t, conn, "hello")
+
+	// drain: the established connection continues after cancel.
+	env.Cancel(nil)
+	time.Sleep(50 * time.Millisecond)
+	echoOnce(t, conn, "world")
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Error(`new connection should be refused`)
+	}
+
+	conn.(*net.TCPConn).CloseWrite()
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Error(err)
+	}
+	conn.Close()
+
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+	if p.TimedOut() {
+		t.Error(`p.TimedOut()`)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("bytes_sent=10")) {
+		t.Error(`bytes_sent is not logged`, string(buf.Bytes()))
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("bytes_received=10")) {
+		t.Error(`bytes_received is not logged`, string(buf.Bytes()))
+	}
+}
+
+func TestTCPProxyShutdownTimeout(t *testing.T) {
+	t.Parallel()
+
+	upstream := startEchoServer(t)
+	defer upstream.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	logger.SetOutput(io.Discard)
+	p := &TCPProxy{
+		Address:         upstream.Addr().String(),
+		ShutdownTimeout: 100 * time.Millisecond,
+		Logger:          logger,
+		Env:             env,
+	}
+	p.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echoOnce(t, conn, "hello")
+
+	env.Cancel(nil)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Error(err)
+	}
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTCPProxyDialError(t *testing.T) {
+	t.Parallel()
+
+	// get a port that nobody listens on.
+	dummy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	addr := dummy.Addr().String()
+	dummy.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	buf := new(syncBuffer)
+	logger.SetOutput(buf)
+	p := &TCPProxy{
+		Address: addr,
+		Logger:  logger,
+		Env:     env,
+	}
+	p.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.ReadAll(conn)
+	conn.Close()
+
+	env.Cancel(nil)
+	env.Wait()
+	if !bytes.Contains(buf.Bytes(), []byte("well: proxy failed to connect upstream")) {
+		t.Error(`dial error is not logged`, string(buf.Bytes()))
+	}
+}
@@ -0,0 +1,107 @@
+package well
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+var (
+	ready       int32
+	readyManual int32
+)
+
+// SetReady sets the readiness state of the program.
+//
+// The program is not ready at start.  Unless SetReady is called,
+// it becomes ready automatically when Server or HTTPServer starts
+// serving in the global environment.  Programs serving the listeners
+// by other means, e.g. net/http directly, should call StartServing
+// or SetReady.  Once SetReady is called, the readiness is controlled
+// only by the program; call SetReady(false) before starting servers
+// to delay the readiness, e.g. until caches are warmed up, and
+// SetReady(true) afterward.
+//
+// The program becomes not ready when the global environment is
+// canceled.
+//
+// When the program becomes ready, READY=1 is sent to systemd if
+// NOTIFY_SOCKET is set.  Under Graceful, the master process sends it
+// instead when its child becomes ready.
+//
+// In a child process of Graceful, the restart completes when
+// Graceful.Serve is called.  If SetReady has been called before
+// Graceful.Run, the restart completes when the program becomes ready
+// for the first time instead.  See Graceful.
+func SetReady(ready bool) {
+	atomic.StoreInt32(&readyManual, 1)
+	setReady(ready)
+}
+
+func setReady(r bool) {
+	if !r {
+		atomic.StoreInt32(&ready, 0)
+		return
+	}
+	if atomic.SwapInt32(&ready, 1) == 0 {
+		emitEvent(Event{Type: EventReady})
+		notifyReady()
+	}
+	notifyChildReady()
+}
+
+// markReady makes the program ready if SetReady has not been called.
+// This is called when servers start serving in env.
+//
+// Servers in environments other than the global one do not change
+// the readiness state.
+func markReady(env *Environment) {
+	if atomic.LoadInt32(&readyManual) == 1 {
+		return
+	}
+	if env == nil {
+		env = defaultEnv
+	}
+	if env != defaultEnv || env.ctx.Err() != nil {
+		return
+	}
+	setReady(true)
+}
+
+// markChildServing completes the restart in a child process of
+// Graceful if SetReady has not been called.  This is called just
+// before Graceful.Serve.
+func markChildServing() {
+	if atomic.LoadInt32(&readyManual) == 1 {
+		return
+	}
+	notifyChildReady()
+}
+
+// handleReadiness makes the program not ready when env is canceled.
+func handleReadiness(env *Environment) {
+	go func() {
+		<-env.ctx.Done()
+		setReady(false)
+	}()
+}
+
+// IsReady returns the readiness state of the program.
+func IsReady() bool {
+	return atomic.LoadInt32(&ready) == 1
+}
+
+// ReadinessHandler returns an http.Handler that responds 200 OK if
+// the program is ready, or 503 Service Unavailable otherwise.
+// This is intended to be used as a readiness probe of Kubernetes
+// or a health check of load balancers.
+func ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !IsReady() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("not ready\n"))
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+}
@@ -0,0 +1,56 @@
+package well
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	defer func() {
+		atomic.StoreInt32(&readyManual, 0)
+		SetReady(true)
+	}()
+
+	atomic.StoreInt32(&ready, 0)
+	atomic.StoreInt32(&readyManual, 0)
+
+	markReady(nil)
+	if !IsReady() {
+		t.Error(`!IsReady()`)
+	}
+
+	SetReady(false)
+	markReady(nil)
+	if IsReady() {
+		t.Error(`markReady should not override SetReady`)
+	}
+
+	SetReady(true)
+	if !IsReady() {
+		t.Error(`!IsReady()`)
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	defer SetReady(true)
+
+	SetReady(true)
+	h := ReadinessHandler()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Error(`w.Code != http.StatusOK`, w.Code)
+	}
+
+	SetReady(false)
+	if IsReady() {
+		t.Error(`IsReady()`)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Error(`w.Code != http.StatusServiceUnavailable`, w.Code)
+	}
+}
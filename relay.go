@@ -0,0 +1,64 @@
+package well
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+// CopyConn copies from src to dst until EOF on src, like io.Copy.
+//
+// On Linux, if src is *os.File, data is transferred by sendfile(2).
+// If both src and dst are TCP or UNIX stream sockets, data is
+// transferred by splice(2) without copying through user space.
+// Otherwise, this falls back to io.Copy.
+func CopyConn(dst net.Conn, src io.Reader) (int64, error) {
+	switch s := src.(type) {
+	case *os.File:
+		if n, handled, err := sendFile(dst, s); handled {
+			return n, err
+		}
+	case net.Conn:
+		if n, handled, err := spliceConn(dst, s); handled {
+			return n, err
+		}
+	}
+	return io.Copy(dst, src)
+}
+
+// Relay copies data between a and b in both directions by CopyConn
+// until both directions reach EOF.  When one direction reaches EOF,
+// the writing side of the destination is shut down, so that the peer
+// receives EOF while the other direction continues.
+//
+// Relay returns the numbers of bytes copied from a to b and from b to
+// a, and the first error, if any.  Relay does not close a or b.
+func Relay(a, b net.Conn) (aToB, bToA int64, err error) {
+	var errAB error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		aToB, errAB = CopyConn(b, a)
+		closeWrite(b)
+	}()
+	bToA, err = CopyConn(a, b)
+	closeWrite(a)
+	wg.Wait()
+
+	if errAB != nil {
+		err = errAB
+	}
+	return aToB, bToA, err
+}
+
+// closeWrite shuts down the writing side of conn if possible so that
+// the peer receives EOF while the other direction continues.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,146 @@
+//go:build linux
+// +build linux
+
+package well
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+const (
+	spliceFlagMove     = 0x1
+	spliceFlagNonblock = 0x2
+
+	// maxSpliceSize is the size of data moved by a splice or
+	// sendfile call.  This is the default capacity of pipes.
+	maxSpliceSize = 64 << 10
+)
+
+// streamRawConn returns syscall.RawConn of conn if it is a TCP or
+// UNIX stream socket.
+func streamRawConn(conn interface{}) (syscall.RawConn, bool) {
+	switch c := conn.(type) {
+	case *net.TCPConn:
+		rc, err := c.SyscallConn()
+		return rc, err == nil
+	case *net.UnixConn:
+		if c.LocalAddr().Network() != "unix" {
+			return nil, false
+		}
+		rc, err := c.SyscallConn()
+		return rc, err == nil
+	}
+	return nil, false
+}
+
+// spliceConn copies from src to dst with splice(2) through a pipe.
+// handled is false if splice cannot be used for src and dst.
+func spliceConn(dst, src net.Conn) (written int64, handled bool, err error) {
+	srcRC, ok := streamRawConn(src)
+	if !ok {
+		return 0, false, nil
+	}
+	dstRC, ok := streamRawConn(dst)
+	if !ok {
+		return 0, false, nil
+	}
+
+	var p [2]int
+	if err := syscall.Pipe2(p[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		return 0, false, nil
+	}
+	defer syscall.Close(p[0])
+	defer syscall.Close(p[1])
+
+	for {
+		var n int64
+		var serr error
+		err := srcRC.Read(func(fd uintptr) bool {
+			for {
+				n, serr = syscall.Splice(int(fd), nil, p[1], nil, maxSpliceSize, spliceFlagMove|spliceFlagNonblock)
+				if serr != syscall.EINTR {
+					break
+				}
+			}
+			return serr != syscall.EAGAIN
+		})
+		if err != nil {
+			return written, true, err
+		}
+		if serr != nil {
+			return written, true, os.NewSyscallError("splice", serr)
+		}
+		if n == 0 {
+			return written, true, nil
+		}
+
+		for n > 0 {
+			var m int64
+			err := dstRC.Write(func(fd uintptr) bool {
+				for {
+					m, serr = syscall.Splice(p[0], nil, int(fd), nil, int(n), spliceFlagMove|spliceFlagNonblock)
+					if serr != syscall.EINTR {
+						break
+					}
+				}
+				return serr != syscall.EAGAIN
+			})
+			if err != nil {
+				return written, true, err
+			}
+			if serr != nil {
+				return written, true, os.NewSyscallError("splice", serr)
+			}
+			n -= m
+			written += m
+		}
+	}
+}
+
+// sendFile copies from the current offset of f to dst with sendfile(2).
+// handled is false if sendfile cannot be used for f and dst.
+func sendFile(dst net.Conn, f *os.File) (written int64, handled bool, err error) {
+	st, err := f.Stat()
+	if err != nil || !st.Mode().IsRegular() {
+		return 0, false, nil
+	}
+	dstRC, ok := streamRawConn(dst)
+	if !ok {
+		return 0, false, nil
+	}
+	srcRC, err := f.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	for {
+		var n int
+		var serr error
+		err := srcRC.Control(func(sfd uintptr) {
+			werr := dstRC.Write(func(fd uintptr) bool {
+				for {
+					n, serr = syscall.Sendfile(int(fd), int(sfd), nil, maxSpliceSize)
+					if serr != syscall.EINTR {
+						break
+					}
+				}
+				return serr != syscall.EAGAIN
+			})
+			if serr == nil {
+				serr = werr
+			}
+		})
+		if err != nil {
+			return written, true, err
+		}
+		if serr != nil {
+			return written, true, os.NewSyscallError("sendfile", serr)
+		}
+		if n == 0 {
+			return written, true, nil
+		}
+		written += int64(n)
+	}
+}
@@ -0,0 +1,54 @@
+package well
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpliceConn(t *testing.T) {
+	t.Parallel()
+
+	sock := filepath.Join(t.TempDir(), "splice.sock")
+	src, peer := connPair(t, "unix", sock)
+	defer src.Close()
+	defer peer.Close()
+	dst, reader := connPair(t, "tcp", "127.0.0.1:0")
+	defer dst.Close()
+	defer reader.Close()
+
+	go func() {
+		peer.Write([]byte("spliced"))
+		peer.Close()
+	}()
+
+	n, handled, err := spliceConn(dst, src)
+	if !handled {
+		t.Fatal(`!handled`)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 {
+		t.Error(`n != 7`, n)
+	}
+	dst.Close()
+
+	reader.SetDeadline(time.Now().Add(5 * time.Second))
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "spliced" {
+		t.Error(`string(got) != "spliced"`, string(got))
+	}
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	if _, handled, _ := spliceConn(c1, src); handled {
+		t.Error(`net.Pipe should not be handled`)
+	}
+}
@@ -0,0 +1,133 @@
+package well
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// connPair returns a pair of connected sockets of network.
+func connPair(t *testing.T, network, addr string) (net.Conn, net.Conn) {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	ch := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			close(ch)
+			return
+		}
+		ch <- c
+	}()
+	c1, err := net.Dial(network, l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, ok := <-ch
+	if !ok {
+		t.Fatal("failed to accept")
+	}
+	return c1, c2
+}
+
+func TestRelay(t *testing.T) {
+	t.Parallel()
+
+	networks := [][2]string{{"tcp", "127.0.0.1:0"}}
+	if runtime.GOOS != "windows" {
+		networks = append(networks, [2]string{"unix", filepath.Join(t.TempDir(), "relay.sock")})
+	}
+	for _, nw := range networks {
+		// client <-> (a, b) <-> upstream
+		client, a := connPair(t, "tcp", "127.0.0.1:0")
+		b, upstream := connPair(t, nw[0], nw[1])
+
+		type result struct {
+			aToB, bToA int64
+			err        error
+		}
+		ch := make(chan result, 1)
+		go func() {
+			aToB, bToA, err := Relay(a, b)
+			ch <- result{aToB, bToA, err}
+		}()
+
+		data := bytes.Repeat([]byte("0123456789"), 100000)
+		go func() {
+			client.Write(data)
+			client.(*net.TCPConn).CloseWrite()
+		}()
+		go func() {
+			io.Copy(upstream, upstream)
+			closeWrite(upstream)
+		}()
+
+		client.SetDeadline(time.Now().Add(10 * time.Second))
+		got, err := io.ReadAll(client)
+		if err != nil {
+			t.Fatal(nw[0], err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Error(nw[0], `!bytes.Equal(got, data)`, len(got))
+		}
+
+		res := <-ch
+		if res.err != nil {
+			t.Error(nw[0], res.err)
+		}
+		if res.aToB != int64(len(data)) || res.bToA != int64(len(data)) {
+			t.Error(nw[0], `wrong sizes`, res.aToB, res.bToA)
+		}
+		for _, c := range []net.Conn{client, a, b, upstream} {
+			c.Close()
+		}
+	}
+}
+
+func TestCopyConnFile(t *testing.T) {
+	t.Parallel()
+
+	data := bytes.Repeat([]byte("abcdefghij"), 20000)
+	p := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	c1, c2 := connPair(t, "tcp", "127.0.0.1:0")
+	defer c1.Close()
+	defer c2.Close()
+
+	go func() {
+		n, err := CopyConn(c1, f)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != int64(len(data)) {
+			t.Error(`n != int64(len(data))`, n)
+		}
+		c1.Close()
+	}()
+
+	c2.SetDeadline(time.Now().Add(10 * time.Second))
+	got, err := io.ReadAll(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error(`!bytes.Equal(got, data)`, len(got))
+	}
+}
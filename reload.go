@@ -0,0 +1,70 @@
+package well
+
+import (
+	"context"
+	"sync"
+	"syscall"
+
+	"github.com/cybozu-go/log"
+)
+
+var (
+	reloadMu    sync.Mutex
+	reloadFuncs []func(ctx context.Context) error
+	reloadOnce  sync.Once
+)
+
+// OnReload registers f to be called when the program receives SIGHUP
+// or Reload is called.  This is intended for single-process programs
+// to reload configurations, TLS certificates, and so on.
+//
+// Registered functions are called serially in the order of
+// registration.  Errors are logged and do not stop the subsequent
+// functions.
+//
+// In the master process of Graceful, SIGHUP restarts the child process
+// and the registered functions are not called.  SIGHUP is not
+// available on Windows.
+func OnReload(f func(ctx context.Context) error) {
+	reloadMu.Lock()
+	reloadFuncs = append(reloadFuncs, f)
+	reloadMu.Unlock()
+
+	reloadOnce.Do(func() {
+		HandleSignal(syscall.SIGHUP, func(ctx context.Context) {
+			// SIGHUP restarts the child of Graceful instead.
+			if gracefulRunning() {
+				return
+			}
+			Reload(ctx)
+		})
+	})
+}
+
+// Reload calls functions registered by OnReload serially.
+// It returns the first error, if any.
+func Reload(ctx context.Context) error {
+	reloadMu.Lock()
+	funcs := reloadFuncs
+	reloadMu.Unlock()
+
+	log.Info("well: reloading", map[string]interface{}{
+		"funcs": len(funcs),
+	})
+
+	var firstErr error
+	for _, f := range funcs {
+		err := f(ctx)
+		if err == nil {
+			continue
+		}
+		log.Error("well: failed to reload", map[string]interface{}{
+			"func":      funcName(f),
+			log.FnError: err,
+		})
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,27 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	var calls []int
+	OnReload(func(ctx context.Context) error {
+		calls = append(calls, 1)
+		return errors.New("reload error")
+	})
+	OnReload(func(ctx context.Context) error {
+		calls = append(calls, 2)
+		return nil
+	})
+
+	err := Reload(context.Background())
+	if err == nil || err.Error() != "reload error" {
+		t.Error(`the first error should be returned`, err)
+	}
+	if len(calls) != 2 || calls[0] != 1 || calls[1] != 2 {
+		t.Error(`functions should be called serially in order`, calls)
+	}
+}
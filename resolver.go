@@ -0,0 +1,206 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultResolverTTL      = 30 * time.Second
+	defaultResolverStaleTTL = 10 * time.Minute
+	resolverLookupTimeout   = 10 * time.Second
+)
+
+// CachingResolver is a DNS resolver that caches results.
+//
+// Concurrent lookups of the same host are merged into one.  If a
+// lookup fails, the expired result is used for StaleTTL.
+//
+// To use with HTTPClient, set DialContext to http.Transport:
+//
+//	r := &well.CachingResolver{}
+//	tr := well.TransportConfig{}.NewTransport()
+//	tr.DialContext = r.DialContext
+//
+// A CachingResolver must not be copied after first use.
+type CachingResolver struct {
+	// Resolver is used to look up hosts.
+	// If nil, net.DefaultResolver is used.
+	Resolver *net.Resolver
+
+	// Dialer is used by DialContext.
+	// If nil, a dialer with 30 seconds timeout is used.
+	Dialer *net.Dialer
+
+	// TTL is the period to cache lookup results.
+	// Zero is treated as 30 seconds.
+	TTL time.Duration
+
+	// StaleTTL is the period to use expired results when lookups fail.
+	// Zero is treated as 10 minutes.  Negative disables it.
+	StaleTTL time.Duration
+
+	// lookupHost replaces Resolver.LookupHost in tests.
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mu    sync.Mutex
+	cache map[string]*resolverEntry
+	calls map[string]*resolverCall
+}
+
+type resolverEntry struct {
+	addrs     []string
+	expiresAt time.Time
+}
+
+type resolverCall struct {
+	done  chan struct{}
+	addrs []string
+	err   error
+}
+
+func (r *CachingResolver) ttl() time.Duration {
+	if r.TTL <= 0 {
+		return defaultResolverTTL
+	}
+	return r.TTL
+}
+
+func (r *CachingResolver) staleTTL() time.Duration {
+	if r.StaleTTL == 0 {
+		return defaultResolverStaleTTL
+	}
+	return r.StaleTTL
+}
+
+// LookupHost looks up host and returns its addresses.
+func (r *CachingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = make(map[string]*resolverEntry)
+		r.calls = make(map[string]*resolverCall)
+	}
+	if e, ok := r.cache[host]; ok && time.Now().Before(e.expiresAt) {
+		r.mu.Unlock()
+		return e.addrs, nil
+	}
+	call, ok := r.calls[host]
+	if !ok {
+		call = &resolverCall{done: make(chan struct{})}
+		r.calls[host] = call
+		go r.lookup(ctx, host, call)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.addrs, call.err
+	}
+}
+
+func (r *CachingResolver) lookup(ctx context.Context, host string, call *resolverCall) {
+	lookupHost := r.lookupHost
+	if lookupHost == nil {
+		resolver := r.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		lookupHost = resolver.LookupHost
+	}
+
+	// The lookup is shared with other callers, so it should not be
+	// canceled by the context of the first caller.
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, resolverLookupTimeout)
+	addrs, err := lookupHost(ctx, host)
+	cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if err == nil {
+		r.cache[host] = &resolverEntry{addrs: addrs, expiresAt: now.Add(r.ttl())}
+	} else if e, ok := r.cache[host]; ok && now.Before(e.expiresAt.Add(r.staleTTL())) {
+		log.Warn("well: failed to look up host, using stale addresses", map[string]interface{}{
+			"host":      host,
+			"addresses": e.addrs,
+			log.FnError: err.Error(),
+		})
+		addrs, err = e.addrs, nil
+	} else if ok {
+		delete(r.cache, host)
+	}
+
+	call.addrs, call.err = addrs, err
+	delete(r.calls, host)
+	close(call.done)
+}
+
+// DialContext connects to addr using cached lookup results.
+// This can be used as http.Transport.DialContext.
+//
+// Addresses of the host are tried in order until one succeeds.
+func (r *CachingResolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := r.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var firstErr error
+	for _, a := range addrs {
+		ip := net.ParseIP(a)
+		if !matchNetwork(network, ip) {
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(a, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("no suitable address for " + host)
+	}
+	return nil, firstErr
+}
+
+func matchNetwork(network string, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	switch network {
+	case "tcp4", "udp4", "ip4":
+		return ip.To4() != nil
+	case "tcp6", "udp6", "ip6":
+		return ip.To4() == nil
+	}
+	return true
+}
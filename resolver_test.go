@@ -0,0 +1,100 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachingResolver(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	var failing int32
+	r := &CachingResolver{
+		TTL: 100 * time.Millisecond,
+		lookupHost: func(ctx context.Context, host string) ([]string, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(50 * time.Millisecond)
+			if atomic.LoadInt32(&failing) == 1 {
+				return nil, errors.New("lookup failure")
+			}
+			return []string{"127.0.0.1"}, nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs, err := r.LookupHost(context.Background(), "example.com")
+			if err != nil || len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+				t.Error(`unexpected result`, addrs, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error(`concurrent lookups should be merged`, n)
+	}
+
+	// cached
+	if _, err := r.LookupHost(context.Background(), "example.com"); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error(`results should be cached`, n)
+	}
+
+	// stale on error
+	time.Sleep(150 * time.Millisecond)
+	atomic.StoreInt32(&failing, 1)
+	addrs, err := r.LookupHost(context.Background(), "example.com")
+	if err != nil || len(addrs) != 1 {
+		t.Error(`stale addresses should be returned`, addrs, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Error(`expired results should be looked up again`, n)
+	}
+
+	_, err = r.LookupHost(context.Background(), "example.org")
+	if err == nil {
+		t.Error(`lookup should fail without stale addresses`)
+	}
+}
+
+func TestCachingResolverDial(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	r := &CachingResolver{
+		lookupHost: func(ctx context.Context, host string) ([]string, error) {
+			return []string{"::1", "127.0.0.1"}, nil
+		},
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	conn, err := r.DialContext(context.Background(), "tcp4", net.JoinHostPort("example.com", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,67 @@
+package well
+
+import (
+	"context"
+	"errors"
+)
+
+// permanentError is an error that should not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err to stop retries by Retry.
+// Retry returns err unwrapped.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Retry calls f and retries it with jittered exponential backoff
+// while it returns an error, up to p.MaxRetries times.  Only
+// MaxRetries, MinBackoff, and MaxBackoff of p are used.
+//
+// retryable, if not nil, decides if an error should be retried.
+// If nil, all errors are retried.  Errors wrapped by Permanent are
+// not retried regardless of retryable.
+//
+// Retries stop when ctx is canceled.  Pass the context given to
+// functions started by Go to stop waiting as soon as the environment
+// is canceled.  The error of the last attempt is returned.
+func Retry(ctx context.Context, p *RetryPolicy, retryable func(err error) bool, f func(ctx context.Context) error) error {
+	for retry := 1; ; retry++ {
+		err := f(ctx)
+		if err == nil {
+			return nil
+		}
+
+		var pe permanentError
+		if errors.As(err, &pe) {
+			if err == pe {
+				return pe.err
+			}
+			return err
+		}
+		if retry > p.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+		if retryable != nil && !retryable(err) {
+			return err
+		}
+
+		d, _ := p.backoff(retry, nil)
+		if Sleep(ctx, d) != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	p := &RetryPolicy{
+		MaxRetries: 3,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 2 * time.Millisecond,
+	}
+
+	count := 0
+	err := Retry(context.Background(), p, nil, func(ctx context.Context) error {
+		count++
+		if count < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if count != 3 {
+		t.Error(`count != 3`, count)
+	}
+
+	count = 0
+	err = Retry(context.Background(), p, nil, func(ctx context.Context) error {
+		count++
+		return errors.New("always")
+	})
+	if err == nil || count != 4 {
+		t.Error(`err == nil || count != 4`, err, count)
+	}
+
+	errFatal := errors.New("fatal")
+	count = 0
+	err = Retry(context.Background(), p, nil, func(ctx context.Context) error {
+		count++
+		return Permanent(errFatal)
+	})
+	if err != errFatal || count != 1 {
+		t.Error(`err != errFatal || count != 1`, err, count)
+	}
+
+	retryable := func(err error) bool {
+		return err.Error() != "no retry"
+	}
+	count = 0
+	err = Retry(context.Background(), p, retryable, func(ctx context.Context) error {
+		count++
+		return errors.New("no retry")
+	})
+	if err == nil || count != 1 {
+		t.Error(`err == nil || count != 1`, err, count)
+	}
+
+	// ShouldRetry for HTTPClient is not used.
+	p3 := *p
+	p3.ShouldRetry = func(resp *http.Response, err error) bool {
+		return resp.StatusCode == http.StatusServiceUnavailable
+	}
+	count = 0
+	err = Retry(context.Background(), &p3, nil, func(ctx context.Context) error {
+		count++
+		return errors.New("always")
+	})
+	if err == nil || count != 4 {
+		t.Error(`err == nil || count != 4`, err, count)
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	t.Parallel()
+
+	p := &RetryPolicy{
+		MaxRetries: 10,
+		MinBackoff: time.Hour,
+		MaxBackoff: time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	st := time.Now()
+	count := 0
+	err := Retry(ctx, p, nil, func(ctx context.Context) error {
+		count++
+		return errors.New("temporary")
+	})
+	if err == nil || count != 1 {
+		t.Error(`err == nil || count != 1`, err, count)
+	}
+	if time.Since(st) > 5*time.Second {
+		t.Error(`Retry did not stop on cancellation`)
+	}
+}
@@ -0,0 +1,173 @@
+package well
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultRuntimeStatsInterval = time.Minute
+)
+
+var (
+	runtimeStatsMu   sync.Mutex
+	runtimeStatsStop chan struct{}
+)
+
+// RuntimeStats is a snapshot of statistics of the Go runtime.
+type RuntimeStats struct {
+	Goroutines   int
+	HeapAlloc    uint64
+	HeapSys      uint64
+	HeapObjects  uint64
+	NumGC        uint32
+	GCPauseTotal time.Duration
+
+	// GCPauses are the recent GC pause times, up to 256, in the
+	// order of GC.
+	GCPauses []time.Duration
+
+	// OpenFDs is the number of open file descriptors, or -1 if not
+	// available on the platform.
+	OpenFDs int
+}
+
+// ReadRuntimeStats returns statistics of the Go runtime.
+//
+// This calls runtime.ReadMemStats that stops the world briefly.
+func ReadRuntimeStats() RuntimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	n := int(ms.NumGC)
+	if n > len(ms.PauseNs) {
+		n = len(ms.PauseNs)
+	}
+	pauses := make([]time.Duration, n)
+	for i := 0; i < n; i++ {
+		// the most recent pause is at PauseNs[(NumGC+255)%256].
+		idx := (int(ms.NumGC) - n + i) % len(ms.PauseNs)
+		pauses[i] = time.Duration(ms.PauseNs[idx])
+	}
+
+	return RuntimeStats{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapSys:      ms.HeapSys,
+		HeapObjects:  ms.HeapObjects,
+		NumGC:        ms.NumGC,
+		GCPauseTotal: time.Duration(ms.PauseTotalNs),
+		GCPauses:     pauses,
+		OpenFDs:      countOpenFDs(),
+	}
+}
+
+func countOpenFDs() int {
+	var dir string
+	switch runtime.GOOS {
+	case "linux":
+		dir = "/proc/self/fd"
+	case "darwin", "freebsd", "netbsd", "openbsd", "dragonfly":
+		dir = "/dev/fd"
+	default:
+		return -1
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return -1
+	}
+	// exclude the descriptor opened to read dir.
+	return len(entries) - 1
+}
+
+// RuntimeStatsConfig configures periodic logging of RuntimeStats.
+//
+// When applied, a goroutine logs the statistics every Interval until
+// the global environment is canceled and Wait returns.  The goroutine
+// is not a task of the global environment, so it does not prevent
+// Wait from returning.
+//
+// Interval defaults to 1 minute.  Severity is the severity of logs,
+// and defaults to log.LvInfo.
+//
+// Each log has the following fields:
+//
+//   - goroutines, heap_alloc, heap_sys, heap_objects, open_fds:
+//     the values at the time of logging.
+//   - gc: the number of GCs during the interval.
+//   - gc_pause_total, gc_pause_max: the total and the maximum of GC
+//     pause times in seconds during the interval.  If more than 256
+//     GCs ran, the maximum is of the last 256.
+type RuntimeStatsConfig struct {
+	Interval time.Duration `toml:"interval" json:"interval" yaml:"interval"`
+	Severity int           `toml:"severity" json:"severity" yaml:"severity"`
+}
+
+// Apply starts logging of runtime statistics.
+// The goroutine started by the previous Apply, if any, is stopped.
+func (c RuntimeStatsConfig) Apply() {
+	if c.Interval <= 0 {
+		c.Interval = defaultRuntimeStatsInterval
+	}
+	if c.Severity == 0 {
+		c.Severity = log.LvInfo
+	}
+
+	runtimeStatsMu.Lock()
+	defer runtimeStatsMu.Unlock()
+	if runtimeStatsStop != nil {
+		close(runtimeStatsStop)
+	}
+	runtimeStatsStop = make(chan struct{})
+	go c.run(runtimeStatsStop, defaultEnv.ctx.Done())
+}
+
+func (c RuntimeStatsConfig) run(stop, done <-chan struct{}) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	prev := ReadRuntimeStats()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		cur := ReadRuntimeStats()
+		logRuntimeStats(log.DefaultLogger(), c.Severity, prev, cur)
+		prev = cur
+	}
+}
+
+func logRuntimeStats(logger *log.Logger, severity int, prev, cur RuntimeStats) {
+	numGC := cur.NumGC - prev.NumGC
+	var maxPause time.Duration
+	recent := cur.GCPauses
+	if int(numGC) < len(recent) {
+		recent = recent[len(recent)-int(numGC):]
+	}
+	for _, p := range recent {
+		if p > maxPause {
+			maxPause = p
+		}
+	}
+
+	logger.Log(severity, "well: runtime stats", map[string]interface{}{
+		"goroutines":     cur.Goroutines,
+		"heap_alloc":     cur.HeapAlloc,
+		"heap_sys":       cur.HeapSys,
+		"heap_objects":   cur.HeapObjects,
+		"open_fds":       cur.OpenFDs,
+		"gc":             numGC,
+		"gc_pause_total": (cur.GCPauseTotal - prev.GCPauseTotal).Seconds(),
+		"gc_pause_max":   maxPause.Seconds(),
+	})
+}
@@ -0,0 +1,54 @@
+package well
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestReadRuntimeStats(t *testing.T) {
+	t.Parallel()
+
+	runtime.GC()
+	s := ReadRuntimeStats()
+	if s.Goroutines == 0 {
+		t.Error(`s.Goroutines == 0`)
+	}
+	if s.NumGC == 0 {
+		t.Error(`s.NumGC == 0`)
+	}
+	if len(s.GCPauses) == 0 {
+		t.Error(`len(s.GCPauses) == 0`)
+	}
+	if runtime.GOOS == "linux" && s.OpenFDs < 3 {
+		t.Error(`s.OpenFDs < 3`, s.OpenFDs)
+	}
+}
+
+func TestLogRuntimeStats(t *testing.T) {
+	t.Parallel()
+
+	logger := log.NewLogger()
+	buf := new(bytes.Buffer)
+	logger.SetOutput(buf)
+
+	prev := RuntimeStats{NumGC: 1, GCPauseTotal: time.Millisecond}
+	cur := RuntimeStats{
+		NumGC:        3,
+		GCPauseTotal: 4 * time.Millisecond,
+		GCPauses:     []time.Duration{5 * time.Millisecond, 2 * time.Millisecond, time.Millisecond},
+	}
+	logRuntimeStats(logger, log.LvInfo, prev, cur)
+
+	out := buf.String()
+	if !strings.Contains(out, "gc=2") {
+		t.Error(`!strings.Contains(out, "gc=2")`, out)
+	}
+	if !strings.Contains(out, "gc_pause_max=0.002") {
+		t.Error(`!strings.Contains(out, "gc_pause_max=0.002")`, out)
+	}
+}
@@ -0,0 +1,274 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// OverlapPolicy specifies what Scheduler does when a job is due
+// while its previous run is still running.
+type OverlapPolicy int
+
+// Overlap policies.
+const (
+	// OverlapSkip skips the new run.  This is the default.
+	OverlapSkip OverlapPolicy = iota
+
+	// OverlapAllow starts the new run concurrently.
+	OverlapAllow
+
+	// OverlapReplace cancels the running runs and starts the new run.
+	OverlapReplace
+)
+
+// Job is a job registered to Scheduler.
+type Job struct {
+	// Name identifies the job in logs.  Required.
+	Name string
+
+	// Schedule determines when the job runs.  Required.
+	// Use ParseCron or Every to create one.
+	Schedule Schedule
+
+	// Run is the function to run.  Required.
+	//
+	// Errors returned from Run are logged, but do not cancel the
+	// environment.
+	Run func(ctx context.Context) error
+
+	// Timeout is the maximum duration of a run.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	// Overlap specifies the policy for overlapping runs.
+	Overlap OverlapPolicy
+}
+
+// Scheduler runs jobs periodically as tasks of an Environment.
+//
+// Jobs are scheduled once Start is called.  When the environment is
+// canceled, no more runs start and contexts of running runs are
+// canceled, so Wait returns after they return.
+//
+// Each run is logged with the job name, elapsed time, and error if any.
+type Scheduler struct {
+	// Env is the environment where jobs run.
+	// If nil, the global environment is used.
+	Env *Environment
+
+	// Logger is the logger for run logs.
+	// If nil, the default logger is used.
+	Logger *log.Logger
+
+	// MaxConcurrent limits the number of runs of all jobs running at
+	// the same time.  Runs exceeding the limit wait for others to
+	// finish.  Job.Timeout does not include the waiting time.
+	//
+	// Zero means no limit.
+	MaxConcurrent int
+
+	mu      sync.Mutex
+	jobs    []*scheduledJob
+	started bool
+	sem     *Semaphore
+}
+
+type scheduledJob struct {
+	Job
+
+	mu      sync.Mutex
+	runID   int64
+	running map[int64]*jobRun
+}
+
+// jobRun allows to cancel a run before its context is created.
+type jobRun struct {
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+func (r *jobRun) setCancel(cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancel = cancel
+	if r.canceled {
+		cancel()
+	}
+}
+
+func (r *jobRun) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.canceled = true
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// Add registers a job.  Jobs added after Start are scheduled
+// immediately.
+func (s *Scheduler) Add(job Job) error {
+	if job.Name == "" {
+		return errors.New("job name is empty")
+	}
+	if job.Schedule == nil {
+		return errors.New("no schedule for job " + job.Name)
+	}
+	if job.Run == nil {
+		return errors.New("no function for job " + job.Name)
+	}
+	if es, ok := job.Schedule.(everySchedule); ok && es <= 0 {
+		return errors.New("non-positive interval for job " + job.Name)
+	}
+
+	j := &scheduledJob{
+		Job:     job,
+		running: make(map[int64]*jobRun),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j2 := range s.jobs {
+		if j2.Name == job.Name {
+			return errors.New("duplicate job name: " + job.Name)
+		}
+	}
+	s.jobs = append(s.jobs, j)
+	if s.started {
+		s.schedule(j)
+	}
+	return nil
+}
+
+// Start starts scheduling registered jobs.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	if s.MaxConcurrent > 0 {
+		s.sem = NewSemaphore(int64(s.MaxConcurrent))
+	}
+	for _, j := range s.jobs {
+		s.schedule(j)
+	}
+}
+
+func (s *Scheduler) env() *Environment {
+	if s.Env == nil {
+		return defaultEnv
+	}
+	return s.Env
+}
+
+func (s *Scheduler) logger() *log.Logger {
+	if s.Logger == nil {
+		return log.DefaultLogger()
+	}
+	return s.Logger
+}
+
+func (s *Scheduler) schedule(j *scheduledJob) {
+	s.env().goTask("well.Scheduler: "+j.Name, nil, func(ctx context.Context) error {
+		clock := ClockFromContext(ctx)
+		now := clock.Now()
+		for {
+			next := j.Schedule.Next(now)
+			if next.IsZero() {
+				return nil
+			}
+
+			timer := clock.NewTimer(next.Sub(clock.Now()))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C():
+			}
+
+			s.fire(j, next)
+			now = next
+			if t := clock.Now(); t.After(now) {
+				// do not try to catch up missed runs.
+				now = t
+			}
+		}
+	})
+}
+
+func (s *Scheduler) fire(j *scheduledJob, scheduled time.Time) {
+	j.mu.Lock()
+	if len(j.running) > 0 {
+		switch j.Overlap {
+		case OverlapSkip:
+			j.mu.Unlock()
+			s.logger().Warn("well: job skipped", map[string]interface{}{
+				"job":       j.Name,
+				"scheduled": scheduled.UTC().Format(time.RFC3339),
+				"reason":    "previous run is still running",
+			})
+			return
+		case OverlapReplace:
+			for _, r := range j.running {
+				r.stop()
+			}
+		}
+	}
+	j.runID++
+	id := j.runID
+	run := &jobRun{}
+	j.running[id] = run
+	j.mu.Unlock()
+
+	s.env().goTask("well.Scheduler.run: "+j.Name, nil, func(ctx context.Context) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		run.setCancel(cancel)
+		defer func() {
+			j.mu.Lock()
+			delete(j.running, id)
+			j.mu.Unlock()
+		}()
+
+		if s.sem != nil {
+			if err := s.sem.Acquire(ctx, 1); err != nil {
+				s.logger().Warn("well: job skipped", map[string]interface{}{
+					"job":       j.Name,
+					"scheduled": scheduled.UTC().Format(time.RFC3339),
+					"reason":    "canceled while waiting for other jobs",
+				})
+				return nil
+			}
+			defer s.sem.Release(1)
+		}
+		if j.Timeout > 0 {
+			var cancelTimeout context.CancelFunc
+			ctx, cancelTimeout = withClockTimeout(ctx, j.Timeout)
+			defer cancelTimeout()
+		}
+
+		clock := ClockFromContext(ctx)
+		st := clock.Now()
+		err := j.Run(ctx)
+		fields := map[string]interface{}{
+			"job":              j.Name,
+			"run_id":           id,
+			"scheduled":        scheduled.UTC().Format(time.RFC3339),
+			log.FnResponseTime: clock.Now().Sub(st).Seconds(),
+		}
+		if err != nil {
+			fields[log.FnError] = err.Error()
+			s.logger().Error("well: job failed", fields)
+			return nil
+		}
+		s.logger().Info("well: job finished", fields)
+		return nil
+	})
+}
@@ -0,0 +1,194 @@
+package well
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestScheduler(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	buf := new(syncBuffer)
+	logger.SetOutput(buf)
+	s := &Scheduler{Env: env, Logger: logger}
+
+	var ok, failed int32
+	err := s.Add(Job{
+		Name:     "ok",
+		Schedule: Every(10 * time.Millisecond),
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&ok, 1)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	err = s.Add(Job{
+		Name:     "failed",
+		Schedule: Every(10 * time.Millisecond),
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&failed, 1)
+			return errors.New("oops")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	env.Cancel(nil)
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+
+	if atomic.LoadInt32(&ok) == 0 {
+		t.Error(`ok == 0`)
+	}
+	if atomic.LoadInt32(&failed) == 0 {
+		t.Error(`failed == 0`)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("well: job finished")) {
+		t.Error(`no run log`, string(buf.Bytes()))
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("well: job failed")) {
+		t.Error(`no failure log`, string(buf.Bytes()))
+	}
+
+	if err := s.Add(Job{Name: "ok", Schedule: Every(time.Second), Run: func(context.Context) error { return nil }}); err == nil {
+		t.Error(`duplicate job should be rejected`)
+	}
+	if err := s.Add(Job{Name: "bad", Schedule: Every(0), Run: func(context.Context) error { return nil }}); err == nil {
+		t.Error(`zero interval should be rejected`)
+	}
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	t.Parallel()
+
+	testOverlap := func(policy OverlapPolicy) (runs, canceled int32) {
+		env := NewEnvironment(context.Background())
+		logger := log.NewLogger()
+		logger.SetOutput(new(syncBuffer))
+		s := &Scheduler{Env: env, Logger: logger}
+		s.Add(Job{
+			Name:     "slow",
+			Schedule: Every(20 * time.Millisecond),
+			Overlap:  policy,
+			Timeout:  time.Second,
+			Run: func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				<-ctx.Done()
+				if errors.Is(ctx.Err(), context.Canceled) {
+					atomic.AddInt32(&canceled, 1)
+				}
+				return ctx.Err()
+			},
+		})
+		s.Start()
+		time.Sleep(110 * time.Millisecond)
+		env.Cancel(nil)
+		env.Wait()
+		return
+	}
+
+	if runs, _ := testOverlap(OverlapSkip); runs != 1 {
+		t.Error(`runs != 1`, runs)
+	}
+	if runs, canceled := testOverlap(OverlapAllow); runs < 3 || canceled != runs {
+		t.Error(`runs < 3 || canceled != runs`, runs, canceled)
+	}
+	if runs, canceled := testOverlap(OverlapReplace); runs < 3 || canceled != runs {
+		t.Error(`runs < 3 || canceled != runs`, runs, canceled)
+	}
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	buf := new(syncBuffer)
+	logger.SetOutput(buf)
+	s := &Scheduler{Env: env, Logger: logger}
+
+	done := make(chan error, 1)
+	s.Add(Job{
+		Name:     "timeout",
+		Schedule: Every(10 * time.Millisecond),
+		Timeout:  10 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			select {
+			case done <- ctx.Err():
+			default:
+			}
+			return ctx.Err()
+		},
+	})
+	s.Start()
+
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Error(`err != context.DeadlineExceeded`, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error(`job did not time out`)
+	}
+	env.Cancel(nil)
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSchedulerMaxConcurrent(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(context.Background())
+	logger := log.NewLogger()
+	logger.SetOutput(new(syncBuffer))
+	s := &Scheduler{Env: env, Logger: logger, MaxConcurrent: 1}
+
+	var active, maxActive, runs int32
+	run := func(ctx context.Context) error {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		if n > atomic.LoadInt32(&maxActive) {
+			atomic.StoreInt32(&maxActive, n)
+		}
+		atomic.AddInt32(&runs, 1)
+		Sleep(ctx, 15*time.Millisecond)
+		return nil
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		err := s.Add(Job{
+			Name:     name,
+			Schedule: Every(10 * time.Millisecond),
+			Run:      run,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Start()
+	time.Sleep(100 * time.Millisecond)
+	env.Cancel(nil)
+	env.Wait()
+
+	if m := atomic.LoadInt32(&maxActive); m != 1 {
+		t.Error(`maxActive != 1`, m)
+	}
+	if n := atomic.LoadInt32(&runs); n < 2 {
+		t.Error(`runs < 2`, n)
+	}
+}
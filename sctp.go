@@ -0,0 +1,18 @@
+package well
+
+import "net"
+
+// ListenSCTP creates a one-to-one style SCTP listener.  network must be
+// "sctp", "sctp4", or "sctp6".  "sctp" listens on IPv4 unless the host
+// part of address is an IPv6 address.
+//
+// The returned listener and its connections use stream semantics and
+// are represented as *net.TCPListener and *net.TCPConn.  Therefore,
+// the listener can be served by Server and passed to child processes
+// by Graceful just like TCP listeners.  TCP specific options such as
+// Server.KeepAlive do not apply to SCTP sockets.
+//
+// SCTP is supported only on Linux.
+func ListenSCTP(network, address string) (net.Listener, error) {
+	return listenSCTP(network, address)
+}
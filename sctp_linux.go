@@ -0,0 +1,61 @@
+//go:build linux
+// +build linux
+
+package well
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+func listenSCTP(network, address string) (net.Listener, error) {
+	var tcpNetwork string
+	switch network {
+	case "sctp":
+		tcpNetwork = "tcp"
+	case "sctp4":
+		tcpNetwork = "tcp4"
+	case "sctp6":
+		tcpNetwork = "tcp6"
+	default:
+		return nil, errors.New("unknown network: " + network)
+	}
+	addr, err := net.ResolveTCPAddr(tcpNetwork, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var sa syscall.Sockaddr
+	family := syscall.AF_INET
+	ip4 := addr.IP.To4()
+	if network == "sctp6" || (ip4 == nil && addr.IP != nil) {
+		family = syscall.AF_INET6
+		sa6 := &syscall.SockaddrInet6{Port: addr.Port}
+		copy(sa6.Addr[:], addr.IP.To16())
+		sa = sa6
+	} else {
+		sa4 := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa4.Addr[:], ip4)
+		sa = sa4
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, syscall.IPPROTO_SCTP)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	f := os.NewFile(uintptr(fd), "sctp:"+address)
+	defer f.Close()
+
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		return nil, os.NewSyscallError("bind", err)
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		return nil, os.NewSyscallError("listen", err)
+	}
+	return net.FileListener(f)
+}
@@ -0,0 +1,123 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func listenSCTPOrSkip(t *testing.T, spec string) net.Listener {
+	l, err := Listen(spec)
+	if errors.Is(err, syscall.EPROTONOSUPPORT) || errors.Is(err, syscall.ESOCKTNOSUPPORT) {
+		t.Skip("SCTP is not available:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func dialSCTP(t *testing.T, addr *net.TCPAddr) net.Conn {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, syscall.IPPROTO_SCTP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := os.NewFile(uintptr(fd), "sctp-client")
+	defer f.Close()
+
+	sa := &syscall.SockaddrInet4{Port: addr.Port}
+	copy(sa.Addr[:], addr.IP.To4())
+	if err := syscall.Connect(fd, sa); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.FileConn(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestListenSCTP(t *testing.T) {
+	t.Parallel()
+
+	l := listenSCTPOrSkip(t, "sctp4://127.0.0.1:0")
+
+	// hand over the listener as Graceful does.
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	l, err = net.FileListener(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := getSockoptOf(l.(*net.TCPListener), syscall.SOL_SOCKET, syscall.SO_PROTOCOL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != syscall.IPPROTO_SCTP {
+		t.Error(`n != syscall.IPPROTO_SCTP`, n)
+	}
+
+	env := NewEnvironment(context.Background())
+	s := &Server{
+		Handler: func(ctx context.Context, conn net.Conn) {
+			io.Copy(conn, conn)
+		},
+		Env: env,
+	}
+	s.Serve(l)
+
+	conn := dialSCTP(t, l.Addr().(*net.TCPAddr))
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Error(`string(buf) != "hello"`, string(buf))
+	}
+	conn.Close()
+
+	env.Cancel(nil)
+	env.Wait()
+}
+
+func getSockoptOf(l *net.TCPListener, level, opt int) (int, error) {
+	rc, err := l.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		n, serr = syscall.GetsockoptInt(int(fd), level, opt)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, serr
+}
+
+func TestListenSCTPInvalid(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Listen("sctp://"); err == nil {
+		t.Error(`sctp:// should fail`)
+	}
+	if _, err := ListenSCTP("udp", "127.0.0.1:0"); err == nil {
+		t.Error(`ListenSCTP("udp") should fail`)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package well
+
+import (
+	"errors"
+	"net"
+)
+
+func listenSCTP(network, address string) (net.Listener, error) {
+	return nil, errors.New("sctp is not supported")
+}
@@ -0,0 +1,118 @@
+package well
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	notifySocketEnv = "NOTIFY_SOCKET"
+
+	// extendTimeoutInterval is the interval to send EXTEND_TIMEOUT_USEC.
+	// Each notification extends the timeout by 3 intervals so that
+	// a delayed notification does not let the timeout expire.
+	extendTimeoutInterval = 10 * time.Second
+)
+
+// SdNotify sends state to systemd via the socket specified by
+// NOTIFY_SOCKET environment variable.  state is a newline-separated
+// list of variable assignments such as "READY=1".
+//
+// If NOTIFY_SOCKET is not set, SdNotify returns (false, nil).
+// Otherwise, it returns true if state is sent successfully.
+//
+// READY=1 is sent automatically when the program becomes ready, or by
+// the master process of Graceful when its child becomes ready, so
+// programs do not need to call this for readiness.  See SetReady.
+//
+// https://www.freedesktop.org/software/systemd/man/sd_notify.html
+func SdNotify(state string) (bool, error) {
+	name := os.Getenv(notifySocketEnv)
+	if len(name) == 0 {
+		return false, nil
+	}
+
+	// net package treats a name beginning with "@" as an abstract socket.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// notifyReady sends READY=1 to systemd.  This is called when the
+// program becomes ready.  The master process of Graceful notifies
+// systemd on behalf of its children, so neither the children nor the
+// master send it here.
+func notifyReady() {
+	if !isMaster() || gracefulRunning() {
+		return
+	}
+	if _, err := SdNotify("READY=1"); err != nil {
+		log.Warn("well: failed to notify readiness", map[string]interface{}{
+			log.FnError: err,
+		})
+	}
+}
+
+var stoppingOnce sync.Once
+
+// notifyStopping sends STOPPING=1 to systemd once.
+// Graceful children are stopped on restart too, so only the master
+// process sends it.
+func notifyStopping() {
+	if !isMaster() {
+		return
+	}
+	stoppingOnce.Do(func() {
+		SdNotify("STOPPING=1")
+	})
+}
+
+// extendStopTimeout sends EXTEND_TIMEOUT_USEC to systemd periodically
+// until the returned function is called.  This prevents systemd from
+// killing the service while connections are draining for longer than
+// TimeoutStopSec.
+func extendStopTimeout() func() {
+	if len(os.Getenv(notifySocketEnv)) == 0 {
+		return func() {}
+	}
+
+	usec := strconv.FormatInt(int64(3*extendTimeoutInterval/time.Microsecond), 10)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(extendTimeoutInterval)
+		defer ticker.Stop()
+		for {
+			SdNotify("EXTEND_TIMEOUT_USEC=" + usec)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// notifyReloading sends RELOADING=1 to systemd.  MONOTONIC_USEC is
+// added as required by Type=notify-reload services.  The reloading
+// completes when READY=1 is sent.
+func notifyReloading() {
+	state := "RELOADING=1"
+	if usec, ok := monotonicUsec(); ok {
+		state += "\nMONOTONIC_USEC=" + strconv.FormatInt(usec, 10)
+	}
+	SdNotify(state)
+}
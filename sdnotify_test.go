@@ -0,0 +1,155 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func listenNotifySocket(t *testing.T) *net.UnixConn {
+	addr := &net.UnixAddr{Name: filepath.Join(t.TempDir(), "notify.sock"), Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv(notifySocketEnv, addr.Name)
+	return conn
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestSdNotify(t *testing.T) {
+	t.Setenv(notifySocketEnv, "")
+	ok, err := SdNotify("READY=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error(`SdNotify should return false without NOTIFY_SOCKET`)
+	}
+
+	conn := listenNotifySocket(t)
+	ok, err = SdNotify("READY=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error(`SdNotify should return true`)
+	}
+	if msg := readNotify(t, conn); msg != "READY=1" {
+		t.Error(`unexpected notification:`, msg)
+	}
+
+	notifyStopping()
+	if msg := readNotify(t, conn); msg != "STOPPING=1" {
+		t.Error(`unexpected notification:`, msg)
+	}
+}
+
+func TestNotifyReady(t *testing.T) {
+	// this test changes the global readiness state.
+	defer func() {
+		atomic.StoreInt32(&readyManual, 0)
+		SetReady(true)
+	}()
+
+	atomic.StoreInt32(&ready, 0)
+	atomic.StoreInt32(&readyManual, 0)
+	conn := listenNotifySocket(t)
+
+	markReady(nil)
+	if msg := readNotify(t, conn); msg != "READY=1" {
+		t.Error(`unexpected notification:`, msg)
+	}
+
+	// READY=1 is sent only when the program becomes ready.
+	SetReady(true)
+	SetReady(false)
+	SetReady(true)
+	if msg := readNotify(t, conn); msg != "READY=1" {
+		t.Error(`unexpected notification:`, msg)
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, 4096)); err == nil {
+		t.Error(`READY=1 should not be sent while the program is ready`, n)
+	}
+}
+
+func TestNotifyRelay(t *testing.T) {
+	conn := listenNotifySocket(t)
+
+	relay, err := newNotifyRelay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+
+	child, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: relay.path(), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer child.Close()
+	_, err = child.Write([]byte("READY=1\nSTATUS=serving"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := readNotify(t, conn); msg != "READY=1\nSTATUS=serving" {
+		t.Error(`unexpected notification:`, msg)
+	}
+}
+
+func TestExtendStopTimeout(t *testing.T) {
+	conn := listenNotifySocket(t)
+
+	stop := extendStopTimeout()
+	msg := readNotify(t, conn)
+	stop()
+	if msg != "EXTEND_TIMEOUT_USEC=30000000" {
+		t.Error(`unexpected notification:`, msg)
+	}
+}
+
+func TestNotifyReloading(t *testing.T) {
+	conn := listenNotifySocket(t)
+
+	notifyReloading()
+	msg := readNotify(t, conn)
+	if !strings.HasPrefix(msg, "RELOADING=1") {
+		t.Error(`unexpected notification:`, msg)
+	}
+	if runtime.GOOS == "linux" && !strings.Contains(msg, "\nMONOTONIC_USEC=") {
+		t.Error(`MONOTONIC_USEC is missing:`, msg)
+	}
+}
+
+func TestServeStatus(t *testing.T) {
+	if status := serveStatus(); !strings.Contains(status, " active connections, ") {
+		t.Error(`unexpected status:`, status)
+	}
+
+	r := &notifyRelay{}
+	if s := r.annotate("READY=1\nSTATUS=serving"); s != "READY=1\nSTATUS=serving" {
+		t.Error(`status should not be annotated before restarts:`, s)
+	}
+	r.setRestarts(2)
+	if s := r.annotate("READY=1\nSTATUS=serving"); s != "READY=1\nSTATUS=serving, 2 restarts" {
+		t.Error(`status should be annotated with restarts:`, s)
+	}
+}
@@ -0,0 +1,99 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/cybozu-go/log"
+)
+
+const maxNotifySize = 64 << 10
+
+// notifyRelay receives sd_notify messages from child processes and
+// relays them to systemd.
+//
+// systemd accepts notifications only from the main process by default
+// (NotifyAccess=main), so the master process relays them.
+//
+// STATUS= from children is annotated with the number of restarts.
+type notifyRelay struct {
+	dir      string
+	conn     *net.UnixConn
+	restarts int32
+}
+
+// newNotifyRelay creates a relay if NOTIFY_SOCKET is set.
+// It returns (nil, nil) otherwise.
+func newNotifyRelay() (*notifyRelay, error) {
+	if len(os.Getenv(notifySocketEnv)) == 0 {
+		return nil, nil
+	}
+
+	dir, err := os.MkdirTemp("", "well-notify")
+	if err != nil {
+		return nil, err
+	}
+	addr := &net.UnixAddr{Name: filepath.Join(dir, "notify.sock"), Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	r := &notifyRelay{dir: dir, conn: conn}
+	go r.serve()
+	return r, nil
+}
+
+// path returns the socket path to be given to children as NOTIFY_SOCKET.
+func (r *notifyRelay) path() string {
+	return r.conn.LocalAddr().String()
+}
+
+func (r *notifyRelay) serve() {
+	buf := make([]byte, maxNotifySize)
+	for {
+		n, err := r.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		_, err = SdNotify(r.annotate(string(buf[:n])))
+		if err != nil {
+			log.Warn("well: failed to relay sd_notify", map[string]interface{}{
+				log.FnError: err,
+			})
+		}
+	}
+}
+
+func (r *notifyRelay) setRestarts(n int) {
+	atomic.StoreInt32(&r.restarts, int32(n))
+}
+
+func (r *notifyRelay) annotate(state string) string {
+	restarts := atomic.LoadInt32(&r.restarts)
+	if restarts == 0 {
+		return state
+	}
+
+	lines := strings.Split(state, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, "STATUS=") {
+			lines[i] = l + ", " + strconv.Itoa(int(restarts)) + " restarts"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *notifyRelay) Close() error {
+	err := r.conn.Close()
+	os.RemoveAll(r.dir)
+	return err
+}
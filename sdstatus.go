@@ -0,0 +1,67 @@
+package well
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	statusInterval = 5 * time.Second
+)
+
+// serving statistics published by sd_notify STATUS=.
+var (
+	activeConns    int64
+	activeRequests int64
+	drainingCount  int32
+
+	statusOnce sync.Once
+)
+
+// serveStatus returns a human-readable status of servers and the
+// last results of health checks.
+func serveStatus() string {
+	state := "serving"
+	if atomic.LoadInt32(&drainingCount) > 0 {
+		state = "draining"
+	}
+	status := state +
+		", " + strconv.FormatInt(atomic.LoadInt64(&activeConns), 10) + " active connections" +
+		", " + strconv.FormatInt(atomic.LoadInt64(&activeRequests), 10) + " active requests"
+	if health := healthStatus(); len(health) > 0 {
+		status += ", " + health
+	}
+	return status
+}
+
+// startStatusNotifier starts a goroutine to send STATUS= to systemd
+// periodically.  It does nothing if not run as a Type=notify service.
+func startStatusNotifier() {
+	if len(os.Getenv(notifySocketEnv)) == 0 {
+		return
+	}
+
+	statusOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(statusInterval)
+			defer ticker.Stop()
+
+			last := ""
+			for {
+				if hasHealthChecks() {
+					CheckHealth(context.Background())
+				}
+				status := serveStatus()
+				if status != last {
+					SdNotify("STATUS=" + status)
+					last = status
+				}
+				<-ticker.C
+			}
+		}()
+	})
+}
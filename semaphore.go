@@ -0,0 +1,118 @@
+package well
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Semaphore is a weighted semaphore integrated with context.
+//
+// Waiters acquire weights in FIFO order; a large request blocks
+// smaller requests that come after it so that it does not starve.
+//
+// Server.MaxConns and Scheduler.MaxConcurrent are implemented with
+// Semaphore.
+type Semaphore struct {
+	size int64
+
+	mu      sync.Mutex
+	cur     int64
+	waiters list.List
+}
+
+type semaphoreWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// NewSemaphore creates a Semaphore with the total weight n.
+func NewSemaphore(n int64) *Semaphore {
+	return &Semaphore{size: n}
+}
+
+// Acquire acquires the weight n, blocking until the weight becomes
+// available or ctx is canceled.  It returns ctx.Err() if ctx is
+// canceled.  If n is larger than the total weight, Acquire blocks
+// until ctx is canceled.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+
+	w := &semaphoreWaiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-w.ready:
+		// acquired just after ctx was canceled.
+		s.cur -= n
+		s.notifyWaiters()
+	default:
+		isFront := s.waiters.Front() == elem
+		s.waiters.Remove(elem)
+		if isFront && s.size > s.cur {
+			s.notifyWaiters()
+		}
+	}
+	return ctx.Err()
+}
+
+// TryAcquire acquires the weight n without blocking.
+// It returns false if the weight is not available.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+// Release releases the weight n.
+// It panics if n is more than the weight held.
+func (s *Semaphore) Release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur -= n
+	if s.cur < 0 {
+		panic("well: semaphore released more than held")
+	}
+	s.notifyWaiters()
+}
+
+// Acquired returns the weight currently held.
+func (s *Semaphore) Acquired() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cur
+}
+
+func (s *Semaphore) notifyWaiters() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(*semaphoreWaiter)
+		if s.size-s.cur < w.n {
+			return
+		}
+		s.cur += w.n
+		s.waiters.Remove(front)
+		close(w.ready)
+	}
+}
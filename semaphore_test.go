@@ -0,0 +1,83 @@
+package well
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	t.Parallel()
+
+	s := NewSemaphore(3)
+	ctx := context.Background()
+	if err := s.Acquire(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !s.TryAcquire(1) {
+		t.Error(`!s.TryAcquire(1)`)
+	}
+	if s.TryAcquire(1) {
+		t.Error(`s.TryAcquire(1)`)
+	}
+	if s.Acquired() != 3 {
+		t.Error(`s.Acquired() != 3`, s.Acquired())
+	}
+
+	acquired := make(chan int64, 2)
+	go func() {
+		s.Acquire(ctx, 2)
+		acquired <- 2
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		s.Acquire(ctx, 1)
+		acquired <- 1
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// FIFO: the waiter for 1 must not overtake the waiter for 2.
+	s.Release(1)
+	select {
+	case n := <-acquired:
+		t.Fatal(`acquired too early`, n)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.Release(2)
+	if n := <-acquired + <-acquired; n != 3 {
+		t.Error(`n != 3`, n)
+	}
+	if s.Acquired() != 3 {
+		t.Error(`s.Acquired() != 3`, s.Acquired())
+	}
+}
+
+func TestSemaphoreCancel(t *testing.T) {
+	t.Parallel()
+
+	s := NewSemaphore(2)
+	if !s.TryAcquire(1) {
+		t.Fatal(`!s.TryAcquire(1)`)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(ctx, 2); err != context.DeadlineExceeded {
+		t.Error(`err != context.DeadlineExceeded`, err)
+	}
+
+	// the canceled waiter must not block others.
+	if !s.TryAcquire(1) {
+		t.Error(`!s.TryAcquire(1)`)
+	}
+
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel2()
+	if err := s.Acquire(ctx2, 3); err == nil {
+		t.Error(`acquired more than the size`)
+	}
+	if s.Acquired() != 2 {
+		t.Error(`s.Acquired() != 2`, s.Acquired())
+	}
+}
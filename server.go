@@ -11,6 +11,8 @@ import (
 	"github.com/cybozu-go/netutil"
 )
 
+var serverLog = Module("well.server")
+
 // Server is a generic network server that accepts connections
 // and invokes Handler in a goroutine for each connection.
 //
@@ -30,8 +32,25 @@ type Server struct {
 	// all connections to be closed before shutdown.
 	//
 	// Zero duration disables timeout.
+	//
+	// When run as a systemd service, EXTEND_TIMEOUT_USEC is sent
+	// periodically while waiting so that systemd does not kill the
+	// service by TimeoutStopSec.
 	ShutdownTimeout time.Duration
 
+	// MaxConns limits the number of connections handled at the same
+	// time.  When the limit is reached, the server stops accepting
+	// new connections until a handler returns.
+	//
+	// Zero means no limit.
+	MaxConns int
+
+	// KeepAlive configures TCP keep-alive of accepted connections.
+	//
+	// If nil, keep-alive is enabled with the default parameters
+	// for connections accepted by *net.TCPListener.
+	KeepAlive *KeepAliveConfig
+
 	// Env is the environment where this server runs.
 	//
 	// The global environment is used if Env is nil.
@@ -39,6 +58,8 @@ type Server struct {
 
 	wg       sync.WaitGroup
 	timedout int32
+	semOnce  sync.Once
+	sem      *Semaphore
 }
 
 // Serve starts a managed goroutine to accept connections.
@@ -48,7 +69,7 @@ type Server struct {
 // canceled.
 //
 // If the listener is *net.TCPListener, TCP keep-alive is automatically
-// enabled.
+// enabled.  Set KeepAlive to tune it.
 //
 // The listener l will be closed automatically when the environment's
 // Cancel is called.
@@ -58,44 +79,104 @@ func (s *Server) Serve(l net.Listener) {
 		env = defaultEnv
 	}
 
-	l = netutil.KeepAliveListener(l)
+	if s.KeepAlive == nil {
+		l = netutil.KeepAliveListener(l)
+	}
+	StartServing(env)
 
 	go func() {
 		<-env.ctx.Done()
 		l.Close()
 	}()
 
+	s.semOnce.Do(func() {
+		if s.MaxConns > 0 {
+			s.sem = NewSemaphore(int64(s.MaxConns))
+		}
+	})
+
 	env.Go(func(ctx context.Context) error {
 		generator := NewIDGenerator()
 		for {
+			if s.sem != nil {
+				if err := s.sem.Acquire(ctx, 1); err != nil {
+					goto OUT
+				}
+			}
 			conn, err := l.Accept()
 			if err != nil {
-				log.Debug("well: Listener.Accept error", map[string]interface{}{
+				if s.sem != nil {
+					s.sem.Release(1)
+				}
+				serverLog.Debug("well: Listener.Accept error", map[string]interface{}{
 					"addr":  l.Addr().String(),
 					"error": err.Error(),
 				})
 				goto OUT
 			}
 
+			if s.KeepAlive != nil {
+				if err := s.KeepAlive.apply(conn); err != nil {
+					serverLog.Warn("well: failed to configure keep-alive", map[string]interface{}{
+						"remote":    conn.RemoteAddr().String(),
+						log.FnError: err,
+					})
+				}
+			}
+
 			s.wg.Add(1)
+			atomic.AddInt64(&activeConns, 1)
 			go func() {
 				ctx, cancel := context.WithCancel(ctx)
 				defer func() {
 					cancel()
 					conn.Close()
+					atomic.AddInt64(&activeConns, -1)
+					if s.sem != nil {
+						s.sem.Release(1)
+					}
 				}()
-				ctx = WithRequestID(ctx, generator.Generate())
+				ctx = WithRequestID(ctx, newActivityID(ctx, generator))
 				s.Handler(ctx, conn)
 				s.wg.Done()
 			}()
 		}
 	OUT:
-		s.wait()
+		s.wait(ctx)
 		return nil
 	})
 }
 
-func (s *Server) wait() {
+// StartServing tells that a server implemented outside this package,
+// e.g. a gRPC server, started serving in env.  The program becomes
+// ready as Server and HTTPServer do.  See SetReady.
+func StartServing(env *Environment) {
+	startStatusNotifier()
+	markReady(env)
+}
+
+// StartDraining tells that a server implemented outside this package
+// started draining connections on shutdown.  The returned function
+// must be called when draining finishes.
+//
+// While draining, Stats.Draining is true and systemd is asked to
+// extend the stop timeout.  EventDraining is emitted if no other
+// server is draining.
+func StartDraining() (done func()) {
+	stop := extendStopTimeout()
+	if atomic.AddInt32(&drainingCount, 1) == 1 {
+		emitEvent(Event{Type: EventDraining})
+	}
+	return func() {
+		atomic.AddInt32(&drainingCount, -1)
+		stop()
+	}
+}
+
+func (s *Server) wait(ctx context.Context) {
+	done := StartDraining()
+	defer done()
+
 	if s.ShutdownTimeout == 0 {
 		s.wg.Wait()
 		return
@@ -107,10 +188,12 @@ func (s *Server) wait() {
 		close(ch)
 	}()
 
+	timer := ClockFromContext(ctx).NewTimer(s.ShutdownTimeout)
+	defer timer.Stop()
 	select {
 	case <-ch:
-	case <-time.After(s.ShutdownTimeout):
-		log.Warn("well: timeout waiting for shutdown", nil)
+	case <-timer.C():
+		serverLog.Warn("well: timeout waiting for shutdown", nil)
 		atomic.StoreInt32(&s.timedout, 1)
 	}
 }
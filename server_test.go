@@ -7,6 +7,8 @@ import (
 	"net"
 	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -116,3 +118,57 @@ func TestServerTimeout(t *testing.T) {
 		t.Error(`!s.TimedOut()`)
 	}
 }
+
+func TestServerMaxConns(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var active, maxActive int32
+	handler := func(ctx context.Context, conn net.Conn) {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		conn.Write([]byte("ok"))
+	}
+
+	env := NewEnvironment(context.Background())
+	s := &Server{
+		Handler:  handler,
+		MaxConns: 2,
+		Env:      env,
+	}
+	s.Serve(l)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			io.ReadAll(conn)
+		}()
+	}
+	wg.Wait()
+
+	if m := atomic.LoadInt32(&maxActive); m != 2 {
+		t.Error(`maxActive != 2`, m)
+	}
+
+	env.Cancel(nil)
+	env.Wait()
+}
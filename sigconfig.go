@@ -0,0 +1,79 @@
+package well
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// SignalConfig configures signals handled by the global environment.
+//
+// Stop is a list of signal names that cancel the global environment.
+// Empty list is treated as the default, SIGINT and SIGTERM.
+// Names are case-insensitive and "SIG" prefix is optional, e.g.
+// "SIGQUIT" and "quit" are the same.
+//
+// Ignore is a list of signal names to be ignored.  Signals removed
+// from Stop are handled in the default way of Go unless they are
+// listed in Ignore.  For example, to ignore SIGINT in production,
+// set Stop to ["SIGTERM"] and Ignore to ["SIGINT"].
+//
+// IgnoreSigPipe, if true, makes the program discard SIGPIPE.
+// See IgnoreSigPipe function.
+//
+// Child processes of graceful restarting servers always stop on
+// SIGTERM because the master process uses it to stop them.
+//
+// On Windows, only SIGINT and SIGTERM are available.
+type SignalConfig struct {
+	Stop   []string `toml:"stop"   json:"stop"   yaml:"stop"`
+	Ignore []string `toml:"ignore" json:"ignore" yaml:"ignore"`
+
+	IgnoreSigPipe bool `toml:"ignore_sigpipe" json:"ignore_sigpipe" yaml:"ignore_sigpipe"`
+}
+
+// Apply applies configurations to the global environment.
+func (c SignalConfig) Apply() error {
+	stop, err := parseSignals(c.Stop)
+	if err != nil {
+		return err
+	}
+	if len(stop) == 0 {
+		stop = stopSignals
+	}
+	if !isMaster() {
+		stop = append(stop, syscall.SIGTERM)
+	}
+	ignore, err := parseSignals(c.Ignore)
+	if err != nil {
+		return err
+	}
+
+	signal.Stop(stopSignalCh)
+	signal.Notify(stopSignalCh, stop...)
+	if len(ignore) > 0 {
+		signal.Ignore(ignore...)
+	}
+	if c.IgnoreSigPipe {
+		IgnoreSigPipe()
+	}
+	return nil
+}
+
+func parseSignals(names []string) ([]os.Signal, error) {
+	sigs := make([]os.Signal, 0, len(names))
+	for _, name := range names {
+		n := strings.ToUpper(name)
+		if !strings.HasPrefix(n, "SIG") {
+			n = "SIG" + n
+		}
+		sig, ok := signalNames[n]
+		if !ok {
+			return nil, errors.New("unknown signal: " + name)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
@@ -0,0 +1,36 @@
+package well
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignals(t *testing.T) {
+	t.Parallel()
+
+	sigs, err := parseSignals([]string{"SIGINT", "term", "Sigterm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 3 || sigs[0] != syscall.SIGINT || sigs[1] != syscall.SIGTERM || sigs[2] != syscall.SIGTERM {
+		t.Error(`unexpected signals`, sigs)
+	}
+
+	_, err = parseSignals([]string{"SIGFOO"})
+	if err == nil {
+		t.Error(`unknown signal should be an error`)
+	}
+}
+
+func TestSignalConfig(t *testing.T) {
+	err := SignalConfig{Stop: []string{"SIGKILL"}}.Apply()
+	if err == nil {
+		t.Error(`SIGKILL should not be accepted`)
+	}
+
+	// restore the default.
+	err = SignalConfig{}.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,46 +1,116 @@
 package well
 
 import (
+	"context"
 	"errors"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/cybozu-go/log"
 )
 
+const (
+	// forceExitCode is the exit status when the program is stopped
+	// by a repeated stop signal.
+	forceExitCode = 3
+)
+
 var (
-	errSignaled = errors.New("signaled")
+	stopSignalCh = make(chan os.Signal, 2)
+
+	signalHandlersMu sync.Mutex
+	signalHandlers   = make(map[os.Signal][]func(ctx context.Context))
+	signalCh         chan os.Signal
 
 	cancellationDelaySecondsEnv = "CANCELLATION_DELAY_SECONDS"
 
 	defaultCancellationDelaySeconds = 5
 )
 
+// signalError is the error given to Cancel when the program receives
+// a stop signal.
+type signalError struct {
+	sig os.Signal
+}
+
+func (e signalError) Error() string {
+	return "signaled"
+}
+
 // IsSignaled returns true if err returned by Wait indicates that
 // the program has received SIGINT or SIGTERM.
 func IsSignaled(err error) bool {
-	return err == errSignaled
+	var se signalError
+	return errors.As(err, &se)
+}
+
+// SignalError returns the error that the global environment is
+// canceled with when the program receives sig.  IsSignaled and
+// SignalFrom recognize the error.  This is useful for tests.
+func SignalError(sig os.Signal) error {
+	return signalError{sig}
+}
+
+// SignalFrom returns the signal that stopped the program if err
+// returned by Wait indicates that the program has received a stop
+// signal.  Otherwise, it returns nil.
+//
+// On Windows, Stop and Shutdown controls of services are reported
+// as syscall.SIGTERM.
+func SignalFrom(err error) os.Signal {
+	var se signalError
+	if !errors.As(err, &se) {
+		return nil
+	}
+	return se.sig
 }
 
 // handleSignal runs independent goroutine to cancel an environment.
 func handleSignal(env *Environment) {
-	ch := make(chan os.Signal, 2)
-	signal.Notify(ch, stopSignals...)
+	signal.Notify(stopSignalCh, stopSignals...)
 
 	go func() {
-		s := <-ch
+		s := <-stopSignalCh
+		notifyStopping()
+		if c := getKubernetesConfig(); c != nil {
+			if isMaster() {
+				go forceExitOnSignal(env)
+			}
+			c.terminate(env, s)
+			return
+		}
 		delay := getDelaySecondsFromEnv()
 		log.Warn("well: got signal", map[string]interface{}{
 			"signal": s.String(),
 			"delay":  delay,
 		})
+
+		// Graceful children should not be force-exited because
+		// both systemd and the master process may send SIGTERM.
+		if isMaster() {
+			go forceExitOnSignal(env)
+		}
+
 		time.Sleep(time.Duration(delay) * time.Second)
-		env.Cancel(errSignaled)
+		env.Cancel(signalError{sig: s})
 	}()
 }
 
+// forceExitOnSignal exits the program immediately when it receives
+// a stop signal again.
+func forceExitOnSignal(env *Environment) {
+	s := <-stopSignalCh
+	log.Error("well: got signal again, exiting immediately", map[string]interface{}{
+		"signal": s.String(),
+		"tasks":  env.runningTasks(),
+	})
+	FlushLogs()
+	os.Exit(forceExitCode)
+}
+
 func getDelaySecondsFromEnv() int {
 	delayStr := os.Getenv(cancellationDelaySecondsEnv)
 	if len(delayStr) == 0 {
@@ -65,3 +135,42 @@ func getDelaySecondsFromEnv() int {
 	}
 	return delay
 }
+
+// HandleSignal registers f to be called when the program receives sig.
+//
+// f is called with the base context of the global environment, which
+// is canceled when the global environment is canceled.  Handlers are
+// called serially in a goroutine in the order of registration, so f
+// should return quickly.
+//
+// Use this instead of signal.Notify to react to signals other than
+// the stop signals, e.g. to flush caches on SIGUSR1.
+func HandleSignal(sig os.Signal, f func(ctx context.Context)) {
+	signalHandlersMu.Lock()
+	defer signalHandlersMu.Unlock()
+
+	if signalCh == nil {
+		signalCh = make(chan os.Signal, 4)
+		go dispatchSignals(signalCh)
+	}
+	if _, ok := signalHandlers[sig]; !ok {
+		signal.Notify(signalCh, sig)
+	}
+	signalHandlers[sig] = append(signalHandlers[sig], f)
+}
+
+func dispatchSignals(ch <-chan os.Signal) {
+	for sig := range ch {
+		signalHandlersMu.Lock()
+		handlers := signalHandlers[sig]
+		signalHandlersMu.Unlock()
+
+		log.Info("well: handling signal", map[string]interface{}{
+			"signal":   sig.String(),
+			"handlers": len(handlers),
+		})
+		for _, f := range handlers {
+			f(defaultEnv.ctx)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignal(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan int, 2)
+	HandleSignal(syscall.SIGWINCH, func(ctx context.Context) {
+		if ctx == nil {
+			t.Error(`ctx should not be nil`)
+		}
+		ch <- 1
+	})
+	HandleSignal(syscall.SIGWINCH, func(ctx context.Context) {
+		ch <- 2
+	})
+
+	err := syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []int{1, 2} {
+		select {
+		case n := <-ch:
+			if n != expected {
+				t.Error(`handlers should be called in order`, n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal(`handler was not called`)
+		}
+	}
+}
+
+func TestSignalFrom(t *testing.T) {
+	t.Parallel()
+
+	err := error(signalError{sig: syscall.SIGTERM})
+	if !IsSignaled(err) {
+		t.Error(`IsSignaled(err) should be true`)
+	}
+	if SignalFrom(err) != syscall.SIGTERM {
+		t.Error(`SignalFrom(err) != syscall.SIGTERM`)
+	}
+
+	err = errors.New("foo")
+	if IsSignaled(err) {
+		t.Error(`IsSignaled(err) should be false`)
+	}
+	if SignalFrom(err) != nil {
+		t.Error(`SignalFrom(err) should be nil`)
+	}
+}
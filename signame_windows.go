@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package well
+
+import (
+	"os"
+	"syscall"
+)
+
+var signalNames = map[string]os.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+}
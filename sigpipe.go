@@ -6,6 +6,7 @@ package well
 import (
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 )
 
@@ -51,9 +52,22 @@ func handleSigPipe() {
 	if !IsSystemdService() {
 		return
 	}
+	IgnoreSigPipe()
+}
+
+var sigPipeOnce sync.Once
 
-	// signal.Ignore does NOT ignore signals; instead, it just stop
-	// relaying signals to the channel.  Instead, we set a nop handler.
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGPIPE)
+// IgnoreSigPipe makes the program discard SIGPIPE regardless of
+// whether it runs as a systemd service.  Writes to closed pipes or
+// sockets, including those from cgo code or raw file descriptors,
+// then fail with EPIPE instead of killing the program.
+//
+// This does nothing on Windows.
+func IgnoreSigPipe() {
+	sigPipeOnce.Do(func() {
+		// signal.Ignore does NOT ignore signals; instead, it just stop
+		// relaying signals to the channel.  Instead, we set a nop handler.
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGPIPE)
+	})
 }
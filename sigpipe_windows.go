@@ -1,3 +1,6 @@
 package well
 
 func handleSigPipe() {}
+
+// IgnoreSigPipe does nothing on Windows.
+func IgnoreSigPipe() {}
@@ -0,0 +1,106 @@
+package well
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Sleep pauses the current goroutine for d or until ctx is canceled.
+// It returns ctx.Err() if ctx is canceled before d elapses.
+//
+// Use this instead of time.Sleep in functions started by Go so that
+// they return promptly when the environment is canceled.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := ClockFromContext(ctx).NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+// RateLimiter is a token bucket rate limiter.
+//
+// The bucket holds up to Burst tokens and is refilled at Rate tokens
+// per second.  It is initially full.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter that allows rate events per
+// second with bursts of up to burst events.  rate must be positive.
+// burst less than 1 is treated as 1.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill adds tokens for the time elapsed since the last call.
+// l.mu must be locked.
+func (l *RateLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// Allow takes a token and returns true if one is available now.
+// Otherwise, it returns false without taking a token.
+func (l *RateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// Wait takes a token, waiting until one is available.
+// It returns ctx.Err() without taking a token if ctx is canceled
+// before that.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.refill(time.Now())
+	l.tokens--
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if err := Sleep(ctx, d); err != nil {
+		// return the reserved token.
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
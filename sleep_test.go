@@ -0,0 +1,68 @@
+package well
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSleep(t *testing.T) {
+	t.Parallel()
+
+	if err := Sleep(context.Background(), 10*time.Millisecond); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	st := time.Now()
+	if err := Sleep(ctx, time.Hour); err != context.DeadlineExceeded {
+		t.Error(`err != context.DeadlineExceeded`, err)
+	}
+	if time.Since(st) > 5*time.Second {
+		t.Error(`Sleep did not stop on cancellation`)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	l := NewRateLimiter(100, 2)
+	if !l.Allow() || !l.Allow() {
+		t.Error(`burst should be allowed`)
+	}
+	if l.Allow() {
+		t.Error(`l.Allow() should fail`)
+	}
+
+	st := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(st); elapsed < 40*time.Millisecond {
+		t.Error(`elapsed < 40ms`, elapsed)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	t.Parallel()
+
+	l := NewRateLimiter(0.001, 1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Error(`err != context.DeadlineExceeded`, err)
+	}
+	l.mu.Lock()
+	tokens := l.tokens
+	l.mu.Unlock()
+	if tokens < -0.5 {
+		t.Error(`reserved token was not returned`, tokens)
+	}
+}
@@ -0,0 +1,149 @@
+//go:build go1.21
+// +build go1.21
+
+package well
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/cybozu-go/log"
+)
+
+// SlogHandler implements slog.Handler to record logs by a cybozu-go/log
+// logger, so that logs from log/slog users end up in the same output
+// with the same format as other logs.
+//
+// slog levels are mapped to cybozu-go/log severities; levels above
+// slog.LevelError are recorded as critical.
+//
+// Attribute keys are converted to valid field names of cybozu-go/log.
+// Keys of groups are joined with "_".  If the context passed to slog
+// has a request ID, it is recorded as well.
+type SlogHandler struct {
+	logger *log.Logger
+	fields map[string]interface{}
+	prefix string
+}
+
+// NewSlogHandler creates a new SlogHandler.
+// If logger is nil, the default logger is used.
+func NewSlogHandler(logger *log.Logger) *SlogHandler {
+	if logger == nil {
+		logger = log.DefaultLogger()
+	}
+	return &SlogHandler{
+		logger: logger,
+		fields: make(map[string]interface{}),
+	}
+}
+
+// SetSlogDefault makes slog's default logger record logs by the
+// default logger of cybozu-go/log.
+func SetSlogDefault() {
+	slog.SetDefault(slog.New(NewSlogHandler(nil)))
+}
+
+func slogSeverity(level slog.Level) int {
+	switch {
+	case level < slog.LevelInfo:
+		return log.LvDebug
+	case level < slog.LevelWarn:
+		return log.LvInfo
+	case level < slog.LevelError:
+		return log.LvWarn
+	case level == slog.LevelError:
+		return log.LvError
+	}
+	return log.LvCritical
+}
+
+// Enabled implements slog.Handler.
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.logger.Enabled(slogSeverity(level))
+}
+
+// Handle implements slog.Handler.
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := FieldsFromContext(ctx)
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addSlogAttr(fields, h.prefix, a)
+		return true
+	})
+	return h.logger.Log(slogSeverity(r.Level), r.Message, fields)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := h.clone()
+	for _, a := range attrs {
+		addSlogAttr(h2.fields, h2.prefix, a)
+	}
+	return h2
+}
+
+// WithGroup implements slog.Handler.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+	h2 := h.clone()
+	h2.prefix = h.prefix + slogKey(name) + "_"
+	return h2
+}
+
+func (h *SlogHandler) clone() *SlogHandler {
+	fields := make(map[string]interface{}, len(h.fields))
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	return &SlogHandler{
+		logger: h.logger,
+		fields: fields,
+		prefix: h.prefix,
+	}
+}
+
+func addSlogAttr(fields map[string]interface{}, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if v.Kind() == slog.KindGroup {
+		if len(a.Key) > 0 {
+			prefix = prefix + slogKey(a.Key) + "_"
+		}
+		for _, ga := range v.Group() {
+			addSlogAttr(fields, prefix, ga)
+		}
+		return
+	}
+
+	key := prefix + slogKey(a.Key)
+	if log.ReservedKey(key) {
+		key = "_" + key
+	}
+	fields[key] = v.Any()
+}
+
+// slogKey converts an attribute key to a valid field name.
+func slogKey(k string) string {
+	k = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '_'
+	}, k)
+	if len(k) == 0 || (k[0] >= '0' && k[0] <= '9') {
+		k = "_" + k
+	}
+	return k
+}
@@ -0,0 +1,64 @@
+//go:build go1.21
+// +build go1.21
+
+package well
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestSlogHandler(t *testing.T) {
+	t.Parallel()
+
+	logger := log.NewLogger()
+	logger.SetFormatter(log.JSONFormat{})
+	buf := new(bytes.Buffer)
+	logger.SetOutput(buf)
+
+	sl := slog.New(NewSlogHandler(logger))
+	sl.Debug("should be suppressed")
+	if buf.Len() != 0 {
+		t.Fatal(`debug log should be suppressed`)
+	}
+
+	ctx := WithRequestID(context.Background(), testUUID)
+	sl.With("userID", 123).WithGroup("req").ErrorContext(ctx, "hello",
+		"method", "GET",
+		slog.Group("peer", "addr", "127.0.0.1"),
+		"message", "reserved",
+	)
+
+	var rec map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"severity":      "error",
+		"message":       "hello",
+		"userid":        123.0,
+		"req_method":    "GET",
+		"req_peer_addr": "127.0.0.1",
+		"req_message":   "reserved",
+		log.FnRequestID: testUUID,
+	}
+	for k, v := range expected {
+		if rec[k] != v {
+			t.Errorf("rec[%s] = %#v", k, rec[k])
+		}
+	}
+
+	if slogSeverity(slog.LevelError+4) != log.LvCritical {
+		t.Error(`slogSeverity(slog.LevelError+4) != log.LvCritical`)
+	}
+	if slogKey("9Foo-Bar") != "_9foo_bar" {
+		t.Error(`slogKey("9Foo-Bar") != "_9foo_bar"`)
+	}
+}
@@ -0,0 +1,129 @@
+package well
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	// FnStack is the log field name for stack traces.
+	FnStack = "stack"
+
+	// FnGoroutine is the log field name for goroutine IDs.
+	FnGoroutine = "goroutine"
+
+	maxStackDepth = 32
+)
+
+// logFrames are prefixes of logging functions.
+// They are trimmed from stack traces.
+var logFrames = []string{
+	"github.com/cybozu-go/log.",
+	"github.com/cybozu-go/well.(*ModuleLogger).",
+	"github.com/cybozu-go/well.(*ContextLogger).",
+	"github.com/cybozu-go/well.(*SlogHandler).",
+	"github.com/cybozu-go/well.writeLog",
+	"log/slog.",
+}
+
+// StackTraceFormat implements log.Formatter to attach the stack trace
+// and the goroutine ID to logs of high severity.
+//
+// The stack trace is recorded in "stack" field as a list of
+// "FUNCTION (FILE:LINE)".  Frames of the logging functions are
+// trimmed.  The goroutine ID is recorded in "goroutine" field.
+type StackTraceFormat struct {
+	// Formatter formats logs.  This must not be nil.
+	Formatter log.Formatter
+
+	// Severity is the lowest severity to attach stack traces.
+	// Zero is treated as log.LvError.
+	Severity int
+}
+
+// String returns the name of the inner formatter.
+func (f StackTraceFormat) String() string {
+	return f.Formatter.String()
+}
+
+// Format implements log.Formatter.
+func (f StackTraceFormat) Format(buf []byte, l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) ([]byte, error) {
+	sv := f.Severity
+	if sv == 0 {
+		sv = log.LvError
+	}
+	if severity > sv {
+		return f.Formatter.Format(buf, l, t, severity, msg, fields)
+	}
+
+	fields2 := make(map[string]interface{}, len(fields)+2)
+	for k, v := range fields {
+		fields2[k] = v
+	}
+	// logs relayed from child processes may already have these fields.
+	if _, ok := fields2[FnStack]; !ok {
+		fields2[FnStack] = callerStack()
+	}
+	if _, ok := fields2[FnGoroutine]; !ok {
+		fields2[FnGoroutine] = goroutineID()
+	}
+	return f.Formatter.Format(buf, l, t, severity, msg, fields2)
+}
+
+// callerStack returns the stack trace of the caller of the logger.
+func callerStack() []string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	stack := make([]string, 0, maxStackDepth)
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.goexit" || len(stack) == maxStackDepth {
+			break
+		}
+		if len(stack) > 0 || !isLogFrame(frame.Function) {
+			stack = append(stack, frame.Function+" ("+frame.File+":"+strconv.Itoa(frame.Line)+")")
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
+func isLogFrame(fn string) bool {
+	// formatters wrapping other formatters.
+	if strings.HasPrefix(fn, "github.com/cybozu-go/well.") && strings.HasSuffix(fn, ".Format") {
+		return true
+	}
+	for _, p := range logFrames {
+		if strings.HasPrefix(fn, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutineID returns the ID of the current goroutine.
+// Go does not provide an API for this; the ID is parsed from the
+// first line of the stack trace, "goroutine 123 [running]:".
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,48 @@
+package well
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestStackTraceFormat(t *testing.T) {
+	t.Parallel()
+
+	logger := log.NewLogger()
+	logger.SetFormatter(StackTraceFormat{Formatter: log.JSONFormat{}})
+	buf := new(bytes.Buffer)
+	logger.SetOutput(buf)
+
+	logger.Warn("no stack", nil)
+	var rec map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec[FnStack]; ok {
+		t.Error(`warning should not have stack trace`)
+	}
+
+	buf.Reset()
+	LogWith(context.Background(), logger).Error("with stack", nil)
+	rec = nil
+	err = json.Unmarshal(buf.Bytes(), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack, ok := rec[FnStack].([]interface{})
+	if !ok || len(stack) == 0 {
+		t.Fatal(`error should have stack trace`, rec)
+	}
+	if !strings.HasPrefix(stack[0].(string), "github.com/cybozu-go/well.TestStackTraceFormat ") {
+		t.Error(`stack trace should start from the caller`, stack[0])
+	}
+	if id, ok := rec[FnGoroutine].(float64); !ok || id <= 0 {
+		t.Error(`invalid goroutine ID`, rec[FnGoroutine])
+	}
+}
@@ -0,0 +1,90 @@
+package well
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultStallTimeout = time.Minute
+)
+
+var (
+	stallMu     sync.Mutex
+	stallConfig *StallConfig
+	stallOnce   sync.Once
+
+	waitDone     = make(chan struct{})
+	waitDoneOnce sync.Once
+)
+
+// StallConfig configures the detection of stalled shutdowns.
+//
+// When applied, if Wait does not return within Timeout after the
+// global environment is canceled, the running tasks and stack traces
+// of all goroutines are logged as DumpGoroutines does.  If ForceExit
+// is true, the program then exits with status 3.
+//
+// Timeout defaults to 1 minute.  It should be shorter than the time
+// the service manager waits for the program to stop, e.g.
+// TimeoutStopSec of systemd.
+type StallConfig struct {
+	Timeout   time.Duration `toml:"timeout"    json:"timeout"    yaml:"timeout"`
+	ForceExit bool          `toml:"force_exit" json:"force_exit" yaml:"force_exit"`
+}
+
+// Apply applies configurations to the global environment.
+func (c StallConfig) Apply() {
+	if c.Timeout <= 0 {
+		c.Timeout = defaultStallTimeout
+	}
+
+	stallMu.Lock()
+	stallConfig = &c
+	stallMu.Unlock()
+
+	stallOnce.Do(func() {
+		go watchStall(defaultEnv)
+	})
+}
+
+func getStallConfig() *StallConfig {
+	stallMu.Lock()
+	defer stallMu.Unlock()
+	return stallConfig
+}
+
+// markWaitDone records that Wait of the global environment returned.
+func markWaitDone() {
+	waitDoneOnce.Do(func() {
+		close(waitDone)
+	})
+}
+
+func watchStall(env *Environment) {
+	<-env.ctx.Done()
+
+	c := getStallConfig()
+	timer := time.NewTimer(c.Timeout)
+	defer timer.Stop()
+
+	select {
+	case <-waitDone:
+		return
+	case <-timer.C:
+	}
+
+	log.Error("well: Wait is stalled", map[string]interface{}{
+		"timeout":    c.Timeout.String(),
+		"tasks":      env.runningTasks(),
+		"force_exit": c.ForceExit,
+	})
+	DumpGoroutines()
+	if c.ForceExit {
+		FlushLogs()
+		os.Exit(forceExitCode)
+	}
+}
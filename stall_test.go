@@ -0,0 +1,44 @@
+package well
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestWatchStall(t *testing.T) {
+	logger := log.DefaultLogger()
+	buf := new(syncBuffer)
+	logger.SetOutput(buf)
+	defer func() {
+		logger.SetOutput(os.Stderr)
+		stallMu.Lock()
+		stallConfig = nil
+		stallMu.Unlock()
+	}()
+
+	stallMu.Lock()
+	stallConfig = &StallConfig{Timeout: 10 * time.Millisecond}
+	stallMu.Unlock()
+
+	env := NewEnvironment(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watchStall(env)
+		close(done)
+	}()
+	env.Cancel(nil)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal(`watchStall did not fire`)
+	}
+	if !strings.Contains(string(buf.Bytes()), "well: Wait is stalled") {
+		t.Error(`no stall log`, string(buf.Bytes()))
+	}
+}
@@ -0,0 +1,91 @@
+package well
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statistics of the framework other than those in sdstatus.go.
+var (
+	gracefulRestarts int64
+	droppedLogs      int64
+	waitDuration     int64 // nanoseconds
+
+	httpRequestsMu       sync.Mutex
+	httpRequestDurations = newHistogram(nil)
+)
+
+// Stats is a snapshot of statistics of the framework.
+type Stats struct {
+	// Goroutines is the number of goroutines in the program.
+	Goroutines int
+
+	// RunningTasks is the number of goroutines started by Go of the
+	// global environment and still running.
+	RunningTasks int
+
+	// ActiveConnections is the number of connections handled by
+	// Server and HTTPServer.
+	ActiveConnections int64
+
+	// ActiveRequests is the number of requests handled by HTTPServer.
+	ActiveRequests int64
+
+	// Draining is true while servers are waiting for connections
+	// to be closed on shutdown.
+	Draining bool
+
+	// Restarts is the number of graceful restarts in the master process.
+	Restarts int64
+
+	// DroppedLogs is the number of logs dropped by LogSampler and
+	// OTLPExporter.
+	DroppedLogs int64
+
+	// WaitDuration is the time Wait took after the global environment
+	// was canceled.  Zero until Wait returns.
+	WaitDuration time.Duration
+
+	// HTTPRequestDuration is the histogram of the time HTTPServer took
+	// to handle requests in seconds.
+	HTTPRequestDuration HistogramSnapshot
+}
+
+// ReadStats returns statistics of the framework.
+func ReadStats() Stats {
+	httpRequestsMu.Lock()
+	hist := httpRequestDurations.snapshot()
+	httpRequestsMu.Unlock()
+
+	return Stats{
+		Goroutines:          runtime.NumGoroutine(),
+		RunningTasks:        len(defaultEnv.runningTasks()),
+		ActiveConnections:   atomic.LoadInt64(&activeConns),
+		ActiveRequests:      atomic.LoadInt64(&activeRequests),
+		Draining:            atomic.LoadInt32(&drainingCount) > 0,
+		Restarts:            atomic.LoadInt64(&gracefulRestarts),
+		DroppedLogs:         atomic.LoadInt64(&droppedLogs),
+		WaitDuration:        time.Duration(atomic.LoadInt64(&waitDuration)),
+		HTTPRequestDuration: hist,
+	}
+}
+
+func observeHTTPRequest(d time.Duration) {
+	httpRequestsMu.Lock()
+	httpRequestDurations.observe(d.Seconds())
+	httpRequestsMu.Unlock()
+	observeStatsDTiming(d)
+}
+
+func recordWaitDuration(env *Environment) {
+	env.mu.RLock()
+	canceledAt := env.canceledAt
+	env.mu.RUnlock()
+
+	if canceledAt.IsZero() {
+		return
+	}
+	atomic.StoreInt64(&waitDuration, int64(time.Since(canceledAt)))
+}
@@ -0,0 +1,81 @@
+package well
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReadStats(t *testing.T) {
+	observeHTTPRequest(3 * time.Millisecond)
+
+	s := ReadStats()
+	if s.Goroutines == 0 {
+		t.Error(`s.Goroutines == 0`)
+	}
+	if s.HTTPRequestDuration.Count == 0 {
+		t.Error(`s.HTTPRequestDuration.Count == 0`)
+	}
+	if s.HTTPRequestDuration.Sum < 0.003 {
+		t.Error(`s.HTTPRequestDuration.Sum < 0.003`, s.HTTPRequestDuration.Sum)
+	}
+}
+
+func TestRecordWaitDuration(t *testing.T) {
+	env := NewEnvironment(context.Background())
+	recordWaitDuration(env)
+
+	env.Cancel(nil)
+	time.Sleep(10 * time.Millisecond)
+	recordWaitDuration(env)
+	if d := ReadStats().WaitDuration; d < 10*time.Millisecond {
+		t.Error(`d < 10*time.Millisecond`, d)
+	}
+}
+
+func TestHTTPServerActiveConnections(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvironment(context.Background())
+	s := &HTTPServer{
+		Server: &http.Server{Handler: http.NotFoundHandler()},
+		Env:    env,
+	}
+	if err := s.Serve(l); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		env.Cancel(nil)
+		env.Wait()
+	}()
+
+	before := ReadStats().ActiveConnections
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := ReadStats().ActiveConnections; n != before+1 {
+		t.Error(`HTTPServer connections should be counted`, before, n)
+	}
+
+	conn.Close()
+	for i := 0; i < 100; i++ {
+		if ReadStats().ActiveConnections == before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error(`closed connections should not be counted`, ReadStats().ActiveConnections)
+}
@@ -0,0 +1,235 @@
+package well
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultStatsDAddress    = "127.0.0.1:8125"
+	defaultStatsDInterval   = 10 * time.Second
+	defaultStatsDMaxTimings = 8192
+
+	// statsDPacketSize keeps packets within the typical Ethernet MTU.
+	statsDPacketSize = 1432
+)
+
+var (
+	statsDSinksMu sync.Mutex
+	statsDSinks   atomic.Value // []*StatsDSink
+)
+
+// StatsDSink pushes well's internal metrics to a StatsD server.
+// This is an alternative of the Prometheus collector in the metrics
+// package for hosts that are not scraped.
+//
+// The following metrics are sent every Interval.  Names are prefixed
+// by Prefix.
+//
+//   - goroutines, tasks.running, connections.active, requests.active,
+//     draining: gauges of the values in Stats.
+//   - restarts, logs.dropped: counters incremented since the last push.
+//   - http.request_duration: timings of HTTP requests in milliseconds.
+//
+// If Tags are given, they are sent with every metric in the DogStatsD
+// format, e.g. "well.goroutines:12|g|#env:prod,service:api".
+type StatsDSink struct {
+	// Address is the UDP address of the StatsD server.
+	// If empty, "127.0.0.1:8125" is used.
+	Address string
+
+	// Prefix is prepended to metric names, e.g. "myapp.".
+	Prefix string
+
+	// Tags are DogStatsD tags such as "env:prod".
+	// Leave this empty for plain StatsD servers.
+	Tags []string
+
+	// Interval is the interval to push metrics.
+	// Zero is treated as 10 seconds.
+	Interval time.Duration
+
+	// MaxTimings is the maximum number of timings buffered between
+	// pushes.  Timings are dropped when the buffer is full.
+	// Zero is treated as 8192.
+	MaxTimings int
+
+	// Env is the environment where this sink runs.  Metrics are pushed
+	// for the last time when the environment is canceled.
+	//
+	// The global environment is used if Env is nil.
+	Env *Environment
+
+	conn    net.Conn
+	tags    string
+	prev    Stats
+	lastErr error
+
+	mu      sync.Mutex
+	timings []time.Duration
+}
+
+// Start starts pushing metrics.  Start itself returns immediately.
+func (s *StatsDSink) Start() error {
+	if s.conn != nil {
+		return errors.New("statsd sink already started")
+	}
+	addr := s.Address
+	if addr == "" {
+		addr = defaultStatsDAddress
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	if len(s.Tags) > 0 {
+		s.tags = "|#" + strings.Join(s.Tags, ",")
+	}
+	s.prev = ReadStats()
+
+	addStatsDSink(s)
+	env := s.Env
+	if env == nil {
+		env = defaultEnv
+	}
+	env.Go(s.run)
+	return nil
+}
+
+func (s *StatsDSink) run(ctx context.Context) error {
+	defer s.conn.Close()
+	defer removeStatsDSink(s)
+
+	interval := s.Interval
+	if interval <= 0 {
+		interval = defaultStatsDInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.push()
+			return nil
+		case <-ticker.C:
+			s.push()
+		}
+	}
+}
+
+func (s *StatsDSink) observeTiming(d time.Duration) {
+	max := s.MaxTimings
+	if max <= 0 {
+		max = defaultStatsDMaxTimings
+	}
+	s.mu.Lock()
+	if len(s.timings) < max {
+		s.timings = append(s.timings, d)
+	}
+	s.mu.Unlock()
+}
+
+func (s *StatsDSink) push() {
+	cur := ReadStats()
+	s.mu.Lock()
+	timings := s.timings
+	s.timings = nil
+	s.mu.Unlock()
+
+	draining := 0
+	if cur.Draining {
+		draining = 1
+	}
+
+	w := &statsDWriter{conn: s.conn}
+	s.write(w, "goroutines", int64(cur.Goroutines), "g")
+	s.write(w, "tasks.running", int64(cur.RunningTasks), "g")
+	s.write(w, "connections.active", cur.ActiveConnections, "g")
+	s.write(w, "requests.active", cur.ActiveRequests, "g")
+	s.write(w, "draining", int64(draining), "g")
+	s.write(w, "restarts", cur.Restarts-s.prev.Restarts, "c")
+	s.write(w, "logs.dropped", cur.DroppedLogs-s.prev.DroppedLogs, "c")
+	for _, d := range timings {
+		w.add(s.line("http.request_duration", strconv.FormatFloat(d.Seconds()*1000, 'f', 3, 64), "ms"))
+	}
+	w.flush()
+	s.prev = cur
+
+	if w.err != nil && s.lastErr == nil {
+		// report only the first error of consecutive failures.
+		fmt.Fprintf(os.Stderr, "well: failed to send metrics to statsd: %v\n", w.err)
+	}
+	s.lastErr = w.err
+}
+
+func (s *StatsDSink) write(w *statsDWriter, name string, value int64, typ string) {
+	w.add(s.line(name, strconv.FormatInt(value, 10), typ))
+}
+
+func (s *StatsDSink) line(name, value, typ string) string {
+	return s.Prefix + name + ":" + value + "|" + typ + s.tags
+}
+
+// statsDWriter packs lines into packets.
+type statsDWriter struct {
+	conn net.Conn
+	buf  []byte
+	err  error
+}
+
+func (w *statsDWriter) add(line string) {
+	if len(w.buf) > 0 && len(w.buf)+1+len(line) > statsDPacketSize {
+		w.flush()
+	}
+	if len(w.buf) > 0 {
+		w.buf = append(w.buf, '\n')
+	}
+	w.buf = append(w.buf, line...)
+}
+
+func (w *statsDWriter) flush() {
+	if len(w.buf) == 0 {
+		return
+	}
+	if _, err := w.conn.Write(w.buf); err != nil && w.err == nil {
+		w.err = err
+	}
+	w.buf = w.buf[:0]
+}
+
+func addStatsDSink(s *StatsDSink) {
+	statsDSinksMu.Lock()
+	defer statsDSinksMu.Unlock()
+	sinks, _ := statsDSinks.Load().([]*StatsDSink)
+	statsDSinks.Store(append(sinks[:len(sinks):len(sinks)], s))
+}
+
+func removeStatsDSink(s *StatsDSink) {
+	statsDSinksMu.Lock()
+	defer statsDSinksMu.Unlock()
+	sinks, _ := statsDSinks.Load().([]*StatsDSink)
+	var newSinks []*StatsDSink
+	for _, sink := range sinks {
+		if sink != s {
+			newSinks = append(newSinks, sink)
+		}
+	}
+	statsDSinks.Store(newSinks)
+}
+
+func observeStatsDTiming(d time.Duration) {
+	sinks, _ := statsDSinks.Load().([]*StatsDSink)
+	for _, s := range sinks {
+		s.observeTiming(d)
+	}
+}
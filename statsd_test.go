@@ -0,0 +1,124 @@
+package well
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsDSink(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	env := NewEnvironment(context.Background())
+	s := &StatsDSink{
+		Address:  pc.LocalAddr().String(),
+		Prefix:   "test.",
+		Tags:     []string{"env:test", "service:well"},
+		Interval: time.Hour,
+		Env:      env,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err == nil {
+		t.Error(`err == nil`)
+	}
+
+	observeHTTPRequest(5 * time.Millisecond)
+	env.Cancel(nil)
+	if err := env.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	buf := make([]byte, 65536)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if n > statsDPacketSize {
+			t.Error(`n > statsDPacketSize`, n)
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	}
+
+	const tags = "|#env:test,service:well"
+	found := map[string]bool{}
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "test.") || !strings.HasSuffix(l, tags) {
+			t.Error(`unexpected line`, l)
+			continue
+		}
+		name := l[len("test."):strings.IndexByte(l, ':')]
+		found[name] = true
+		if name == "restarts" && l != "test.restarts:0|c"+tags {
+			t.Error(`unexpected restarts`, l)
+		}
+		if name == "http.request_duration" && !strings.Contains(l, "|ms|") {
+			t.Error(`timing is not in ms`, l)
+		}
+	}
+	for _, name := range []string{"goroutines", "tasks.running", "connections.active", "requests.active", "draining", "restarts", "logs.dropped", "http.request_duration"} {
+		if !found[name] {
+			t.Error(`metric not sent`, name)
+		}
+	}
+
+	// the sink is removed after the environment finishes.
+	if sinks, _ := statsDSinks.Load().([]*StatsDSink); len(sinks) != 0 {
+		t.Error(`len(sinks) != 0`, len(sinks))
+	}
+}
+
+func TestStatsDWriter(t *testing.T) {
+	t.Parallel()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := &statsDWriter{conn: conn}
+	line := strings.Repeat("a", 100) + ":1|c"
+	for i := 0; i < 30; i++ {
+		w.add(line)
+	}
+	w.flush()
+	if w.err != nil {
+		t.Fatal(w.err)
+	}
+
+	total := 0
+	packets := 0
+	buf := make([]byte, 65536)
+	for total < 30 {
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > statsDPacketSize {
+			t.Error(`n > statsDPacketSize`, n)
+		}
+		packets++
+		total += len(strings.Split(string(buf[:n]), "\n"))
+	}
+	if packets < 3 {
+		t.Error(`packets < 3`, packets)
+	}
+}
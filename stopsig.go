@@ -9,3 +9,9 @@ import (
 )
 
 var stopSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+var dumpSignals = []os.Signal{syscall.SIGQUIT}
+
+func handleServiceControl(env *Environment) error { return nil }
+
+func notifyServiceStopped() {}
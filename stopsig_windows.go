@@ -1,5 +1,89 @@
+//go:build windows
+// +build windows
+
 package well
 
-import "os"
+import (
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/cybozu-go/log"
+	"golang.org/x/sys/windows/svc"
+)
+
+// Go translates CTRL_C_EVENT and CTRL_BREAK_EVENT to os.Interrupt,
+// and CTRL_CLOSE_EVENT, CTRL_LOGOFF_EVENT, and CTRL_SHUTDOWN_EVENT
+// to syscall.SIGTERM.
+var stopSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+var dumpSignals []os.Signal
+
+var (
+	serviceStopped = make(chan struct{})
+	serviceOnce    sync.Once
+)
+
+// handleServiceControl cancels env on Stop or Shutdown control
+// if the program runs as a Windows service.
+func handleServiceControl(env *Environment) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return nil
+	}
+
+	serviceOnce.Do(func() { go runService(env) })
+	return nil
+}
+
+func runService(env *Environment) {
+	err := svc.Run("", serviceHandler{env: env})
+	if err != nil {
+		log.Error("well: failed to run as a service", map[string]interface{}{
+			log.FnError: err,
+		})
+	}
+}
+
+// notifyServiceStopped reports the service is stopped.
+// This is called when the global environment finishes.
+func notifyServiceStopped() {
+	select {
+	case <-serviceStopped:
+	default:
+		close(serviceStopped)
+	}
+}
+
+type serviceHandler struct {
+	env *Environment
+}
+
+// Execute implements svc.Handler.
+func (h serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+	s <- svc.Status{State: svc.Running, Accepts: accepts}
 
-var stopSignals = []os.Signal{os.Interrupt}
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				log.Warn("well: got service control", map[string]interface{}{
+					"control": c.Cmd,
+				})
+				s <- svc.Status{State: svc.StopPending}
+				h.env.Cancel(signalError{sig: syscall.SIGTERM})
+			}
+		case <-h.env.ctx.Done():
+			s <- svc.Status{State: svc.StopPending}
+			<-serviceStopped
+			return false, 0
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package well
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	syslogDialTimeout = 10 * time.Second
+)
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// SyslogFacility returns the facility code for a facility name
+// such as "daemon" or "local0".  Empty string is treated as "user".
+func SyslogFacility(name string) (int, error) {
+	if len(name) == 0 {
+		return syslogFacilities["user"], nil
+	}
+	f, ok := syslogFacilities[name]
+	if !ok {
+		return 0, errors.New("invalid syslog facility: " + name)
+	}
+	return f, nil
+}
+
+// SyslogFormat implements log.Formatter to wrap log messages
+// with RFC 5424 syslog headers.
+//
+// Severities of cybozu-go/log are the same as syslog severities,
+// so they are used as is to compute the PRI part.  The message
+// part is formatted by Body, or by log.PlainFormat if Body is nil.
+//
+// The trailing newline is kept; writers returned by DialSyslog
+// strip or frame it as required by the transport.
+type SyslogFormat struct {
+	// Facility is a syslog facility code.  Use SyslogFacility
+	// to convert a name to the code.
+	Facility int
+
+	// Body formats the message part.
+	Body log.Formatter
+}
+
+// String returns "syslog".
+func (f SyslogFormat) String() string {
+	return "syslog"
+}
+
+// Format implements log.Formatter.
+func (f SyslogFormat) Format(buf []byte, l *log.Logger, t time.Time, severity int,
+	msg string, fields map[string]interface{}) ([]byte, error) {
+	body := f.Body
+	if body == nil {
+		body = log.PlainFormat{}
+	}
+
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(f.Facility*8+severity), 10)
+	buf = append(buf, ">1 "...)
+	buf = t.UTC().AppendFormat(buf, log.RFC3339Micro)
+	buf = append(buf, ' ')
+	buf = append(buf, syslogHostname...)
+	buf = append(buf, ' ')
+	buf = append(buf, l.Topic()...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(os.Getpid()), 10)
+	buf = append(buf, " - - "...)
+	return body.Format(buf, l, t, severity, msg, fields)
+}
+
+var syslogHostname = func() string {
+	h, err := os.Hostname()
+	if err != nil || len(h) == 0 {
+		return "-"
+	}
+	return h
+}()
+
+type syslogWriter struct {
+	network string
+	addr    string
+	tlsConf *tls.Config
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// DialSyslog connects to a syslog server and returns a writer for
+// messages formatted by SyslogFormat.
+//
+// addr is a URL.  Valid schemes are:
+//   - unix:///dev/log  (datagram, then stream unix domain socket)
+//   - udp://host:514
+//   - tcp://host:514
+//   - tls://host:6514
+//
+// Over datagram transports, each message is sent as one datagram.
+// Over stream transports, messages are framed by octet counting
+// as described in RFC 6587.  Broken stream connections are
+// re-established at the next write.
+func DialSyslog(addr string) (io.WriteCloser, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	w := new(syslogWriter)
+	switch u.Scheme {
+	case "unix":
+		w.network = "unixgram"
+		w.addr = u.Path
+	case "udp", "tcp":
+		w.network = u.Scheme
+		w.addr = u.Host
+	case "tls":
+		w.network = "tcp"
+		w.addr = u.Host
+		w.tlsConf = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, errors.New("invalid syslog address: " + addr)
+	}
+	if len(w.addr) == 0 {
+		return nil, errors.New("invalid syslog address: " + addr)
+	}
+
+	conn, err := w.dial()
+	if err != nil {
+		return nil, err
+	}
+	w.conn = conn
+	return w, nil
+}
+
+func (w *syslogWriter) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: syslogDialTimeout}
+	if w.tlsConf != nil {
+		return tls.DialWithDialer(d, w.network, w.addr, w.tlsConf)
+	}
+	conn, err := d.Dial(w.network, w.addr)
+	if err != nil && w.network == "unixgram" {
+		conn, err = d.Dial("unix", w.addr)
+		if err == nil {
+			w.network = "unix"
+		}
+	}
+	return conn, err
+}
+
+func (w *syslogWriter) isStream() bool {
+	return w.network == "tcp" || w.network == "unix"
+}
+
+// Write implements io.Writer.
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	msg := p
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg = msg[:len(msg)-1]
+	}
+	if len(msg) == 0 {
+		return len(p), nil
+	}
+	if w.isStream() {
+		frame := make([]byte, 0, len(msg)+8)
+		frame = strconv.AppendInt(frame, int64(len(msg)), 10)
+		frame = append(frame, ' ')
+		msg = append(frame, msg...)
+	}
+
+	if w.conn == nil {
+		conn, err := w.dial()
+		if err != nil {
+			return 0, err
+		}
+		w.conn = conn
+	}
+
+	_, err := w.conn.Write(msg)
+	if err != nil && w.isStream() {
+		// reconnect once for broken stream connections.
+		w.conn.Close()
+		w.conn = nil
+		conn, err2 := w.dial()
+		if err2 != nil {
+			return 0, err
+		}
+		w.conn = conn
+		_, err = w.conn.Write(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close implements io.Closer.
+func (w *syslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
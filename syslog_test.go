@@ -0,0 +1,139 @@
+package well
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/cybozu-go/log"
+)
+
+func TestSyslogFacility(t *testing.T) {
+	t.Parallel()
+
+	f, err := SyslogFacility("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != 1 {
+		t.Error(`f != 1`)
+	}
+
+	f, err = SyslogFacility("local3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != 19 {
+		t.Error(`f != 19`)
+	}
+
+	_, err = SyslogFacility("bad_facility")
+	if err == nil {
+		t.Error(`bad_facility should cause an error`)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	t.Parallel()
+
+	pc, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer pc.Close()
+
+	w, err := DialSyslog("udp://" + pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	logger := log.NewLogger()
+	logger.SetTopic("syslogtest")
+	logger.SetOutput(w)
+	logger.SetFormatter(SyslogFormat{Facility: 3, Body: log.Logfmt{}})
+
+	err = logger.Warn("hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	t.Log(msg)
+
+	pattern := `^<28>1 \S+ \S+ syslogtest ` + strconv.Itoa(os.Getpid()) + ` - - topic=syslogtest .*message="hello"$`
+	if !regexp.MustCompile(pattern).MatchString(msg) {
+		t.Error(`unexpected message:`, msg)
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	w, err := DialSyslog("tcp://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logger := log.NewLogger()
+	logger.SetOutput(w)
+	logger.SetFormatter(SyslogFormat{Facility: 16})
+
+	err = logger.Error("hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(conn)
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(length[:len(length)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, n)
+	_, err = r.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:5]) != "<131>" {
+		t.Error(`unexpected PRI:`, string(buf))
+	}
+	if buf[n-1] == '\n' {
+		t.Error(`trailing newline should be stripped`)
+	}
+}
+
+func TestSyslogAddress(t *testing.T) {
+	t.Parallel()
+
+	for _, addr := range []string{"", "http://localhost", "udp://", "/dev/log"} {
+		_, err := DialSyslog(addr)
+		if err == nil {
+			t.Error(addr + " should cause an error")
+		}
+	}
+}
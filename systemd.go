@@ -2,44 +2,120 @@ package well
 
 import (
 	"bufio"
+	"io"
 	"os"
 	"runtime"
 	"strings"
 )
 
+// Heuristics to detect systemd services returned by SystemdHeuristic.
+const (
+	SystemdByInvocationID  = "INVOCATION_ID"
+	SystemdByJournalStream = "JOURNAL_STREAM"
+	SystemdByCgroupV1      = "cgroup-v1"
+	SystemdByCgroupV2      = "cgroup-v2"
+)
+
 // IsSystemdService returns true if the program runs as a systemd service.
+//
+// See SystemdHeuristic for how it is detected.
 func IsSystemdService() bool {
+	return len(SystemdHeuristic()) > 0
+}
+
+// SystemdHeuristic returns the name of the heuristic that detected
+// the program runs as a systemd service, or an empty string if not.
+// This is useful to debug misdetection.
+//
+// Heuristics are tried in the following order:
+//
+//  1. INVOCATION_ID environment variable set by systemd for each unit.
+//  2. JOURNAL_STREAM environment variable set when the standard output
+//     or error is connected to the journal.
+//  3. The name=systemd hierarchy of cgroup v1 in /proc/self/cgroup.
+//  4. The unified hierarchy of cgroup v2 in /proc/self/cgroup.
+//
+// The cgroup path is checked rather than /proc/1 because the PID 1
+// may not be systemd in containers.
+func SystemdHeuristic() string {
 	if runtime.GOOS != "linux" {
-		return false
+		return ""
+	}
+
+	// https://www.freedesktop.org/software/systemd/man/systemd.exec.html#%24INVOCATION_ID
+	if len(os.Getenv("INVOCATION_ID")) > 0 {
+		return SystemdByInvocationID
 	}
 
 	// https://www.freedesktop.org/software/systemd/man/systemd.exec.html#%24JOURNAL_STREAM
 	if len(os.Getenv("JOURNAL_STREAM")) > 0 {
-		return true
+		return SystemdByJournalStream
 	}
 
 	f, err := os.Open("/proc/self/cgroup")
 	if err != nil {
-		return false
+		return ""
 	}
 	defer f.Close()
 
-	sc := bufio.NewScanner(f)
-	isService := false
+	return cgroupHeuristic(f)
+}
+
+// cgroupHeuristic checks if the cgroup of the process is a systemd
+// service from the contents of /proc/self/cgroup.
+//
+// With cgroup v1, the path of name=systemd hierarchy is used.
+// With cgroup v2, the path of the unified hierarchy whose ID is 0 is
+// used only if name=systemd hierarchy does not exist, since hybrid
+// setups have both.
+func cgroupHeuristic(r io.Reader) string {
+	var v1, v2 string
+	sc := bufio.NewScanner(r)
 	for sc.Scan() {
-		fields := strings.Split(sc.Text(), ":")
+		fields := strings.SplitN(sc.Text(), ":", 3)
 		if len(fields) < 3 {
 			continue
 		}
-		if fields[1] != "name=systemd" {
-			continue
+		switch {
+		case fields[1] == "name=systemd":
+			v1 = fields[2]
+		case fields[0] == "0" && fields[1] == "":
+			v2 = fields[2]
 		}
-		isService = strings.HasSuffix(fields[2], ".service")
-		break
 	}
 	if err := sc.Err(); err != nil {
-		return false
+		return ""
+	}
+
+	switch {
+	case len(v1) > 0:
+		if isServiceCgroup(v1) {
+			return SystemdByCgroupV1
+		}
+	case len(v2) > 0:
+		if isServiceCgroup(v2) {
+			return SystemdByCgroupV2
+		}
 	}
+	return ""
+}
 
-	return isService
+// isServiceCgroup returns true if path is a cgroup of a service.
+//
+// The innermost unit in path is checked because processes in user
+// sessions are under "user@UID.service" as well as scope units, e.g.
+// "/user.slice/user-1000.slice/user@1000.service/app.slice/foo.scope".
+// Services may create sub-cgroups that are not units under their
+// cgroups with Delegate=, e.g. "/system.slice/foo.service/payload".
+func isServiceCgroup(path string) bool {
+	elems := strings.Split(path, "/")
+	for i := len(elems) - 1; i >= 0; i-- {
+		switch {
+		case strings.HasSuffix(elems[i], ".service"):
+			return true
+		case strings.HasSuffix(elems[i], ".scope"):
+			return false
+		}
+	}
+	return false
 }
@@ -3,6 +3,7 @@ package well
 import (
 	"os"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -36,3 +37,28 @@ func TestIsSystemdService(t *testing.T) {
 		t.Error(`!IsSystemdService()`)
 	}
 }
+
+func TestCgroupHeuristic(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		cgroup   string
+		expected string
+	}{
+		{"12:name=systemd:/system.slice/foo.service\n1:cpu:/\n", SystemdByCgroupV1},
+		{"12:name=systemd:/user.slice/user-1000.slice/session-2.scope\n0::/system.slice/foo.service\n", ""},
+		{"0::/system.slice/foo.service\n", SystemdByCgroupV2},
+		{"0::/system.slice/foo.service/payload\n", SystemdByCgroupV2},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/bar.service\n", SystemdByCgroupV2},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/vte-spawn-1.scope\n", ""},
+		{"0::/\n", ""},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		actual := cgroupHeuristic(strings.NewReader(tc.cgroup))
+		if actual != tc.expected {
+			t.Errorf("cgroupHeuristic(%q) = %q, expected %q", tc.cgroup, actual, tc.expected)
+		}
+	}
+}
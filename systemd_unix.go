@@ -0,0 +1,108 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// SystemdSockets is a set of sockets passed by systemd socket activation.
+type SystemdSockets struct {
+	// Listeners are listening sockets of stream or sequenced-packet type.
+	// These come from ListenStream= or ListenSequentialPacket=.
+	Listeners []net.Listener
+
+	// PacketConns are datagram sockets.
+	// These come from ListenDatagram=.
+	PacketConns []net.PacketConn
+
+	// Files are other file descriptors such as FIFOs, special files,
+	// and sockets that are not listening.  The caller is responsible
+	// for closing them.
+	Files []*os.File
+}
+
+// SystemdAllSockets returns sockets from systemd socket activation.
+// Unlike SystemdListeners, this returns datagram sockets and other
+// file descriptors as well.
+//
+// If the process is not activated by systemd, this returns (nil, nil).
+// Either SystemdListeners or SystemdAllSockets can be called only once.
+func SystemdAllSockets() (*SystemdSockets, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_FDS")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*os.File, nfds)
+	for i := range files {
+		fd := 3 + i
+		files[i] = os.NewFile(uintptr(fd), "FD"+strconv.Itoa(fd))
+	}
+	return classifySockets(files)
+}
+
+// classifySockets converts files into listeners, packet conns, or
+// leaves them as files depending on the socket types.
+// If an error occurs, all files and converted sockets are closed.
+func classifySockets(files []*os.File) (*SystemdSockets, error) {
+	s := &SystemdSockets{}
+	for i, f := range files {
+		fd := int(f.Fd())
+		typ, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE)
+		if err != nil {
+			// not a socket.
+			s.Files = append(s.Files, f)
+			continue
+		}
+		acceptConn, _ := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ACCEPTCONN)
+
+		switch {
+		case acceptConn != 0 && (typ == syscall.SOCK_STREAM || typ == syscall.SOCK_SEQPACKET):
+			l, err := net.FileListener(f)
+			f.Close()
+			if err != nil {
+				s.close(files[i+1:])
+				return nil, err
+			}
+			s.Listeners = append(s.Listeners, l)
+		case typ == syscall.SOCK_DGRAM:
+			c, err := net.FilePacketConn(f)
+			f.Close()
+			if err != nil {
+				s.close(files[i+1:])
+				return nil, err
+			}
+			s.PacketConns = append(s.PacketConns, c)
+		default:
+			s.Files = append(s.Files, f)
+		}
+	}
+	return s, nil
+}
+
+// close closes all sockets and files in s, and rest.
+func (s *SystemdSockets) close(rest []*os.File) {
+	for _, l := range s.Listeners {
+		l.Close()
+	}
+	for _, c := range s.PacketConns {
+		c.Close()
+	}
+	for _, f := range s.Files {
+		f.Close()
+	}
+	for _, f := range rest {
+		f.Close()
+	}
+}
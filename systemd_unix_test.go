@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestClassifySockets(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lf, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	pf, err := pc.(*net.UDPConn).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	s, err := classifySockets([]*os.File{lf, pf, r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Listeners) != 1 || s.Listeners[0].Addr().String() != ln.Addr().String() {
+		t.Error(`stream socket should be a listener`, s.Listeners)
+	}
+	if len(s.PacketConns) != 1 || s.PacketConns[0].LocalAddr().String() != pc.LocalAddr().String() {
+		t.Error(`datagram socket should be a packet conn`, s.PacketConns)
+	}
+	if len(s.Files) != 1 || s.Files[0] != r {
+		t.Error(`pipe should be a file`, s.Files)
+	}
+	for _, l := range s.Listeners {
+		l.Close()
+	}
+	for _, c := range s.PacketConns {
+		c.Close()
+	}
+}
@@ -16,8 +16,16 @@ import (
 	"github.com/cybozu-go/well"
 )
 
+// modeEnv selects how child processes serve the listeners.
+// See serve.
+const modeEnv = "RESTART_TEST_MODE"
+
+// readyDelay is the delay before children of "delayed" mode become ready.
+const readyDelay = time.Second
+
 var (
 	tcpAddr  = "localhost:18556"
+	udpAddr  = "localhost:18557"
 	unixAddr string
 )
 
@@ -35,6 +43,11 @@ func main() {
 	flag.Parse()
 	well.LogConfig{}.Apply()
 
+	if os.Getenv(modeEnv) == "delayed" {
+		// the restart completes when serve calls SetReady(true).
+		well.SetReady(false)
+	}
+
 	if well.IsSystemdService() {
 		log.Info("run as a systemd service", nil)
 	} else {
@@ -61,9 +74,28 @@ func main() {
 		return []net.Listener{ln1, ln2}, nil
 	}
 
+	listenPacket := func() ([]net.PacketConn, error) {
+		pc, err := net.ListenPacket("udp4", udpAddr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.PacketConn{pc}, nil
+	}
+
 	g := &well.Graceful{
-		Listen: listen,
-		Serve:  serve,
+		Listen:       listen,
+		Serve:        serve,
+		ListenPacket: listenPacket,
+		ServePacket:  servePacket,
+		ReadyTimeout: 5 * time.Second,
+		SaveState: func() ([]byte, error) {
+			return []byte("pid " + strconv.Itoa(os.Getpid())), nil
+		},
+		RestoreState: func(data []byte) {
+			log.Info("restored state", map[string]interface{}{
+				"state": string(data),
+			})
+		},
 	}
 	g.Run()
 
@@ -76,7 +108,21 @@ func main() {
 
 // serve implements a network server that can be stopped gracefully
 // using well.Server.
+//
+// If modeEnv is "plain", listeners are served by servePlain instead.
+// If modeEnv is "delayed", the child becomes ready after readyDelay.
 func serve(listeners []net.Listener) {
+	switch os.Getenv(modeEnv) {
+	case "plain":
+		servePlain(listeners)
+		return
+	case "delayed":
+		go func() {
+			time.Sleep(readyDelay)
+			well.SetReady(true)
+		}()
+	}
+
 	var counter int64
 	handler := func(ctx context.Context, conn net.Conn) {
 		if runtime.GOOS == "windows" {
@@ -102,7 +148,85 @@ func serve(listeners []net.Listener) {
 	}
 }
 
+// servePlain serves listeners by a hand-written accept loop without
+// well.Server.
+func servePlain(listeners []net.Listener) {
+	for _, ln := range listeners {
+		ln := ln
+		well.Go(func(ctx context.Context) error {
+			go func() {
+				<-ctx.Done()
+				ln.Close()
+			}()
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return err
+				}
+				conn.Write([]byte("hello 1"))
+				conn.Close()
+			}
+		})
+	}
+	err := well.Wait()
+	if err != nil && !well.IsSignaled(err) {
+		log.ErrorExit(err)
+	}
+}
+
+// echoServer echoes back UDP packets with "echo " prefix.
+type echoServer struct {
+	conn atomic.Value
+}
+
+func (s *echoServer) Serve(conn net.PacketConn) error {
+	s.conn.Store(conn)
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		conn.WriteTo(append([]byte("echo "), buf[:n]...), addr)
+	}
+}
+
+func (s *echoServer) Close() error {
+	if conn, ok := s.conn.Load().(net.PacketConn); ok {
+		return conn.SetReadDeadline(time.Now())
+	}
+	return nil
+}
+
+// servePacket serves packet sockets using well.PacketServer.
+// If modeEnv is "plain", echoServer serves them directly.
+func servePacket(conns []net.PacketConn) {
+	for _, pc := range conns {
+		if os.Getenv(modeEnv) == "plain" {
+			go (&echoServer{}).Serve(pc)
+			continue
+		}
+		s := &well.PacketServer{
+			Server: &echoServer{},
+		}
+		s.Serve(pc)
+	}
+}
+
 func testClient(ctx context.Context) error {
+	restarted := make(chan well.Event, 16)
+	well.Subscribe(func(ev well.Event) {
+		if ev.Type == well.EventRestarted {
+			select {
+			case restarted <- ev:
+			default:
+			}
+		}
+	})
+
 	for i := 0; i < 5; i++ {
 		err := ping("tcp4", tcpAddr)
 		if err != nil {
@@ -118,6 +242,16 @@ func testClient(ctx context.Context) error {
 		}
 	}
 
+	err := pingUDP(udpAddr)
+	if err != nil {
+		return err
+	}
+
+	err = testReadiness(restarted)
+	if err != nil {
+		return err
+	}
+
 	well.Cancel(nil)
 	return nil
 }
@@ -149,3 +283,31 @@ func ping(network, addr string) error {
 	}
 	return nil
 }
+
+func pingUDP(addr string) error {
+	conn, err := net.Dial("udp4", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1024)
+	for i := 0; i < 5; i++ {
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write([]byte("hello")); err != nil {
+			return err
+		}
+		n, err := conn.Read(buf)
+		if err != nil {
+			continue
+		}
+		if string(buf[:n]) != "echo hello" {
+			return errors.New("invalid response")
+		}
+		log.Info("got data", map[string]interface{}{
+			"data": string(buf[:n]),
+		})
+		return nil
+	}
+	return errors.New("no response over UDP")
+}
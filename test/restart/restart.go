@@ -4,12 +4,64 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"syscall"
 	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/well"
 )
 
 func restart() {
 	syscall.Kill(os.Getpid(), syscall.SIGHUP)
 	time.Sleep(100 * time.Millisecond)
 }
+
+// testReadiness tests the handshake between the master and new
+// children.  restarted receives EventRestarted.
+func testReadiness(restarted <-chan well.Event) error {
+	// SIGHUPs sent while a restart is in progress may be merged,
+	// so at least one restart should have been completed so far.
+	if err := waitRestarted(restarted); err != nil {
+		return err
+	}
+	for drained := false; !drained; {
+		select {
+		case <-restarted:
+		case <-time.After(2 * time.Second):
+			drained = true
+		}
+	}
+
+	defer os.Unsetenv(modeEnv)
+	for _, mode := range []string{"plain", "delayed"} {
+		os.Setenv(modeEnv, mode)
+		st := time.Now()
+		restart()
+		if err := waitRestarted(restarted); err != nil {
+			return fmt.Errorf("%s: %w", mode, err)
+		}
+		if mode == "delayed" && time.Since(st) < readyDelay {
+			return errors.New("restarted before the new child became ready")
+		}
+		if err := ping("tcp4", tcpAddr); err != nil {
+			return fmt.Errorf("%s: %w", mode, err)
+		}
+	}
+	return nil
+}
+
+func waitRestarted(restarted <-chan well.Event) error {
+	select {
+	case ev := <-restarted:
+		log.Info("restarted", map[string]interface{}{
+			"pid":        ev.PID,
+			"generation": ev.Generation,
+		})
+		return nil
+	case <-time.After(10 * time.Second):
+		return errors.New("new child did not become ready")
+	}
+}
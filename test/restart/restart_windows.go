@@ -3,8 +3,16 @@
 
 package main
 
-import "time"
+import (
+	"time"
+
+	"github.com/cybozu-go/well"
+)
 
 func restart() {
 	time.Sleep(10 * time.Millisecond)
 }
+
+func testReadiness(restarted <-chan well.Event) error {
+	return nil
+}
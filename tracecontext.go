@@ -0,0 +1,141 @@
+package well
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context headers.
+// https://www.w3.org/TR/trace-context/
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+const (
+	// TraceContextKey is a context key for TraceContext.
+	TraceContextKey contextKey = "trace_context"
+)
+
+// TraceContext represents W3C Trace Context propagated with requests.
+//
+// TraceID and ParentID are lower-case hex strings of 32 and 16
+// characters, respectively.  Flags are the trace flags such as
+// sampled (1).  State is the value of tracestate header.
+type TraceContext struct {
+	TraceID  string
+	ParentID string
+	Flags    byte
+	State    string
+}
+
+// ParseTraceParent parses the value of traceparent header.
+func ParseTraceParent(v string) (TraceContext, error) {
+	var tc TraceContext
+
+	fields := strings.Split(strings.TrimSpace(v), "-")
+	if len(fields) < 4 {
+		return tc, errors.New("invalid traceparent: " + v)
+	}
+	version := fields[0]
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(fields) != 4) {
+		return tc, errors.New("invalid traceparent version: " + v)
+	}
+	if !isLowerHex(fields[1], 32) || isZeroHex(fields[1]) {
+		return tc, errors.New("invalid trace-id: " + v)
+	}
+	if !isLowerHex(fields[2], 16) || isZeroHex(fields[2]) {
+		return tc, errors.New("invalid parent-id: " + v)
+	}
+	if !isLowerHex(fields[3], 2) {
+		return tc, errors.New("invalid trace-flags: " + v)
+	}
+	flags, _ := hex.DecodeString(fields[3])
+
+	tc.TraceID = fields[1]
+	tc.ParentID = fields[2]
+	tc.Flags = flags[0]
+	return tc, nil
+}
+
+// TraceParent returns the value of traceparent header.
+func (tc TraceContext) TraceParent() string {
+	return "00-" + tc.TraceID + "-" + tc.ParentID + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9') && !('a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZeroHex(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+// WithTraceContext returns a new context with tc as a value.
+func WithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, TraceContextKey, tc)
+}
+
+// TraceContextFromContext returns TraceContext in ctx, if any.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(TraceContextKey).(TraceContext)
+	return tc, ok
+}
+
+// traceContextFromRequest extracts TraceContext from headers of r.
+func traceContextFromRequest(r *http.Request) (TraceContext, bool) {
+	tc, err := ParseTraceParent(r.Header.Get(TraceParentHeader))
+	if err != nil {
+		return tc, false
+	}
+	tc.State = r.Header.Get(TraceStateHeader)
+	return tc, true
+}
+
+// injectTraceContext sets traceparent and tracestate headers of req
+// from its context unless traceparent is already set.
+//
+// If the context has no TraceContext but has a request ID that is a
+// UUID, the trace ID is derived from the request ID in the same way as
+// OTLPExporter.
+func injectTraceContext(req *http.Request) {
+	if len(req.Header.Get(TraceParentHeader)) > 0 {
+		return
+	}
+
+	ctx := req.Context()
+	tc, ok := TraceContextFromContext(ctx)
+	if !ok {
+		reqid, _ := ctx.Value(RequestIDContextKey).(string)
+		traceID := otlpTraceID(reqid)
+		if len(traceID) == 0 {
+			return
+		}
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return
+		}
+		tc = TraceContext{
+			TraceID:  traceID,
+			ParentID: hex.EncodeToString(b[:]),
+		}
+	}
+
+	req.Header.Set(TraceParentHeader, tc.TraceParent())
+	if len(tc.State) > 0 {
+		req.Header.Set(TraceStateHeader, tc.State)
+	}
+}
@@ -0,0 +1,100 @@
+package well
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	t.Parallel()
+
+	v := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tc, err := ParseTraceParent(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Error(`tc.TraceID`, tc.TraceID)
+	}
+	if tc.ParentID != "00f067aa0ba902b7" {
+		t.Error(`tc.ParentID`, tc.ParentID)
+	}
+	if tc.Flags != 1 {
+		t.Error(`tc.Flags != 1`, tc.Flags)
+	}
+	if tc.TraceParent() != v {
+		t.Error(`tc.TraceParent() != v`, tc.TraceParent())
+	}
+
+	// future versions may have additional fields.
+	_, err = ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foo")
+	if err != nil {
+		t.Error(err)
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foo",
+	}
+	for _, v := range invalid {
+		if _, err := ParseTraceParent(v); err == nil {
+			t.Error(`should be invalid:`, v)
+		}
+	}
+}
+
+func TestHTTPClientTraceContext(t *testing.T) {
+	t.Parallel()
+
+	var traceparent, tracestate string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(TraceParentHeader)
+		tracestate = r.Header.Get(TraceStateHeader)
+	}))
+	defer s.Close()
+
+	cl := &HTTPClient{Client: &http.Client{}}
+	do := func(ctx context.Context) {
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		resp, err := cl.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	tc := TraceContext{
+		TraceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+		ParentID: "00f067aa0ba902b7",
+		Flags:    1,
+		State:    "foo=bar",
+	}
+	do(WithTraceContext(context.Background(), tc))
+	if traceparent != tc.TraceParent() {
+		t.Error(`traceparent != tc.TraceParent()`, traceparent)
+	}
+	if tracestate != "foo=bar" {
+		t.Error(`tracestate != "foo=bar"`, tracestate)
+	}
+
+	do(WithRequestID(context.Background(), testUUID))
+	if !strings.HasPrefix(traceparent, "00-"+strings.ReplaceAll(testUUID, "-", "")+"-") {
+		t.Error(`trace ID should be derived from the request ID`, traceparent)
+	}
+	if len(tracestate) != 0 {
+		t.Error(`len(tracestate) != 0`, tracestate)
+	}
+
+	do(context.Background())
+	if len(traceparent) != 0 {
+		t.Error(`len(traceparent) != 0`, traceparent)
+	}
+}
@@ -0,0 +1,84 @@
+package well
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig configures connections of http.Transport.
+//
+// Zero values keep the values of http.DefaultTransport.
+type TransportConfig struct {
+	// DialTimeout is the time limit to establish connections.
+	DialTimeout time.Duration `toml:"dial_timeout" json:"dial_timeout" yaml:"dial_timeout"`
+
+	// TLSHandshakeTimeout is the time limit of TLS handshakes.
+	TLSHandshakeTimeout time.Duration `toml:"tls_handshake_timeout" json:"tls_handshake_timeout" yaml:"tls_handshake_timeout"`
+
+	// ResponseHeaderTimeout is the time limit to wait for response
+	// headers after the request is written.
+	ResponseHeaderTimeout time.Duration `toml:"response_header_timeout" json:"response_header_timeout" yaml:"response_header_timeout"`
+
+	// MaxConnsPerHost limits the total number of connections per host.
+	MaxConnsPerHost int `toml:"max_conns_per_host" json:"max_conns_per_host" yaml:"max_conns_per_host"`
+
+	// MaxIdleConns limits the number of idle connections of all hosts.
+	MaxIdleConns int `toml:"max_idle_conns" json:"max_idle_conns" yaml:"max_idle_conns"`
+
+	// MaxIdleConnsPerHost limits the number of idle connections per host.
+	MaxIdleConnsPerHost int `toml:"max_idle_conns_per_host" json:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host"`
+
+	// IdleConnTimeout is the maximum time an idle connection is kept.
+	IdleConnTimeout time.Duration `toml:"idle_conn_timeout" json:"idle_conn_timeout" yaml:"idle_conn_timeout"`
+}
+
+// NewTransport returns a clone of http.DefaultTransport configured by c.
+func (c TransportConfig) NewTransport() *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if c.DialTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   c.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}
+		tr.DialContext = dialer.DialContext
+	}
+	if c.TLSHandshakeTimeout > 0 {
+		tr.TLSHandshakeTimeout = c.TLSHandshakeTimeout
+	}
+	if c.ResponseHeaderTimeout > 0 {
+		tr.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+	}
+	if c.MaxConnsPerHost > 0 {
+		tr.MaxConnsPerHost = c.MaxConnsPerHost
+	}
+	if c.MaxIdleConns > 0 {
+		tr.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		tr.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout > 0 {
+		tr.IdleConnTimeout = c.IdleConnTimeout
+	}
+	return tr
+}
+
+// NewUnixSocketClient returns an HTTPClient that sends requests
+// over the unix domain socket at path.
+//
+// Hosts in request URLs are only used for Host headers, so URLs like
+// "http://localhost/v1/status" can be used.  Requests are logged and
+// tracked in the same way as other HTTPClients.
+func NewUnixSocketClient(path string) *HTTPClient {
+	tr := TransportConfig{}.NewTransport()
+	tr.Proxy = nil
+	dialer := &net.Dialer{}
+	tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+	return &HTTPClient{
+		Client: &http.Client{Transport: tr},
+	}
+}
@@ -0,0 +1,81 @@
+package well
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransportConfig(t *testing.T) {
+	t.Parallel()
+
+	tr := TransportConfig{
+		MaxConnsPerHost: 3,
+		IdleConnTimeout: time.Second,
+	}.NewTransport()
+	if tr.MaxConnsPerHost != 3 {
+		t.Error(`tr.MaxConnsPerHost != 3`, tr.MaxConnsPerHost)
+	}
+	if tr.IdleConnTimeout != time.Second {
+		t.Error(`tr.IdleConnTimeout != time.Second`, tr.IdleConnTimeout)
+	}
+	if tr.MaxIdleConns != http.DefaultTransport.(*http.Transport).MaxIdleConns {
+		t.Error(`MaxIdleConns should be kept`, tr.MaxIdleConns)
+	}
+}
+
+func TestTransportConfigTimeouts(t *testing.T) {
+	t.Parallel()
+
+	tr := TransportConfig{}.NewTransport()
+	if tr.ResponseHeaderTimeout != http.DefaultTransport.(*http.Transport).ResponseHeaderTimeout {
+		t.Error(`ResponseHeaderTimeout should be kept`, tr.ResponseHeaderTimeout)
+	}
+
+	tr = TransportConfig{
+		TLSHandshakeTimeout:   time.Second,
+		ResponseHeaderTimeout: 2 * time.Second,
+	}.NewTransport()
+	if tr.TLSHandshakeTimeout != time.Second {
+		t.Error(`tr.TLSHandshakeTimeout != time.Second`, tr.TLSHandshakeTimeout)
+	}
+	if tr.ResponseHeaderTimeout != 2*time.Second {
+		t.Error(`tr.ResponseHeaderTimeout != 2*time.Second`, tr.ResponseHeaderTimeout)
+	}
+}
+
+func TestUnixSocketClient(t *testing.T) {
+	t.Parallel()
+
+	sock := filepath.Join(t.TempDir(), "test.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip(err)
+	}
+	s := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Host + r.URL.Path))
+		}),
+	}
+	go s.Serve(ln)
+	defer s.Close()
+
+	cl := NewUnixSocketClient(sock)
+	req, _ := http.NewRequest("GET", "http://localhost/v1/status", nil)
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "localhost/v1/status" {
+		t.Error(`string(data) != "localhost/v1/status"`, string(data))
+	}
+}
@@ -0,0 +1,153 @@
+package well
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// UnixListenerConfig is options for CreateUnixListener.
+type UnixListenerConfig struct {
+	// Mode, if not zero, is the permission of the socket file.
+	Mode os.FileMode
+
+	// Owner, if not empty, is the user name or ID of the socket file.
+	Owner string
+
+	// Group, if not empty, is the group name or ID of the socket file.
+	Group string
+
+	// RemoveStale, if true, removes an existing socket file at the
+	// path if no process accepts connections on it, e.g. one left by
+	// a crashed process.  A socket in use is never removed.
+	RemoveStale bool
+}
+
+// CreateUnixListener creates a listener on a UNIX domain socket at
+// path with options of cfg.  cfg may be nil.
+//
+// Closing the returned listener removes the socket file only if the
+// file is still the one it created, so that it does not remove a
+// socket created by another process at the same path.  Listeners
+// inherited by children of Graceful never remove the file; the master
+// process does it when it exits.
+//
+// Owner and Group are not supported on Windows.
+func CreateUnixListener(path string, cfg *UnixListenerConfig) (net.Listener, error) {
+	if cfg == nil {
+		cfg = &UnixListenerConfig{}
+	}
+
+	uid, gid := -1, -1
+	if len(cfg.Owner) > 0 {
+		id, err := lookupUserID(cfg.Owner)
+		if err != nil {
+			return nil, err
+		}
+		uid = id
+	}
+	if len(cfg.Group) > 0 {
+		id, err := lookupGroupID(cfg.Group)
+		if err != nil {
+			return nil, err
+		}
+		gid = id
+	}
+
+	if cfg.RemoveStale {
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// remove the file by ourselves in Close.
+	l.SetUnlinkOnClose(false)
+
+	fi, err := os.Stat(path)
+	if err == nil && cfg.Mode != 0 {
+		err = os.Chmod(path, cfg.Mode)
+	}
+	if err == nil && (uid != -1 || gid != -1) {
+		err = os.Chown(path, uid, gid)
+	}
+	if err != nil {
+		l.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return &unixListener{UnixListener: l, path: path, fi: fi}, nil
+}
+
+// unixListener removes the socket file on Close if the file is the
+// same as the one created.
+type unixListener struct {
+	*net.UnixListener
+	path string
+	fi   os.FileInfo
+	once sync.Once
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.once.Do(func() {
+		fi, err := os.Stat(l.path)
+		if err == nil && os.SameFile(fi, l.fi) {
+			os.Remove(l.path)
+		}
+	})
+	return err
+}
+
+// removeStaleSocket removes the socket file at path if nobody accepts
+// connections on it.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Type() != os.ModeSocket {
+		return errors.New("not a socket: " + path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return errors.New("socket is in use: " + path)
+	}
+	if !isConnRefused(err) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func lookupUserID(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+func lookupGroupID(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
@@ -0,0 +1,87 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCreateUnixListener(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "test.sock")
+	l, err := CreateUnixListener(p, &UnixListenerConfig{
+		Mode:  0660,
+		Owner: strconv.Itoa(os.Getuid()),
+		Group: strconv.Itoa(os.Getgid()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0660 {
+		t.Error(`fi.Mode().Perm() != 0660`, fi.Mode().Perm())
+	}
+
+	// in use
+	if _, err := CreateUnixListener(p, &UnixListenerConfig{RemoveStale: true}); err == nil {
+		t.Error(`socket in use should not be removed`)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Error(`socket file should be removed`, err)
+	}
+}
+
+func TestCreateUnixListenerStale(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "test.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: p, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetUnlinkOnClose(false)
+	l.Close()
+
+	if _, err := CreateUnixListener(p, nil); err == nil {
+		t.Error(`stale socket should not be removed without RemoveStale`)
+	}
+	l2, err := CreateUnixListener(p, &UnixListenerConfig{RemoveStale: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a socket replaced by another process is not removed on Close.
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	l3, err := CreateUnixListener(p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l3.Close()
+	l2.Close()
+	if _, err := os.Stat(p); err != nil {
+		t.Error(`socket of another listener was removed`, err)
+	}
+
+	notSocket := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notSocket, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateUnixListener(notSocket, &UnixListenerConfig{RemoveStale: true}); err == nil {
+		t.Error(`regular file should not be removed`)
+	}
+}
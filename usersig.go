@@ -0,0 +1,91 @@
+//go:build !windows
+// +build !windows
+
+package well
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/cybozu-go/log"
+)
+
+var (
+	userSignalHooksMu sync.Mutex
+	userSignalHooks   = map[os.Signal]func(ctx context.Context){
+		syscall.SIGUSR1: reopenLogFilesHook,
+	}
+
+	sigusr2Once sync.Once
+)
+
+func reopenLogFilesHook(ctx context.Context) {
+	err := ReopenLogFiles()
+	if err != nil {
+		log.Error("well: failed to reopen log files", map[string]interface{}{
+			log.FnError: err,
+		})
+	}
+}
+
+// UpgradeHook restarts the child process of the running graceful
+// restarting server.  As the child is executed from the program file,
+// replacing the file then calling UpgradeHook upgrades the server.
+//
+// This is intended to be set by SetSIGUSR2Hook as nginx and HAProxy
+// upgrade themselves on SIGUSR2:
+//
+//	well.SetSIGUSR2Hook(well.UpgradeHook)
+func UpgradeHook(ctx context.Context) {
+	if !gracefulRunning() {
+		log.Warn("well: no graceful restarting server to upgrade", nil)
+		return
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+}
+
+func handleUserSignals() {
+	handleUserSignal(syscall.SIGUSR1)
+}
+
+func handleUserSignal(sig os.Signal) {
+	HandleSignal(sig, func(ctx context.Context) {
+		userSignalHooksMu.Lock()
+		f := userSignalHooks[sig]
+		userSignalHooksMu.Unlock()
+		if f != nil {
+			f(ctx)
+		}
+	})
+}
+
+func setUserSignalHook(sig os.Signal, f func(ctx context.Context)) {
+	userSignalHooksMu.Lock()
+	userSignalHooks[sig] = f
+	userSignalHooksMu.Unlock()
+}
+
+// SetSIGUSR1Hook replaces the action for SIGUSR1.
+// The default action reopens log files by ReopenLogFiles.
+// If f is nil, SIGUSR1 is ignored.
+//
+// f is called in the same way as handlers registered by HandleSignal.
+// This does nothing on Windows.
+func SetSIGUSR1Hook(f func(ctx context.Context)) {
+	setUserSignalHook(syscall.SIGUSR1, f)
+}
+
+// SetSIGUSR2Hook sets the action for SIGUSR2.
+// SIGUSR2 is not handled by the framework until this is called.
+// If f is nil, SIGUSR2 is ignored.  See also UpgradeHook.
+//
+// f is called in the same way as handlers registered by HandleSignal.
+// This does nothing on Windows.
+func SetSIGUSR2Hook(f func(ctx context.Context)) {
+	setUserSignalHook(syscall.SIGUSR2, f)
+	sigusr2Once.Do(func() {
+		handleUserSignal(syscall.SIGUSR2)
+	})
+}
@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package well
+
+import "context"
+
+func handleUserSignals() {}
+
+// SetSIGUSR1Hook does nothing on Windows.
+func SetSIGUSR1Hook(f func(ctx context.Context)) {}
+
+// UpgradeHook does nothing on Windows.
+func UpgradeHook(ctx context.Context) {}
+
+// SetSIGUSR2Hook does nothing on Windows.
+func SetSIGUSR2Hook(f func(ctx context.Context)) {}
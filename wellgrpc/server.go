@@ -0,0 +1,129 @@
+// Package wellgrpc runs gRPC servers in environments of
+// github.com/cybozu-go/well.
+//
+// Server serves gRPC in an environment and stops gracefully when the
+// environment is canceled.  It also serves the standard health
+// checking service grpc.health.v1, whose status follows the lifecycle
+// of the program: it becomes SERVING when the program becomes ready,
+// and NOT_SERVING as soon as the program starts shutting down, so that
+// gRPC load balancers stop sending traffic before connections are
+// closed on restart.
+//
+// This is a separate package so that programs that do not use gRPC
+// do not depend on it.
+package wellgrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/well"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Server is a wrapper of grpc.Server.
+type Server struct {
+	*grpc.Server
+
+	// Env is the environment where this server runs.
+	// The global environment is used if Env is nil.
+	Env *well.Environment
+
+	// ShutdownTimeout is the maximum duration to wait for RPCs to
+	// finish on shutdown.  After that, remaining RPCs are canceled.
+	// Zero disables timeout.
+	ShutdownTimeout time.Duration
+
+	health *health.Server
+}
+
+// NewServer creates a Server with grpc.NewServer(opts...) and
+// registers the health checking service to it.
+func NewServer(opts ...grpc.ServerOption) *Server {
+	s := &Server{
+		Server: grpc.NewServer(opts...),
+		health: health.NewServer(),
+	}
+	healthpb.RegisterHealthServer(s.Server, s.health)
+
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	well.Subscribe(func(ev well.Event) {
+		switch ev.Type {
+		case well.EventReady:
+			s.health.Resume()
+		case well.EventCanceled, well.EventDraining:
+			s.health.Shutdown()
+		}
+	})
+	if well.IsReady() {
+		s.health.Resume()
+	}
+	return s
+}
+
+// Health returns the health checking service.  Use this to set the
+// status of each service by SetServingStatus.
+func (s *Server) Health() *health.Server {
+	return s.health
+}
+
+// Serve starts a managed goroutine to accept connections on l.
+// Serve itself returns immediately.
+//
+// When the environment is canceled, the health status becomes
+// NOT_SERVING and the server stops gracefully.
+func (s *Server) Serve(l net.Listener) {
+	goFunc := well.Go
+	if s.Env != nil {
+		goFunc = s.Env.Go
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Server.Serve(l)
+	}()
+	well.StartServing(s.Env)
+
+	goFunc(func(ctx context.Context) error {
+		select {
+		case err := <-errCh:
+			if errors.Is(err, grpc.ErrServerStopped) {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+		}
+
+		done := well.StartDraining()
+		defer done()
+		s.health.Shutdown()
+		s.stop()
+		return nil
+	})
+}
+
+// stop stops the server gracefully within ShutdownTimeout.
+func (s *Server) stop() {
+	if s.ShutdownTimeout == 0 {
+		s.Server.GracefulStop()
+		return
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(ch)
+	}()
+
+	select {
+	case <-ch:
+	case <-time.After(s.ShutdownTimeout):
+		log.Warn("well: timeout waiting for gRPC calls", nil)
+		s.Server.Stop()
+	}
+}
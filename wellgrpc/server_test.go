@@ -0,0 +1,66 @@
+package wellgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/well"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := well.NewEnvironment(context.Background())
+	s := NewServer()
+	s.Env = env
+	s.ShutdownTimeout = 5 * time.Second
+	s.Serve(l)
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	check := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := s.Health().Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Status
+	}
+
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Error(`resp.Status != NOT_SERVING`, resp.Status)
+	}
+
+	well.SetReady(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for check() != healthpb.HealthCheckResponse_SERVING {
+		if time.Now().After(deadline) {
+			t.Fatal(`health status did not become SERVING`)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	env.Cancel(nil)
+	if err := env.Wait(); err != nil {
+		t.Error(err)
+	}
+	if st := check(); st != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Error(`st != NOT_SERVING`, st)
+	}
+}
@@ -0,0 +1,101 @@
+// Package wellpprof serves net/http/pprof on a local listener in the
+// global environment of github.com/cybozu-go/well.
+//
+// This is a separate package because importing net/http/pprof
+// registers its handlers on http.DefaultServeMux.  Programs that
+// serve http.DefaultServeMux would expose profiles publicly if the
+// well package imported it.
+package wellpprof
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/well"
+)
+
+const readTimeout = 30 * time.Second
+
+// Listen creates a listener for Serve.
+//
+// If addr contains "/", it is taken as the path of a UNIX domain
+// socket.  A stale socket file is removed, and the socket is made
+// accessible only by the owner of the process.  Otherwise, addr is
+// a TCP address whose host must be "localhost" or a loopback address
+// so that profiles are not exposed to remote hosts.
+//
+// Call this in well.Graceful.Listen and pass the listener to Serve
+// in well.Graceful.Serve.  Since listeners are inherited by new child
+// processes, profiles of the running child can be taken at the same
+// address across graceful restarts.
+func Listen(addr string) (net.Listener, error) {
+	if strings.Contains(addr, "/") {
+		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		l, err := net.Listen("unix", addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(addr, 0600); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !isLoopbackHost(host) {
+		return nil, errors.New("pprof must listen on a loopback address: " + addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Handler returns an http.Handler that serves the endpoints
+// of net/http/pprof under /debug/pprof/.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// Serve serves Handler on l in the global environment.
+// l is typically created by Listen.  Unlike servers of the well
+// package, this does not make the program ready.  See well.SetReady.
+//
+// Serve returns immediately, and the server stops gracefully when the
+// global environment is canceled.  Serve always returns nil.
+func Serve(l net.Listener) error {
+	s := &http.Server{
+		Handler:     Handler(),
+		ReadTimeout: readTimeout,
+	}
+	go s.Serve(l)
+	well.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		s.Shutdown(context.Background())
+		return nil
+	})
+	return nil
+}
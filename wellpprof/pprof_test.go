@@ -0,0 +1,61 @@
+package wellpprof
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	t.Parallel()
+
+	for _, addr := range []string{"0.0.0.0:0", ":0", "192.0.2.1:0", "localhost"} {
+		if l, err := Listen(addr); err == nil {
+			l.Close()
+			t.Error(`Listen should fail`, addr)
+		}
+	}
+
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	sock := filepath.Join(t.TempDir(), "pprof.sock")
+	if err := os.WriteFile(sock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err = Listen(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Error(`fi.Mode().Perm() != 0600`, fi.Mode().Perm())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/pprof/cmdline", nil))
+	if w.Code != 200 {
+		t.Error(`w.Code != 200`, w.Code)
+	}
+	if w.Body.Len() == 0 {
+		t.Error(`empty cmdline`)
+	}
+}
@@ -0,0 +1,128 @@
+package welltest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/well"
+)
+
+// FakeClock is a well.Clock whose time advances only by Advance.
+//
+// Give it to an environment to test timeouts and schedules without
+// real sleeps:
+//
+//	clock := welltest.NewFakeClock(time.Now())
+//	env := well.NewEnvironment(well.WithClock(context.Background(), clock))
+//	...
+//	clock.BlockUntil(1)           // wait for a timer to be created
+//	clock.Advance(10 * time.Second)
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+// NewFakeClock creates a FakeClock whose current time is now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now implements well.Clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer implements well.Clock.
+func (c *FakeClock) NewTimer(d time.Duration) well.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{
+		clock:    c,
+		deadline: c.now.Add(d),
+		ch:       make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		t.ch <- c.now
+		return t
+	}
+	c.waiters = append(c.waiters, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance advances the current time by d and fires timers whose
+// deadlines have come, in the order of their deadlines.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+	n := 0
+	for _, t := range c.waiters {
+		if t.deadline.After(c.now) {
+			c.waiters[n] = t
+			n++
+			continue
+		}
+		t.ch <- c.now
+	}
+	for i := n; i < len(c.waiters); i++ {
+		c.waiters[i] = nil
+	}
+	c.waiters = c.waiters[:n]
+	c.cond.Broadcast()
+}
+
+// Waiters returns the number of timers that have not fired yet.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil blocks until at least n timers are waiting.  This is
+// useful to make sure that the code under test has started waiting
+// before calling Advance.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, w := range c.waiters {
+		if w == t {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package welltest
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/well"
+)
+
+func TestFakeClock(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	t1 := clock.NewTimer(time.Second)
+	t2 := clock.NewTimer(2 * time.Second)
+	t3 := clock.NewTimer(3 * time.Second)
+	if clock.Waiters() != 3 {
+		t.Error(`clock.Waiters() != 3`, clock.Waiters())
+	}
+	if !t3.Stop() {
+		t.Error(`!t3.Stop()`)
+	}
+
+	clock.Advance(1500 * time.Millisecond)
+	select {
+	case now := <-t1.C():
+		if !now.Equal(start.Add(1500 * time.Millisecond)) {
+			t.Error(`wrong time`, now)
+		}
+	default:
+		t.Error(`t1 did not fire`)
+	}
+	select {
+	case <-t2.C():
+		t.Error(`t2 fired too early`)
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case <-t2.C():
+	default:
+		t.Error(`t2 did not fire`)
+	}
+	if t2.Stop() {
+		t.Error(`t2.Stop()`)
+	}
+	if clock.Waiters() != 0 {
+		t.Error(`clock.Waiters() != 0`, clock.Waiters())
+	}
+}
+
+func TestFakeClockSleep(t *testing.T) {
+	t.Parallel()
+
+	clock := NewFakeClock(time.Now())
+	ctx := well.WithClock(context.Background(), clock)
+
+	ch := make(chan error, 1)
+	go func() {
+		ch <- well.Sleep(ctx, time.Hour)
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	select {
+	case err := <-ch:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sleep did not return")
+	}
+}
+
+func TestFakeClockServer(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	clock := NewFakeClock(time.Now())
+	env := well.NewEnvironment(well.WithClock(context.Background(), clock))
+	block := make(chan struct{})
+	defer close(block)
+	accepted := make(chan struct{})
+	s := &well.Server{
+		Handler: func(ctx context.Context, conn net.Conn) {
+			close(accepted)
+			<-block
+		},
+		ShutdownTimeout: time.Minute,
+		Env:             env,
+	}
+	s.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-accepted
+
+	env.Cancel(nil)
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	env.Wait()
+	if !s.TimedOut() {
+		t.Error(`!s.TimedOut()`)
+	}
+}
+
+func TestFakeClockScheduler(t *testing.T) {
+	t.Parallel()
+
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 30, 0, time.UTC))
+	env := well.NewEnvironment(well.WithClock(context.Background(), clock))
+
+	var count int32
+	ran := make(chan struct{}, 10)
+	s := &well.Scheduler{Env: env}
+	err := s.Add(well.Job{
+		Name:     "test",
+		Schedule: well.Every(time.Minute),
+		// the next run may be due before the previous run returns.
+		Overlap: well.OverlapAllow,
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&count, 1)
+			ran <- struct{}{}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Fatal("job did not run")
+		}
+	}
+	if n := atomic.LoadInt32(&count); n != 3 {
+		t.Error(`n != 3`, n)
+	}
+
+	env.Cancel(nil)
+	env.Wait()
+}
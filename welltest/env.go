@@ -0,0 +1,130 @@
+package welltest
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cybozu-go/well"
+)
+
+// Task is a record of a task started in Environment.
+type Task struct {
+	// Name is the name of the task, usually the function name.
+	Name string
+
+	// Running is true until the task returns.
+	Running bool
+
+	// Err is the error returned by the task.
+	Err error
+}
+
+// Environment is a well.Environment for unit tests of libraries
+// built on well.Go and well.Environment.
+//
+// Unlike the global environment, this never installs signal handlers.
+// Tasks started in the environment are recorded and can be examined
+// by Tasks, Started, and Errors.  Pass the embedded well.Environment
+// to the code under test, e.g. as the Env field of well.Server.
+type Environment struct {
+	*well.Environment
+
+	mu    sync.Mutex
+	tasks []Task
+}
+
+// NewEnvironment creates a new Environment from ctx.  If ctx is nil,
+// context.Background() is used.  Give ctx made by well.WithClock to
+// control time with FakeClock.
+//
+// The environment is canceled and waited for when t finishes.
+func NewEnvironment(t testing.TB, ctx context.Context) *Environment {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	e := &Environment{
+		Environment: well.NewEnvironment(ctx),
+	}
+	e.SetTaskHooks(well.TaskHooks{
+		Started:  e.started,
+		Finished: e.finished,
+	})
+	t.Cleanup(func() {
+		e.Cancel(nil)
+		e.Wait()
+	})
+	return e
+}
+
+func (e *Environment) started(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tasks = append(e.tasks, Task{Name: name, Running: true})
+}
+
+func (e *Environment) finished(name string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range e.tasks {
+		t := &e.tasks[i]
+		if t.Name == name && t.Running {
+			t.Running = false
+			t.Err = err
+			return
+		}
+	}
+}
+
+// CancelWithSignal cancels the environment as if the program received
+// sig.  well.IsSignaled returns true for the error returned by Wait.
+func (e *Environment) CancelWithSignal(sig os.Signal) bool {
+	return e.Cancel(well.SignalError(sig))
+}
+
+// Tasks returns the records of tasks in the order they were started.
+func (e *Environment) Tasks() []Task {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Task(nil), e.tasks...)
+}
+
+// Started returns the names of started tasks in the order they were
+// started.
+func (e *Environment) Started() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	names := make([]string, len(e.tasks))
+	for i, t := range e.tasks {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// HasStarted returns true if a task whose name contains substr has
+// been started.
+func (e *Environment) HasStarted(substr string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, t := range e.tasks {
+		if strings.Contains(t.Name, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns non-nil errors returned by finished tasks.
+func (e *Environment) Errors() []error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var errs []error
+	for _, t := range e.tasks {
+		if !t.Running && t.Err != nil {
+			errs = append(errs, t.Err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,71 @@
+package welltest
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/cybozu-go/well"
+)
+
+func taskOK(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func taskFail(ctx context.Context) error {
+	return errors.New("fail")
+}
+
+func TestEnvironment(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(t, nil)
+	env.Go(taskOK)
+	if !env.HasStarted("taskOK") {
+		t.Error(`!env.HasStarted("taskOK")`, env.Started())
+	}
+	tasks := env.Tasks()
+	if len(tasks) != 1 || !tasks[0].Running {
+		t.Error(`unexpected tasks`, tasks)
+	}
+
+	env.Go(taskFail)
+	err := env.Wait()
+	if err == nil || err.Error() != "fail" {
+		t.Error(`err.Error() != "fail"`, err)
+	}
+
+	started := env.Started()
+	if len(started) != 2 {
+		t.Fatal(`len(started) != 2`, started)
+	}
+	errs := env.Errors()
+	if len(errs) != 1 || errs[0].Error() != "fail" {
+		t.Error(`unexpected errors`, errs)
+	}
+	for _, task := range env.Tasks() {
+		if task.Running {
+			t.Error(`task.Running`, task.Name)
+		}
+	}
+}
+
+func TestEnvironmentSignal(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnvironment(t, nil)
+	env.Go(taskOK)
+	env.CancelWithSignal(syscall.SIGTERM)
+	err := env.Wait()
+	if !well.IsSignaled(err) {
+		t.Error(`!well.IsSignaled(err)`, err)
+	}
+	if well.SignalFrom(err) != syscall.SIGTERM {
+		t.Error(`well.SignalFrom(err) != syscall.SIGTERM`, well.SignalFrom(err))
+	}
+	if len(env.Errors()) != 0 {
+		t.Error(`len(env.Errors()) != 0`, env.Errors())
+	}
+}
@@ -0,0 +1,172 @@
+package welltest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultHammerConcurrency = 4
+	maxHammerErrors          = 10
+)
+
+// Probe is a function to check a server once.
+type Probe func(ctx context.Context) error
+
+// DialProbe returns a Probe that connects to addr and reads the
+// response until the server closes the connection.
+func DialProbe(network, addr string) Probe {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		_, err = io.Copy(io.Discard, conn)
+		return err
+	}
+}
+
+// HTTPProbe returns a Probe that sends GET requests to url.
+// Responses with status codes 500 or above are failures.
+func HTTPProbe(url string) Probe {
+	client := &http.Client{
+		Transport: &http.Transport{DisableKeepAlives: true},
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// Hammer runs a Probe repeatedly and concurrently.
+type Hammer struct {
+	// Probe is the function to run.  Required.
+	Probe Probe
+
+	// Concurrency is the number of goroutines to run Probe.
+	// Zero is treated as 4.
+	Concurrency int
+
+	// Timeout is the timeout of each Probe call.
+	// Zero is treated as 5 seconds.
+	Timeout time.Duration
+
+	attempts int64
+	failures int64
+
+	mu     sync.Mutex
+	errors []error
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// HammerResult is the result of Hammer.
+type HammerResult struct {
+	Attempts int64
+	Failures int64
+
+	// Errors are the first errors of failures, up to 10.
+	Errors []error
+}
+
+// Start starts running Probe.
+func (h *Hammer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+
+	concurrency := h.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultHammerConcurrency
+	}
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	h.wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer h.wg.Done()
+			for ctx.Err() == nil {
+				pctx, pcancel := context.WithTimeout(ctx, timeout)
+				err := h.Probe(pctx)
+				pcancel()
+				if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+					return
+				}
+				atomic.AddInt64(&h.attempts, 1)
+				if err == nil {
+					continue
+				}
+				atomic.AddInt64(&h.failures, 1)
+				h.mu.Lock()
+				if len(h.errors) < maxHammerErrors {
+					h.errors = append(h.errors, err)
+				}
+				h.mu.Unlock()
+			}
+		}()
+	}
+}
+
+// Stop stops running Probe and returns the result.
+func (h *Hammer) Stop() HammerResult {
+	h.cancel()
+	h.wg.Wait()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HammerResult{
+		Attempts: atomic.LoadInt64(&h.attempts),
+		Failures: atomic.LoadInt64(&h.failures),
+		Errors:   h.errors,
+	}
+}
+
+// CheckZeroDowntime restarts p the given times while running probe
+// by Hammer.  It returns an error if any restart or probe fails.
+func CheckZeroDowntime(p *Process, probe Probe, restarts int, timeout time.Duration) (HammerResult, error) {
+	h := &Hammer{Probe: probe}
+	h.Start()
+
+	var err error
+	for i := 0; i < restarts; i++ {
+		if err = p.Restart(timeout); err != nil {
+			break
+		}
+	}
+
+	res := h.Stop()
+	if err != nil {
+		return res, err
+	}
+	if res.Failures > 0 {
+		return res, fmt.Errorf("%d of %d probes failed: %v", res.Failures, res.Attempts, res.Errors)
+	}
+	return res, nil
+}
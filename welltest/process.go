@@ -0,0 +1,190 @@
+package welltest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Log messages of well to track graceful restarts.
+const (
+	readyMessage         = "well: child is ready"
+	exitedMessage        = "well: new child exited before ready"
+	notReadyMessage      = "well: new child did not become ready"
+	restartCheckInterval = 10 * time.Millisecond
+)
+
+// Process is a program running as a subprocess.
+// Outputs of the program are collected line by line.
+type Process struct {
+	cmd *exec.Cmd
+
+	mu    sync.Mutex
+	lines []string
+
+	done chan struct{}
+	err  error
+}
+
+// Start starts cmd and returns a Process.
+//
+// Stdout and stderr of cmd are collected and can be inspected by Logs.
+// If cmd.Stdout or cmd.Stderr is not nil, outputs are also written to it.
+func Start(cmd *exec.Cmd) (*Process, error) {
+	p := &Process{
+		cmd:  cmd,
+		done: make(chan struct{}),
+	}
+
+	pr, pw := io.Pipe()
+	var stdout, stderr io.Writer = pw, pw
+	if cmd.Stdout != nil {
+		stdout = io.MultiWriter(pw, cmd.Stdout)
+	}
+	if cmd.Stderr != nil {
+		stderr = io.MultiWriter(pw, cmd.Stderr)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		return nil, err
+	}
+
+	scanDone := make(chan struct{})
+	go func() {
+		defer close(scanDone)
+		sc := bufio.NewScanner(pr)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			p.mu.Lock()
+			p.lines = append(p.lines, sc.Text())
+			p.mu.Unlock()
+		}
+		io.Copy(io.Discard, pr)
+	}()
+
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		<-scanDone
+		p.err = err
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// PID returns the process ID.
+func (p *Process) PID() int {
+	return p.cmd.Process.Pid
+}
+
+// Logs returns the lines of outputs so far.
+func (p *Process) Logs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.lines...)
+}
+
+// countLogs returns the number of lines that contain substr.
+func (p *Process) countLogs(substr string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, l := range p.lines {
+		if strings.Contains(l, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// WaitLog waits until n lines containing substr are output.
+func (p *Process) WaitLog(substr string, n int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for p.countLogs(substr) < n {
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for " + substr)
+		}
+		select {
+		case <-p.done:
+			if p.countLogs(substr) >= n {
+				return nil
+			}
+			return errors.New("process exited while waiting for " + substr)
+		case <-time.After(restartCheckInterval):
+		}
+	}
+	return nil
+}
+
+// WaitReady waits for the first child of well.Graceful to become ready.
+func (p *Process) WaitReady(timeout time.Duration) error {
+	return p.WaitLog(readyMessage, 1, timeout)
+}
+
+// Restart sends SIGHUP to the master process of well.Graceful and
+// waits for the new child to become ready.  It returns an error if
+// the new child fails to become ready.
+func (p *Process) Restart(timeout time.Duration) error {
+	ready := p.countLogs(readyMessage)
+	failed := p.countLogs(exitedMessage) + p.countLogs(notReadyMessage)
+
+	if err := p.cmd.Process.Signal(syscall.SIGHUP); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if p.countLogs(readyMessage) > ready {
+			return nil
+		}
+		if p.countLogs(exitedMessage)+p.countLogs(notReadyMessage) > failed {
+			return errors.New("new child failed to become ready")
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for restart")
+		}
+		select {
+		case <-p.done:
+			return errors.New("process exited while restarting")
+		case <-time.After(restartCheckInterval):
+		}
+	}
+}
+
+// Stop sends SIGTERM to the process and waits for it to exit.
+// If the process does not exit within timeout, it is killed and an
+// error is returned.
+func (p *Process) Stop(timeout time.Duration) error {
+	select {
+	case <-p.done:
+		return p.err
+	default:
+	}
+
+	if err := p.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	select {
+	case <-p.done:
+		return p.err
+	case <-time.After(timeout):
+		p.cmd.Process.Kill()
+		<-p.done
+		return errors.New("timed out waiting for exit")
+	}
+}
+
+// Wait waits for the process to exit and returns the result.
+func (p *Process) Wait() error {
+	<-p.done
+	return p.err
+}
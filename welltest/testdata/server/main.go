@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+
+	"github.com/cybozu-go/well"
+)
+
+var flagAddr = flag.String("addr", "127.0.0.1:0", "listen address")
+
+func main() {
+	flag.Parse()
+	well.LogConfig{}.Apply()
+
+	g := &well.Graceful{
+		Listen: func() ([]net.Listener, error) {
+			return well.ListenAll([]string{*flagAddr})
+		},
+		Serve: func(listeners []net.Listener) {
+			s := &well.Server{
+				Handler: func(ctx context.Context, conn net.Conn) {
+					conn.Write([]byte("hello"))
+				},
+			}
+			for _, l := range listeners {
+				s.Serve(l)
+			}
+			well.Wait()
+		},
+	}
+	g.Run()
+
+	err := well.Wait()
+	if err != nil && !well.IsSignaled(err) {
+		well.ErrorExit(err)
+	}
+}
@@ -0,0 +1,48 @@
+// Package welltest provides utilities to test programs built with
+// github.com/cybozu-go/well, especially graceful restarts of servers
+// using well.Graceful.
+//
+// A typical test builds the program, starts it as a subprocess,
+// and checks that restarts do not drop connections:
+//
+//	bin := welltest.Build(t, "./cmd/myserver")
+//	cmd := exec.Command(bin, "-listen", addr)
+//	cmd.Env = append(os.Environ(), "CANCELLATION_DELAY_SECONDS=0")
+//	p, err := welltest.Start(cmd)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer p.Stop(10 * time.Second)
+//	if err := p.WaitReady(10 * time.Second); err != nil {
+//		t.Fatal(err)
+//	}
+//	res, err := welltest.CheckZeroDowntime(p, welltest.DialProbe("tcp", addr), 3, time.Minute)
+//	if err != nil {
+//		t.Fatal(err, res)
+//	}
+//
+// CANCELLATION_DELAY_SECONDS=0 makes Stop return quickly.
+// Graceful restarts are not supported on Windows.
+//
+// For unit tests, Environment records tasks started by the code under
+// test, and FakeClock controls timeouts and schedules.
+package welltest
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Build builds the main package pkg by "go build" and returns the path
+// of the executable in a temporary directory of t.
+func Build(t testing.TB, pkg string) string {
+	t.Helper()
+
+	bin := filepath.Join(t.TempDir(), filepath.Base(pkg))
+	out, err := exec.Command("go", "build", "-o", bin, pkg).CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to build %s: %v\n%s", pkg, err, out)
+	}
+	return bin
+}
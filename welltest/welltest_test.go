@@ -0,0 +1,50 @@
+package welltest
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGracefulRestart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("graceful restart is not supported on Windows")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	bin := Build(t, "./testdata/server")
+	cmd := exec.Command(bin, "-addr", addr)
+	cmd.Env = append(os.Environ(), "CANCELLATION_DELAY_SECONDS=0")
+	p, err := Start(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop(10 * time.Second)
+
+	if err := p.WaitReady(10 * time.Second); err != nil {
+		t.Fatal(err, p.Logs())
+	}
+	res, err := CheckZeroDowntime(p, DialProbe("tcp", addr), 3, 10*time.Second)
+	if err != nil {
+		t.Fatal(err, p.Logs())
+	}
+	if res.Attempts == 0 {
+		t.Error(`res.Attempts == 0`)
+	}
+	if n := p.countLogs(readyMessage); n != 4 {
+		t.Error(`n != 4`, n)
+	}
+
+	if err := p.Stop(10 * time.Second); err != nil {
+		t.Error(err)
+	}
+}